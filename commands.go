@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	cfg "go_project_context_maker/internal/config"
+	"go_project_context_maker/internal/generator"
+	"go_project_context_maker/internal/selfupdate"
+)
+
+// globals are the flags given before the command name.
+type globals struct {
+	config, root, runID string
+}
+
+// command is one subcommand of the CLI. Each command parses its own flags
+// with a FlagSet from newFlagSet, which prints the usage below on -h.
+type command struct {
+	name    string
+	aliases []string // other names that run it, e.g. "pick" for "tui"
+	args    string   // synopsis after the command name, e.g. "print [-effective]"
+	summary string   // one line for the command list
+	help    string   // more detail for "<command> -h"; optional
+	run     func(g globals, args []string) error
+}
+
+// commands lists the subcommands in the order the usage text shows them.
+// It is a function rather than a variable, as the commands refer back to it
+// through newFlagSet.
+func commands() []command {
+	return []command{
+		{name: "init", summary: "Create a default config.yaml (use -config to choose path)",
+			run: func(g globals, args []string) error { return runInit(g.config, args) }},
+		{name: "generate", args: "[flags]", summary: "Run generation according to config.yaml",
+			run: func(g globals, args []string) error { return runGenerate(g.config, g.root, g.runID, args) }},
+		{name: "validate", summary: "Check config.yaml and report problems with line numbers",
+			run: func(g globals, args []string) error { return runValidate(g.config, g.root, args) }},
+		{name: "schema", args: "[-o FILE]", summary: "Print a JSON Schema of the config for editor completion and checks",
+			help: "With yaml-language-server, start config.yaml with: # yaml-language-server: $schema=config.schema.json",
+			run:  func(g globals, args []string) error { return runSchema(args) }},
+		{name: "config", args: "print [-effective]", summary: "Print the config, merged with defaults using print -effective",
+			run: func(g globals, args []string) error { return runConfig(g.config, g.root, args) }},
+		{name: "migrate-config", args: "[-o FILE] [-dry-run]", summary: "Upgrade the config file to the current format and print what changed",
+			help: "YAML keeps its comments; includes are not followed, so migrate each included file on its own.",
+			run:  func(g globals, args []string) error { return runMigrateConfig(g.config, args) }},
+		{name: "add-document", args: "[flags] NAME [PATH...]", summary: "Add a document, with a source of PATHs, to the config file",
+			help: "YAML files keep their comments and key order; TOML and JSON files are rewritten.",
+			run:  func(g globals, args []string) error { return runAddDocument(g.config, args) }},
+		{name: "add-source", args: "[flags] DOC PATH...", summary: "Add a source of PATHs to a document of the config file",
+			help: "DOC is a document name or outputPath. YAML files keep their comments and key order; TOML and JSON files are rewritten.",
+			run:  func(g globals, args []string) error { return runAddSource(g.config, args) }},
+		{name: "check", args: "[flags]", summary: "Fail if generated documents on disk are out of date",
+			run: func(g globals, args []string) error { return runCheck(g.config, g.root, args) }},
+		{name: "snapshot", args: "[-name NAME] [-only DOCS]", summary: "Store the files and token counts of every document under " + generator.SnapshotDir,
+			run: func(g globals, args []string) error { return runSnapshot(g.config, g.root, args) }},
+		{name: "diff-snapshot", args: "[flags] REF [REF]", summary: "Report files added, removed and grown since a snapshot",
+			help: "REF is a snapshot name, latest or a manifest file. With one REF the documents are rendered and compared with it; with two, the second snapshot is.",
+			run:  func(g globals, args []string) error { return runDiffSnapshot(g.config, g.root, args) }},
+		{name: "fit", args: "-model NAME [flags]", summary: "Check that documents fit a model's context window",
+			help: "Documents that do not fit get suggestions which sources to demote to an outline or a reference list.",
+			run:  func(g globals, args []string) error { return runFit(g.config, g.root, args) }},
+		{name: "classify", args: "[flags]", summary: "Report which embedded files are core and which periphery",
+			help: "Core files are imported by many others and changed often in the last 500 commits; see the core source setting.",
+			run:  func(g globals, args []string) error { return runClassify(g.config, g.root, args) }},
+		{name: "hooks", args: "install [flags]", summary: "Install a git hook running check or generate",
+			run: func(g globals, args []string) error { return runHooks(g.config, args) }},
+		{name: "export", args: "[flags]", summary: "Split documents for LLM Files APIs",
+			run: func(g globals, args []string) error { return runExport(g.config, g.root, g.runID, args) }},
+		{name: "publish", args: "[flags]", summary: "Post documents as pull request comments",
+			run: func(g globals, args []string) error { return runPublish(g.config, g.root, g.runID, args) }},
+		{name: "serve", args: "[flags]", summary: "Serve documents over HTTP, generated on request",
+			run: func(g globals, args []string) error { return runServe(g.config, g.root, args) }},
+		{name: "tui", aliases: []string{"pick"}, summary: "Pick files interactively and save them as a source or generate",
+			run: func(g globals, args []string) error { return runTUI(g.config, g.root, g.runID, args) }},
+		{name: "verify", args: "-allowed-signers FILE [flags] document...", summary: "Check the signatures written by generate -sign",
+			help: "Documents may be local paths or storage URLs such as s3://bucket/key.md.",
+			run:  func(g globals, args []string) error { return runVerify(args) }},
+		{name: "deanonymize", args: "-map FILE [input]", summary: "Restore names in text using an anonymization mapping",
+			help: "Reads input (default stdin) and writes it to stdout with original names restored.",
+			run:  func(g globals, args []string) error { return runDeanonymize(args) }},
+		{name: "version", args: "[-json]", summary: "Print the version, commit and build date",
+			run: func(g globals, args []string) error { return runVersion(args) }},
+		{name: "self-update", args: "[-check] [-version TAG] [-allow-unverified]", summary: "Replace this binary with the latest GitHub release",
+			help: "Downloads the " + selfupdate.AssetName(runtime.GOOS, runtime.GOARCH) + " asset of " + selfupdate.Repo + ", checked against the release's " + selfupdate.ChecksumsAsset + "; a release without it is only installed with -allow-unverified. GITHUB_TOKEN raises the API rate limit.",
+			run:  func(g globals, args []string) error { return runSelfUpdate(args) }},
+		{name: "completion", args: "bash|zsh", summary: "Print a shell completion script",
+			help: "Load it in the current shell with: source <(gpcm completion bash)",
+			run:  func(g globals, args []string) error { return runCompletion(args) }},
+	}
+}
+
+func findCommand(name string) (command, bool) {
+	for _, c := range commands() {
+		if c.name == name || slices.Contains(c.aliases, name) {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+func progName() string {
+	return filepath.Base(os.Args[0])
+}
+
+// usage prints the global flags and the command list.
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintf(w, "Usage:\n  %s [flags] <command> [command flags]\n\nCommands:\n", progName())
+	for _, c := range commands() {
+		summary := c.summary
+		if len(c.aliases) > 0 {
+			summary += " (also " + strings.Join(c.aliases, ", ") + ")"
+		}
+		fmt.Fprintf(w, "  %-14s %s\n", c.name, summary)
+	}
+	fmt.Fprintf(w, "\nRun \"%s <command> -h\" for the flags of a command.\n\nFlags:\n", progName())
+	flag.PrintDefaults()
+}
+
+// newFlagSet returns the FlagSet of a command; name may include a sub
+// action ("config print"). Its usage text comes from the command table.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	c, _ := findCommand(strings.Fields(name)[0])
+	fs.Usage = func() {
+		w := fs.Output()
+		synopsis := strings.TrimSpace(c.name + " " + c.args)
+		if sub := strings.TrimPrefix(name, c.name+" "); sub != name && !strings.HasPrefix(c.args, sub) {
+			synopsis = name + " [flags]"
+		}
+		fmt.Fprintf(w, "Usage: %s [global flags] %s\n\n%s.\n", progName(), synopsis, c.summary)
+		if c.help != "" {
+			fmt.Fprintf(w, "%s\n", c.help)
+		}
+		n := 0
+		fs.VisitAll(func(*flag.Flag) { n++ })
+		if n > 0 {
+			fmt.Fprintf(w, "\nFlags:\n")
+			fs.PrintDefaults()
+		}
+	}
+	return fs
+}
+
+// runCompletion prints a completion script. Command names and global flags
+// are written into it; the flags of a command are read from "<command> -h"
+// when completing, so they never go stale.
+// runSchema prints the config's JSON Schema or writes it to -o.
+func runSchema(args []string) error {
+	fs := newFlagSet("schema")
+	output := fs.String("o", "", "write the schema to this file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	data, err := cfg.Schema()
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if *output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(*output, data, 0o644)
+}
+
+// runVersion prints the build of the running binary.
+func runVersion(args []string) error {
+	fs := newFlagSet("version")
+	asJSON := fs.Bool("json", false, "print the build info as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	info := selfupdate.Current(version, commit, date)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(info)
+	}
+	fmt.Println(info)
+	return nil
+}
+
+// runSelfUpdate replaces the running binary with a release from GitHub.
+func runSelfUpdate(args []string) error {
+	fs := newFlagSet("self-update")
+	check := fs.Bool("check", false, "only report whether a newer release is available")
+	tag := fs.String("version", "", "install this release tag instead of the latest, e.g. v1.4.0")
+	force := fs.Bool("force", false, "install even when the release is the running version")
+	unverified := fs.Bool("allow-unverified", false, "install a release that has no "+selfupdate.ChecksumsAsset+" to verify the download against")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	current := selfupdate.Current(version, commit, date)
+	client := selfupdate.NewClient()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	rel, err := client.Release(ctx, *tag)
+	if err != nil {
+		return fmt.Errorf("find release: %w", err)
+	}
+	update, err := selfupdate.NeedsUpdate(current, rel.Tag)
+	if errors.Is(err, selfupdate.ErrDevel) {
+		fmt.Fprintf(os.Stderr, "running a development build; the release is %s\n", rel.Tag)
+	}
+	if !update && !*force {
+		fmt.Printf("gpcm %s is up to date\n", current.Version)
+		return nil
+	}
+	if *check {
+		fmt.Printf("gpcm %s is available (running %s): %s\n", rel.Tag, current.Version, rel.URL)
+		return nil
+	}
+	data, err := client.Download(ctx, rel, *unverified)
+	if errors.Is(err, selfupdate.ErrUnverified) {
+		return fmt.Errorf("download %s: %w (use -allow-unverified to install it anyway)", rel.Tag, err)
+	}
+	if err != nil {
+		return fmt.Errorf("download %s: %w", rel.Tag, err)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if err := selfupdate.Replace(exe, data); err != nil {
+		return err
+	}
+	fmt.Printf("updated gpcm %s to %s\n", current.Version, rel.Tag)
+	return nil
+}
+
+func runCompletion(args []string) error {
+	fs := newFlagSet("completion")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	shell := fs.Arg(0)
+	if shell != "bash" && shell != "zsh" {
+		return fmt.Errorf("unknown shell %q (expected bash or zsh)", shell)
+	}
+	var names, globalFlags, valueFlags []string
+	for _, c := range commands() {
+		names = append(names, c.name)
+		names = append(names, c.aliases...)
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		globalFlags = append(globalFlags, "-"+f.Name)
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !ok || !b.IsBoolFlag() {
+			valueFlags = append(valueFlags, "-"+f.Name)
+		}
+	})
+	prog := progName()
+	fn := "_" + strings.NewReplacer("-", "_", ".", "_").Replace(prog)
+	if shell == "zsh" {
+		fmt.Println("autoload -U +X bashcompinit && bashcompinit")
+	}
+	fmt.Printf(completionScript, fn, strings.Join(valueFlags, "|"), strings.Join(globalFlags, " "), strings.Join(names, " "), prog)
+	return nil
+}
+
+// completionScript is a bash completion function; zsh loads it through
+// bashcompinit. Its arguments: function name, global flags taking a value, all
+// global flags, command names, program name.
+const completionScript = `%[1]s() {
+	local cur=${COMP_WORDS[COMP_CWORD]} cmd="" sub="" i
+	for ((i = 1; i < COMP_CWORD; i++)); do
+		case ${COMP_WORDS[i]} in
+		%[2]s) ((i++)) ;;
+		-*) ;;
+		*)
+			if [[ -z $cmd ]]; then
+				cmd=${COMP_WORDS[i]}
+			elif [[ -z $sub && ($cmd == config || $cmd == hooks) ]]; then
+				sub=${COMP_WORDS[i]}
+			fi
+			;;
+		esac
+	done
+	if [[ -z $cmd ]]; then
+		if [[ $cur == -* ]]; then
+			COMPREPLY=($(compgen -W "%[3]s" -- "$cur"))
+		else
+			COMPREPLY=($(compgen -W "%[4]s" -- "$cur"))
+		fi
+	elif [[ $cur == -* ]]; then
+		COMPREPLY=($(compgen -W "$(%[5]s $cmd $sub -h 2>&1 | awk '$1 ~ /^-/ {print $1}')" -- "$cur"))
+	elif [[ $cmd == config && -z $sub ]]; then
+		COMPREPLY=($(compgen -W "print" -- "$cur"))
+	elif [[ $cmd == hooks && -z $sub ]]; then
+		COMPREPLY=($(compgen -W "install" -- "$cur"))
+	else
+		COMPREPLY=($(compgen -f -- "$cur"))
+	fi
+}
+complete -o default -F %[1]s %[5]s
+`
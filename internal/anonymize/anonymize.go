@@ -0,0 +1,192 @@
+// Package anonymize replaces project-identifying strings — module paths,
+// organization names, internal hostnames — with neutral placeholders such
+// as "org1", consistently across a document, and maps them back.
+package anonymize
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Kinds of identifying strings, each with its own placeholder scheme.
+const (
+	KindModule = "module" // module or package path: example.com/module1
+	KindOrg    = "org"    // organization or company name: org1
+	KindHost   = "host"   // internal hostname: host1.internal.example
+	KindTerm   = "term"   // any other configured string: name1
+)
+
+// Entry maps one original string to its placeholder.
+type Entry struct {
+	Original    string `yaml:"original"`
+	Placeholder string `yaml:"placeholder"`
+}
+
+// Mapping is the reversible list of replacements.
+type Mapping struct {
+	Entries []Entry `yaml:"entries"`
+}
+
+// Builder assigns placeholders in the order strings are added.
+type Builder struct {
+	entries []Entry
+	seen    map[string]bool
+	counts  map[string]int
+}
+
+// NewBuilder returns an empty Builder.
+func NewBuilder() *Builder {
+	return &Builder{seen: make(map[string]bool), counts: make(map[string]int)}
+}
+
+// Add gives original a placeholder of kind unless it already has one.
+// Organization names and terms are also replaced in their capitalized and
+// upper-case spellings ("Acme", "ACME"). Strings shorter than three
+// characters are ignored: replacing them would garble the text.
+func (b *Builder) Add(kind, original string) {
+	original = strings.TrimSpace(original)
+	if len(original) < 3 || b.seen[strings.ToLower(original)] {
+		return
+	}
+	b.seen[strings.ToLower(original)] = true
+	b.counts[kind]++
+	n := b.counts[kind]
+
+	var placeholder string
+	switch kind {
+	case KindModule:
+		placeholder = fmt.Sprintf("example.com/module%d", n)
+	case KindOrg:
+		placeholder = fmt.Sprintf("org%d", n)
+	case KindHost:
+		placeholder = fmt.Sprintf("host%d.internal.example", n)
+	default:
+		placeholder = fmt.Sprintf("name%d", n)
+	}
+	b.entries = append(b.entries, Entry{Original: original, Placeholder: placeholder})
+	if kind != KindOrg && kind != KindTerm {
+		return
+	}
+	for _, v := range []struct{ orig, ph string }{
+		{strings.ToLower(original), placeholder},
+		{capitalize(strings.ToLower(original)), capitalize(placeholder)},
+		{strings.ToUpper(original), strings.ToUpper(placeholder)},
+	} {
+		if v.orig != original {
+			b.entries = append(b.entries, Entry{Original: v.orig, Placeholder: v.ph})
+		}
+	}
+}
+
+// Mapping returns the replacements added so far.
+func (b *Builder) Mapping() Mapping {
+	return Mapping{Entries: append([]Entry(nil), b.entries...)}
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// Apply replaces every original in s with its placeholder and returns how
+// many replacements were made.
+func (m Mapping) Apply(s string) (string, int) {
+	pairs := make(map[string]string, len(m.Entries))
+	for _, e := range m.Entries {
+		pairs[e.Original] = e.Placeholder
+	}
+	return replace(s, pairs)
+}
+
+// Reverse replaces every placeholder in s with its original; when spellings
+// share a placeholder, the first entry wins.
+func (m Mapping) Reverse(s string) string {
+	pairs := make(map[string]string, len(m.Entries))
+	for _, e := range m.Entries {
+		if _, dup := pairs[e.Placeholder]; !dup {
+			pairs[e.Placeholder] = e.Original
+		}
+	}
+	out, _ := replace(s, pairs)
+	return out
+}
+
+// Marshal encodes the mapping as YAML, with a comment on how to reverse it.
+func (m Mapping) Marshal() (string, error) {
+	data, err := yaml.Marshal(m)
+	if err != nil {
+		return "", fmt.Errorf("encode anonymization mapping: %w", err)
+	}
+	return "# Placeholders used in the anonymized document; keep this file private.\n" +
+		"# Reverse with: gpcm deanonymize -map <this file> < text\n" + string(data), nil
+}
+
+// Parse decodes a mapping written by Marshal.
+func Parse(data []byte) (Mapping, error) {
+	var m Mapping
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("parse anonymization mapping: %w", err)
+	}
+	return m, nil
+}
+
+// replace substitutes the keys of pairs in s, longest first, where they are
+// not part of a longer word: "acme" is replaced in "acme-api" and
+// "acme_db", but not in "acmetools".
+func replace(s string, pairs map[string]string) (string, int) {
+	if len(pairs) == 0 {
+		return s, 0
+	}
+	keys := make([]string, 0, len(pairs))
+	for k := range pairs {
+		keys = append(keys, regexp.QuoteMeta(k))
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+	re := regexp.MustCompile(strings.Join(keys, "|"))
+
+	var b strings.Builder
+	n, last := 0, 0
+	for _, loc := range re.FindAllStringIndex(s, -1) {
+		if (loc[0] > 0 && isWordByte(s[loc[0]-1])) || (loc[1] < len(s) && isWordByte(s[loc[1]])) {
+			continue
+		}
+		b.WriteString(s[last:loc[0]])
+		b.WriteString(pairs[s[loc[0]:loc[1]]])
+		last = loc[1]
+		n++
+	}
+	b.WriteString(s[last:])
+	return b.String(), n
+}
+
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// hostRe matches hostnames under TLDs reserved for private networks.
+var hostRe = regexp.MustCompile(`\b(?:[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?\.)+(?:internal|corp|local|lan|intranet|private|home\.arpa)\b`)
+
+// Hosts returns the internal hostnames in s (such as "db1.corp" or
+// "build.acme.internal") in order of first appearance.
+func Hosts(s string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, h := range hostRe.FindAllString(s, -1) {
+		if !seen[h] {
+			seen[h] = true
+			out = append(out, h)
+		}
+	}
+	return out
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Compose returns c with the "document" sources of every document replaced
+// by the sources of the documents they name (see ComposedSources), so a
+// document composed of others renders whichever documents are selected.
+func (c Config) Compose() (Config, error) {
+	docs := slices.Clone(c.Documents)
+	for i := range docs {
+		srcs, err := c.ComposedSources(docs[i])
+		if err != nil {
+			return c, fmt.Errorf("document %s: %w", cmp.Or(docs[i].Name, docs[i].OutputPath), err)
+		}
+		docs[i].Sources = srcs
+	}
+	c.Documents = docs
+	return c, nil
+}
+
+// ComposedSources returns the sources of doc with every source of type
+// "document" replaced, in place, by the sources of the document it names,
+// themselves composed. The sources taken over keep their settings but get
+// the priority of the document source, so they stay together. Naming an
+// unknown document or composing a document into itself is an error.
+func (c Config) ComposedSources(doc Document) ([]Source, error) {
+	return c.composeSources(doc, []string{cmp.Or(doc.Name, doc.OutputPath)})
+}
+
+// composeSources is ComposedSources for doc reached through the documents
+// in chain.
+func (c Config) composeSources(doc Document, chain []string) ([]Source, error) {
+	if !slices.ContainsFunc(doc.Sources, isDocumentSource) {
+		return doc.Sources, nil
+	}
+	var srcs []Source
+	for _, src := range doc.Sources {
+		if !isDocumentSource(src) {
+			srcs = append(srcs, src)
+			continue
+		}
+		name := strings.TrimSpace(src.Document)
+		if slices.Contains(chain, name) {
+			return nil, fmt.Errorf("document source: cycle %s", strings.Join(append(slices.Clip(chain), name), " -> "))
+		}
+		i := slices.IndexFunc(c.Documents, func(d Document) bool { return d.Name == name })
+		if name == "" || i < 0 {
+			return nil, fmt.Errorf("document source: no document named %q", name)
+		}
+		sub, err := c.composeSources(c.Documents[i], append(slices.Clip(chain), name))
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range sub {
+			s.Priority = src.Priority
+			srcs = append(srcs, s)
+		}
+	}
+	return srcs, nil
+}
+
+func isDocumentSource(src Source) bool {
+	return strings.EqualFold(strings.TrimSpace(src.Type), "document")
+}
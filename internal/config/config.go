@@ -2,74 +2,688 @@ package config
 
 import (
 	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	ProjectPath string `yaml:"projectPath"`
+	// Include lists config files (relative to this one) merged in before
+	// it: their documents come first and this file's settings win.
+	Include []string `yaml:"include,omitempty"`
+
+	ProjectPath string `yaml:"projectPath"` // relative to the directory of the config file
+
+	// OutputBase is what relative output paths are resolved against: "cwd"
+	// (default, the working directory, as before) or "config" (the directory
+	// of the config file, like projectPath)
+	OutputBase string `yaml:"outputBase,omitempty"`
+
+	// Vars define ${NAME} variables for every document, over the
+	// environment; a document's vars and -set win over them.
+	Vars map[string]string `yaml:"vars,omitempty"`
 
 	Documents []Document `yaml:"documents"`
+
+	// LicensePolicy applies to every document that does not define its own.
+	LicensePolicy *LicensePolicy `yaml:"licensePolicy,omitempty"`
+
+	// WalkBackend selects directory traversal: "std" (filepath.WalkDir, default)
+	// or "batched" (unsorted readdir batches, cheaper on slow disks).
+	WalkBackend string `yaml:"walkBackend,omitempty"`
+
+	// ConfigSnapshot applies to every document that does not set its own.
+	ConfigSnapshot string `yaml:"configSnapshot,omitempty"`
+
+	// Deterministic makes every document deterministic (see Document).
+	Deterministic bool `yaml:"deterministic,omitempty"`
+
+	// Redact applies to every document that does not define its own rules.
+	Redact []RedactRule `yaml:"redact,omitempty"`
+
+	// Profiles are named variants of the config, selected with
+	// generate -profile.
+	Profiles map[string]Profile `yaml:"profiles,omitempty"`
+
+	// CommentSyntaxes registers comment markers for languages the comment
+	// and license header stripping do not know, or overrides built-in ones.
+	CommentSyntaxes []CommentSyntax `yaml:"commentSyntaxes,omitempty"`
+
+	// LanguageMap sets the code fence language by extension (".tpl") or
+	// file name ("Tiltfile"), over the built-in table.
+	LanguageMap map[string]string `yaml:"languageMap,omitempty"`
+
+	// LLM is the endpoint that writes the summaries embedded for sources
+	// with summarize: true.
+	LLM *LLM `yaml:"llm,omitempty"`
+
+	// Plugins add source types implemented by external programs, by type
+	// name: a source whose type is one of them runs its plugin.
+	Plugins map[string]Plugin `yaml:"plugins,omitempty"`
+
+	// Pricing sets the input price of models in USD per million tokens, by
+	// model name, for generate -cost: models not known by name, or newer
+	// prices than the built-in ones.
+	Pricing map[string]float64 `yaml:"pricing,omitempty"`
+}
+
+// LLM configures an OpenAI-compatible chat completions endpoint.
+type LLM struct {
+	BaseURL   string `yaml:"baseURL"`             // e.g. "https://api.openai.com/v1" or "http://localhost:11434/v1"
+	Model     string `yaml:"model"`               // e.g. "gpt-4o-mini"
+	APIKeyEnv string `yaml:"apiKeyEnv,omitempty"` // environment variable holding the API key; empty sends none
+	Prompt    string `yaml:"prompt,omitempty"`    // instructions for each file; empty means a built-in prompt
+	MaxTokens int    `yaml:"maxTokens,omitempty"` // upper bound on each summary; 0 leaves it to the endpoint
+	Timeout   string `yaml:"timeout,omitempty"`   // Go duration per request, default 2m
+}
+
+// Auth holds the credentials of a url source. Secrets are only named here:
+// they are read from environment variables when the source is fetched, so
+// they stay out of the config, its snapshots and the output.
+type Auth struct {
+	TokenEnv    string `yaml:"tokenEnv,omitempty"`    // environment variable holding a token, sent as "Authorization: Bearer <token>"
+	Header      string `yaml:"header,omitempty"`      // header carrying the token as it is instead, e.g. "PRIVATE-TOKEN" (GitLab) or "X-JFrog-Art-Api"
+	Username    string `yaml:"username,omitempty"`    // basic auth user
+	PasswordEnv string `yaml:"passwordEnv,omitempty"` // environment variable holding the basic auth password
+}
+
+// Plugin is an external program implementing a source type. It is started
+// in the project root for each source of its type, reads one JSON request
+// on stdin (the source's params among others) and writes the items to
+// embed as JSON on stdout; see the README for the protocol.
+type Plugin struct {
+	Cmd     string   `yaml:"cmd"`               // executable to run, e.g. "gpcm-jira"
+	Args    []string `yaml:"args,omitempty"`    // arguments passed to cmd
+	Timeout string   `yaml:"timeout,omitempty"` // Go duration per source, e.g. "30s"; empty means no timeout; a source's timeout wins
+}
+
+// Profile narrows a config to some documents and adjusts their sources.
+type Profile struct {
+	Documents    []string `yaml:"documents,omitempty"`    // generate only these documents (by name)
+	Skip         []string `yaml:"skip,omitempty"`         // leave these documents out
+	FilePattern  Patterns `yaml:"filePattern,omitempty"`  // replaces the filePattern of every source that has one
+	ExcludePaths []string `yaml:"excludePaths,omitempty"` // added to the excludePaths of every source
+}
+
+// WithProfile returns c narrowed by the named profile.
+func (c Config) WithProfile(name string) (Config, error) {
+	p, ok := c.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(c.Profiles))
+		for n := range c.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return c, fmt.Errorf("unknown profile %q (defined: %s)", name, strings.Join(names, ", "))
+	}
+	keep := func(d Document) bool {
+		return (len(p.Documents) == 0 || slices.Contains(p.Documents, d.Name)) && !slices.Contains(p.Skip, d.Name)
+	}
+	var docs []Document
+	for _, d := range c.Documents {
+		if !keep(d) {
+			continue
+		}
+		d.Sources = slices.Clone(d.Sources)
+		for i := range d.Sources {
+			s := &d.Sources[i]
+			if len(p.FilePattern) > 0 && len(s.FilePattern) > 0 {
+				s.FilePattern = p.FilePattern
+			}
+			if len(p.ExcludePaths) > 0 {
+				s.ExcludePaths = slices.Concat(s.ExcludePaths, p.ExcludePaths)
+			}
+		}
+		docs = append(docs, d)
+	}
+	c.Documents = docs
+	return c, nil
+}
+
+// CommentSyntax describes how comments look in files with the given extensions.
+type CommentSyntax struct {
+	Extensions []string `yaml:"extensions"`       // e.g. [".zig"] or ["tf", "hcl"]
+	Line       []string `yaml:"line,omitempty"`   // line comment openers, e.g. ["//", "#"]
+	Block      []string `yaml:"block,omitempty"`  // "<open> <close>" pairs, e.g. ["/* */", "{- -}"]
+	Quotes     string   `yaml:"quotes,omitempty"` // string delimiters whose contents are not comments, e.g. "\"'"
 }
 
 type Document struct {
-	Description string   `yaml:"description"`
-	OutputPath  string   `yaml:"outputPath"`
-	Sources     []Source `yaml:"sources"`
+	Name         string   `yaml:"name,omitempty"`    // identifier used to select the document on the CLI
+	Extends      string   `yaml:"extends,omitempty"` // name of a document whose settings and sources this one starts from
+	Description  string   `yaml:"description"`
+	OutputPath   string   `yaml:"outputPath"`             // "-" writes the document to stdout
+	OutputFormat string   `yaml:"outputFormat,omitempty"` // "markdown", "xml", "html", "text", "json", "jsonl-chunks", "repomix" or "gitingest"; inferred from outputPath extension when empty
+	Outputs      []Output `yaml:"outputs,omitempty"`      // several encodings rendered from one collection pass; replaces outputPath and outputFormat
+	Sources      []Source `yaml:"sources"`
+	Footer       bool     `yaml:"footer,omitempty"`      // append a stats summary (files, languages, tokens, excluded count, timing)
+	FrontMatter  bool     `yaml:"frontMatter,omitempty"` // markdown: start with YAML front matter (time, commit, branch, config hash, tool version, files, tokens)
+	TOC          bool     `yaml:"toc,omitempty"`         // markdown: start with a table of contents linking the tree and every embedded file
+	DedupeFiles  bool     `yaml:"dedupeFiles,omitempty"` // embed a file matched by several sources only once, where it first appears
+	Order        string   `yaml:"order,omitempty"`       // "path" (default), "size" (smallest first) or "modtime" (newest first) within each source, or "priority" to render sources by their priority
+	Sort         string   `yaml:"sort,omitempty"`        // "lexical" (default), "natural" (file2 before file10, case folded), "size" (smallest first) or "modtime" (newest first): files within each source and entries of tree sources
+	Template     string   `yaml:"template,omitempty"`    // per-file layout: "default", "compact", "xml-tags" or inline text/template
+
+	// Headings and paths, for documents concatenated into a larger one
+	HeadingLevel int    `yaml:"headingLevel,omitempty"` // markdown and html: level of file, command and block headings, 1-6 (default 3); the title and contents shift with it
+	PathStyle    string `yaml:"pathStyle,omitempty"`    // embedded file paths: "relative" (default, to the project root), "absolute" or "basename"
+	RepoPrefix   bool   `yaml:"repoPrefix,omitempty"`   // prefix relative paths with the name of the project directory, e.g. "myrepo/internal/x.go"
+
+	// PathSeparator is "slash" (default: "internal/x.go" on every system) or
+	// "native" to show embedded paths with the separator of the system
+	// generating the document, "internal\x.go" on Windows
+	PathSeparator string `yaml:"pathSeparator,omitempty"`
+
+	// Vars define ${NAME} variables for this document over the config's
+	// vars. After loading they hold every variable visible in the document,
+	// including -set ones, and templates read them as .Vars.
+	Vars map[string]string `yaml:"vars,omitempty"`
+
+	// ChangedSince is a git ref, e.g. "main": tree, stats, symbols, api-spec,
+	// db-schema, infra, file and outline sources keep only files changed
+	// since HEAD branched off it, including uncommitted and untracked ones,
+	// embedded in full
+	ChangedSince string `yaml:"changedSince,omitempty"`
+
+	// FilesFrom names a file listing, one per line, the files the tree,
+	// stats, symbols, api-spec, db-schema, infra, file and outline sources
+	// take theirs from instead of walking sourcePaths, e.g. the output of
+	// git diff --name-only; paths are relative to the project root. The
+	// sources' sourcePaths, filePattern and excludePaths still apply.
+	FilesFrom string `yaml:"filesFrom,omitempty"`
+
+	// SplitBy cuts the document into numbered parts (name.part1.md,
+	// name.part2.md, ...) of at most splitSize "tokens", "bytes" or "files"
+	SplitBy   string `yaml:"splitBy,omitempty"`
+	SplitSize string `yaml:"splitSize,omitempty"` // e.g. "100000" (tokens), "512KB" (bytes) or "40" (files)
+
+	// Chunks of the jsonl-chunks format, in tokens; whole lines are kept
+	// together, so chunks may be smaller
+	ChunkSize    int `yaml:"chunkSize,omitempty"`    // default 512
+	ChunkOverlap int `yaml:"chunkOverlap,omitempty"` // tokens of lines repeated from the end of the previous chunk; default 64
+
+	LicensePolicy *LicensePolicy `yaml:"licensePolicy,omitempty"` // overrides the top-level policy
+	Assertions    *Assertions    `yaml:"assertions,omitempty"`    // checked after rendering; generation fails if any does not hold
+
+	// ConfigSnapshot records the effective config that produced the document:
+	// "appendix" (collapsed section at the end), "sidecar" (<outputPath>.config.yaml) or "none"
+	ConfigSnapshot string `yaml:"configSnapshot,omitempty"`
+
+	Redact []RedactRule `yaml:"redact,omitempty"` // overrides the top-level rules
+
+	// Anonymize replaces the module path, organization names, internal
+	// hostnames and anonymizeTerms with placeholders, writing the mapping to
+	// <outputPath>.anonymize.yaml
+	Anonymize      bool     `yaml:"anonymize,omitempty"`
+	AnonymizeTerms []string `yaml:"anonymizeTerms,omitempty"` // further strings to hide, e.g. product or customer names
+
+	// Pipeline lists the stages run on the rendered document, in order,
+	// before it is written; the default is redact, assert, anonymize
+	Pipeline []Stage `yaml:"pipeline,omitempty"`
+	// PostProcess is a shell command, run in the project root, the document
+	// is piped through last, after the pipeline, e.g. "prettier --parser
+	// markdown"; it reads each output (each part when split) on stdin, named
+	// by GPCM_FILE, and writes what is written instead
+	PostProcess        string `yaml:"postProcess,omitempty"`
+	PostProcessTimeout string `yaml:"postProcessTimeout,omitempty"` // Go duration; empty means no timeout
+
+	// FailurePolicy decides what a failing document does to the run:
+	// "abortAll" (default) stops it, "continue" leaves the document out and
+	// writes the others, "retry" tries twice more before doing the same
+	FailurePolicy string `yaml:"failurePolicy,omitempty"`
+
+	// Deterministic leaves out everything that changes between runs on the
+	// same input (run id, timing, generation time, commit and branch) and
+	// writes LF line endings, so the document can be committed and diffed
+	Deterministic bool `yaml:"deterministic,omitempty"`
+
+	// OutputMode is the octal permission of the written files, e.g. "0600"
+	// for documents that must stay private; empty means 0644
+	OutputMode string `yaml:"outputMode,omitempty"`
+
+	Hooks *Hooks `yaml:"hooks,omitempty"` // shell commands run before and after the document is generated
+}
+
+// Hooks are shell commands run in the project root, in order; the first to
+// fail fails the document. They see GPCM_DOCUMENT (the document's name or
+// first output path), GPCM_OUTPUT (its first output path), GPCM_OUTPUTS (all
+// of them, one per line) and GPCM_RUN_ID in their environment.
+type Hooks struct {
+	PreGenerate  []string `yaml:"preGenerate,omitempty"`  // before sources are collected, e.g. "go generate ./..."
+	PostGenerate []string `yaml:"postGenerate,omitempty"` // after the outputs are written, e.g. "git add context/*.md"
+}
+
+// Stage is one step of a document pipeline.
+type Stage struct {
+	Stage       string       `yaml:"stage"`                 // "redact", "assert", "anonymize", "command" or "replace"
+	Rules       []RedactRule `yaml:"rules,omitempty"`       // redact: rules to apply instead of the document's redact
+	Cmd         string       `yaml:"cmd,omitempty"`         // command: shell command reading the document on stdin and writing the result
+	Timeout     string       `yaml:"timeout,omitempty"`     // command: Go duration; empty means no timeout
+	Pattern     string       `yaml:"pattern,omitempty"`     // replace: regexp
+	Replacement string       `yaml:"replacement,omitempty"` // replace: replacement text, "$1" refers to groups
+}
+
+// Output is one encoding of a document listed under "outputs".
+type Output struct {
+	Path   string `yaml:"path"`             // "-" writes to stdout
+	Format string `yaml:"format,omitempty"` // inferred from the path extension when empty
+}
+
+// Targets returns the outputs the document is rendered to: its outputs
+// list, or outputPath with outputFormat.
+func (d Document) Targets() []Output {
+	if len(d.Outputs) > 0 {
+		return d.Outputs
+	}
+	return []Output{{Path: d.OutputPath, Format: d.OutputFormat}}
+}
+
+// FileMode parses OutputMode; it returns 0 when it is not set.
+func (d Document) FileMode() (fs.FileMode, error) {
+	if d.OutputMode == "" {
+		return 0, nil
+	}
+	m, err := strconv.ParseUint(d.OutputMode, 8, 32)
+	if err != nil || m == 0 || m > 0o777 {
+		return 0, fmt.Errorf("invalid outputMode %q (expected octal permissions such as \"0600\")", d.OutputMode)
+	}
+	return fs.FileMode(m), nil
+}
+
+// RedactRule replaces matches in the rendered document with
+// "[REDACTED:<name>]". Written as a plain string it names a built-in rule
+// ("builtin" enables all of them); as a mapping it defines a pattern.
+type RedactRule struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern,omitempty"` // regular expression; with a capture group only the first group is replaced
+}
+
+// UnmarshalYAML accepts both the string and the mapping form.
+func (r *RedactRule) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		r.Name = n.Value
+		return nil
+	}
+	type plain RedactRule
+	return n.Decode((*plain)(r))
+}
+
+// MarshalYAML writes built-in references back in the string form.
+func (r RedactRule) MarshalYAML() (any, error) {
+	if r.Pattern == "" {
+		return r.Name, nil
+	}
+	type plain RedactRule
+	return plain(r), nil
+}
+
+// Patterns is a filePattern: a list of gitignore-style patterns or, with
+// patternSyntax regex, one regular expression. Older configs write the
+// list as one comma-separated string, which is kept as a single entry.
+type Patterns []string
+
+// ParsePatterns splits a comma-separated list such as "*.go,!*_test.go".
+func ParsePatterns(csv string) Patterns {
+	var p Patterns
+	for _, g := range strings.Split(csv, ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			p = append(p, g)
+		}
+	}
+	return p
+}
+
+// String returns the patterns as one comma-separated list.
+func (p Patterns) String() string {
+	return strings.Join(p, ",")
+}
+
+// UnmarshalYAML accepts both the list and the string form.
+func (p *Patterns) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		*p = nil
+		if n.Value != "" {
+			*p = Patterns{n.Value}
+		}
+		return nil
+	}
+	return n.Decode((*[]string)(p))
+}
+
+// MarshalYAML writes a single entry back in the string form.
+func (p Patterns) MarshalYAML() (any, error) {
+	if len(p) <= 1 {
+		return p.String(), nil
+	}
+	return []string(p), nil
+}
+
+// Transform is one step of a source's transforms: the name of one of
+// TransformNames, written as a plain string, or a mapping of the name to
+// the step's options, e.g. {truncate: {lines: 500}}.
+type Transform struct {
+	Name    string
+	Options map[string]any // truncate: lines, bytes; redactSecrets: rules (built-in rule names, default all)
+}
+
+// UnmarshalYAML accepts both the string and the mapping form.
+func (t *Transform) UnmarshalYAML(n *yaml.Node) error {
+	switch {
+	case n.Kind == yaml.ScalarNode:
+		t.Name = n.Value
+		return nil
+	case n.Kind == yaml.MappingNode && len(n.Content) == 2:
+		t.Name = n.Content[0].Value
+		if v := n.Content[1]; v.Tag != "!!null" {
+			return v.Decode(&t.Options)
+		}
+		return nil
+	}
+	return fmt.Errorf("line %d: a transform is a name or a mapping of one name to its options", n.Line)
+}
+
+// MarshalYAML writes steps without options back in the string form.
+func (t Transform) MarshalYAML() (any, error) {
+	if len(t.Options) == 0 {
+		return t.Name, nil
+	}
+	return map[string]any{t.Name: t.Options}, nil
+}
+
+// Assertions guard a document against config drift, e.g. a renamed
+// directory that silently drops critical files from the bundle.
+type Assertions struct {
+	Contains    []string `yaml:"contains,omitempty"`    // path globs that must each match at least one embedded file
+	NotContains []string `yaml:"notContains,omitempty"` // regular expressions that must not match the rendered document
+	MaxTokens   int      `yaml:"maxTokens,omitempty"`   // upper bound on the estimated token count; 0 means unlimited
+}
+
+// LicensePolicy gates which licenses may end up in a generated document.
+// Licenses are taken from SPDX-License-Identifier headers or the nearest
+// LICENSE/COPYING file above each included file.
+type LicensePolicy struct {
+	Deny   []string `yaml:"deny"`             // SPDX id globs, e.g. "GPL-*", "AGPL-*"
+	Action string   `yaml:"action,omitempty"` // "warn" (default) or "fail"
 }
 
 type Source struct {
-	Type         string   `yaml:"type"`         // "tree" or "file"
-	SourcePaths  []string `yaml:"sourcePaths"`  // directories to scan
-	ExcludePaths []string `yaml:"excludePaths"` // path globs (relative to project root) to exclude; supports simple * and ? globs
-	FilePattern  string   `yaml:"filePattern"`  // comma-separated globs for file names, e.g. "*.php,*.twig"
+	Type           string   `yaml:"type"`                     // "tree", "file", "outline", "stats", "symbols", "api-spec", "db-schema", "infra", "command", "deps", "git-log", "dirdiff", "template", "url", "document" or the name of one of the plugins
+	ID             string   `yaml:"id,omitempty"`             // captures this source's rendered output for {{ source "id" }} in later templates
+	Priority       int      `yaml:"priority,omitempty"`       // with the document's order: priority, higher renders first; equal priorities keep config order
+	Root           string   `yaml:"root,omitempty"`           // directory sourcePaths, excludePaths and ignore files are relative to instead of projectPath, e.g. a sibling repository "../shared-lib"; its files are shown under its name, "shared-lib/x.go"
+	SourcePaths    []string `yaml:"sourcePaths"`              // directories or files to scan; globs including "**" are expanded
+	ExcludePaths   []string `yaml:"excludePaths"`             // gitignore-style patterns relative to the project root, e.g. "vendor/", "/build", "!keep.go"
+	FilePattern    Patterns `yaml:"filePattern"`              // gitignore-style patterns, e.g. ["*.php", "*.twig"] or ["*.go", "!*_test.go"]; older configs give one comma-separated string
+	ExcludeOwners  []string `yaml:"excludeOwners,omitempty"`  // CODEOWNERS owners whose files are dropped, e.g. "team-data" or "@org/team-data"
+	Authors        []string `yaml:"authors,omitempty"`        // keep only files git blame attributes mostly (over half the lines) to these people: email prefixes such as "alice@" or full names
+	ContentMatch   []string `yaml:"contentMatch,omitempty"`   // regexps; keep only files with a line matching one of them (types "tree", "stats", "symbols", "api-spec", "db-schema", "infra", "file" and "outline")
+	ContentExclude []string `yaml:"contentExclude,omitempty"` // regexps; drop files with a line matching one of them
+	TreeDetails    []string `yaml:"treeDetails,omitempty"`    // type "tree": show "size", "lines" and/or "modtime" per file and totals per directory
+	MaxDepth       int      `yaml:"maxDepth,omitempty"`       // type "tree": show this many levels (0 means all); deeper entries are counted
+	DirsOnly       bool     `yaml:"dirsOnly,omitempty"`       // type "tree": list directories only, each with its file count
+	TreeFormat     string   `yaml:"treeFormat,omitempty"`     // type "tree": "ascii" (default), "mermaid" (flowchart) or "mindmap" (Mermaid mindmap)
+	TreeShowAll    bool     `yaml:"treeShowAll,omitempty"`    // type "tree": show every file, ignoring filePattern, so the tree reflects the real layout
+	TreeExclude    []string `yaml:"treeExclude,omitempty"`    // type "tree" with treeShowAll: further gitignore-style patterns to leave out, e.g. "node_modules/"
+	MaxTokens      int      `yaml:"maxTokens,omitempty"`      // token budget; type "tree": the deepest, largest subtrees collapse to "dir/ (N files)" until it fits; types "file" and "outline": see Budget
+	RecentWithin   string   `yaml:"recentWithin,omitempty"`   // type "tree": mark entries modified within this window ("7d", "36h") with "*"
+	Largest        int      `yaml:"largest,omitempty"`        // type "stats": how many of the largest files to list; 0 means 10
+	AnnotateGo     bool     `yaml:"annotateGo,omitempty"`     // prepend package, exported symbol count and internal imports to Go files
+	FileHeader     []string `yaml:"fileHeader,omitempty"`     // types "file" and "outline": show "size", "lines", "sha256", "modtime" and/or "commit" (last commit hash, date and author) under each file's heading
+	LineNumbers    bool     `yaml:"lineNumbers,omitempty"`    // prefix embedded lines with "  12 | "
+	Entrypoints    string   `yaml:"entrypoints,omitempty"`    // types "file" and "outline": "first" embeds detected entry points (main.go, cmd/*, index.ts, manage.py, ...) before other files
+	Core           string   `yaml:"core,omitempty"`           // types "file" and "outline": "first" embeds core files (imported by many, changed often) before the periphery, "only" drops the periphery
+	Rank           string   `yaml:"rank,omitempty"`           // types "file" and "outline": "auto" embeds files by importance: entry points, READMEs and root config, fan-in and recent changes
+	RankTop        int      `yaml:"rankTop,omitempty"`        // with rank "auto": keep only this many of the highest-ranked files
+	ContentMode    string   `yaml:"contentMode,omitempty"`    // types "file" and "outline": "full" (default) or "reference" to list path, size and first line only
+	Template       string   `yaml:"template,omitempty"`       // overrides the document's per-file template
+	Summarize      bool     `yaml:"summarize,omitempty"`      // types "file" and "outline": embed a summary of each file written by the llm endpoint instead of its content
+
+	// How filePattern is read
+	PatternSyntax   string `yaml:"patternSyntax,omitempty"`   // "glob" (default) or "regex": one regular expression matched against the base name or the path, e.g. "^(handler|service)_.*\\.go$"
+	CaseInsensitive bool   `yaml:"caseInsensitive,omitempty"` // ignore case, so "*.md" also selects README.MD
+
+	// Modification window (types "tree", "stats", "symbols", "api-spec",
+	// "db-schema", "infra", "file" and "outline"): only files changed within it are kept; with both set, the
+	// later bound wins
+	ModifiedWithin string `yaml:"modifiedWithin,omitempty"` // e.g. "30d", "2w" or "36h"
+	ModifiedAfter  string `yaml:"modifiedAfter,omitempty"`  // e.g. "2024-01-01" or "2024-01-01T09:00:00Z"
+	ModifiedBy     string `yaml:"modifiedBy,omitempty"`     // "mtime" (default, the filesystem) or "git" (commit times, plus uncommitted changes)
+
+	// Generated files (types "tree", "stats", "symbols", "api-spec",
+	// "db-schema", "infra", "file" and "outline")
+	SkipGenerated     bool     `yaml:"skipGenerated,omitempty"`     // drop generated code ("Code generated ... DO NOT EDIT", *.pb.go), minified JS/CSS and lockfiles
+	GeneratedPatterns []string `yaml:"generatedPatterns,omitempty"` // gitignore-style patterns of further generated files, e.g. "*.gen.ts"
+
+	// Test coverage (types "file" and "outline"), for "what needs tests"
+	// documents: embedded files are annotated with their statement coverage
+	CoverageProfile string  `yaml:"coverageProfile,omitempty"` // Go coverage profile written by go test -coverprofile, relative to the project root
+	CoverageBelow   float64 `yaml:"coverageBelow,omitempty"`   // keep only files covered less than this percentage, e.g. 50; files missing from the profile are left out
+	SortByCoverage  bool    `yaml:"sortByCoverage,omitempty"`  // embed the least covered files first
+
+	// Marked regions (types "file" and "outline"): keep only the lines
+	// between "gpcm:begin <label>" and "gpcm:end" comments in the file,
+	// for the labels listed; files without such a region are left out
+	Regions []string `yaml:"regions,omitempty"` // e.g. ["auth-flow"]; "*" keeps every marked region
+
+	// Rich files (types "file" and "outline") are flattened to text before
+	// anything else reads them: "ipynb" notebooks to their markdown and code
+	// cells with text outputs, "docx" documents to paragraphs and "xlsx"
+	// workbooks to CSV per sheet
+	Convert []string `yaml:"convert,omitempty"` // e.g. ["ipynb", "docx"]
+
+	// Post-processing of each matched file (types "file" and "outline")
+	FilterCommand string `yaml:"filterCommand,omitempty"` // shell command reading content on stdin, e.g. "sqlformat -"
+	FilterTimeout string `yaml:"filterTimeout,omitempty"` // Go duration per file; empty means no timeout
+	FilterOnError string `yaml:"filterOnError,omitempty"` // "fail" (default), "skip" the file or embed it "raw"
+
+	// Content transforms (types "file", "outline" and "url"), applied after the
+	// filter command; comment syntax is chosen by file extension
+	StripLicenseHeader bool `yaml:"stripLicenseHeader,omitempty"` // drop a leading comment block mentioning a license or copyright
+	StripComments      bool `yaml:"stripComments,omitempty"`      // drop comments (Go, JS/TS, PHP, Python, shell); //go: directives are kept
+	CollapseImports    bool `yaml:"collapseImports,omitempty"`    // replace import blocks (Go, JS/TS, Python, PHP) with "imports: 14 stdlib, 6 internal, 3 third-party"
+	CollapseBlankLines bool `yaml:"collapseBlankLines,omitempty"` // squeeze runs of blank lines into one
+	// Transforms are further steps run in order after the ones above, e.g.
+	// [stripComments, redactSecrets, {truncate: {lines: 500}}, lineNumbers]
+	Transforms []Transform `yaml:"transforms,omitempty"`
+
+	// Budget (types "file" and "outline", with maxTokens): while the content
+	// to embed is over it, files are left out with a warning
+	MaxBytes string `yaml:"maxBytes,omitempty"` // e.g. "200KB"; empty means unlimited
+	TrimBy   string `yaml:"trimBy,omitempty"`   // which files go first: "largest" (default), "oldest" (least recently modified) or "last" in embedding order
+
+	// Size limits per matched file (types "file", "outline" and "url")
+	MaxLineLength  int    `yaml:"maxLineLength,omitempty"`  // characters per line; 0 means unlimited
+	LongLinePolicy string `yaml:"longLinePolicy,omitempty"` // "wrap" (default), "truncate" or "flag" (keep and warn)
+	MaxFileSize    string `yaml:"maxFileSize,omitempty"`    // e.g. "64KB" or "1MiB"; empty means unlimited
+	MaxFileLines   int    `yaml:"maxFileLines,omitempty"`   // 0 means unlimited
+	OversizePolicy string `yaml:"oversizePolicy,omitempty"` // "truncate" (default), "skip" or "fail"
+
+	// Character encoding of matched files (types "file" and "outline")
+	Encoding          string `yaml:"encoding,omitempty"`          // e.g. "windows-1251", converted to UTF-8; empty means UTF-8, with other encodings detected in files that are not
+	InvalidUTF8Policy string `yaml:"invalidUTF8Policy,omitempty"` // files that are not valid UTF-8: "convert" (default) from the detected encoding, "replace" invalid bytes with U+FFFD or "skip" them
+
+	// Fields used by type "command"
+	Cmd     string   `yaml:"cmd,omitempty"`     // executable to run, e.g. "go"
+	Args    []string `yaml:"args,omitempty"`    // arguments passed to cmd
+	Workdir string   `yaml:"workdir,omitempty"` // working directory (relative to project root)
+	Timeout string   `yaml:"timeout,omitempty"` // Go duration, e.g. "30s"; empty means no timeout (type "url": per request, default 30s)
+	OnError string   `yaml:"onError,omitempty"` // non-zero exit handling: "fail" (default), "skip" or "stderr"; types "file" and "outline": unreadable files and directories "fail" (default), are left out ("skip") or embedded as a "placeholder"; type "tree": unreadable directories are left out ("skip") or shown annotated with the reason ("placeholder")
+
+	// Fields used by type "git-log"; sourcePaths limits it to commits touching those paths
+	Commits   int    `yaml:"commits,omitempty"`   // how many commits, newest first; 0 means 20
+	Revisions string `yaml:"revisions,omitempty"` // revision range, e.g. "v1.4.0..HEAD"; empty means HEAD
+	LogFormat string `yaml:"logFormat,omitempty"` // "oneline" (default): hash, date, author and subject; "full": with message and changed files
+
+	// Fields used by type "deps"; workdir selects the Go module (default the project root)
+	Graph       string `yaml:"graph,omitempty"`       // "packages" (default): imports between the module's packages; "modules": go.mod requirements
+	GraphFormat string `yaml:"graphFormat,omitempty"` // "text" (default) or "mermaid"
+
+	// Fields used by type "dirdiff"; filePattern and excludePaths apply to both sides
+	Left        string `yaml:"left,omitempty"`        // directory compared against right (relative to project root)
+	Right       string `yaml:"right,omitempty"`       // directory compared against left
+	UnifiedDiff bool   `yaml:"unifiedDiff,omitempty"` // embed a unified diff for every differing file
+	// IgnoreWhitespace treats files that differ only in whitespace or line
+	// endings as equal.
+	IgnoreWhitespace bool `yaml:"ignoreWhitespace,omitempty"`
+
+	// Fields used by type "url"; timeout applies too
+	URLs           []string `yaml:"urls,omitempty"`           // http(s) URLs whose bodies are embedded
+	HTMLToMarkdown bool     `yaml:"htmlToMarkdown,omitempty"` // convert text/html responses to markdown
+	Retries        int      `yaml:"retries,omitempty"`        // extra attempts on network errors, 5xx and 429
+	CacheTTL       string   `yaml:"cacheTTL,omitempty"`       // reuse responses (and command output and plugin items) from the user cache dir for this long, e.g. "1h"
+	// Auth authenticates the requests, for private endpoints such as a
+	// GitLab or Artifactory instance.
+	Auth *Auth `yaml:"auth,omitempty"`
+
+	// Fields used by type "db-schema": without dsnEnv, the migrations matched
+	// by sourcePaths and filePattern (default "*.sql") are concatenated in
+	// version order, leaving out ".down." files; timeout applies to dumps
+	DSNEnv string `yaml:"dsnEnv,omitempty"` // environment variable holding the database URL, e.g. "DATABASE_URL"; its schema is dumped with pg_dump, mysqldump or sqlite3 by scheme
+
+	// Fields used by type "document"
+	Document string `yaml:"document,omitempty"` // name of another document whose sources are rendered here, e.g. "backend"
+
+	// Fields used by type "template"
+	Text string `yaml:"text,omitempty"` // text/template rendered in place; may reference earlier sources with {{ source "id" }}
+
+	// Fields used by plugin types (see Config.Plugins); timeout, cacheTTL
+	// and the file processing settings apply too
+	Params map[string]any `yaml:"params,omitempty"` // settings passed to the plugin as they are, e.g. {jql: "project = PAY"}
 }
 
-// Default returns the default configuration matching the task description.
+// Default returns the config init writes when the project type is not
+// known: the monorepo preset, which covers the common languages.
 func Default() Config {
-	return Config{
-		ProjectPath: ".",
-		Documents: []Document{
-			{
-				Description: "Project structure overview",
-				OutputPath:  "project-structure.md",
-				Sources: []Source{
-					{
-						Type:         "tree",
-						SourcePaths:  []string{"src", "migrations", "templates"},
-						FilePattern:  "*.php,*.twig",
-						ExcludePaths: []string{"vendor", "node_modules", ".git"},
-					},
-					{
-						Type:         "file",
-						SourcePaths:  []string{"src", "migrations", "templates"},
-						FilePattern:  "*.php,*.twig",
-						ExcludePaths: []string{"vendor", "node_modules", ".git"},
-					},
-				},
-			},
-		},
-	}
-}
-
-// Load reads configuration from a YAML file.
+	return presets[len(presets)-1].config()
+}
+
+// Load reads configuration from a YAML, JSON or TOML file (see FormatOf),
+// or from every such file of a directory (see loadDir), merging the files
+// it includes and resolving documents that extend others (see loadNode).
+// ${NAME} variables are taken from the environment.
 func Load(path string) (Config, error) {
+	return LoadVars(path, nil)
+}
+
+// LoadVars is Load with variables that take precedence over the environment
+// (see Config.expand).
+func LoadVars(path string, vars map[string]string) (Config, error) {
 	var c Config
-	data, err := os.ReadFile(path)
+	top, err := loadNode(path, vars, nil)
 	if err != nil {
 		return c, err
 	}
-	if err := yaml.Unmarshal(data, &c); err != nil {
+	if err := top.Decode(&c); err != nil {
 		return c, err
 	}
+	if err := c.expand(vars); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
 	return c, nil
 }
 
-// Save writes configuration to a YAML file, creating parent directories if needed.
+// LoadFile reads a single configuration file as written, without resolving
+// include and extends; edit and Save the result to change the file.
+func LoadFile(path string) (Config, error) {
+	var c Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	doc, err := parseFile(path, data)
+	if err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(doc.Content) > 0 {
+		if err := doc.Content[0].Decode(&c); err != nil {
+			return c, err
+		}
+	}
+	return c, nil
+}
+
+// ResolveRoot returns the project root for a config read from configPath:
+// ProjectPath (default ".") relative to the directory containing the config
+// file, or to configPath itself for a config directory, so a config behaves
+// the same whatever the working directory is.
+func (c Config) ResolveRoot(configPath string) string {
+	root := c.ProjectPath
+	if root == "" {
+		root = "."
+	}
+	if filepath.IsAbs(root) {
+		return filepath.Clean(root)
+	}
+	return filepath.Join(configBase(configPath), root)
+}
+
+// RootDir returns the directory the source's sourcePaths are relative to:
+// its Root, absolute or relative to projectRoot, or else projectRoot.
+func (s Source) RootDir(projectRoot string) string {
+	switch {
+	case s.Root == "":
+		return projectRoot
+	case filepath.IsAbs(s.Root):
+		return filepath.Clean(s.Root)
+	}
+	return filepath.Join(projectRoot, s.Root)
+}
+
+// ResolveOutputs returns c with the relative output paths of its documents
+// joined to the directory of the config read from configPath when
+// OutputBase is "config". Stdout ("-") and storage URLs are left as they are.
+func (c Config) ResolveOutputs(configPath string) Config {
+	if !strings.EqualFold(c.OutputBase, "config") {
+		return c
+	}
+	base := configBase(configPath)
+	resolve := func(p string) string {
+		if p == "" || p == "-" || filepath.IsAbs(p) || strings.Contains(p, "://") {
+			return p
+		}
+		return filepath.Join(base, p)
+	}
+	c.Documents = slices.Clone(c.Documents)
+	for i := range c.Documents {
+		d := &c.Documents[i]
+		d.OutputPath = resolve(d.OutputPath)
+		d.Outputs = slices.Clone(d.Outputs)
+		for j := range d.Outputs {
+			d.Outputs[j].Path = resolve(d.Outputs[j].Path)
+		}
+	}
+	return c
+}
+
+// configBase is the directory relative paths of a config read from
+// configPath start from: the one containing the file, or configPath itself
+// for a config directory.
+func configBase(configPath string) string {
+	if info, err := os.Stat(configPath); err == nil && info.IsDir() {
+		return configPath
+	}
+	return filepath.Dir(configPath)
+}
+
+// Save writes configuration to a file in the format its extension names,
+// creating parent directories if needed. An existing file is updated in
+// place: comments, key order and the spelling of unchanged values are kept.
 func Save(path string, c Config) error {
-	data, err := yaml.Marshal(c)
+	old, err := os.ReadFile(path)
+	var data []byte
+	switch {
+	case err == nil:
+		data, err = update(path, old, c)
+	case errors.Is(err, fs.ErrNotExist):
+		data, err = marshal(path, c)
+	}
 	if err != nil {
 		return err
 	}
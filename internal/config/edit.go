@@ -0,0 +1,323 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// update returns the config file path, with content data, changed to hold
+// c. The change is made to the file's node tree rather than by encoding c
+// afresh, so comments, key order, quoting, anchors and merge keys of what
+// did not change survive, and keys the file leaves at their defaults are
+// not spelled out.
+func update(path string, data []byte, c Config) ([]byte, error) {
+	doc, err := parseFile(path, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var n yaml.Node
+	if err := n.Encode(c); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		doc = &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{&n}}
+	} else {
+		mergeNode(doc.Content[0], &n)
+	}
+	out, err := encodeNode(path, doc, indentOf(data))
+	if err != nil || FormatOf(path) != FormatYAML {
+		return out, err
+	}
+	return blankLinesLike(data, out), nil
+}
+
+// blankLinesLike puts back the blank lines data has before top-level keys
+// and comments into out, which the encoder drops.
+func blankLinesLike(data, out []byte) []byte {
+	before := make(map[string]bool)
+	blank := false
+	for _, line := range strings.Split(string(data), "\n") {
+		switch {
+		case strings.TrimSpace(line) == "":
+			blank = true
+			continue
+		case blank && line[0] != ' ' && line[0] != '-':
+			before[strings.TrimRight(line, " ")] = true
+		}
+		blank = false
+	}
+	var b strings.Builder
+	for i, line := range strings.SplitAfter(string(out), "\n") {
+		if i > 0 && before[strings.TrimRight(line, " \n")] {
+			b.WriteByte('\n')
+		}
+		b.WriteString(line)
+	}
+	return []byte(b.String())
+}
+
+// mergeNode changes dst, part of a parsed file, to the value of src, an
+// encoded struct, keeping what dst already says the same way.
+func mergeNode(dst, src *yaml.Node) {
+	switch {
+	case sameValue(dst, src):
+		return
+	case dst.Kind == yaml.MappingNode && src.Kind == yaml.MappingNode:
+		mergeMapping(dst, src)
+		return
+	case dst.Kind == yaml.SequenceNode && src.Kind == yaml.SequenceNode:
+		for i, item := range src.Content {
+			if i < len(dst.Content) {
+				mergeNode(dst.Content[i], item)
+			} else {
+				if i > 0 {
+					styleLike(item, dst.Content[i-1])
+				}
+				dst.Content = append(dst.Content, pruneZero(item))
+			}
+		}
+		dst.Content = dst.Content[:len(src.Content)]
+		return
+	case dst.Kind == yaml.SequenceNode && len(dst.Content) == 1 && src.Kind == yaml.ScalarNode:
+		// a list of one, such as filePattern: ["*.go"], may encode as a string
+		mergeNode(dst.Content[0], src)
+		return
+	case dst.Kind == yaml.ScalarNode && src.Kind == yaml.ScalarNode:
+		dst.Value, dst.Tag = src.Value, src.Tag
+		if dst.Style == 0 || strings.Contains(src.Value, "\n") {
+			dst.Style = src.Style
+		}
+		return
+	}
+	// a different kind of value: keep only the comments
+	head, line, foot := dst.HeadComment, dst.LineComment, dst.FootComment
+	*dst = *pruneZero(src)
+	dst.HeadComment, dst.LineComment, dst.FootComment = head, line, foot
+}
+
+// mergeMapping merges the keys of src into dst: changed values in place,
+// new keys at the end. Keys src leaves out are removed unless dst sets
+// them to a zero value, which decodes the same, or they are no config key
+// at all, such as one holding anchors; "<<" merge keys are kept, and the
+// keys they provide only added when src changes them.
+func mergeMapping(dst, src *yaml.Node) {
+	var inherited map[string]any
+	for i := 0; i+1 < len(dst.Content); i += 2 {
+		if dst.Content[i].Value == "<<" {
+			_ = dst.Decode(&inherited)
+			break
+		}
+	}
+	have := make(map[string]*yaml.Node, len(dst.Content)/2)
+	for i := 0; i+1 < len(dst.Content); i += 2 {
+		have[dst.Content[i].Value] = dst.Content[i+1]
+	}
+	want := make(map[string]bool, len(src.Content)/2)
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		want[key.Value] = true
+		if v, ok := have[key.Value]; ok {
+			mergeNode(v, value)
+			continue
+		}
+		var decoded any
+		if err := value.Decode(&decoded); err == nil {
+			if old, ok := inherited[key.Value]; ok && reflect.DeepEqual(old, decoded) || isZero(decoded) {
+				continue
+			}
+		}
+		dst.Content = append(dst.Content, key, pruneZero(value))
+	}
+	kept := dst.Content[:0]
+	for i := 0; i+1 < len(dst.Content); i += 2 {
+		key, value := dst.Content[i], dst.Content[i+1]
+		if !want[key.Value] && key.Value != "<<" && configKeys()[key.Value] {
+			var decoded any
+			if err := value.Decode(&decoded); err != nil || !isZero(decoded) {
+				continue
+			}
+		}
+		kept = append(kept, key, value)
+	}
+	dst.Content = kept
+}
+
+// pruneZero drops the keys an encoded struct sets to zero values from
+// the mappings in n, as a file written by hand leaves them out.
+func pruneZero(n *yaml.Node) *yaml.Node {
+	switch n.Kind {
+	case yaml.MappingNode:
+		kept := n.Content[:0]
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			var decoded any
+			if err := n.Content[i+1].Decode(&decoded); err == nil && isZero(decoded) {
+				continue
+			}
+			kept = append(kept, n.Content[i], pruneZero(n.Content[i+1]))
+		}
+		n.Content = kept
+	case yaml.SequenceNode:
+		for _, item := range n.Content {
+			pruneZero(item)
+		}
+	}
+	return n
+}
+
+// styleLike writes the values of item, a new sequence entry, the way dst,
+// the entry before it in the file, writes the same keys: flow sequences
+// and quoted strings.
+func styleLike(item, dst *yaml.Node) {
+	if item.Kind != yaml.MappingNode || dst.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(item.Content); i += 2 {
+		_, like := mapValue(dst, item.Content[i].Value)
+		value := item.Content[i+1]
+		if like == nil || like.Kind != value.Kind {
+			continue
+		}
+		switch {
+		case value.Kind == yaml.SequenceNode && like.Style&yaml.FlowStyle != 0:
+			value.Style |= yaml.FlowStyle
+		case value.Kind == yaml.ScalarNode && value.Tag == "!!str" && like.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0:
+			value.Style = like.Style & (yaml.DoubleQuotedStyle | yaml.SingleQuotedStyle)
+		}
+	}
+}
+
+// configKeys returns the keys of the config structs.
+var configKeys = sync.OnceValue(func() map[string]bool {
+	keys := make(map[string]bool)
+	seen := make(map[reflect.Type]bool)
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct || seen[t] {
+			return
+		}
+		seen[t] = true
+		for i := range t.NumField() {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+			if !f.IsExported() || name == "-" {
+				continue
+			}
+			keys[cmp.Or(name, strings.ToLower(f.Name))] = true
+			walk(f.Type)
+		}
+	}
+	walk(reflect.TypeOf(Config{}))
+	return keys
+})
+
+// untagMerge clears the tag of "<<" keys below n, which the encoder would
+// otherwise spell out as "!!merge <<".
+func untagMerge(n *yaml.Node) {
+	if n.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if key := n.Content[i]; key.Value == "<<" && key.Tag == "!!merge" {
+				key.Tag = ""
+			}
+		}
+	}
+	for _, c := range n.Content {
+		untagMerge(c)
+	}
+}
+
+// sameValue reports whether dst already decodes to the value of src, as
+// an alias or spelled differently ("yes", "0x10", a quoted string).
+func sameValue(dst, src *yaml.Node) bool {
+	if dst.Kind == yaml.MappingNode || dst.Kind == yaml.SequenceNode {
+		// merged item by item, so comments inside are kept
+		return false
+	}
+	var a, b any
+	if dst.Decode(&a) != nil || src.Decode(&b) != nil {
+		return false
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// isZero reports whether a decoded value is what an unset key means.
+func isZero(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case bool:
+		return !v
+	case int:
+		return v == 0
+	case float64:
+		return v == 0
+	case []any:
+		return len(v) == 0
+	case map[string]any:
+		return len(v) == 0
+	}
+	return false
+}
+
+// encodeNode encodes a document node in the format of the config file
+// path: YAML with its comments at the given indentation, JSON or TOML.
+func encodeNode(path string, doc *yaml.Node, indent int) ([]byte, error) {
+	var b strings.Builder
+	switch FormatOf(path) {
+	case FormatYAML:
+		untagMerge(doc)
+		enc := yaml.NewEncoder(&b)
+		enc.SetIndent(indent)
+		if err := enc.Encode(doc); err != nil {
+			return nil, fmt.Errorf("encode config: %w", err)
+		}
+		if err := enc.Close(); err != nil {
+			return nil, fmt.Errorf("encode config: %w", err)
+		}
+	case FormatTOML:
+		if err := writeTOML(&b, doc.Content[0]); err != nil {
+			return nil, fmt.Errorf("encode config: %w", err)
+		}
+	default:
+		if err := writeJSON(&b, doc.Content[0]); err != nil {
+			return nil, fmt.Errorf("encode config: %w", err)
+		}
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, []byte(b.String()), "", "  "); err != nil {
+			return nil, fmt.Errorf("encode config: %w", err)
+		}
+		indented.WriteByte('\n')
+		return indented.Bytes(), nil
+	}
+	return []byte(b.String()), nil
+}
+
+// indentOf returns the indentation a YAML file nests with: that of its
+// first indented line, 2 when it has none.
+func indentOf(data []byte) int {
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := sc.Text()
+		trimmed := strings.TrimLeft(line, " ")
+		n := len(line) - len(trimmed)
+		if n == 0 || trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if n >= 2 && n <= 8 {
+			return n
+		}
+	}
+	return 2
+}
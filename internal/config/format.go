@@ -0,0 +1,143 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config file formats. JSON is read by the YAML parser, of which it is a
+// subset; TOML is read into the same node tree.
+const (
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+	FormatTOML = "toml"
+)
+
+// Formats lists the config file formats.
+var Formats = []string{FormatYAML, FormatJSON, FormatTOML}
+
+// DefaultFormat is the format of config files whose extension names none
+// (.yaml, .yml, .json, .toml); the CLI sets it with -format.
+var DefaultFormat = FormatYAML
+
+// FormatOf returns the format of the config file at path.
+func FormatOf(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".json":
+		return FormatJSON
+	case ".toml":
+		return FormatTOML
+	}
+	return DefaultFormat
+}
+
+// parseFile parses the config file path with content data into a document
+// node.
+func parseFile(path string, data []byte) (*yaml.Node, error) {
+	if FormatOf(path) == FormatTOML {
+		return parseTOML(data)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// marshal encodes c in the format of the config file path.
+func marshal(path string, c Config) ([]byte, error) {
+	format := FormatOf(path)
+	if format == FormatYAML {
+		return yaml.Marshal(c)
+	}
+	var n yaml.Node
+	if err := n.Encode(c); err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	if format == FormatTOML {
+		if err := writeTOML(&b, &n); err != nil {
+			return nil, err
+		}
+		return []byte(b.String()), nil
+	}
+	if err := writeJSON(&b, &n); err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, []byte(b.String()), "", "  "); err != nil {
+		return nil, err
+	}
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
+
+// jsonValue encodes v without escaping <, > and &, which templates use.
+func jsonValue(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}), nil
+}
+
+// writeJSON writes n as compact JSON, keeping the order of mapping keys.
+func writeJSON(b *strings.Builder, n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.MappingNode:
+		b.WriteByte('{')
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			key, _ := jsonValue(n.Content[i].Value)
+			b.Write(key)
+			b.WriteByte(':')
+			if err := writeJSON(b, n.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		b.WriteByte('}')
+	case yaml.SequenceNode:
+		b.WriteByte('[')
+		for i, c := range n.Content {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if err := writeJSON(b, c); err != nil {
+				return err
+			}
+		}
+		b.WriteByte(']')
+	case yaml.ScalarNode:
+		switch n.Tag {
+		case "!!int", "!!bool", "!!float":
+			var v any
+			if err := n.Decode(&v); err != nil {
+				return err
+			}
+			data, err := jsonValue(v)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", n.Line, err)
+			}
+			b.Write(data)
+		case "!!null":
+			b.WriteString("null")
+		default:
+			data, _ := jsonValue(n.Value)
+			b.Write(data)
+		}
+	default:
+		return fmt.Errorf("unsupported yaml node kind %d", n.Kind)
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadNode reads the config at path and merges the files it includes into
+// it, returning the top-level mapping. stack holds the files being loaded
+// to detect include cycles. Include paths may use variables (see expand).
+//
+// Included files are merged in order and the including file goes last:
+// its top-level keys override theirs, and its documents are appended, a
+// document replacing an included one of the same name. extends is resolved
+// while documents are merged, so it can name any document of an included
+// file or one defined earlier in the same file.
+func loadNode(path string, vars map[string]string, stack []string) (*yaml.Node, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(stack, abs) {
+		return nil, fmt.Errorf("include cycle: %s includes itself", path)
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return loadDir(path, vars, append(stack, abs))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parseFile(path, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	top := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if len(doc.Content) > 0 && doc.Content[0].Kind == yaml.MappingNode {
+		top = doc.Content[0]
+	}
+
+	_, incNode := mapValue(top, "include")
+	if incNode == nil {
+		return top, resolveExtends(path, nil, top)
+	}
+	var includes []string
+	if err := incNode.Decode(&includes); err != nil {
+		return nil, fmt.Errorf("%s:%d: include: %w", path, incNode.Line, err)
+	}
+	missing := make(map[string]bool)
+	for i := range includes {
+		includes[i] = expandVars(includes[i], vars, missing)
+	}
+	if err := missingVars(missing); err != nil {
+		return nil, fmt.Errorf("%s:%d: include: %w", path, incNode.Line, err)
+	}
+	merged := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, inc := range includes {
+		if !filepath.IsAbs(inc) {
+			inc = filepath.Join(filepath.Dir(path), inc)
+		}
+		n, err := loadNode(inc, vars, append(stack, abs))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: include %s: %w", path, incNode.Line, inc, err)
+		}
+		merged = mergeTop(merged, n)
+	}
+	_, baseDocs := mapValue(merged, "documents")
+	if err := resolveExtends(path, baseDocs, top); err != nil {
+		return nil, err
+	}
+	return mergeTop(merged, top), nil
+}
+
+// configExts are the extensions of the files read from a config directory.
+var configExts = []string{".yaml", ".yml", ".json", ".toml"}
+
+// dirFiles returns the config files directly in dir, in name order.
+func dirFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() && slices.Contains(configExts, strings.ToLower(filepath.Ext(e.Name()))) {
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s: no config files (%s)", dir, strings.Join(configExts, ", "))
+	}
+	return files, nil
+}
+
+// loadDir merges the config files of dir in name order, as if a file
+// included them all. Unlike includes, a document name may be used in only
+// one of them, so that one team's file cannot silently replace another's
+// document.
+func loadDir(dir string, vars map[string]string, stack []string) (*yaml.Node, error) {
+	files, err := dirFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	merged := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	defined := make(map[string]string)
+	for _, f := range files {
+		n, err := loadNode(f, vars, stack)
+		if err != nil {
+			return nil, err
+		}
+		_, docs := mapValue(n, "documents")
+		if docs != nil {
+			for _, d := range docs.Content {
+				name := scalarValue(d, "name")
+				if prev, dup := defined[name]; dup && name != "" {
+					return nil, fmt.Errorf("%s: document %q is also defined in %s", f, name, prev)
+				}
+				defined[name] = f
+			}
+		}
+		merged = mergeTop(merged, n)
+	}
+	return merged, nil
+}
+
+// mergeTop merges the top-level mapping over into base: keys of over win,
+// documents are appended and replace base documents with the same name,
+// and vars, plugins and pricing are merged name by name. include is
+// dropped, as it has been resolved.
+func mergeTop(base, over *yaml.Node) *yaml.Node {
+	out := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for i := 0; i+1 < len(base.Content); i += 2 {
+		out.Content = append(out.Content, base.Content[i], base.Content[i+1])
+	}
+	for i := 0; i+1 < len(over.Content); i += 2 {
+		k, v := over.Content[i], over.Content[i+1]
+		switch k.Value {
+		case "include":
+			continue
+		case "documents":
+			if _, docs := mapValue(out, "documents"); docs != nil {
+				v = mergeDocuments(docs, v)
+			}
+		case "vars", "plugins", "pricing":
+			if _, prev := mapValue(out, k.Value); prev != nil && prev.Kind == yaml.MappingNode && v.Kind == yaml.MappingNode {
+				merged := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: slices.Clone(prev.Content)}
+				for j := 0; j+1 < len(v.Content); j += 2 {
+					setValue(merged, v.Content[j], v.Content[j+1])
+				}
+				v = merged
+			}
+		}
+		setValue(out, k, v)
+	}
+	return out
+}
+
+// mergeDocuments appends the documents of over to base; a named document
+// replaces the base document of the same name in place.
+func mergeDocuments(base, over *yaml.Node) *yaml.Node {
+	out := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: slices.Clone(base.Content)}
+	for _, d := range over.Content {
+		name := scalarValue(d, "name")
+		i := slices.IndexFunc(out.Content, func(b *yaml.Node) bool {
+			return name != "" && scalarValue(b, "name") == name
+		})
+		if i >= 0 {
+			out.Content[i] = d
+		} else {
+			out.Content = append(out.Content, d)
+		}
+	}
+	return out
+}
+
+// resolveExtends replaces every document of top that extends another with
+// the merged document. The base is looked up among the earlier documents of
+// top, then among included, latest first.
+func resolveExtends(path string, included, top *yaml.Node) error {
+	_, docs := mapValue(top, "documents")
+	if docs == nil {
+		return nil
+	}
+	var candidates []*yaml.Node
+	if included != nil {
+		candidates = slices.Clone(included.Content)
+	}
+	for i, d := range docs.Content {
+		if ext := scalarValue(d, "extends"); ext != "" {
+			var base *yaml.Node
+			for k := len(candidates) - 1; k >= 0; k-- {
+				if scalarValue(candidates[k], "name") == ext {
+					base = candidates[k]
+					break
+				}
+			}
+			if base == nil {
+				_, n := mapValue(d, "extends")
+				return fmt.Errorf("%s:%d:%d: extends unknown document %q", path, n.Line, n.Column, ext)
+			}
+			docs.Content[i] = extendDocument(base, d)
+		}
+		candidates = append(candidates, docs.Content[i])
+	}
+	return nil
+}
+
+// extendDocument returns base with the keys of over applied: sources are
+// appended to the base sources, any other key replaces the base value. The
+// base name is not inherited, and setting outputPath or outputFormat drops
+// the base outputs (and the other way around).
+func extendDocument(base, over *yaml.Node) *yaml.Node {
+	out := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: over.Line, Column: over.Column}
+	for i := 0; i+1 < len(base.Content); i += 2 {
+		switch base.Content[i].Value {
+		case "name", "extends":
+			continue
+		case "outputs":
+			if hasKey(over, "outputPath") || hasKey(over, "outputFormat") {
+				continue
+			}
+		case "outputPath", "outputFormat":
+			if hasKey(over, "outputs") {
+				continue
+			}
+		}
+		out.Content = append(out.Content, base.Content[i], base.Content[i+1])
+	}
+	for i := 0; i+1 < len(over.Content); i += 2 {
+		k, v := over.Content[i], over.Content[i+1]
+		switch k.Value {
+		case "extends":
+			continue
+		case "sources":
+			if _, bs := mapValue(out, "sources"); bs != nil {
+				v = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: slices.Concat(bs.Content, v.Content)}
+			}
+		}
+		setValue(out, k, v)
+	}
+	return out
+}
+
+// setValue sets key k of mapping n to v, replacing an existing value.
+func setValue(n, k, v *yaml.Node) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == k.Value {
+			n.Content[i+1] = v
+			return
+		}
+	}
+	n.Content = append(n.Content, k, v)
+}
+
+func hasKey(n *yaml.Node, key string) bool {
+	k, _ := mapValue(n, key)
+	return k != nil
+}
+
+func scalarValue(n *yaml.Node, key string) string {
+	_, v := mapValue(n, key)
+	if v == nil || v.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return v.Value
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Change is one edit Migrate makes to a config file.
+type Change struct {
+	Line int // line in the file as read; 0 when unknown
+	Msg  string
+}
+
+func (c Change) String() string {
+	if c.Line > 0 {
+		return fmt.Sprintf("%d: %s", c.Line, c.Msg)
+	}
+	return c.Msg
+}
+
+// migration upgrades one way of writing the config that an older version
+// of the tool wrote or accepted to the current one. It edits the document
+// node in place and reports what it changed.
+type migration func(root *yaml.Node) []Change
+
+// migrations run in order. A key that is renamed or a setting whose form
+// changes gets a migration here, so configs written for older versions
+// keep loading after the old spelling is dropped.
+var migrations = []migration{
+	lowercaseSourceTypes,
+	scalarTransforms,
+	filePatternLists,
+}
+
+// Migrate upgrades the config file at path, with content data, to the
+// current format and encodes it again in the format of out, which may be
+// path itself. YAML keeps its comments and key order; JSON and TOML are
+// written the way Save writes them. Includes are not followed: each file
+// is migrated on its own.
+func Migrate(path string, data []byte, out string) ([]byte, []Change, error) {
+	doc, err := parseFile(path, data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return data, nil, nil
+	}
+	root := doc.Content[0]
+	var changes []Change
+	for _, m := range migrations {
+		changes = append(changes, m(root)...)
+	}
+	// the result must still load
+	var c Config
+	if err := root.Decode(&c); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	data, err = encodeNode(out, doc, indentOf(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, changes, nil
+}
+
+// eachSource calls fn with the node of every source of every document.
+func eachSource(root *yaml.Node, fn func(src *yaml.Node)) {
+	_, docs := mapValue(root, "documents")
+	if docs == nil || docs.Kind != yaml.SequenceNode {
+		return
+	}
+	for _, doc := range docs.Content {
+		_, sources := mapValue(doc, "sources")
+		if sources == nil || sources.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, src := range sources.Content {
+			fn(src)
+		}
+	}
+}
+
+// lowercaseSourceTypes spells source types in lower case, as the
+// documentation does; they were always matched regardless of case.
+func lowercaseSourceTypes(root *yaml.Node) []Change {
+	var changes []Change
+	eachSource(root, func(src *yaml.Node) {
+		_, t := mapValue(src, "type")
+		if t == nil || t.Kind != yaml.ScalarNode || t.Value == strings.ToLower(t.Value) {
+			return
+		}
+		lower := strings.ToLower(t.Value)
+		changes = append(changes, Change{Line: t.Line, Msg: fmt.Sprintf("type %q is now written %q", t.Value, lower)})
+		t.Value = lower
+	})
+	return changes
+}
+
+// scalarTransforms writes transforms given as a mapping without options,
+// such as "- stripComments: {}", in the short form "- stripComments".
+func scalarTransforms(root *yaml.Node) []Change {
+	var changes []Change
+	eachSource(root, func(src *yaml.Node) {
+		_, ts := mapValue(src, "transforms")
+		if ts == nil || ts.Kind != yaml.SequenceNode {
+			return
+		}
+		for _, t := range ts.Content {
+			if t.Kind != yaml.MappingNode || len(t.Content) != 2 {
+				continue
+			}
+			name, opts := t.Content[0], t.Content[1]
+			if opts.Tag != "!!null" && !(opts.Kind == yaml.MappingNode && len(opts.Content) == 0) {
+				continue
+			}
+			changes = append(changes, Change{Line: t.Line, Msg: fmt.Sprintf("transform %s without options is now written as a plain name", name.Value)})
+			*t = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name.Value, Line: t.Line, Column: t.Column}
+		}
+	})
+	return changes
+}
+
+// filePatternLists writes a comma-separated filePattern string, such as
+// "*.go,!*_test.go", as a list of patterns, in sources and profiles.
+// Regular expressions (patternSyntax regex) stay a string.
+func filePatternLists(root *yaml.Node) []Change {
+	var changes []Change
+	split := func(n *yaml.Node) {
+		_, syntax := mapValue(n, "patternSyntax")
+		if syntax != nil && strings.EqualFold(syntax.Value, "regex") {
+			return
+		}
+		_, fp := mapValue(n, "filePattern")
+		if fp == nil || fp.Kind != yaml.ScalarNode || fp.Tag == "!!null" || !strings.Contains(fp.Value, ",") {
+			return
+		}
+		list := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Style: yaml.FlowStyle, Line: fp.Line, Column: fp.Column}
+		for _, p := range ParsePatterns(fp.Value) {
+			list.Content = append(list.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Style: yaml.DoubleQuotedStyle, Value: p})
+		}
+		changes = append(changes, Change{Line: fp.Line, Msg: fmt.Sprintf("filePattern %q is now written as a list", fp.Value)})
+		list.LineComment = fp.LineComment
+		*fp = *list
+	}
+	eachSource(root, split)
+	if _, profiles := mapValue(root, "profiles"); profiles != nil && profiles.Kind == yaml.MappingNode {
+		for i := 1; i < len(profiles.Content); i += 2 {
+			split(profiles.Content[i])
+		}
+	}
+	return changes
+}
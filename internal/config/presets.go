@@ -0,0 +1,174 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// preset describes the files of one kind of project for `init`.
+type preset struct {
+	name        string
+	description string
+	sourcePaths []string // embedded by the files document; the tree shows the whole project
+	filePattern string
+	exclude     []string
+	markers     []string // files at the project root that identify the project type
+}
+
+// presets are the project types init offers, in the order it lists them.
+var presets = []preset{
+	{
+		name: "go", description: "Go module",
+		sourcePaths: []string{"."},
+		filePattern: "*.go,go.mod",
+		exclude:     []string{".git", "vendor", "testdata", "**/*_test.go"},
+		markers:     []string{"go.mod"},
+	},
+	{
+		name: "php", description: "PHP / Symfony application",
+		sourcePaths: []string{"src", "config", "migrations", "templates"},
+		filePattern: "*.php,*.twig,*.yaml",
+		exclude:     []string{".git", "vendor", "var", "node_modules"},
+		markers:     []string{"composer.json"},
+	},
+	{
+		name: "node", description: "Node.js / TypeScript project",
+		sourcePaths: []string{"src"},
+		filePattern: "*.js,*.jsx,*.mjs,*.cjs,*.ts,*.tsx,*.vue,*.svelte",
+		exclude:     []string{".git", "node_modules", "dist", "build", "coverage", ".next", "**/*.min.js"},
+		markers:     []string{"package.json"},
+	},
+	{
+		name: "python", description: "Python package or application",
+		sourcePaths: []string{"."},
+		filePattern: "*.py,*.pyi,pyproject.toml",
+		exclude:     []string{".git", ".venv", "venv", "__pycache__", ".tox", "build", "dist", "*.egg-info"},
+		markers:     []string{"pyproject.toml", "setup.py", "requirements.txt"},
+	},
+	{
+		name: "monorepo", description: "several projects in one repository",
+		sourcePaths: []string{"."},
+		filePattern: "*.go,*.php,*.py,*.js,*.jsx,*.ts,*.tsx,*.md",
+		exclude: []string{".git", "vendor", "node_modules", "dist", "build", "coverage",
+			".venv", "venv", "__pycache__", "var", "testdata"},
+	},
+}
+
+// PresetNames lists the project types Preset accepts, with a description
+// each, for prompts and usage text.
+func PresetNames() [][2]string {
+	out := make([][2]string, len(presets))
+	for i, p := range presets {
+		out[i] = [2]string{p.name, p.description}
+	}
+	return out
+}
+
+// Preset returns the starting config for a project type: a tree document
+// showing the project layout and a files document embedding its sources.
+func Preset(name string) (Config, error) {
+	if p, ok := findPreset(name); ok {
+		return p.config(), nil
+	}
+	names := make([]string, len(presets))
+	for i, p := range presets {
+		names[i] = p.name
+	}
+	return Config{}, fmt.Errorf("unknown preset %q (expected %s)", name, strings.Join(names, ", "))
+}
+
+func findPreset(name string) (preset, bool) {
+	for _, p := range presets {
+		if p.name == name {
+			return p, true
+		}
+	}
+	return preset{}, false
+}
+
+func (p preset) config() Config {
+	return Config{
+		ProjectPath: ".",
+		Documents: []Document{
+			{
+				Name:        "tree",
+				Description: "Project structure overview",
+				OutputPath:  "context/project-tree.md",
+				Sources: []Source{{
+					Type:         "tree",
+					SourcePaths:  []string{"."},
+					FilePattern:  ParsePatterns(p.filePattern),
+					ExcludePaths: p.exclude,
+				}},
+			},
+			{
+				Name:        "files",
+				Description: "Project source files",
+				OutputPath:  "context/project-files.md",
+				Sources: []Source{{
+					Type:         "file",
+					SourcePaths:  p.sourcePaths,
+					FilePattern:  ParsePatterns(p.filePattern),
+					ExcludePaths: p.exclude,
+				}},
+			},
+		},
+	}
+}
+
+// DetectPreset guesses the project type of root from the files at its top
+// level: one matching type wins, several make it a monorepo. It returns ""
+// when nothing matches.
+func DetectPreset(root string) string {
+	var found []string
+	for _, p := range presets {
+		for _, m := range p.markers {
+			if _, err := os.Stat(filepath.Join(root, m)); err == nil {
+				found = append(found, p.name)
+				break
+			}
+		}
+	}
+	switch len(found) {
+	case 0:
+		return ""
+	case 1:
+		return found[0]
+	default:
+		return "monorepo"
+	}
+}
+
+// Auto returns a config for root built without a config file: the preset
+// for the detected project type (monorepo when unknown) as one
+// project-context.md holding the tree and the files. Source paths of the
+// preset missing under root fall back to the whole project.
+func Auto(root string) Config {
+	p := presets[len(presets)-1]
+	if name := DetectPreset(root); name != "" {
+		p, _ = findPreset(name)
+	}
+	var paths []string
+	for _, sp := range p.sourcePaths {
+		if _, err := os.Stat(filepath.Join(root, sp)); err == nil {
+			paths = append(paths, sp)
+		}
+	}
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	c := p.config()
+	c.ProjectPath = root
+	c.Documents = []Document{{
+		Name:        "project-context",
+		Description: fmt.Sprintf("Project context (%s, detected)", p.description),
+		OutputPath:  "project-context.md",
+		Sources: []Source{
+			c.Documents[0].Sources[0],
+			{Type: "file", SourcePaths: paths, FilePattern: ParsePatterns(p.filePattern), ExcludePaths: p.exclude},
+		},
+	}}
+	return c
+}
@@ -0,0 +1,237 @@
+package config
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configSource is this package's config.go, whose field comments are the
+// descriptions in the schema: the comments stay the one place the config
+// format is documented.
+//
+//go:embed config.go
+var configSource string
+
+// fieldEnums lists the values of fields that take one of a fixed set, by
+// type and yaml key.
+var fieldEnums = map[string][]string{
+	"Source.type":              SourceTypes,
+	"Source.treeDetails":       TreeDetailFields,
+	"Source.fileHeader":        FileHeaderFields,
+	"Source.patternSyntax":     PatternSyntaxes,
+	"Source.encoding":          Encodings,
+	"Source.invalidUTF8Policy": InvalidUTF8Policies,
+	"Document.outputFormat":    OutputFormats,
+	"Document.splitBy":         SplitUnits,
+	"Output.format":            OutputFormats,
+	"Stage.stage":              StageTypes,
+}
+
+// schema is a JSON Schema (draft-07) node.
+type schema struct {
+	Schema      string             `json:"$schema,omitempty"`
+	Ref         string             `json:"$ref,omitempty"`
+	Title       string             `json:"title,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Enum        []string           `json:"enum,omitempty"`
+	Items       *schema            `json:"items,omitempty"`
+	Properties  properties         `json:"properties,omitempty"`
+	Additional  any                `json:"additionalProperties,omitempty"`
+	AnyOf       []*schema          `json:"anyOf,omitempty"`
+	Definitions map[string]*schema `json:"definitions,omitempty"`
+}
+
+// properties keeps the order of struct fields in the output.
+type properties []property
+
+type property struct {
+	name   string
+	schema *schema
+}
+
+func (ps properties) MarshalJSON() ([]byte, error) {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, p := range ps {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		name, _ := json.Marshal(p.name)
+		value, err := json.Marshal(p.schema)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&b, "%s:%s", name, value)
+	}
+	b.WriteByte('}')
+	return []byte(b.String()), nil
+}
+
+// Schema returns a JSON Schema of the config file, for editors: with
+// yaml-language-server it completes and checks keys and values.
+func Schema() ([]byte, error) {
+	docs, err := fieldDocs()
+	if err != nil {
+		return nil, err
+	}
+	g := schemaGen{docs: docs, defs: make(map[string]*schema)}
+	root := g.structSchema(reflect.TypeOf(Config{}))
+	root.Schema = "http://json-schema.org/draft-07/schema#"
+	root.Title = "go_project_context_maker config"
+	root.Definitions = g.defs
+	return json.MarshalIndent(root, "", "  ")
+}
+
+type schemaGen struct {
+	docs map[string]string // descriptions by "Type" and "Type.Field"
+	defs map[string]*schema
+}
+
+var yamlUnmarshaler = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+
+func (g *schemaGen) typeSchema(t reflect.Type) *schema {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.typeSchema(t.Elem())
+	case reflect.String:
+		return &schema{Type: "string"}
+	case reflect.Bool:
+		return &schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &schema{Type: "number"}
+	case reflect.Slice:
+		list := &schema{Type: "array", Items: g.typeSchema(t.Elem())}
+		// lists with their own UnmarshalYAML (Patterns) also take a string
+		if reflect.PointerTo(t).Implements(yamlUnmarshaler) {
+			return &schema{AnyOf: []*schema{{Type: "string"}, list}}
+		}
+		return list
+	case reflect.Map:
+		return &schema{Type: "object", Additional: g.typeSchema(t.Elem())}
+	case reflect.Struct:
+		if t == reflect.TypeOf(Transform{}) {
+			// a name, or a mapping of one name to its options
+			return &schema{AnyOf: []*schema{{Type: "string", Enum: TransformNames}, {Type: "object", Additional: &schema{Type: "object"}}}}
+		}
+		if _, ok := g.defs[t.Name()]; !ok {
+			g.defs[t.Name()] = nil // reserve, for recursive types
+			g.defs[t.Name()] = g.structSchema(t)
+		}
+		ref := &schema{Ref: "#/definitions/" + t.Name()}
+		// types with their own UnmarshalYAML (RedactRule) also take a string
+		if reflect.PointerTo(t).Implements(yamlUnmarshaler) {
+			return &schema{AnyOf: []*schema{{Type: "string"}, ref}}
+		}
+		return ref
+	}
+	return &schema{}
+}
+
+func (g *schemaGen) structSchema(t reflect.Type) *schema {
+	s := &schema{Type: "object", Description: g.docs[t.Name()], Additional: false}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fs := g.typeSchema(f.Type)
+		if fs.Ref != "" {
+			// a description next to $ref is ignored by draft-07 validators
+			fs = &schema{AnyOf: []*schema{fs}}
+		}
+		// comments name the Go field, the schema the key
+		fs.Description = g.docs[t.Name()+"."+f.Name]
+		if rest, ok := strings.CutPrefix(fs.Description, f.Name+" "); ok {
+			fs.Description = name + " " + rest
+		}
+		if enum, ok := fieldEnums[t.Name()+"."+name]; ok {
+			if fs.Type == "array" {
+				fs.Items.Enum = enum
+			} else {
+				fs.Enum = enum
+			}
+		}
+		s.Properties = append(s.Properties, property{name, fs})
+	}
+	return s
+}
+
+// fieldDocs reads the comments of the types in config.go: a type's doc
+// comment, and for each field its doc and line comments. A comment heading
+// a group of fields ("Fields used by type ...") rather than naming its field
+// is put in front of the description of every field in the group.
+func fieldDocs() (map[string]string, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "config.go", configSource, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("parse config.go: %w", err)
+	}
+	docs := make(map[string]string)
+	for _, decl := range file.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			st, ok := ts.Type.(*ast.StructType)
+			if !ok {
+				continue
+			}
+			if gd.Doc != nil {
+				docs[ts.Name.Name] = commentText(gd.Doc)
+			}
+			heading, lastLine := "", 0
+			for _, f := range st.Fields.List {
+				line := fset.Position(f.Pos()).Line
+				var parts []string
+				if f.Doc != nil {
+					text := commentText(f.Doc)
+					if len(f.Names) > 0 && strings.HasPrefix(text, f.Names[0].Name+" ") {
+						parts = append(parts, text)
+						heading = ""
+					} else {
+						heading = strings.TrimSuffix(text, ".")
+					}
+				} else if line > lastLine+1 {
+					// a blank line ends the group
+					heading = ""
+				}
+				lastLine = fset.Position(f.End()).Line
+				if heading != "" {
+					parts = append([]string{heading + ":"}, parts...)
+				}
+				if f.Comment != nil {
+					parts = append(parts, commentText(f.Comment))
+				}
+				for _, n := range f.Names {
+					if len(parts) > 0 {
+						docs[ts.Name.Name+"."+n.Name] = strings.Join(parts, " ")
+					}
+				}
+			}
+		}
+	}
+	return docs, nil
+}
+
+// commentText returns a comment group as one line.
+func commentText(g *ast.CommentGroup) string {
+	return strings.Join(strings.Fields(g.Text()), " ")
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// selectorRe matches a sourcePaths entry that addresses part of a file:
+// "path:120-240", "path:120" or "path#Symbol" (Go: "Func", "Type" or
+// "Type.Method").
+var selectorRe = regexp.MustCompile(`^(.+?)(:\d+(?:-\d+)?|#[A-Za-z_][A-Za-z0-9_]*(?:\.[A-Za-z_][A-Za-z0-9_]*)?)$`)
+
+// Selector is the part of a sourcePaths entry after the file path.
+type Selector struct {
+	Raw    string // ":120-240" or "#Name" as written
+	Start  int    // first line (1-based) of a line range
+	End    int    // last line of a line range
+	Symbol string // Go symbol name
+}
+
+// SplitSelector splits a sourcePaths entry into the path and an optional
+// selector; sel is nil for plain paths.
+func SplitSelector(entry string) (path string, sel *Selector, err error) {
+	m := selectorRe.FindStringSubmatch(strings.TrimSpace(entry))
+	if m == nil {
+		return entry, nil, nil
+	}
+	path, raw := m[1], m[2]
+	sel = &Selector{Raw: raw}
+	if name, ok := strings.CutPrefix(raw, "#"); ok {
+		sel.Symbol = name
+		return path, sel, nil
+	}
+	from, to, isRange := strings.Cut(raw[1:], "-")
+	sel.Start, _ = strconv.Atoi(from)
+	sel.End = sel.Start
+	if isRange {
+		sel.End, _ = strconv.Atoi(to)
+	}
+	if sel.Start < 1 || sel.End < sel.Start {
+		return path, nil, fmt.Errorf("invalid line range %q in %q", raw[1:], entry)
+	}
+	return path, sel, nil
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var sizeUnits = []struct {
+	suffix string
+	mult   int64
+}{
+	{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30},
+	{"KB", 1000}, {"MB", 1000 * 1000}, {"GB", 1000 * 1000 * 1000},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30},
+	{"B", 1},
+}
+
+// ParseSize parses a byte size such as "1048576", "512KB" or "2MiB".
+// An empty string yields 0, meaning "no limit".
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	upper := strings.ToUpper(s)
+	mult := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(upper, u.suffix) {
+			mult = u.mult
+			upper = strings.TrimSpace(strings.TrimSuffix(upper, u.suffix))
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(upper, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(mult)), nil
+}
+
+// SplitLimit returns the largest part of a document split by by ("tokens",
+// "bytes" or "files"): a byte size for bytes, a count otherwise. It is 0
+// when the document is not split.
+func SplitLimit(by, size string) (int64, error) {
+	by = strings.ToLower(strings.TrimSpace(by))
+	size = strings.TrimSpace(size)
+	switch by {
+	case "":
+		if size != "" {
+			return 0, fmt.Errorf("splitSize %q needs splitBy", size)
+		}
+		return 0, nil
+	case "tokens", "bytes", "files":
+	default:
+		return 0, fmt.Errorf("invalid splitBy %q (expected tokens, bytes or files)", by)
+	}
+	var n int64
+	var err error
+	if by == "bytes" {
+		n, err = ParseSize(size)
+	} else {
+		n, err = strconv.ParseInt(size, 10, 64)
+	}
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid splitSize %q for splitBy %s (expected a positive number)", size, by)
+	}
+	return n, nil
+}
+
+// ParseAge parses a time window such as "7d", "2w" or any time.ParseDuration
+// value ("36h").
+func ParseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			v, err := strconv.ParseFloat(n, 64)
+			if err != nil || v <= 0 {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			return time.Duration(v * float64(unit)), nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q (expected e.g. 7d, 2w or 36h)", s)
+	}
+	return d, nil
+}
+
+// ParseDate parses a point in time given as a date ("2024-01-01", local
+// midnight) or in RFC 3339 ("2024-01-01T09:00:00Z").
+func ParseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q (expected e.g. 2024-01-01 or 2024-01-01T09:00:00Z)", s)
+	}
+	return t, nil
+}
@@ -0,0 +1,731 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// parseTOML reads a TOML document into the yaml.Node tree the YAML loader
+// works on, so includes, extends and validation treat both formats alike.
+// Node lines point into the TOML text. Dates and times are read as strings,
+// as no config field holds one.
+func parseTOML(data []byte) (*yaml.Node, error) {
+	p := &tomlParser{data: data, explicit: make(map[*yaml.Node]bool), frozen: make(map[*yaml.Node]bool), arrays: make(map[*yaml.Node]bool)}
+	for i, c := range data {
+		if c == '\n' {
+			p.newlines = append(p.newlines, i)
+		}
+	}
+	p.root = p.newMap(0)
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	return &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{p.root}}, nil
+}
+
+type tomlParser struct {
+	data     []byte
+	pos      int
+	newlines []int // offsets of '\n', to map positions to lines
+	root     *yaml.Node
+	explicit map[*yaml.Node]bool // tables opened by a [header]
+	frozen   map[*yaml.Node]bool // inline tables and arrays, which are complete
+	arrays   map[*yaml.Node]bool // arrays of tables, opened by [[headers]]
+}
+
+// tomlError is a syntax error; its text starts like a yaml error so that
+// validate reports the line.
+type tomlError struct {
+	line int
+	msg  string
+}
+
+func (e *tomlError) Error() string { return fmt.Sprintf("toml: line %d: %s", e.line, e.msg) }
+
+func (p *tomlParser) errorf(format string, args ...any) error {
+	return &tomlError{line: p.line(p.pos), msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *tomlParser) line(pos int) int {
+	return sort.SearchInts(p.newlines, pos) + 1
+}
+
+func (p *tomlParser) newMap(pos int) *yaml.Node {
+	return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: p.line(pos)}
+}
+
+func (p *tomlParser) eof() bool { return p.pos >= len(p.data) }
+
+func (p *tomlParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.data[p.pos]
+}
+
+func (p *tomlParser) hasPrefix(s string) bool {
+	return bytes.HasPrefix(p.data[p.pos:], []byte(s))
+}
+
+// skipSpace skips blanks; with newlines also line breaks and comments.
+func (p *tomlParser) skipSpace(newlines bool) {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t':
+			p.pos++
+		case c == '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		case newlines && (c == '\n' || c == '\r'):
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+// endOfLine consumes blanks, a comment and the line break after a statement.
+func (p *tomlParser) endOfLine() error {
+	p.skipSpace(false)
+	if p.eof() {
+		return nil
+	}
+	if p.hasPrefix("\r\n") {
+		p.pos += 2
+		return nil
+	}
+	if p.peek() != '\n' {
+		return p.errorf("unexpected %q after value", p.peek())
+	}
+	p.pos++
+	return nil
+}
+
+func (p *tomlParser) parse() error {
+	cur := p.root
+	for {
+		p.skipSpace(true)
+		if p.eof() {
+			return nil
+		}
+		var err error
+		if p.peek() == '[' {
+			cur, err = p.header()
+		} else {
+			err = p.keyValue(cur)
+		}
+		if err != nil {
+			return err
+		}
+		if err := p.endOfLine(); err != nil {
+			return err
+		}
+	}
+}
+
+// header opens the table of a [table] or [[array of tables]] line.
+func (p *tomlParser) header() (*yaml.Node, error) {
+	start := p.pos
+	array := p.hasPrefix("[[")
+	if array {
+		p.pos += 2
+	} else {
+		p.pos++
+	}
+	p.skipSpace(false)
+	keys, err := p.key()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace(false)
+	closing := "]"
+	if array {
+		closing = "]]"
+	}
+	if !p.hasPrefix(closing) {
+		return nil, p.errorf("expected %s", closing)
+	}
+	p.pos += len(closing)
+
+	cur := p.root
+	for _, k := range keys[:len(keys)-1] {
+		if cur, err = p.descend(cur, k, start); err != nil {
+			return nil, err
+		}
+	}
+	last := keys[len(keys)-1]
+	v := tableValue(cur, last)
+	if array {
+		if v == nil {
+			v = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: p.line(start)}
+			p.arrays[v] = true
+			mapAdd(cur, last, v, p.line(start))
+		} else if !p.arrays[v] {
+			return nil, p.errorf("%s is already defined", last)
+		}
+		t := p.newMap(start)
+		v.Content = append(v.Content, t)
+		return t, nil
+	}
+	if v == nil {
+		v = p.newMap(start)
+		mapAdd(cur, last, v, p.line(start))
+	} else if v.Kind != yaml.MappingNode || p.frozen[v] || p.explicit[v] {
+		return nil, p.errorf("table %s is already defined", last)
+	}
+	p.explicit[v] = true
+	return v, nil
+}
+
+// descend returns the table key of cur, creating it when missing; for an
+// array of tables that is its last table.
+func (p *tomlParser) descend(cur *yaml.Node, key string, pos int) (*yaml.Node, error) {
+	v := tableValue(cur, key)
+	switch {
+	case v == nil:
+		v = p.newMap(pos)
+		mapAdd(cur, key, v, p.line(pos))
+	case p.arrays[v]:
+		v = v.Content[len(v.Content)-1]
+	case v.Kind != yaml.MappingNode || p.frozen[v]:
+		return nil, p.errorf("%s is not a table", key)
+	}
+	return v, nil
+}
+
+// keyValue reads a key = value pair into table.
+func (p *tomlParser) keyValue(table *yaml.Node) error {
+	start := p.pos
+	keys, err := p.key()
+	if err != nil {
+		return err
+	}
+	p.skipSpace(false)
+	if p.peek() != '=' {
+		return p.errorf("expected = after key %s", strings.Join(keys, "."))
+	}
+	p.pos++
+	p.skipSpace(false)
+	for _, k := range keys[:len(keys)-1] {
+		if table, err = p.descend(table, k, start); err != nil {
+			return err
+		}
+	}
+	last := keys[len(keys)-1]
+	if tableValue(table, last) != nil {
+		return p.errorf("duplicate key %s", last)
+	}
+	v, err := p.value()
+	if err != nil {
+		return err
+	}
+	mapAdd(table, last, v, p.line(start))
+	return nil
+}
+
+var bareKeyRe = regexp.MustCompile(`^[A-Za-z0-9_-]+`)
+
+// key reads a possibly dotted key.
+func (p *tomlParser) key() ([]string, error) {
+	var keys []string
+	for {
+		var k string
+		switch p.peek() {
+		case '"':
+			s, err := p.basicString()
+			if err != nil {
+				return nil, err
+			}
+			k = s
+		case '\'':
+			s, err := p.literalString()
+			if err != nil {
+				return nil, err
+			}
+			k = s
+		default:
+			m := bareKeyRe.Find(p.data[p.pos:])
+			if m == nil {
+				return nil, p.errorf("expected a key")
+			}
+			k = string(m)
+			p.pos += len(m)
+		}
+		keys = append(keys, k)
+		p.skipSpace(false)
+		if p.peek() != '.' {
+			return keys, nil
+		}
+		p.pos++
+		p.skipSpace(false)
+	}
+}
+
+func (p *tomlParser) value() (*yaml.Node, error) {
+	start := p.pos
+	scalar := func(tag, value string) *yaml.Node {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value, Line: p.line(start)}
+	}
+	switch {
+	case p.hasPrefix(`"""`):
+		s, err := p.multilineString(`"""`, true)
+		return scalar("!!str", s), err
+	case p.hasPrefix(`'''`):
+		s, err := p.multilineString(`'''`, false)
+		return scalar("!!str", s), err
+	case p.peek() == '"':
+		s, err := p.basicString()
+		return scalar("!!str", s), err
+	case p.peek() == '\'':
+		s, err := p.literalString()
+		return scalar("!!str", s), err
+	case p.peek() == '[':
+		return p.array()
+	case p.peek() == '{':
+		return p.inlineTable()
+	}
+	tok := p.token()
+	switch {
+	case tok == "":
+		return nil, p.errorf("expected a value")
+	case tok == "true" || tok == "false":
+		return scalar("!!bool", tok), nil
+	case dateTimeRe.MatchString(tok):
+		return scalar("!!str", tok), nil
+	}
+	if n, ok := tomlInt(tok); ok {
+		return scalar("!!int", strconv.FormatInt(n, 10)), nil
+	}
+	if f, ok := tomlFloat(tok); ok {
+		switch {
+		case math.IsNaN(f):
+			return scalar("!!float", ".nan"), nil
+		case math.IsInf(f, 1):
+			return scalar("!!float", ".inf"), nil
+		case math.IsInf(f, -1):
+			return scalar("!!float", "-.inf"), nil
+		}
+		return scalar("!!float", strconv.FormatFloat(f, 'g', -1, 64)), nil
+	}
+	p.pos = start
+	return nil, p.errorf("invalid value %q", tok)
+}
+
+var dateTimeRe = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}([Tt ]\d{2}:\d{2}(:\d{2}(\.\d+)?)?([Zz]|[+-]\d{2}:\d{2})?)?|\d{2}:\d{2}:\d{2}(\.\d+)?)$`)
+
+// token reads a bare value: a number, boolean, date or time.
+func (p *tomlParser) token() string {
+	start := p.pos
+	for !p.eof() {
+		c := p.peek()
+		// a space separates the date and time of a datetime
+		if c == ' ' && p.pos-start == 10 && p.pos+1 < len(p.data) && p.data[p.pos+1] >= '0' && p.data[p.pos+1] <= '9' {
+			p.pos++
+			continue
+		}
+		if !(c == '_' || c == '+' || c == '-' || c == '.' || c == ':' ||
+			c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			break
+		}
+		p.pos++
+	}
+	return string(p.data[start:p.pos])
+}
+
+func tomlInt(tok string) (int64, bool) {
+	for _, prefix := range []string{"0x", "0o", "0b"} {
+		if strings.HasPrefix(tok, prefix) {
+			n, err := strconv.ParseInt(tok, 0, 64)
+			return n, err == nil
+		}
+	}
+	digits := strings.TrimLeft(tok, "+-")
+	if digits == "" || strings.Trim(digits, "0123456789_") != "" ||
+		strings.HasPrefix(digits, "_") || strings.HasSuffix(digits, "_") || strings.Contains(digits, "__") ||
+		len(digits) > 1 && digits[0] == '0' {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(strings.ReplaceAll(tok, "_", ""), 10, 64)
+	return n, err == nil
+}
+
+var leadingZeroRe = regexp.MustCompile(`^[+-]?0[0-9_]`)
+
+func tomlFloat(tok string) (float64, bool) {
+	switch strings.TrimLeft(tok, "+-") {
+	case "inf":
+		if strings.HasPrefix(tok, "-") {
+			return math.Inf(-1), true
+		}
+		return math.Inf(1), true
+	case "nan":
+		return math.NaN(), true
+	}
+	digits := strings.TrimPrefix(strings.TrimPrefix(tok, "+"), "-")
+	if digits == "" || digits[0] < '0' || digits[0] > '9' || strings.ContainsAny(tok, "xX") || leadingZeroRe.MatchString(tok) ||
+		!betweenDigits(tok, '_') || !betweenDigits(tok, '.') {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(strings.ReplaceAll(tok, "_", ""), 64)
+	return f, err == nil
+}
+
+// betweenDigits reports whether every c in tok has a digit on both sides,
+// as TOML requires of underscores and the decimal point.
+func betweenDigits(tok string, c byte) bool {
+	isDigit := func(i int) bool { return i >= 0 && i < len(tok) && tok[i] >= '0' && tok[i] <= '9' }
+	for i := range len(tok) {
+		if tok[i] == c && !(isDigit(i-1) && isDigit(i+1)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *tomlParser) array() (*yaml.Node, error) {
+	n := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: p.line(p.pos)}
+	p.frozen[n] = true
+	p.pos++
+	for {
+		p.skipSpace(true)
+		if p.peek() == ']' {
+			p.pos++
+			return n, nil
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		n.Content = append(n.Content, v)
+		p.skipSpace(true)
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+			p.pos++
+			return n, nil
+		default:
+			return nil, p.errorf("expected , or ] in array")
+		}
+	}
+}
+
+func (p *tomlParser) inlineTable() (*yaml.Node, error) {
+	n := p.newMap(p.pos)
+	p.pos++
+	p.skipSpace(false)
+	if p.peek() == '}' {
+		p.pos++
+		p.frozen[n] = true
+		return n, nil
+	}
+	for {
+		p.skipSpace(false)
+		if err := p.keyValue(n); err != nil {
+			return nil, err
+		}
+		p.skipSpace(false)
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			p.frozen[n] = true
+			return n, nil
+		default:
+			return nil, p.errorf("expected , or } in inline table")
+		}
+	}
+}
+
+func (p *tomlParser) basicString() (string, error) {
+	p.pos++
+	var b strings.Builder
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.peek()
+		switch c {
+		case '"':
+			p.pos++
+			return b.String(), nil
+		case '\\':
+			if err := p.escape(&b); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+func (p *tomlParser) literalString() (string, error) {
+	p.pos++
+	start := p.pos
+	for !p.eof() && p.peek() != '\'' && p.peek() != '\n' {
+		p.pos++
+	}
+	if p.peek() != '\'' {
+		return "", p.errorf("unterminated string")
+	}
+	s := string(p.data[start:p.pos])
+	p.pos++
+	return s, nil
+}
+
+// multilineString reads a """ or ”' string; a newline right after the
+// opening delimiter is dropped, and in basic strings a backslash at the end
+// of a line joins it with the next non-blank text.
+func (p *tomlParser) multilineString(delim string, basic bool) (string, error) {
+	p.pos += 3
+	if p.hasPrefix("\r\n") {
+		p.pos += 2
+	} else if p.peek() == '\n' {
+		p.pos++
+	}
+	var b strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		if p.hasPrefix(delim) {
+			// up to two quotes may come right before the closing delimiter
+			n := 0
+			for p.pos+n < len(p.data) && p.data[p.pos+n] == delim[0] {
+				n++
+			}
+			if n > 5 {
+				return "", p.errorf("too many quotes in string")
+			}
+			b.WriteString(strings.Repeat(delim[:1], n-3))
+			p.pos += n
+			return b.String(), nil
+		}
+		c := p.peek()
+		if basic && c == '\\' {
+			rest := strings.TrimLeft(string(p.data[p.pos+1:]), " \t\r")
+			if strings.HasPrefix(rest, "\n") {
+				p.pos = len(p.data) - len(strings.TrimLeft(rest, " \t\r\n"))
+				continue
+			}
+			if err := p.escape(&b); err != nil {
+				return "", err
+			}
+			continue
+		}
+		b.WriteByte(c)
+		p.pos++
+	}
+}
+
+// escape reads the escape sequence at the current backslash.
+func (p *tomlParser) escape(b *strings.Builder) error {
+	p.pos++
+	if p.eof() {
+		return p.errorf("unterminated string")
+	}
+	c := p.peek()
+	p.pos++
+	switch c {
+	case 'b':
+		b.WriteByte('\b')
+	case 't':
+		b.WriteByte('\t')
+	case 'n':
+		b.WriteByte('\n')
+	case 'f':
+		b.WriteByte('\f')
+	case 'r':
+		b.WriteByte('\r')
+	case 'e':
+		b.WriteByte(0x1b)
+	case '"', '\\':
+		b.WriteByte(c)
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		if p.pos+n > len(p.data) {
+			return p.errorf("invalid escape \\%c", c)
+		}
+		r, err := strconv.ParseUint(string(p.data[p.pos:p.pos+n]), 16, 32)
+		if err != nil || !utf8.ValidRune(rune(r)) {
+			return p.errorf("invalid escape \\%c%s", c, p.data[p.pos:p.pos+n])
+		}
+		b.WriteRune(rune(r))
+		p.pos += n
+	default:
+		return p.errorf("invalid escape \\%c", c)
+	}
+	return nil
+}
+
+// tableValue returns the value of key in the table m, or nil.
+func tableValue(m *yaml.Node, key string) *yaml.Node {
+	_, v := mapValue(m, key)
+	return v
+}
+
+func mapAdd(m *yaml.Node, key string, v *yaml.Node, line int) {
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key, Line: line}, v)
+}
+
+// writeTOML writes the mapping n as TOML: the plain keys of each table
+// first, then its tables and arrays of tables. Nulls are left out, as TOML
+// has none.
+func writeTOML(b *strings.Builder, n *yaml.Node) error {
+	return writeTOMLTable(b, nil, n)
+}
+
+func writeTOMLTable(b *strings.Builder, path []string, n *yaml.Node) error {
+	var tables []int
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i].Value, n.Content[i+1]
+		if isTable(v) || isTableArray(v) {
+			tables = append(tables, i)
+			continue
+		}
+		if v.Tag == "!!null" {
+			continue
+		}
+		b.WriteString(tomlKey(k) + " = ")
+		if err := writeTOMLValue(b, v); err != nil {
+			return fmt.Errorf("%s: %w", strings.Join(append(path, k), "."), err)
+		}
+		b.WriteByte('\n')
+	}
+	for _, i := range tables {
+		k, v := n.Content[i].Value, n.Content[i+1]
+		sub := append(path[:len(path):len(path)], k)
+		header := make([]string, len(sub))
+		for j, s := range sub {
+			header[j] = tomlKey(s)
+		}
+		if isTable(v) {
+			fmt.Fprintf(b, "\n[%s]\n", strings.Join(header, "."))
+			if err := writeTOMLTable(b, sub, v); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, t := range v.Content {
+			fmt.Fprintf(b, "\n[[%s]]\n", strings.Join(header, "."))
+			if err := writeTOMLTable(b, sub, t); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func isTable(n *yaml.Node) bool { return n.Kind == yaml.MappingNode }
+
+func isTableArray(n *yaml.Node) bool {
+	if n.Kind != yaml.SequenceNode || len(n.Content) == 0 {
+		return false
+	}
+	for _, c := range n.Content {
+		if c.Kind != yaml.MappingNode {
+			return false
+		}
+	}
+	return true
+}
+
+func writeTOMLValue(b *strings.Builder, n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.SequenceNode:
+		b.WriteByte('[')
+		for i, c := range n.Content {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			if err := writeTOMLValue(b, c); err != nil {
+				return err
+			}
+		}
+		b.WriteByte(']')
+	case yaml.MappingNode:
+		b.WriteByte('{')
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(tomlKey(n.Content[i].Value) + " = ")
+			if err := writeTOMLValue(b, n.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		b.WriteByte('}')
+	case yaml.ScalarNode:
+		switch n.Tag {
+		case "!!int", "!!bool":
+			b.WriteString(n.Value)
+		case "!!float":
+			b.WriteString(strings.NewReplacer(".inf", "inf", ".nan", "nan").Replace(n.Value))
+		case "!!null":
+			return fmt.Errorf("null inside an array or inline table")
+		default:
+			b.WriteString(tomlString(n.Value))
+		}
+	default:
+		return fmt.Errorf("unsupported yaml node kind %d", n.Kind)
+	}
+	return nil
+}
+
+// tomlKey quotes k unless it is a bare key.
+func tomlKey(k string) string {
+	if k != "" && len(bareKeyRe.FindString(k)) == len(k) {
+		return k
+	}
+	return tomlString(k)
+}
+
+// tomlString quotes s as a basic string, or as a multi-line basic string
+// when it spans lines.
+func tomlString(s string) string {
+	multiline := strings.Contains(strings.TrimSuffix(s, "\n"), "\n")
+	var b strings.Builder
+	if multiline {
+		b.WriteString("\"\"\"\n")
+	} else {
+		b.WriteByte('"')
+	}
+	for _, r := range s {
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '"':
+			b.WriteString(`\"`)
+		case r == '\n' && multiline:
+			b.WriteByte('\n')
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	if multiline {
+		b.WriteString(`"""`)
+	} else {
+		b.WriteByte('"')
+	}
+	return b.String()
+}
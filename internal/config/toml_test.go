@@ -0,0 +1,217 @@
+package config
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// decodeTOML parses src and decodes it as the YAML loader would.
+func decodeTOML(t *testing.T, src string) map[string]any {
+	t.Helper()
+	n, err := parseTOML([]byte(src))
+	if err != nil {
+		t.Fatalf("parseTOML(%q): %v", src, err)
+	}
+	var v map[string]any
+	if err := n.Decode(&v); err != nil {
+		t.Fatalf("decode %q: %v", src, err)
+	}
+	return v
+}
+
+func TestParseTOML(t *testing.T) {
+	type m = map[string]any
+	tests := []struct {
+		name string
+		src  string
+		want m
+	}{
+		{"empty", "", m{}},
+		{"comments", "# top\n\na = 1 # trailing\n", m{"a": 1}},
+		{"basic string", `a = "x\ty\u00e9\"\\"`, m{"a": "x\tyé\"\\"}},
+		{"literal string", `a = 'C:\path\*.go'`, m{"a": `C:\path\*.go`}},
+		{"multiline basic", "a = \"\"\"\none\ntwo\"\"\"", m{"a": "one\ntwo"}},
+		{"multiline line continuation", "a = \"\"\"\none \\\n    two\"\"\"", m{"a": "one two"}},
+		{"multiline quotes before delimiter", `a = """say "hi"""""`, m{"a": `say "hi""`}},
+		{"multiline literal", "a = '''\nraw \\n\n'''", m{"a": "raw \\n\n"}},
+		{"integers", "a = 1_000\nb = -7\nc = 0x1F\nd = 0o17\ne = 0b101\nf = +0", m{"a": 1000, "b": -7, "c": 31, "d": 15, "e": 5, "f": 0}},
+		{"floats", "a = 1.5e3\nb = -0.25\nc = -inf\nd = 3_141.5", m{"a": 1500.0, "b": -0.25, "c": math.Inf(-1), "d": 3141.5}},
+		{"booleans", "a = true\nb = false", m{"a": true, "b": false}},
+		{"dates as strings", "a = 1979-05-27T07:32:00Z\nb = 1979-05-27 07:32:00\nc = 1979-05-27\nd = 07:32:00", m{"a": "1979-05-27T07:32:00Z", "b": "1979-05-27 07:32:00", "c": "1979-05-27", "d": "07:32:00"}},
+		{"arrays", "a = [1, [2, 3], ]\nb = [\n  \"x\", # first\n  \"y\",\n]\nc = []", m{"a": []any{1, []any{2, 3}}, "b": []any{"x", "y"}, "c": []any{}}},
+		{"inline table", `a = { b = 1, "c d" = "e", f = {} }`, m{"a": m{"b": 1, "c d": "e", "f": m{}}}},
+		{"dotted keys", "a.b.c = 1\na.b.d = 2\n\"x.y\" = 3", m{"a": m{"b": m{"c": 1, "d": 2}}, "x.y": 3}},
+		{"tables", "[a.b]\nc = 1\n\n[a]\nd = 2", m{"a": m{"b": m{"c": 1}, "d": 2}}},
+		{"array of tables", "[[documents]]\nname = \"a\"\n[documents.vars]\nk = \"v\"\n\n[[documents]]\nname = \"b\"", m{"documents": []any{m{"name": "a", "vars": m{"k": "v"}}, m{"name": "b"}}}},
+		{"nested array of tables", "[[documents]]\nname = \"a\"\n[[documents.sources]]\ntype = \"tree\"\n[[documents.sources]]\ntype = \"file\"", m{"documents": []any{m{"name": "a", "sources": []any{m{"type": "tree"}, m{"type": "file"}}}}}},
+		{"crlf", "a = 1\r\n[b]\r\nc = \"x\"\r\n", m{"a": 1, "b": m{"c": "x"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeTOML(t, tt.src); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTOML(%q) = %#v, want %#v", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTOMLNaN(t *testing.T) {
+	got := decodeTOML(t, "a = nan")
+	if f, ok := got["a"].(float64); !ok || !math.IsNaN(f) {
+		t.Errorf("parseTOML(\"a = nan\") = %#v, want NaN", got)
+	}
+}
+
+func TestParseTOMLLines(t *testing.T) {
+	n, err := parseTOML([]byte("a = 1\n\n[b]\nc = \"x\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, b := mapValue(n.Content[0], "b")
+	k, c := mapValue(b, "c")
+	if b.Line != 3 || k.Line != 4 || c.Line != 4 {
+		t.Errorf("lines: table %d, key %d, value %d, want 3, 4, 4", b.Line, k.Line, c.Line)
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		line int
+		msg  string
+	}{
+		{"a =", 1, "expected a value"},
+		{"= 1", 1, "expected a key"},
+		{"a 1", 1, "expected ="},
+		{"a = 1 b = 2", 1, ""},
+		{"a = 1\na = 2", 2, "duplicate key a"},
+		{"[a]\nx = 1\n[a]", 3, "already defined"},
+		{"a = 1\n[a]", 2, "already defined"},
+		{"a = { b = 1 }\n[a]", 2, "already defined"},
+		{"a = { b = 1 }\na.c = 2", 2, "not a table"},
+		{"[[a]]\n[a]", 2, "already defined"},
+		{"a = [1]\n[[a]]", 2, "already defined"},
+		{"[a", 1, "expected ]"},
+		{"[[a]", 1, "expected ]]"},
+		{`a = "x`, 1, "unterminated string"},
+		{"a = \"x\ny\"", 1, "unterminated string"},
+		{"a = 'x", 1, "unterminated string"},
+		{"a = \"\"\"x", 1, "unterminated string"},
+		{`a = """x""""""`, 1, "too many quotes"},
+		{`a = "\q"`, 1, `invalid escape \q`},
+		{`a = "\uD800"`, 1, "invalid escape"},
+		{`a = "\u12"`, 1, "invalid escape"},
+		{"a = [1 2]", 1, "expected , or ]"},
+		{"a = { b = 1 c = 2 }", 1, "expected , or }"},
+		{"a = 01", 1, "invalid value"},
+		{"a = 1_", 1, "invalid value"},
+		{"a = 1__0", 1, "invalid value"},
+		{"a = yes", 1, "invalid value"},
+		{"a = .5", 1, "invalid value"},
+		{"a = 1.", 1, "invalid value"},
+		{"a = 1._5", 1, "invalid value"},
+		{"a = 1e_5", 1, "invalid value"},
+		{"a = Infinity", 1, "invalid value"},
+	}
+	for _, tt := range tests {
+		_, err := parseTOML([]byte(tt.src))
+		var te *tomlError
+		if !errors.As(err, &te) {
+			t.Errorf("parseTOML(%q) = %v, want a syntax error", tt.src, err)
+			continue
+		}
+		if te.line != tt.line || !strings.Contains(te.msg, tt.msg) {
+			t.Errorf("parseTOML(%q) = %v, want line %d: %s", tt.src, err, tt.line, tt.msg)
+		}
+	}
+}
+
+func TestWriteTOMLRoundTrip(t *testing.T) {
+	src := `projectPath: .
+"odd key": 1
+jobs: 4
+ratio: 0.5
+big: .inf
+strict: true
+empty: []
+patterns: ["*.go", "!*_test.go"]
+description: |
+  Line one with "quotes" and \backslashes\.
+  Line two with """triple""" quotes.
+tab: "a\tb\u0001"
+vars: {team: core, "with space": x}
+documents:
+  - name: api
+    outputPath: api.md
+    vars:
+      env: prod
+    sources:
+      - type: tree
+        sourcePaths: [.]
+      - type: file
+        sourcePaths: [internal, cmd]
+        filePattern: ["*.go"]
+  - name: docs
+    sources:
+      - type: file
+        sourcePaths: [docs]
+        transforms:
+          - {type: replace, from: a, to: b}
+`
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(src), &doc); err != nil {
+		t.Fatal(err)
+	}
+	var want map[string]any
+	if err := doc.Decode(&want); err != nil {
+		t.Fatal(err)
+	}
+
+	var b strings.Builder
+	if err := writeTOML(&b, doc.Content[0]); err != nil {
+		t.Fatal(err)
+	}
+	if got := decodeTOML(t, b.String()); !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip through\n%s\n= %#v, want %#v", b.String(), got, want)
+	}
+
+	// writing the parsed document again gives the same text
+	n, err := parseTOML([]byte(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var again strings.Builder
+	if err := writeTOML(&again, n.Content[0]); err != nil {
+		t.Fatal(err)
+	}
+	if again.String() != b.String() {
+		t.Errorf("second write\n%s\ndiffers from the first\n%s", again.String(), b.String())
+	}
+}
+
+func TestWriteTOMLNulls(t *testing.T) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte("a: ~\nb: 1\n"), &doc); err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	if err := writeTOML(&b, doc.Content[0]); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "b = 1\n" {
+		t.Errorf("writeTOML = %q, want the null key left out", b.String())
+	}
+
+	if err := yaml.Unmarshal([]byte("a: [1, ~]\n"), &doc); err != nil {
+		t.Fatal(err)
+	}
+	b.Reset()
+	if err := writeTOML(&b, doc.Content[0]); err == nil {
+		t.Error("writeTOML of a null in an array: want error")
+	}
+}
@@ -0,0 +1,1476 @@
+package config
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"go_project_context_maker/internal/match"
+	"go_project_context_maker/internal/redact"
+)
+
+// SourceTypes lists the values accepted in a source's "type" field.
+var SourceTypes = []string{"tree", "file", "outline", "stats", "symbols", "api-spec", "db-schema", "infra", "command", "deps", "git-log", "dirdiff", "template", "url", "document"}
+
+// TransformNames lists the steps a source's "transforms" may name.
+var TransformNames = []string{"stripLicenseHeader", "stripComments", "collapseImports", "collapseBlankLines", "redactSecrets", "truncate", "lineNumbers"}
+
+// OutputFormats lists the values accepted in a document's "outputFormat" field.
+var OutputFormats = []string{"markdown", "md", "xml", "html", "text", "txt", "json", "jsonl-chunks", "repomix", "gitingest"}
+
+// TreeDetailFields lists the values accepted in a tree source's "treeDetails" field.
+var TreeDetailFields = []string{"size", "lines", "modtime"}
+
+// FileHeaderFields lists the values accepted in a source's "fileHeader" field.
+var FileHeaderFields = []string{"size", "lines", "sha256", "modtime", "commit"}
+
+// PatternSyntaxes lists the values accepted in a source's "patternSyntax" field.
+var PatternSyntaxes = []string{"glob", "regex"}
+
+// StageTypes lists the values accepted in a pipeline stage's "stage" field.
+var StageTypes = []string{"redact", "assert", "anonymize", "command", "replace"}
+
+// SplitUnits lists the values accepted in a document's "splitBy" field.
+var SplitUnits = []string{"tokens", "bytes", "files"}
+
+// Encodings lists the values accepted in a source's "encoding" field.
+var Encodings = []string{"utf-8", "utf-16le", "utf-16be", "windows-1251", "cp1251", "windows-1252", "cp1252", "iso-8859-1", "latin1", "koi8-r"}
+
+// InvalidUTF8Policies lists the values accepted in a source's "invalidUTF8Policy" field.
+var InvalidUTF8Policies = []string{"convert", "replace", "skip"}
+
+// ConvertFormats lists the values accepted in a source's "convert" field.
+var ConvertFormats = []string{"ipynb", "docx", "xlsx"}
+
+// Problem is a single validation finding with its YAML position.
+type Problem struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (p Problem) String() string {
+	if p.Line == 0 {
+		return p.Msg
+	}
+	if p.Column == 0 {
+		return fmt.Sprintf("%d: %s", p.Line, p.Msg)
+	}
+	return fmt.Sprintf("%d:%d: %s", p.Line, p.Column, p.Msg)
+}
+
+var yamlLineRe = regexp.MustCompile(`^line (\d+): (.*)$`)
+
+// Validate checks the config at path for unknown keys, missing required
+// fields, invalid source types, conflicting output paths and nonexistent
+// source paths. Source paths are checked under rootOverride, or under the config's
+// projectPath when rootOverride is empty. It returns every problem found instead of
+// stopping at the first.
+func Validate(path, rootOverride string) ([]Problem, error) {
+	return ValidateVars(path, rootOverride, nil)
+}
+
+// ValidateVars is Validate with variables for ${NAME} that take precedence
+// over the environment.
+func ValidateVars(path, rootOverride string, vars map[string]string) ([]Problem, error) {
+	return validate(path, rootOverride, vars, nil)
+}
+
+// validate is Validate for a file included from the files on stack.
+func validate(path, rootOverride string, vars map[string]string, stack []string) ([]Problem, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(stack, abs) {
+		return nil, fmt.Errorf("include cycle: %s includes itself", path)
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return validateDir(path, rootOverride, vars, append(stack, abs))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []Problem
+
+	root, err := parseFile(path, data)
+	if err != nil {
+		// syntax error: nothing else can be checked
+		return []Problem{yamlErrorProblem(err.Error())}, nil
+	}
+	var c Config
+	if FormatOf(path) == FormatTOML {
+		problems = append(problems, strictTOML(root, &c)...)
+	} else {
+		// Strict decode to report unknown keys and type mismatches.
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+			var te *yaml.TypeError
+			if !errors.As(err, &te) {
+				return []Problem{yamlErrorProblem(err.Error())}, nil
+			}
+			for _, msg := range te.Errors {
+				problems = append(problems, yamlErrorProblem(msg))
+			}
+		}
+	}
+
+	if len(root.Content) == 0 {
+		return append(problems, Problem{Msg: "config is empty"}), nil
+	}
+	top := root.Content[0]
+
+	if err := c.expand(vars); err != nil {
+		problems = append(problems, Problem{Msg: err.Error()})
+	}
+	projectRoot := rootOverride
+	if projectRoot == "" {
+		projectRoot = c.ResolveRoot(path)
+	}
+
+	// documents of included files, which documents here may extend, and
+	// the plugins they define
+	inherited := make(map[string]bool)
+	plugins := make(map[string]Plugin)
+	_, incNode := mapValue(top, "include")
+	for i, inc := range c.Include {
+		n := incNode
+		if incNode != nil && i < len(incNode.Content) {
+			n = incNode.Content[i]
+		}
+		if !filepath.IsAbs(inc) {
+			inc = filepath.Join(filepath.Dir(path), inc)
+		}
+		incProblems, err := validate(inc, projectRoot, vars, append(stack, abs))
+		if err != nil {
+			problems = append(problems, at(n, fmt.Sprintf("include %s: %v", c.Include[i], err)))
+			continue
+		}
+		for _, p := range incProblems {
+			problems = append(problems, at(n, fmt.Sprintf("%s:%s", c.Include[i], p)))
+		}
+		if len(incProblems) > 0 {
+			continue
+		}
+		ic, err := LoadVars(inc, vars)
+		if err != nil {
+			problems = append(problems, at(n, fmt.Sprintf("include %s: %v", c.Include[i], err)))
+			continue
+		}
+		for _, d := range ic.Documents {
+			inherited[d.Name] = true
+		}
+		for name, p := range ic.Plugins {
+			plugins[strings.ToLower(name)] = p
+		}
+	}
+	for name, p := range c.Plugins {
+		plugins[strings.ToLower(name)] = p
+	}
+
+	_, docsNode := mapValue(top, "documents")
+	if (docsNode == nil || len(docsNode.Content) == 0) && len(c.Include) == 0 {
+		return append(problems, at(top, "no documents defined")), nil
+	}
+	if docsNode == nil {
+		docsNode = &yaml.Node{}
+	}
+	switch strings.ToLower(c.OutputBase) {
+	case "", "cwd", "config":
+	default:
+		_, n := mapValue(top, "outputBase")
+		problems = append(problems, at(n, fmt.Sprintf("invalid outputBase %q (expected cwd or config)", c.OutputBase)))
+	}
+	switch strings.ToLower(strings.TrimSpace(c.WalkBackend)) {
+	case "", "std", "batched":
+	default:
+		_, n := mapValue(top, "walkBackend")
+		problems = append(problems, at(n, fmt.Sprintf("invalid walkBackend %q (expected std or batched)", c.WalkBackend)))
+	}
+	if p, ok := checkSnapshot(top, c.ConfigSnapshot); !ok {
+		problems = append(problems, p)
+	}
+	if c.LicensePolicy != nil {
+		_, n := mapValue(top, "licensePolicy")
+		problems = append(problems, checkLicensePolicy(n, *c.LicensePolicy)...)
+	}
+	if _, n := mapValue(top, "vars"); n != nil {
+		problems = append(problems, checkVarNames(n)...)
+	}
+	if len(c.Redact) > 0 {
+		_, n := mapValue(top, "redact")
+		problems = append(problems, checkRedact(n, c.Redact)...)
+	}
+	if len(c.CommentSyntaxes) > 0 {
+		_, n := mapValue(top, "commentSyntaxes")
+		problems = append(problems, checkCommentSyntaxes(n, c.CommentSyntaxes)...)
+	}
+	if c.LLM != nil {
+		_, n := mapValue(top, "llm")
+		problems = append(problems, checkLLM(n, *c.LLM)...)
+	}
+	if len(c.Plugins) > 0 {
+		_, n := mapValue(top, "plugins")
+		problems = append(problems, checkPlugins(n, c.Plugins)...)
+	}
+	if len(c.Pricing) > 0 {
+		_, n := mapValue(top, "pricing")
+		for i := 0; n != nil && i+1 < len(n.Content); i += 2 {
+			if name := n.Content[i].Value; c.Pricing[name] < 0 {
+				problems = append(problems, at(n.Content[i+1], fmt.Sprintf("pricing: invalid price %v for %s (expected USD per million input tokens)", c.Pricing[name], name)))
+			}
+		}
+	}
+
+	outputs := make(map[string]*yaml.Node)
+	names := make(map[string]*yaml.Node)
+	for i, dn := range docsNode.Content {
+		var doc Document
+		if i < len(c.Documents) {
+			doc = c.Documents[i]
+		}
+
+		if doc.Name != "" {
+			_, n := mapValue(dn, "name")
+			if prev, dup := names[doc.Name]; dup {
+				problems = append(problems, at(n, fmt.Sprintf("duplicate document name %q (first defined at line %d)", doc.Name, prev.Line)))
+			} else {
+				names[doc.Name] = n
+			}
+		}
+		// an extending document may take its outputs and sources from the base
+		extends := doc.Extends != ""
+		if extends {
+			_, earlier := names[doc.Extends]
+			if doc.Extends == doc.Name {
+				earlier = false
+			}
+			if !earlier && !inherited[doc.Extends] {
+				_, n := mapValue(dn, "extends")
+				problems = append(problems, at(n, fmt.Sprintf("extends unknown document %q", doc.Extends)))
+			}
+		}
+
+		_, on := mapValue(dn, "outputPath")
+		_, osn := mapValue(dn, "outputs")
+		checkOutput := func(path, format string, pn, fn *yaml.Node, pathKey, formatKey string) {
+			if path != "-" {
+				key := filepath.Clean(path)
+				if prev, dup := outputs[key]; dup {
+					problems = append(problems, at(pn, fmt.Sprintf("%s %q conflicts with the document at line %d", pathKey, path, prev.Line)))
+				} else {
+					outputs[key] = pn
+				}
+			}
+			if f := strings.ToLower(strings.TrimSpace(format)); f != "" && !contains(OutputFormats, f) {
+				problems = append(problems, at(fn, fmt.Sprintf("invalid %s %q (expected one of %s)", formatKey, format, strings.Join(OutputFormats, ", "))))
+			}
+		}
+		switch {
+		case len(doc.Outputs) > 0:
+			if doc.OutputPath != "" || doc.OutputFormat != "" {
+				problems = append(problems, at(osn, "outputs replaces outputPath and outputFormat; set only one of them"))
+			}
+			for j, o := range doc.Outputs {
+				var item *yaml.Node
+				if osn != nil && j < len(osn.Content) {
+					item = osn.Content[j]
+				}
+				_, pn := mapValue(item, "path")
+				_, fn := mapValue(item, "format")
+				if strings.TrimSpace(o.Path) == "" {
+					problems = append(problems, at(item, "output is missing path"))
+					continue
+				}
+				checkOutput(o.Path, o.Format, pn, fn, "path", "format")
+			}
+		case strings.TrimSpace(doc.OutputPath) == "":
+			if !extends {
+				problems = append(problems, at(dn, "document is missing outputPath"))
+			}
+		default:
+			_, fn := mapValue(dn, "outputFormat")
+			checkOutput(doc.OutputPath, doc.OutputFormat, on, fn, "outputPath", "outputFormat")
+		}
+
+		if _, err := SplitLimit(doc.SplitBy, doc.SplitSize); err != nil {
+			key := "splitSize"
+			if !contains(SplitUnits, strings.ToLower(doc.SplitBy)) {
+				key = "splitBy"
+			}
+			_, n := mapValue(dn, key)
+			if n == nil {
+				n = dn
+			}
+			problems = append(problems, at(n, err.Error()))
+		}
+
+		if len(doc.Pipeline) > 0 {
+			_, n := mapValue(dn, "pipeline")
+			problems = append(problems, checkPipeline(n, doc.Pipeline)...)
+		}
+
+		if doc.PostProcessTimeout != "" {
+			if _, err := time.ParseDuration(doc.PostProcessTimeout); err != nil {
+				_, vn := mapValue(dn, "postProcessTimeout")
+				problems = append(problems, at(vn, fmt.Sprintf("invalid postProcessTimeout %q", doc.PostProcessTimeout)))
+			}
+		}
+
+		if len(doc.AnonymizeTerms) > 0 && !doc.Anonymize && !hasStage(doc.Pipeline, "anonymize") {
+			_, n := mapValue(dn, "anonymizeTerms")
+			problems = append(problems, at(n, "anonymizeTerms needs anonymize: true"))
+		}
+
+		if p, ok := checkSnapshot(dn, doc.ConfigSnapshot); !ok {
+			problems = append(problems, p)
+		}
+		if _, err := doc.FileMode(); err != nil {
+			_, vn := mapValue(dn, "outputMode")
+			problems = append(problems, at(vn, err.Error()))
+		}
+		if doc.ChunkSize < 0 || doc.ChunkOverlap < 0 {
+			_, vn := mapValue(dn, "chunkSize")
+			if doc.ChunkSize >= 0 {
+				_, vn = mapValue(dn, "chunkOverlap")
+			}
+			problems = append(problems, at(vn, "chunkSize and chunkOverlap must not be negative"))
+		}
+		switch strings.ToLower(doc.Order) {
+		case "", "path", "size", "modtime", "priority":
+		default:
+			_, vn := mapValue(dn, "order")
+			problems = append(problems, at(vn, fmt.Sprintf("invalid order %q (expected path, size, modtime or priority)", doc.Order)))
+		}
+		switch sort := strings.ToLower(doc.Sort); sort {
+		case "", "lexical", "natural", "size", "modtime":
+			if order := strings.ToLower(doc.Order); (order == "size" || order == "modtime") && sort != "" && sort != order {
+				_, vn := mapValue(dn, "sort")
+				problems = append(problems, at(vn, fmt.Sprintf("sort %q conflicts with order %q", doc.Sort, doc.Order)))
+			}
+		default:
+			_, vn := mapValue(dn, "sort")
+			problems = append(problems, at(vn, fmt.Sprintf("invalid sort %q (expected lexical, natural, size or modtime)", doc.Sort)))
+		}
+		switch strings.ToLower(doc.FailurePolicy) {
+		case "", "abortall", "continue", "retry":
+		default:
+			_, vn := mapValue(dn, "failurePolicy")
+			problems = append(problems, at(vn, fmt.Sprintf("invalid failurePolicy %q (expected abortAll, continue or retry)", doc.FailurePolicy)))
+		}
+		if doc.HeadingLevel < 0 || doc.HeadingLevel > 6 {
+			_, vn := mapValue(dn, "headingLevel")
+			problems = append(problems, at(vn, fmt.Sprintf("invalid headingLevel %d (expected 1 to 6)", doc.HeadingLevel)))
+		}
+		switch strings.ToLower(doc.PathStyle) {
+		case "", "relative", "absolute", "basename":
+		default:
+			_, vn := mapValue(dn, "pathStyle")
+			problems = append(problems, at(vn, fmt.Sprintf("invalid pathStyle %q (expected relative, absolute or basename)", doc.PathStyle)))
+		}
+		if _, vn := mapValue(dn, "vars"); vn != nil {
+			problems = append(problems, checkVarNames(vn)...)
+		}
+		switch strings.ToLower(doc.PathSeparator) {
+		case "", "slash", "native":
+		default:
+			_, vn := mapValue(dn, "pathSeparator")
+			problems = append(problems, at(vn, fmt.Sprintf("invalid pathSeparator %q (expected slash or native)", doc.PathSeparator)))
+		}
+		if strings.HasPrefix(doc.ChangedSince, "-") {
+			_, vn := mapValue(dn, "changedSince")
+			problems = append(problems, at(vn, fmt.Sprintf("invalid changedSince %q (expected a git ref, not an option)", doc.ChangedSince)))
+		}
+
+		if strings.TrimSpace(doc.FilesFrom) == "-" {
+			_, vn := mapValue(dn, "filesFrom")
+			problems = append(problems, at(vn, `filesFrom cannot read stdin (use generate -files-from -)`))
+		}
+
+		if doc.LicensePolicy != nil {
+			_, n := mapValue(dn, "licensePolicy")
+			problems = append(problems, checkLicensePolicy(n, *doc.LicensePolicy)...)
+		}
+
+		if doc.Assertions != nil {
+			_, n := mapValue(dn, "assertions")
+			problems = append(problems, checkAssertions(n, *doc.Assertions)...)
+		}
+
+		if doc.Hooks != nil {
+			_, hn := mapValue(dn, "hooks")
+			for _, hook := range []struct {
+				key  string
+				cmds []string
+			}{{"preGenerate", doc.Hooks.PreGenerate}, {"postGenerate", doc.Hooks.PostGenerate}} {
+				_, ln := mapValue(hn, hook.key)
+				for i, c := range hook.cmds {
+					if strings.TrimSpace(c) == "" {
+						var item *yaml.Node
+						if ln != nil && i < len(ln.Content) {
+							item = ln.Content[i]
+						}
+						problems = append(problems, at(item, fmt.Sprintf("empty %s hook", hook.key)))
+					}
+				}
+			}
+		}
+
+		if len(doc.Redact) > 0 {
+			_, n := mapValue(dn, "redact")
+			problems = append(problems, checkRedact(n, doc.Redact)...)
+		}
+
+		_, srcsNode := mapValue(dn, "sources")
+		if srcsNode == nil || len(srcsNode.Content) == 0 {
+			if !extends {
+				problems = append(problems, at(dn, "document has no sources"))
+			}
+			continue
+		}
+		ids := make(map[string]*yaml.Node)
+		for j, sn := range srcsNode.Content {
+			var src Source
+			if j < len(doc.Sources) {
+				src = doc.Sources[j]
+			}
+			if id := strings.TrimSpace(src.ID); id != "" {
+				_, n := mapValue(sn, "id")
+				if prev, dup := ids[id]; dup {
+					problems = append(problems, at(n, fmt.Sprintf("duplicate source id %q (first defined at line %d)", id, prev.Line)))
+				} else {
+					ids[id] = n
+				}
+			}
+			problems = append(problems, checkSource(sn, src, projectRoot, plugins)...)
+			// an included file may configure the endpoint
+			if src.Summarize && c.LLM == nil && len(c.Include) == 0 {
+				_, n := mapValue(sn, "summarize")
+				problems = append(problems, at(n, "summarize needs an llm endpoint configured at the top level"))
+			}
+		}
+	}
+
+	// documents composed of others: unknown names first, then cycles, which
+	// can only be followed through the documents of this file
+	local := true
+	for i, dn := range docsNode.Content {
+		if i >= len(c.Documents) {
+			break
+		}
+		_, srcsNode := mapValue(dn, "sources")
+		for j, src := range c.Documents[i].Sources {
+			name := strings.TrimSpace(src.Document)
+			if !isDocumentSource(src) || name == "" {
+				continue
+			}
+			if _, ok := names[name]; ok {
+				continue
+			}
+			local = false
+			if !inherited[name] {
+				var sn *yaml.Node
+				if srcsNode != nil && j < len(srcsNode.Content) {
+					sn = srcsNode.Content[j]
+				}
+				_, vn := mapValue(sn, "document")
+				problems = append(problems, at(vn, fmt.Sprintf("document source names unknown document %q", name)))
+			}
+		}
+	}
+	for i, dn := range docsNode.Content {
+		if !local || i >= len(c.Documents) {
+			break
+		}
+		if _, err := c.ComposedSources(c.Documents[i]); err != nil {
+			_, sn := mapValue(dn, "sources")
+			problems = append(problems, at(sn, err.Error()))
+		}
+	}
+
+	_, profNode := mapValue(top, "profiles")
+	profiles := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		profiles = append(profiles, name)
+	}
+	slices.Sort(profiles)
+	for _, name := range profiles {
+		p := c.Profiles[name]
+		_, pn := mapValue(profNode, name)
+		for _, key := range []string{"documents", "skip"} {
+			list := p.Documents
+			if key == "skip" {
+				list = p.Skip
+			}
+			_, ln := mapValue(pn, key)
+			for i, d := range list {
+				if _, ok := names[d]; ok || inherited[d] {
+					continue
+				}
+				var item *yaml.Node
+				if ln != nil && i < len(ln.Content) {
+					item = ln.Content[i]
+				}
+				problems = append(problems, at(item, fmt.Sprintf("profile %q: unknown document %q", name, d)))
+			}
+		}
+	}
+	return problems, nil
+}
+
+func checkCommentSyntaxes(n *yaml.Node, syntaxes []CommentSyntax) []Problem {
+	var problems []Problem
+	for i, syn := range syntaxes {
+		var item *yaml.Node
+		if n != nil && i < len(n.Content) {
+			item = n.Content[i]
+		}
+		if len(syn.Extensions) == 0 {
+			problems = append(problems, at(item, "comment syntax is missing extensions"))
+		}
+		if len(syn.Line) == 0 && len(syn.Block) == 0 {
+			problems = append(problems, at(item, "comment syntax needs line or block markers"))
+		}
+		_, bn := mapValue(item, "block")
+		for j, b := range syn.Block {
+			if len(strings.Fields(b)) != 2 {
+				var bi *yaml.Node
+				if bn != nil && j < len(bn.Content) {
+					bi = bn.Content[j]
+				}
+				problems = append(problems, at(bi, fmt.Sprintf("invalid block %q (expected \"<open> <close>\", e.g. \"/* */\")", b)))
+			}
+		}
+	}
+	return problems
+}
+
+func checkLLM(n *yaml.Node, l LLM) []Problem {
+	var problems []Problem
+	if u, err := url.Parse(l.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		vn := n
+		if _, bn := mapValue(n, "baseURL"); bn != nil {
+			vn = bn
+		}
+		problems = append(problems, at(vn, fmt.Sprintf("invalid llm baseURL %q (expected an http or https URL)", l.BaseURL)))
+	}
+	if strings.TrimSpace(l.Model) == "" {
+		problems = append(problems, at(n, "llm is missing model"))
+	}
+	if l.Timeout != "" {
+		if _, err := time.ParseDuration(l.Timeout); err != nil {
+			_, vn := mapValue(n, "timeout")
+			problems = append(problems, at(vn, fmt.Sprintf("invalid timeout %q", l.Timeout)))
+		}
+	}
+	if l.MaxTokens < 0 {
+		_, vn := mapValue(n, "maxTokens")
+		problems = append(problems, at(vn, "maxTokens must not be negative"))
+	}
+	return problems
+}
+
+// transformOptions lists the options each transform takes.
+var transformOptions = map[string][]string{
+	"truncate":      {"lines", "bytes"},
+	"redactSecrets": {"rules"},
+}
+
+// checkTransforms reports unknown transforms and options, and invalid
+// option values.
+func checkTransforms(n *yaml.Node, ts []Transform) []Problem {
+	var problems []Problem
+	for i, t := range ts {
+		var tn *yaml.Node
+		if n != nil && i < len(n.Content) {
+			tn = n.Content[i]
+		}
+		if !contains(TransformNames, t.Name) {
+			problems = append(problems, at(tn, fmt.Sprintf("unknown transform %q (expected one of %s)", t.Name, strings.Join(TransformNames, ", "))))
+			continue
+		}
+		for _, key := range sortedOptionKeys(t.Options) {
+			if !contains(transformOptions[t.Name], key) {
+				problems = append(problems, at(tn, fmt.Sprintf("transform %s has no option %q", t.Name, key)))
+			}
+		}
+		switch t.Name {
+		case "truncate":
+			lines, hasLines := t.Options["lines"]
+			size, hasBytes := t.Options["bytes"]
+			if !hasLines && !hasBytes {
+				problems = append(problems, at(tn, "transform truncate needs lines or bytes"))
+			}
+			if n, ok := lines.(int); hasLines && (!ok || n <= 0) {
+				problems = append(problems, at(tn, fmt.Sprintf("transform truncate: invalid lines %v (expected a positive number)", lines)))
+			}
+			if hasBytes {
+				if v, err := ParseSize(fmt.Sprint(size)); err != nil || v <= 0 {
+					problems = append(problems, at(tn, fmt.Sprintf("transform truncate: invalid bytes %v (expected a size such as \"64KB\")", size)))
+				}
+			}
+		case "redactSecrets":
+			rules, ok := t.Options["rules"].([]any)
+			if _, set := t.Options["rules"]; set && !ok {
+				problems = append(problems, at(tn, "transform redactSecrets: rules must be a list of built-in rule names"))
+			}
+			for _, r := range rules {
+				if name, _ := r.(string); name != "builtin" && !contains(redact.BuiltinNames(), name) {
+					problems = append(problems, at(tn, fmt.Sprintf("transform redactSecrets: unknown rule %v (expected builtin or one of %s)", r, strings.Join(redact.BuiltinNames(), ", "))))
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// sortedOptionKeys returns the keys of a transform's options, sorted.
+func sortedOptionKeys(options map[string]any) []string {
+	keys := make([]string, 0, len(options))
+	for k := range options {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// checkAuth reports credentials that are incomplete or mix a token with
+// basic auth.
+func checkAuth(n *yaml.Node, a Auth) []Problem {
+	var problems []Problem
+	basic := a.Username != "" || a.PasswordEnv != ""
+	switch {
+	case a.TokenEnv != "" && basic:
+		problems = append(problems, at(n, "auth sets both tokenEnv and basic auth (username, passwordEnv)"))
+	case a.TokenEnv == "" && !basic:
+		problems = append(problems, at(n, "auth is missing tokenEnv or username"))
+	case basic && a.Username == "":
+		problems = append(problems, at(n, "auth is missing username"))
+	}
+	if a.Header != "" && a.TokenEnv == "" {
+		_, hn := mapValue(n, "header")
+		problems = append(problems, at(hn, "auth header needs tokenEnv"))
+	}
+	for _, key := range []struct{ name, value string }{{"tokenEnv", a.TokenEnv}, {"passwordEnv", a.PasswordEnv}} {
+		if key.value != "" && !varNameRe.MatchString(key.value) {
+			_, vn := mapValue(n, key.name)
+			problems = append(problems, at(vn, fmt.Sprintf("invalid %s %q (expected an environment variable name)", key.name, key.value)))
+		}
+	}
+	return problems
+}
+
+// checkPlugins reports plugins that would shadow a built-in source type,
+// lack cmd or have an invalid timeout.
+func checkPlugins(n *yaml.Node, plugins map[string]Plugin) []Problem {
+	var problems []Problem
+	for _, name := range pluginNames(plugins) {
+		p := plugins[name]
+		kn, pn := mapValue(n, name)
+		switch {
+		case !pluginNameRe.MatchString(name):
+			problems = append(problems, at(kn, fmt.Sprintf("invalid plugin name %q (expected lowercase letters, digits and dashes)", name)))
+		case contains(SourceTypes, name):
+			problems = append(problems, at(kn, fmt.Sprintf("plugin %q shadows the built-in source type", name)))
+		}
+		if strings.TrimSpace(p.Cmd) == "" {
+			problems = append(problems, at(pn, fmt.Sprintf("plugin %q is missing cmd", name)))
+		}
+		if p.Timeout != "" {
+			if _, err := time.ParseDuration(p.Timeout); err != nil {
+				_, vn := mapValue(pn, "timeout")
+				problems = append(problems, at(vn, fmt.Sprintf("invalid timeout %q", p.Timeout)))
+			}
+		}
+	}
+	return problems
+}
+
+// pluginNames returns the names of plugins, sorted.
+func pluginNames(plugins map[string]Plugin) []string {
+	names := make([]string, 0, len(plugins))
+	for name := range plugins {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// pluginNameRe matches the names plugins may register as source types.
+var pluginNameRe = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+func checkSource(n *yaml.Node, src Source, projectRoot string, plugins map[string]Plugin) []Problem {
+	var problems []Problem
+	_, tn := mapValue(n, "type")
+	kind := strings.ToLower(strings.TrimSpace(src.Type))
+	_, plugin := plugins[kind]
+	switch {
+	case kind == "":
+		return append(problems, at(n, "source is missing type"))
+	case !contains(SourceTypes, kind) && !plugin:
+		types := slices.Clone(SourceTypes)
+		for _, name := range pluginNames(plugins) {
+			if !contains(types, name) {
+				types = append(types, name)
+			}
+		}
+		return append(problems, at(tn, fmt.Sprintf("invalid source type %q (expected one of %s)", src.Type, strings.Join(types, ", "))))
+	}
+	if len(src.Params) > 0 && !plugin {
+		_, pn := mapValue(n, "params")
+		problems = append(problems, at(pn, fmt.Sprintf("params is only used by plugin source types, not %q", src.Type)))
+	}
+	if src.Root != "" {
+		_, rn := mapValue(n, "root")
+		switch {
+		case plugin || contains([]string{"template", "command", "url", "git-log", "deps", "dirdiff", "document"}, kind):
+			problems = append(problems, at(rn, fmt.Sprintf("root is only used by sources that scan sourcePaths, not %q", src.Type)))
+		default:
+			// sourcePaths are checked below the root
+			projectRoot = src.RootDir(projectRoot)
+			if info, err := os.Stat(projectRoot); err != nil || !info.IsDir() {
+				// its sourcePaths cannot be checked
+				return append(problems, at(rn, fmt.Sprintf("root %q is not a directory", src.Root)))
+			}
+		}
+	}
+
+	if len(src.Transforms) > 0 {
+		_, tsn := mapValue(n, "transforms")
+		problems = append(problems, checkTransforms(tsn, src.Transforms)...)
+	}
+	if src.Auth != nil && kind != "url" {
+		_, an := mapValue(n, "auth")
+		problems = append(problems, at(an, fmt.Sprintf("auth is only used by url sources, not %q", src.Type)))
+	}
+
+	if plugin {
+		for _, key := range []struct{ name, value string }{{"timeout", src.Timeout}, {"cacheTTL", src.CacheTTL}} {
+			if key.value == "" {
+				continue
+			}
+			if _, err := time.ParseDuration(key.value); err != nil {
+				_, vn := mapValue(n, key.name)
+				problems = append(problems, at(vn, fmt.Sprintf("invalid %s %q", key.name, key.value)))
+			}
+		}
+		return problems
+	}
+
+	if kind == "command" {
+		if strings.TrimSpace(src.Cmd) == "" {
+			problems = append(problems, at(n, "command source is missing cmd"))
+		}
+		for _, key := range []struct{ name, value string }{{"timeout", src.Timeout}, {"cacheTTL", src.CacheTTL}} {
+			if key.value == "" {
+				continue
+			}
+			if _, err := time.ParseDuration(key.value); err != nil {
+				_, vn := mapValue(n, key.name)
+				problems = append(problems, at(vn, fmt.Sprintf("invalid %s %q", key.name, key.value)))
+			}
+		}
+		switch strings.ToLower(src.OnError) {
+		case "", "fail", "skip", "stderr":
+		default:
+			_, vn := mapValue(n, "onError")
+			problems = append(problems, at(vn, fmt.Sprintf("invalid onError %q (expected fail, skip or stderr)", src.OnError)))
+		}
+		return problems
+	}
+
+	if kind == "url" {
+		_, un := mapValue(n, "urls")
+		if len(src.URLs) == 0 {
+			problems = append(problems, at(n, "url source is missing urls"))
+		}
+		for i, raw := range src.URLs {
+			var item *yaml.Node
+			if un != nil && i < len(un.Content) {
+				item = un.Content[i]
+			}
+			u, err := url.Parse(raw)
+			switch {
+			case err != nil:
+				problems = append(problems, at(item, "invalid url (expected http or https)"))
+			case u.Scheme != "http" && u.Scheme != "https" || u.Host == "":
+				problems = append(problems, at(item, fmt.Sprintf("invalid url %q (expected http or https)", u.Redacted())))
+			case u.User != nil:
+				if _, ok := u.User.Password(); ok {
+					problems = append(problems, at(item, fmt.Sprintf("url %q embeds a password (use auth with passwordEnv)", u.Redacted())))
+				}
+			}
+		}
+		if src.Auth != nil {
+			_, an := mapValue(n, "auth")
+			problems = append(problems, checkAuth(an, *src.Auth)...)
+		}
+		for _, key := range []struct{ name, value string }{{"timeout", src.Timeout}, {"cacheTTL", src.CacheTTL}} {
+			if key.value == "" {
+				continue
+			}
+			if _, err := time.ParseDuration(key.value); err != nil {
+				_, vn := mapValue(n, key.name)
+				problems = append(problems, at(vn, fmt.Sprintf("invalid %s %q", key.name, key.value)))
+			}
+		}
+		if src.Retries < 0 {
+			_, vn := mapValue(n, "retries")
+			problems = append(problems, at(vn, "retries must not be negative"))
+		}
+		return problems
+	}
+
+	if kind == "git-log" {
+		if src.Commits < 0 {
+			_, vn := mapValue(n, "commits")
+			problems = append(problems, at(vn, "commits must not be negative"))
+		}
+		if strings.HasPrefix(src.Revisions, "-") {
+			_, vn := mapValue(n, "revisions")
+			problems = append(problems, at(vn, fmt.Sprintf("invalid revisions %q (expected a revision range, not an option)", src.Revisions)))
+		}
+		switch strings.ToLower(src.LogFormat) {
+		case "", "oneline", "full":
+		default:
+			_, vn := mapValue(n, "logFormat")
+			problems = append(problems, at(vn, fmt.Sprintf("invalid logFormat %q (expected oneline or full)", src.LogFormat)))
+		}
+		return problems
+	}
+
+	if kind == "deps" {
+		switch strings.ToLower(src.Graph) {
+		case "", "packages", "modules":
+		default:
+			_, vn := mapValue(n, "graph")
+			problems = append(problems, at(vn, fmt.Sprintf("invalid graph %q (expected packages or modules)", src.Graph)))
+		}
+		switch strings.ToLower(src.GraphFormat) {
+		case "", "text", "mermaid":
+		default:
+			_, vn := mapValue(n, "graphFormat")
+			problems = append(problems, at(vn, fmt.Sprintf("invalid graphFormat %q (expected text or mermaid)", src.GraphFormat)))
+		}
+		return problems
+	}
+
+	if kind == "db-schema" && src.DSNEnv != "" {
+		if len(src.SourcePaths) > 0 {
+			_, vn := mapValue(n, "sourcePaths")
+			problems = append(problems, at(vn, "db-schema source takes either dsnEnv or sourcePaths, not both"))
+		}
+		if src.Timeout != "" {
+			if _, err := time.ParseDuration(src.Timeout); err != nil {
+				_, vn := mapValue(n, "timeout")
+				problems = append(problems, at(vn, fmt.Sprintf("invalid timeout %q", src.Timeout)))
+			}
+		}
+		return problems
+	}
+
+	if kind == "document" {
+		if strings.TrimSpace(src.Document) == "" {
+			problems = append(problems, at(n, "document source is missing document"))
+		}
+		return problems
+	}
+
+	if kind == "template" {
+		if strings.TrimSpace(src.Text) == "" {
+			problems = append(problems, at(n, "template source is missing text"))
+		}
+		return problems
+	}
+
+	if kind == "dirdiff" {
+		for _, side := range []struct{ key, value string }{{"left", src.Left}, {"right", src.Right}} {
+			_, vn := mapValue(n, side.key)
+			p := strings.TrimSpace(side.value)
+			if p == "" {
+				problems = append(problems, at(n, fmt.Sprintf("dirdiff source is missing %s", side.key)))
+				continue
+			}
+			full := p
+			if !filepath.IsAbs(full) {
+				full = filepath.Join(projectRoot, p)
+			}
+			if info, err := os.Stat(full); err != nil || !info.IsDir() {
+				problems = append(problems, at(vn, fmt.Sprintf("%s %q is not a directory", side.key, p)))
+			}
+		}
+		problems = append(problems, checkFilePattern(n, src)...)
+		if _, err := match.Compile(src.ExcludePaths); err != nil {
+			_, vn := mapValue(n, "excludePaths")
+			problems = append(problems, at(vn, err.Error()))
+		}
+		return problems
+	}
+
+	if src.FilterTimeout != "" {
+		if _, err := time.ParseDuration(src.FilterTimeout); err != nil {
+			_, vn := mapValue(n, "filterTimeout")
+			problems = append(problems, at(vn, fmt.Sprintf("invalid filterTimeout %q", src.FilterTimeout)))
+		}
+	}
+	switch strings.ToLower(src.FilterOnError) {
+	case "", "fail", "skip", "raw":
+	default:
+		_, vn := mapValue(n, "filterOnError")
+		problems = append(problems, at(vn, fmt.Sprintf("invalid filterOnError %q (expected fail, skip or raw)", src.FilterOnError)))
+	}
+
+	if _, err := ParseSize(src.MaxFileSize); err != nil {
+		_, vn := mapValue(n, "maxFileSize")
+		problems = append(problems, at(vn, err.Error()))
+	}
+	switch strings.ToLower(src.OversizePolicy) {
+	case "", "truncate", "skip", "fail":
+	default:
+		_, vn := mapValue(n, "oversizePolicy")
+		problems = append(problems, at(vn, fmt.Sprintf("invalid oversizePolicy %q (expected truncate, skip or fail)", src.OversizePolicy)))
+	}
+	if src.Encoding != "" && !contains(Encodings, strings.ToLower(src.Encoding)) {
+		_, vn := mapValue(n, "encoding")
+		problems = append(problems, at(vn, fmt.Sprintf("invalid encoding %q (expected one of %s)", src.Encoding, strings.Join(Encodings, ", "))))
+	}
+	if src.InvalidUTF8Policy != "" && !contains(InvalidUTF8Policies, strings.ToLower(src.InvalidUTF8Policy)) {
+		_, vn := mapValue(n, "invalidUTF8Policy")
+		problems = append(problems, at(vn, fmt.Sprintf("invalid invalidUTF8Policy %q (expected convert, replace or skip)", src.InvalidUTF8Policy)))
+	}
+	switch strings.ToLower(src.OnError) {
+	case "", "fail", "skip", "placeholder":
+	default:
+		_, vn := mapValue(n, "onError")
+		problems = append(problems, at(vn, fmt.Sprintf("invalid onError %q (expected fail, skip or placeholder)", src.OnError)))
+	}
+	if e := strings.ToLower(src.Entrypoints); e != "" && e != "first" {
+		_, vn := mapValue(n, "entrypoints")
+		problems = append(problems, at(vn, fmt.Sprintf("invalid entrypoints %q (expected first)", src.Entrypoints)))
+	}
+	switch strings.ToLower(src.Core) {
+	case "", "first", "only":
+	default:
+		_, vn := mapValue(n, "core")
+		problems = append(problems, at(vn, fmt.Sprintf("invalid core %q (expected first or only)", src.Core)))
+	}
+	if r := strings.ToLower(src.Rank); r != "" && r != "auto" {
+		_, vn := mapValue(n, "rank")
+		problems = append(problems, at(vn, fmt.Sprintf("invalid rank %q (expected auto)", src.Rank)))
+	}
+	if src.RankTop < 0 {
+		_, vn := mapValue(n, "rankTop")
+		problems = append(problems, at(vn, "rankTop must not be negative"))
+	} else if src.RankTop > 0 && !strings.EqualFold(src.Rank, "auto") {
+		_, vn := mapValue(n, "rankTop")
+		problems = append(problems, at(vn, "rankTop needs rank: auto"))
+	}
+	switch strings.ToLower(src.ContentMode) {
+	case "", "full", "reference":
+	default:
+		_, vn := mapValue(n, "contentMode")
+		problems = append(problems, at(vn, fmt.Sprintf("invalid contentMode %q (expected full or reference)", src.ContentMode)))
+	}
+	if src.MaxLineLength < 0 {
+		_, vn := mapValue(n, "maxLineLength")
+		problems = append(problems, at(vn, "maxLineLength must not be negative"))
+	}
+	switch strings.ToLower(src.LongLinePolicy) {
+	case "", "wrap", "truncate", "flag":
+	default:
+		_, vn := mapValue(n, "longLinePolicy")
+		problems = append(problems, at(vn, fmt.Sprintf("invalid longLinePolicy %q (expected wrap, truncate or flag)", src.LongLinePolicy)))
+	}
+
+	problems = append(problems, checkFilePattern(n, src)...)
+	if _, err := match.Compile(src.ExcludePaths); err != nil {
+		_, vn := mapValue(n, "excludePaths")
+		problems = append(problems, at(vn, err.Error()))
+	}
+	if _, err := match.Compile(src.TreeExclude); err != nil {
+		_, vn := mapValue(n, "treeExclude")
+		problems = append(problems, at(vn, err.Error()))
+	}
+	_, an := mapValue(n, "authors")
+	for i, a := range src.Authors {
+		if strings.TrimSpace(a) == "" {
+			var item *yaml.Node
+			if an != nil && i < len(an.Content) {
+				item = an.Content[i]
+			}
+			problems = append(problems, at(item, "empty author"))
+		}
+	}
+	if src.ModifiedWithin != "" {
+		if _, err := ParseAge(src.ModifiedWithin); err != nil {
+			_, vn := mapValue(n, "modifiedWithin")
+			problems = append(problems, at(vn, "modifiedWithin: "+err.Error()))
+		}
+	}
+	if src.ModifiedAfter != "" {
+		if _, err := ParseDate(src.ModifiedAfter); err != nil {
+			_, vn := mapValue(n, "modifiedAfter")
+			problems = append(problems, at(vn, "modifiedAfter: "+err.Error()))
+		}
+	}
+	switch strings.ToLower(src.ModifiedBy) {
+	case "", "mtime", "git":
+	default:
+		_, vn := mapValue(n, "modifiedBy")
+		problems = append(problems, at(vn, fmt.Sprintf("invalid modifiedBy %q (expected mtime or git)", src.ModifiedBy)))
+	}
+	if src.RecentWithin != "" {
+		if _, err := ParseAge(src.RecentWithin); err != nil {
+			_, vn := mapValue(n, "recentWithin")
+			problems = append(problems, at(vn, "recentWithin: "+err.Error()))
+		}
+	}
+	if _, err := match.Compile(src.GeneratedPatterns); err != nil {
+		_, vn := mapValue(n, "generatedPatterns")
+		problems = append(problems, at(vn, err.Error()))
+	}
+	switch strings.ToLower(src.TreeFormat) {
+	case "", "ascii", "mermaid", "mindmap":
+	default:
+		_, vn := mapValue(n, "treeFormat")
+		problems = append(problems, at(vn, fmt.Sprintf("invalid treeFormat %q (expected ascii, mermaid or mindmap)", src.TreeFormat)))
+	}
+	if src.MaxDepth < 0 {
+		_, vn := mapValue(n, "maxDepth")
+		problems = append(problems, at(vn, "maxDepth must not be negative"))
+	}
+	if src.Largest < 0 {
+		_, vn := mapValue(n, "largest")
+		problems = append(problems, at(vn, "largest must not be negative"))
+	}
+	if src.MaxTokens < 0 {
+		_, vn := mapValue(n, "maxTokens")
+		problems = append(problems, at(vn, "maxTokens must not be negative"))
+	}
+	if _, err := ParseSize(src.MaxBytes); err != nil {
+		_, vn := mapValue(n, "maxBytes")
+		problems = append(problems, at(vn, err.Error()))
+	}
+	switch strings.ToLower(src.TrimBy) {
+	case "", "largest", "oldest", "last":
+	default:
+		_, vn := mapValue(n, "trimBy")
+		problems = append(problems, at(vn, fmt.Sprintf("invalid trimBy %q (expected largest, oldest or last)", src.TrimBy)))
+	}
+	if src.CoverageBelow < 0 || src.CoverageBelow > 100 {
+		_, vn := mapValue(n, "coverageBelow")
+		problems = append(problems, at(vn, fmt.Sprintf("invalid coverageBelow %g (expected a percentage from 0 to 100)", src.CoverageBelow)))
+	}
+	if src.CoverageProfile == "" {
+		for _, key := range []string{"coverageBelow", "sortByCoverage"} {
+			if k, _ := mapValue(n, key); k != nil {
+				problems = append(problems, at(k, key+" needs coverageProfile"))
+			}
+		}
+	}
+	_, rn := mapValue(n, "regions")
+	for i, label := range src.Regions {
+		if !regionLabelRe.MatchString(label) {
+			var item *yaml.Node
+			if rn != nil && i < len(rn.Content) {
+				item = rn.Content[i]
+			}
+			problems = append(problems, at(item, fmt.Sprintf("invalid region label %q (expected letters, digits, _, . and -, or *)", label)))
+		}
+	}
+	_, cvn := mapValue(n, "convert")
+	for i, f := range src.Convert {
+		if !contains(ConvertFormats, strings.ToLower(f)) {
+			var item *yaml.Node
+			if cvn != nil && i < len(cvn.Content) {
+				item = cvn.Content[i]
+			}
+			problems = append(problems, at(item, fmt.Sprintf("invalid convert format %q (expected one of %s)", f, strings.Join(ConvertFormats, ", "))))
+		}
+	}
+	_, tdn := mapValue(n, "treeDetails")
+	for i, f := range src.TreeDetails {
+		if !contains(TreeDetailFields, strings.ToLower(f)) {
+			var item *yaml.Node
+			if tdn != nil && i < len(tdn.Content) {
+				item = tdn.Content[i]
+			}
+			problems = append(problems, at(item, fmt.Sprintf("invalid treeDetails field %q (expected one of %s)", f, strings.Join(TreeDetailFields, ", "))))
+		}
+	}
+	_, fhn := mapValue(n, "fileHeader")
+	for i, f := range src.FileHeader {
+		if !contains(FileHeaderFields, strings.ToLower(f)) {
+			var item *yaml.Node
+			if fhn != nil && i < len(fhn.Content) {
+				item = fhn.Content[i]
+			}
+			problems = append(problems, at(item, fmt.Sprintf("invalid fileHeader field %q (expected one of %s)", f, strings.Join(FileHeaderFields, ", "))))
+		}
+	}
+	problems = append(problems, checkRegexps(n, "contentMatch", src.ContentMatch)...)
+	problems = append(problems, checkRegexps(n, "contentExclude", src.ContentExclude)...)
+
+	_, pn := mapValue(n, "sourcePaths")
+	if pn == nil || len(pn.Content) == 0 {
+		return append(problems, at(n, fmt.Sprintf("%s source is missing sourcePaths", kind)))
+	}
+	for j, item := range pn.Content {
+		value := item.Value
+		if j < len(src.SourcePaths) {
+			// with variables expanded
+			value = src.SourcePaths[j]
+		}
+		p, sel, err := SplitSelector(value)
+		if err != nil {
+			problems = append(problems, at(item, err.Error()))
+			continue
+		}
+		p = strings.TrimSpace(p)
+		if p == "" || p == "*" {
+			continue
+		}
+		if sel != nil && strings.ContainsAny(p, "*?[") {
+			problems = append(problems, at(item, fmt.Sprintf("%q: line ranges and symbols need a file path, not a glob", value)))
+			continue
+		}
+		full := p
+		if !filepath.IsAbs(full) {
+			full = filepath.Join(projectRoot, p)
+		}
+		if strings.Contains(p, "**") {
+			// expanded by walking; only the directory before the globs must exist
+			if _, err := match.Compile([]string{p}); err != nil {
+				problems = append(problems, at(item, err.Error()))
+			} else if _, err := os.Stat(filepath.Dir(full[:strings.IndexAny(full, "*?[")] + "x")); err != nil {
+				problems = append(problems, at(item, fmt.Sprintf("sourcePath %q matches nothing", p)))
+			}
+			continue
+		}
+		if strings.ContainsAny(p, "*?[") {
+			matches, err := filepath.Glob(full)
+			if err != nil {
+				problems = append(problems, at(item, fmt.Sprintf("invalid glob %q: %v", p, err)))
+			} else if len(matches) == 0 {
+				problems = append(problems, at(item, fmt.Sprintf("sourcePath %q matches nothing", p)))
+			}
+			continue
+		}
+		if _, err := os.Stat(full); err != nil {
+			problems = append(problems, at(item, fmt.Sprintf("sourcePath %q does not exist", p)))
+		}
+	}
+	return problems
+}
+
+func checkSnapshot(n *yaml.Node, mode string) (Problem, bool) {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "", "none", "appendix", "sidecar":
+		return Problem{}, true
+	}
+	_, vn := mapValue(n, "configSnapshot")
+	return at(vn, fmt.Sprintf("invalid configSnapshot %q (expected appendix, sidecar or none)", mode)), false
+}
+
+func checkLicensePolicy(n *yaml.Node, lp LicensePolicy) []Problem {
+	switch strings.ToLower(lp.Action) {
+	case "", "warn", "fail":
+		return nil
+	}
+	_, vn := mapValue(n, "action")
+	return []Problem{at(vn, fmt.Sprintf("invalid licensePolicy action %q (expected warn or fail)", lp.Action))}
+}
+
+// checkRedact compiles each rule on its own so problems point at the entry.
+func checkPipeline(n *yaml.Node, stages []Stage) []Problem {
+	var problems []Problem
+	anonymize := 0
+	for i, st := range stages {
+		var item *yaml.Node
+		if n != nil && i < len(n.Content) {
+			item = n.Content[i]
+		}
+		_, sn := mapValue(item, "stage")
+		kind := strings.ToLower(strings.TrimSpace(st.Stage))
+		switch kind {
+		case "":
+			problems = append(problems, at(item, "pipeline stage is missing stage"))
+		case "redact":
+			_, rn := mapValue(item, "rules")
+			problems = append(problems, checkRedact(rn, st.Rules)...)
+		case "anonymize":
+			if anonymize++; anonymize == 2 {
+				problems = append(problems, at(sn, "only one anonymize stage is allowed"))
+			}
+		case "command":
+			if strings.TrimSpace(st.Cmd) == "" {
+				problems = append(problems, at(item, "command stage is missing cmd"))
+			}
+			if st.Timeout != "" {
+				if _, err := time.ParseDuration(st.Timeout); err != nil {
+					_, tn := mapValue(item, "timeout")
+					problems = append(problems, at(tn, fmt.Sprintf("invalid timeout %q", st.Timeout)))
+				}
+			}
+		case "replace":
+			_, pn := mapValue(item, "pattern")
+			if st.Pattern == "" {
+				problems = append(problems, at(item, "replace stage is missing pattern"))
+			} else if _, err := regexp.Compile(st.Pattern); err != nil {
+				problems = append(problems, at(pn, fmt.Sprintf("invalid pattern %q: %v", st.Pattern, err)))
+			}
+		case "assert":
+		default:
+			problems = append(problems, at(sn, fmt.Sprintf("invalid stage %q (expected one of %s)", st.Stage, strings.Join(StageTypes, ", "))))
+		}
+	}
+	return problems
+}
+
+func hasStage(stages []Stage, kind string) bool {
+	for _, st := range stages {
+		if strings.EqualFold(strings.TrimSpace(st.Stage), kind) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkRedact(n *yaml.Node, rules []RedactRule) []Problem {
+	var problems []Problem
+	for i, r := range rules {
+		if _, err := redact.New([]redact.Rule{{Name: r.Name, Pattern: r.Pattern}}); err != nil {
+			var item *yaml.Node
+			if n != nil && i < len(n.Content) {
+				item = n.Content[i]
+			}
+			problems = append(problems, at(item, err.Error()))
+		}
+	}
+	return problems
+}
+
+// checkRegexps reports the entries of the list under key that do not compile.
+// checkFilePattern checks a source's filePattern in its patternSyntax.
+func checkFilePattern(n *yaml.Node, src Source) []Problem {
+	if !contains(PatternSyntaxes, strings.ToLower(cmp.Or(src.PatternSyntax, "glob"))) {
+		_, vn := mapValue(n, "patternSyntax")
+		return []Problem{at(vn, fmt.Sprintf("invalid patternSyntax %q (expected %s)", src.PatternSyntax, strings.Join(PatternSyntaxes, " or ")))}
+	}
+	if strings.EqualFold(src.PatternSyntax, "regex") && len(src.FilePattern) > 1 {
+		_, vn := mapValue(n, "filePattern")
+		return []Problem{at(vn, "with patternSyntax regex, filePattern is one regular expression, not a list")}
+	}
+	if _, err := match.CompileFilePattern(src.FilePattern.String(), src.PatternSyntax, src.CaseInsensitive); err != nil {
+		_, vn := mapValue(n, "filePattern")
+		return []Problem{at(vn, err.Error())}
+	}
+	return nil
+}
+
+func checkRegexps(n *yaml.Node, key string, exprs []string) []Problem {
+	var problems []Problem
+	_, ln := mapValue(n, key)
+	for i, expr := range exprs {
+		if _, err := regexp.Compile(expr); err != nil {
+			var item *yaml.Node
+			if ln != nil && i < len(ln.Content) {
+				item = ln.Content[i]
+			}
+			problems = append(problems, at(item, fmt.Sprintf("invalid %s regexp %q: %v", key, expr, err)))
+		}
+	}
+	return problems
+}
+
+func checkAssertions(n *yaml.Node, a Assertions) []Problem {
+	var problems []Problem
+	if _, err := match.Compile(a.Contains); err != nil {
+		_, vn := mapValue(n, "contains")
+		problems = append(problems, at(vn, err.Error()))
+	}
+	problems = append(problems, checkRegexps(n, "notContains", a.NotContains)...)
+	if a.MaxTokens < 0 {
+		_, vn := mapValue(n, "maxTokens")
+		problems = append(problems, at(vn, "maxTokens must not be negative"))
+	}
+	return problems
+}
+
+func contains(list []string, v string) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// validateDir validates every config file of the directory dir and reports
+// document names and output paths used by more than one of them.
+func validateDir(dir, rootOverride string, vars map[string]string, stack []string) ([]Problem, error) {
+	files, err := dirFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	// the files share the project root of the merged config, where the
+	// last projectPath wins
+	if rootOverride == "" {
+		var merged Config
+		for _, f := range files {
+			if c, err := LoadVars(f, vars); err == nil && c.ProjectPath != "" {
+				merged.ProjectPath = c.ProjectPath
+			}
+		}
+		rootOverride = merged.ResolveRoot(dir)
+	}
+	var problems []Problem
+	names, outputs := make(map[string]string), make(map[string]string)
+	for _, f := range files {
+		rel := filepath.Base(f)
+		fileProblems, err := validate(f, rootOverride, vars, stack)
+		if err != nil {
+			problems = append(problems, Problem{Msg: fmt.Sprintf("%s: %v", rel, err)})
+			continue
+		}
+		for _, p := range fileProblems {
+			problems = append(problems, Problem{Msg: fmt.Sprintf("%s:%s", rel, p)})
+		}
+		if len(fileProblems) > 0 {
+			continue
+		}
+		c, err := LoadVars(f, vars)
+		if err != nil {
+			problems = append(problems, Problem{Msg: fmt.Sprintf("%s: %v", rel, err)})
+			continue
+		}
+		for _, d := range c.Documents {
+			if prev, dup := names[d.Name]; dup && d.Name != "" {
+				problems = append(problems, Problem{Msg: fmt.Sprintf("%s: document name %q is also defined in %s", rel, d.Name, prev)})
+			}
+			names[d.Name] = rel
+			for _, t := range d.Targets() {
+				if prev, dup := outputs[t.Path]; dup && t.Path != "-" {
+					problems = append(problems, Problem{Msg: fmt.Sprintf("%s: outputPath %q is also written by %s", rel, t.Path, prev)})
+				}
+				outputs[t.Path] = rel
+			}
+		}
+	}
+	return problems, nil
+}
+
+// strictTOML decodes the parsed TOML document into c and reports type
+// mismatches and unknown keys. Unknown keys are found by a strict decode of
+// the document's YAML form, whose lines differ, so they are reported at the
+// first key of that name.
+func strictTOML(root *yaml.Node, c *Config) []Problem {
+	if len(root.Content) == 0 {
+		return nil
+	}
+	top := root.Content[0]
+	var problems []Problem
+	var te *yaml.TypeError
+	if err := top.Decode(c); errors.As(err, &te) {
+		for _, msg := range te.Errors {
+			problems = append(problems, yamlErrorProblem(msg))
+		}
+	}
+	data, err := yaml.Marshal(top)
+	if err != nil {
+		return append(problems, Problem{Msg: err.Error()})
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(new(Config)); errors.As(err, &te) {
+		for _, msg := range te.Errors {
+			p := yamlErrorProblem(msg)
+			m := unknownFieldRe.FindStringSubmatch(p.Msg)
+			if m == nil {
+				continue
+			}
+			p.Line = keyLine(top, m[1])
+			problems = append(problems, p)
+		}
+	}
+	return problems
+}
+
+var unknownFieldRe = regexp.MustCompile(`^field (\S+) not found in type`)
+
+// keyLine returns the line of the first mapping key named key below n.
+func keyLine(n *yaml.Node, key string) int {
+	if n.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == key {
+				return n.Content[i].Line
+			}
+		}
+	}
+	for _, c := range n.Content {
+		if line := keyLine(c, key); line != 0 {
+			return line
+		}
+	}
+	return 0
+}
+
+// mapValue returns the key and value nodes for key in a mapping node.
+// regionLabelRe matches the labels regions can select (see
+// Source.Regions).
+var regionLabelRe = regexp.MustCompile(`^(?:[\w.-]+|\*)$`)
+
+// checkVarNames reports vars that cannot be referenced as ${NAME}.
+func checkVarNames(n *yaml.Node) []Problem {
+	var problems []Problem
+	for i := 0; n.Kind == yaml.MappingNode && i+1 < len(n.Content); i += 2 {
+		if k := n.Content[i]; !varNameRe.MatchString(k.Value) {
+			problems = append(problems, at(k, fmt.Sprintf("invalid variable name %q (expected letters, digits and _)", k.Value)))
+		}
+	}
+	return problems
+}
+
+func mapValue(n *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i], n.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+func at(n *yaml.Node, msg string) Problem {
+	if n == nil {
+		return Problem{Msg: msg}
+	}
+	return Problem{Line: n.Line, Column: n.Column, Msg: msg}
+}
+
+// yamlErrorProblem extracts the "line N:" prefix yaml.v3 puts on its messages.
+func yamlErrorProblem(msg string) Problem {
+	msg = strings.TrimPrefix(strings.TrimPrefix(msg, "yaml: "), "toml: ")
+	if m := yamlLineRe.FindStringSubmatch(msg); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return Problem{Line: line, Msg: m[2]}
+	}
+	return Problem{Msg: msg}
+}
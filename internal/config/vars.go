@@ -0,0 +1,151 @@
+package config
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// varRe matches ${NAME} and ${NAME:-default}; varNameRe a bare NAME.
+var (
+	varRe     = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+	varNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// expandVars replaces ${NAME} in s with vars[NAME], else the environment
+// variable NAME, else the default given as ${NAME:-default}. Names with
+// none of these are returned in missing.
+func expandVars(s string, vars map[string]string, missing map[string]bool) string {
+	if !strings.Contains(s, "${") {
+		return s
+	}
+	return varRe.ReplaceAllStringFunc(s, func(m string) string {
+		sub := varRe.FindStringSubmatch(m)
+		if v, ok := vars[sub[1]]; ok {
+			return v
+		}
+		if v, ok := os.LookupEnv(sub[1]); ok {
+			return v
+		}
+		if strings.Contains(m, ":-") {
+			return sub[2]
+		}
+		missing[sub[1]] = true
+		return m
+	})
+}
+
+// expand interpolates variables in the values that name files and
+// describe documents: projectPath, include, outputPath, outputs paths, description,
+// sourcePaths, excludePaths and filePattern. Commands and templates are
+// left alone, as ${...} means something else there. A description is also
+// a template seeing the document's variables as .Vars, like template
+// sources: "Context for {{.Vars.service}}".
+//
+// vars (from -set) win over a document's vars, which win over the config's
+// vars and then the environment; the merged variables of each document are
+// stored in its Vars for templates.
+func (c *Config) expand(vars map[string]string) error {
+	missing := make(map[string]bool)
+	c.Vars = mergeVars(vars, missing, c.Vars)
+	ex := func(s *string) { *s = expandVars(*s, c.Vars, missing) }
+	exAll := func(ss []string) {
+		for i := range ss {
+			ex(&ss[i])
+		}
+	}
+	ex(&c.ProjectPath)
+	exAll(c.Include)
+	if c.LLM != nil {
+		ex(&c.LLM.BaseURL)
+		ex(&c.LLM.Model)
+	}
+	for i := range c.Documents {
+		d := &c.Documents[i]
+		d.Vars = mergeVars(vars, missing, c.Vars, d.Vars)
+		ex := func(s *string) { *s = expandVars(*s, d.Vars, missing) }
+		exAll := func(ss []string) {
+			for i := range ss {
+				ex(&ss[i])
+			}
+		}
+		ex(&d.OutputPath)
+		ex(&d.Description)
+		if err := expandTemplate(&d.Description, d.Vars); err != nil {
+			return fmt.Errorf("document %s: description: %w", cmp.Or(d.Name, d.OutputPath), err)
+		}
+		for j := range d.Outputs {
+			ex(&d.Outputs[j].Path)
+		}
+		for j := range d.Sources {
+			s := &d.Sources[j]
+			exAll(s.SourcePaths)
+			exAll(s.ExcludePaths)
+			exAll(s.FilePattern)
+			for k, v := range s.Params {
+				if str, ok := v.(string); ok {
+					s.Params[k] = expandVars(str, d.Vars, missing)
+				}
+			}
+		}
+	}
+	return missingVars(missing)
+}
+
+// expandTemplate executes *s as a template with vars as .Vars when it
+// contains an action.
+func expandTemplate(s *string, vars map[string]string) error {
+	if !strings.Contains(*s, "{{") {
+		return nil
+	}
+	tmpl, err := template.New("").Option("missingkey=error").Parse(*s)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, struct{ Vars map[string]string }{vars}); err != nil {
+		return err
+	}
+	*s = b.String()
+	return nil
+}
+
+// mergeVars layers the configured variable maps, later ones winning, with
+// the command-line vars on top. Configured values may themselves use
+// ${NAME} from the command line and the environment.
+func mergeVars(vars map[string]string, missing map[string]bool, layers ...map[string]string) map[string]string {
+	out := make(map[string]string)
+	for _, layer := range layers {
+		for k, v := range layer {
+			out[k] = expandVars(v, vars, missing)
+		}
+	}
+	maps.Copy(out, vars)
+	return out
+}
+
+func missingVars(missing map[string]bool) error {
+	if len(missing) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(missing))
+	for n := range missing {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("undefined variable(s) %s (set them in vars, the environment or with -set NAME=value)", strings.Join(names, ", "))
+}
+
+// ParseVar splits a "NAME=value" assignment given on the command line.
+func ParseVar(s string) (name, value string, err error) {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || !varNameRe.MatchString(name) {
+		return "", "", fmt.Errorf("invalid variable %q (expected NAME=value)", s)
+	}
+	return name, value, nil
+}
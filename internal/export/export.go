@@ -0,0 +1,79 @@
+package export
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Provider describes the upload constraints of an LLM provider's Files API.
+type Provider struct {
+	Name     string
+	MaxBytes int    // maximum size of a single uploaded file
+	Ext      string // file extension accepted by the provider for text documents
+	MimeType string
+}
+
+// Providers lists the supported Files API targets keyed by name.
+var Providers = map[string]Provider{
+	"openai": {
+		Name:     "openai",
+		MaxBytes: 512 << 20,
+		Ext:      ".md",
+		MimeType: "text/markdown",
+	},
+	"anthropic": {
+		Name:     "anthropic",
+		MaxBytes: 500 << 20,
+		Ext:      ".txt",
+		MimeType: "text/plain",
+	},
+}
+
+// LookupProvider returns the provider profile for name.
+func LookupProvider(name string) (Provider, error) {
+	p, ok := Providers[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return Provider{}, fmt.Errorf("unknown provider %q (expected openai or anthropic)", name)
+	}
+	return p, nil
+}
+
+// Part is one file produced by splitting a document.
+type Part struct {
+	Path    string
+	Content string
+}
+
+// WriteParts splits the document at docPath into provider-sized files in outDir.
+// Files are named "<base>.partNN<ext>"; a document that fits in one file is
+// written as "<base><ext>".
+func WriteParts(docPath, content, outDir string, p Provider, maxBytes int) ([]Part, error) {
+	if maxBytes <= 0 || maxBytes > p.MaxBytes {
+		maxBytes = p.MaxBytes
+	}
+	if outDir == "" {
+		return nil, errors.New("output directory is required")
+	}
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	base := strings.TrimSuffix(filepath.Base(docPath), filepath.Ext(docPath))
+	chunks := Split(content, maxBytes)
+	parts := make([]Part, 0, len(chunks))
+	for i, c := range chunks {
+		name := base + p.Ext
+		if len(chunks) > 1 {
+			name = fmt.Sprintf("%s.part%02d%s", base, i+1, p.Ext)
+		}
+		path := filepath.Join(outDir, name)
+		if err := os.WriteFile(path, []byte(c), 0o644); err != nil {
+			return nil, fmt.Errorf("write %s: %w", path, err)
+		}
+		parts = append(parts, Part{Path: path, Content: c})
+	}
+	return parts, nil
+}
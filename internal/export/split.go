@@ -0,0 +1,225 @@
+package export
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"unicode/utf8"
+)
+
+// Break point priorities, best first when choosing where to cut.
+const (
+	prioAny     = iota // any line inside a fenced block
+	prioBlock          // blank-line gap or top-level declaration inside a fenced block
+	prioLine           // line outside fenced blocks
+	prioHeading        // right before a "### " file heading
+)
+
+type breakPoint struct {
+	off    int
+	prio   int
+	closer string // fence closing line appended when cutting inside a block
+	reopen string // fence opening line repeated at the start of the next part
+}
+
+// MinPartBytes is the smallest part size Split is asked for by the CLI: room
+// for a reopened fence line, its closing marker and some content.
+const MinPartBytes = 64
+
+// Split cuts content into chunks of at most maxBytes. It prefers to break
+// right before a "### " file heading, then between lines outside code fences.
+// When a fenced block itself is too large, it is cut between top-level
+// declarations (Go, via go/parser) or at blank lines (other languages), and
+// the fence is closed and reopened so every part stays valid markdown.
+func Split(content string, maxBytes int) []string {
+	if maxBytes <= 0 || len(content) <= maxBytes {
+		return []string{content}
+	}
+	bps := breakPoints(content)
+
+	var parts []string
+	start, prefix := 0, ""
+	for {
+		budget := maxBytes - len(prefix)
+		if budget < 1 {
+			// the reopened fence does not fit: continue without it
+			prefix, budget = "", maxBytes
+		}
+		if len(content)-start <= budget {
+			parts = append(parts, prefix+content[start:])
+			return parts
+		}
+		bp, ok := chooseBreak(bps, start, budget)
+		if !ok {
+			// no line boundary fits: hard cut at a rune boundary
+			cut := start + budget
+			for cut > start+1 && !utf8.RuneStart(content[cut]) {
+				cut--
+			}
+			bp = breakPoint{off: cut}
+		}
+		parts = append(parts, prefix+content[start:bp.off]+bp.closer)
+		start, prefix = bp.off, bp.reopen
+	}
+}
+
+// chooseBreak picks the best break point in (start, start+budget]: the latest
+// one of the highest priority that still leaves the part at least a quarter
+// full, or else simply the latest one that fits.
+func chooseBreak(bps []breakPoint, start, budget int) (breakPoint, bool) {
+	var best [prioHeading + 1]*breakPoint
+	var latest *breakPoint
+	for i := range bps {
+		bp := &bps[i]
+		if bp.off <= start {
+			continue
+		}
+		if bp.off+len(bp.closer) > start+budget {
+			break
+		}
+		best[bp.prio] = bp
+		latest = bp
+	}
+	for prio := prioHeading; prio >= prioAny; prio-- {
+		if bp := best[prio]; bp != nil && bp.off-start >= budget/4 {
+			return *bp, true
+		}
+	}
+	if latest == nil {
+		return breakPoint{}, false
+	}
+	return *latest, true
+}
+
+// breakPoints lists every line start of content with its priority, in order.
+func breakPoints(content string) []breakPoint {
+	var bps []breakPoint
+	var (
+		inFence   bool
+		opening   string // opening fence line
+		marker    string // backtick run that closes the fence
+		bodyStart int
+		bodyLines []int // offsets of lines inside the fence
+	)
+	flushFence := func(bodyEnd int) {
+		body := content[bodyStart:bodyEnd]
+		good := blockBoundaries(fenceLang(opening, marker), body, bodyStart)
+		for _, off := range bodyLines {
+			if off == bodyStart {
+				continue
+			}
+			prio := prioAny
+			if good[off] {
+				prio = prioBlock
+			}
+			bps = append(bps, breakPoint{off: off, prio: prio, closer: marker + "\n", reopen: opening + "\n"})
+		}
+	}
+
+	off := 0
+	for _, line := range strings.SplitAfter(content, "\n") {
+		if line == "" {
+			break
+		}
+		text := strings.TrimRight(line, "\r\n")
+		if inFence {
+			if strings.TrimSpace(text) == marker {
+				flushFence(off)
+				inFence = false
+			} else {
+				bodyLines = append(bodyLines, off)
+			}
+			off += len(line)
+			continue
+		}
+		if off > 0 {
+			prio := prioLine
+			if strings.HasPrefix(text, "### ") {
+				prio = prioHeading
+			}
+			bps = append(bps, breakPoint{off: off, prio: prio})
+		}
+		if m := fenceMarker(text); m != "" {
+			inFence, opening, marker = true, text, m
+			bodyStart, bodyLines = off+len(line), nil
+		}
+		off += len(line)
+	}
+	if inFence {
+		flushFence(len(content))
+	}
+	return bps
+}
+
+// fenceMarker returns the backtick run opening a fenced block, or "".
+func fenceMarker(line string) string {
+	n := 0
+	for n < len(line) && line[n] == '`' {
+		n++
+	}
+	if n < 3 {
+		return ""
+	}
+	return line[:n]
+}
+
+func fenceLang(opening, marker string) string {
+	return strings.ToLower(strings.TrimSpace(strings.TrimPrefix(opening, marker)))
+}
+
+// blockBoundaries returns absolute offsets of lines inside a fenced block
+// where cutting keeps code units intact.
+func blockBoundaries(lang, body string, base int) map[int]bool {
+	good := make(map[int]bool)
+	if lang == "go" {
+		if offs, ok := goDeclStarts(body); ok {
+			for _, o := range offs {
+				good[base+o] = true
+			}
+			return good
+		}
+	}
+	// blank-line heuristic: a non-blank line following a blank one
+	off, prevBlank := 0, false
+	for _, line := range strings.SplitAfter(body, "\n") {
+		blank := strings.TrimSpace(line) == ""
+		if prevBlank && !blank {
+			good[base+off] = true
+		}
+		prevBlank = blank
+		off += len(line)
+	}
+	return good
+}
+
+// goDeclStarts returns the offsets of top-level declarations (including
+// their doc comments) in Go source. ok is false if the source does not parse.
+func goDeclStarts(src string) ([]int, bool) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, false
+	}
+	var offs []int
+	for _, d := range f.Decls {
+		pos := d.Pos()
+		switch x := d.(type) {
+		case *ast.FuncDecl:
+			if x.Doc != nil {
+				pos = x.Doc.Pos()
+			}
+		case *ast.GenDecl:
+			if x.Doc != nil {
+				pos = x.Doc.Pos()
+			}
+		}
+		o := fset.Position(pos).Offset
+		// move to the start of the line
+		for o > 0 && src[o-1] != '\n' {
+			o--
+		}
+		offs = append(offs, o)
+	}
+	return offs, true
+}
@@ -0,0 +1,105 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	openaiFilesURL    = "https://api.openai.com/v1/files"
+	anthropicFilesURL = "https://api.anthropic.com/v1/files"
+)
+
+// Upload sends a part to the provider's Files API and returns the file ID.
+// The API key is read from OPENAI_API_KEY or ANTHROPIC_API_KEY.
+func Upload(p Provider, part Part) (string, error) {
+	var (
+		url    string
+		header = http.Header{}
+		fields = map[string]string{}
+	)
+	switch p.Name {
+	case "openai":
+		key := os.Getenv("OPENAI_API_KEY")
+		if key == "" {
+			return "", errors.New("OPENAI_API_KEY is not set")
+		}
+		url = openaiFilesURL
+		header.Set("Authorization", "Bearer "+key)
+		fields["purpose"] = "assistants"
+	case "anthropic":
+		key := os.Getenv("ANTHROPIC_API_KEY")
+		if key == "" {
+			return "", errors.New("ANTHROPIC_API_KEY is not set")
+		}
+		url = anthropicFilesURL
+		header.Set("x-api-key", key)
+		header.Set("anthropic-version", "2023-06-01")
+		header.Set("anthropic-beta", "files-api-2025-04-14")
+	default:
+		return "", fmt.Errorf("upload not supported for provider %q", p.Name)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range fields {
+		if err := mw.WriteField(k, v); err != nil {
+			return "", err
+		}
+	}
+	fh := textproto.MIMEHeader{}
+	fh.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename=%q`, filepath.Base(part.Path)))
+	fh.Set("Content-Type", p.MimeType)
+	fw, err := mw.CreatePart(fh)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.WriteString(fw, part.Content); err != nil {
+		return "", err
+	}
+	if err := mw.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header = header
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	client := &http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("upload %s: %w", part.Path, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("read upload response: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("upload %s: %s: %s", part.Path, resp.Status, bytes.TrimSpace(data))
+	}
+
+	var res struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return "", fmt.Errorf("decode upload response: %w", err)
+	}
+	if res.ID == "" {
+		return "", errors.New("upload response has no file id")
+	}
+	return res.ID, nil
+}
@@ -0,0 +1,135 @@
+package generator
+
+import (
+	"cmp"
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// Dependency is the reason a document depends on a changed file: one of
+// its sources collects the file, or the file is its filesFrom list.
+type Dependency struct {
+	Index    int    // index of the document in the config
+	Document string // name of the document, else its first output path
+	Path     string // the changed file, slash-separated and relative to the project root
+	Source   int    // 1-based index of the source collecting it; 0 for filesFrom
+	Type     string // type of that source
+}
+
+func (d Dependency) String() string {
+	if d.Source == 0 {
+		return fmt.Sprintf("%s: %s is its filesFrom list", d.Document, d.Path)
+	}
+	return fmt.Sprintf("%s: %s is collected by source %d (%s)", d.Document, d.Path, d.Source, d.Type)
+}
+
+// Affected maps changed files (paths relative to the project root, or
+// absolute) to the documents that depend on them, so only those need
+// regenerating. Sources are matched as when rendering, through their
+// sourcePaths, filePattern, excludePaths and ignore files, without reading
+// any file; deleted files count where they would have been collected. Only
+// the file sources are tracked: command, url, git-log, deps, dirdiff,
+// plugin and database sources do not depend on files of the project in a
+// way that can be known before running them.
+func Affected(c cfg.Config, projectRoot string, changed []string, opts Options) ([]Dependency, error) {
+	if err := opts.setup(c, projectRoot); err != nil {
+		return nil, err
+	}
+	rootAbs, err := filepath.Abs(projectRoot)
+	if err != nil {
+		return nil, fmt.Errorf("resolve root: %w", err)
+	}
+	list, err := documentFileList(Options{FileList: changed}, rootAbs, "")
+	if err != nil {
+		return nil, err
+	}
+	fsys := listedFS{sourceFS: opts.files, rootAbs: rootAbs, files: list, missing: true}
+
+	var deps []Dependency
+	for di, doc := range c.Documents {
+		label := cmp.Or(doc.Name, doc.Targets()[0].Path)
+		var listed map[string]bool
+		if doc.FilesFrom != "" {
+			from := filepath.ToSlash(doc.FilesFrom)
+			if filepath.IsAbs(doc.FilesFrom) {
+				if rel, err := filepath.Rel(rootAbs, doc.FilesFrom); err == nil {
+					from = filepath.ToSlash(rel)
+				}
+			}
+			if slices.Contains(list, path.Clean(from)) {
+				deps = append(deps, Dependency{Index: di, Document: label, Path: path.Clean(from), Type: "filesFrom"})
+				continue
+			}
+			names, err := documentFileList(opts, rootAbs, doc.FilesFrom)
+			if err != nil {
+				return nil, err
+			}
+			listed = make(map[string]bool, len(names))
+			for _, n := range names {
+				listed[n] = true
+			}
+		}
+
+		seen := make(map[string]bool)
+		for i, src := range doc.Sources {
+			kind := strings.ToLower(src.Type)
+			if !collectsFiles(kind, src, opts.providers) {
+				continue
+			}
+			switch kind {
+			case "db-schema":
+				if len(src.FilePattern) == 0 {
+					src.FilePattern = cfg.Patterns{"*.sql"}
+				}
+			case "infra":
+				if len(src.FilePattern) == 0 {
+					src.FilePattern = cfg.ParsePatterns(infraPattern)
+				}
+			}
+			root, err := newSourceRoot(projectRoot, src)
+			if err != nil {
+				return nil, err
+			}
+			paths, _, err := splitSelectors(root.dir, src.SourcePaths)
+			if err != nil {
+				return nil, err
+			}
+			var files []string
+			if kind == "tree" && src.TreeShowAll {
+				files, err = collectFiles(fsys, root.dir, paths, "", slices.Concat(src.ExcludePaths, src.TreeExclude))
+			} else {
+				files, err = sourceFiles(fsys, root.dir, paths, src, nil)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: collect files for %q: %w", label, src.Type, err)
+			}
+			for _, f := range files {
+				f = root.fromRoot(f)
+				if seen[f] || listed != nil && !listed[f] && !(kind == "tree" && src.TreeShowAll) {
+					continue
+				}
+				seen[f] = true
+				deps = append(deps, Dependency{Index: di, Document: label, Path: f, Source: i + 1, Type: src.Type})
+			}
+		}
+	}
+	return deps, nil
+}
+
+// collectsFiles reports whether a source of kind walks its sourcePaths, as
+// opposed to running a command, fetching a url or asking a provider.
+func collectsFiles(kind string, src cfg.Source, providers map[string]SourceProvider) bool {
+	switch kind {
+	case "template", "command", "url", "git-log", "deps", "dirdiff":
+		return false
+	case "db-schema":
+		return src.DSNEnv == ""
+	}
+	_, plugin := providers[kind]
+	return !plugin
+}
@@ -0,0 +1,102 @@
+package generator
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+
+	"go_project_context_maker/internal/anonymize"
+	cfg "go_project_context_maker/internal/config"
+)
+
+// AnonymizeSuffix is appended to a document's output path to name the
+// mapping that reverses its anonymization.
+const AnonymizeSuffix = ".anonymize.yaml"
+
+// codeHosts are forges whose second path element is the organization.
+var codeHosts = setOf("github.com", "gitlab.com", "bitbucket.org", "codeberg.org", "dev.azure.com")
+
+// anonymizeDocument replaces the identifying strings in every part of
+// every encoding of doc (see anonymizeMapping), and in the config sidecar,
+// and returns the mapping to write next to the outputs; it is empty when
+// doc is not anonymized.
+func anonymizeDocument(fsys sourceFS, projectRoot string, doc cfg.Document, contents [][]string, sidecar *string, opts Options) (string, error) {
+	if !doc.Anonymize {
+		return "", nil
+	}
+	m := anonymizeMapping(fsys, projectRoot, doc, contents)
+	total := 0
+	for _, parts := range contents {
+		for j, p := range parts {
+			var n int
+			parts[j], n = m.Apply(p)
+			total += n
+		}
+	}
+	*sidecar, _ = m.Apply(*sidecar)
+	opts.logf("%s: anonymized %d occurrence(s) of %d name(s)\n", doc.OutputPath, total, len(m.Entries))
+	return m.Marshal()
+}
+
+// anonymizeMapping collects the strings identifying the project: the Go
+// module path, the package.json and composer.json package names, the
+// organizations they name, doc.AnonymizeTerms and the internal hostnames
+// found in contents.
+func anonymizeMapping(fsys sourceFS, projectRoot string, doc cfg.Document, contents [][]string) anonymize.Mapping {
+	b := anonymize.NewBuilder()
+	var modules []string
+	if mp := goModulePath(fsys, projectRoot); mp != "" {
+		modules = append(modules, mp)
+	}
+	for _, manifest := range []string{"package.json", "composer.json"} {
+		data, err := fsys.ReadFile(filepath.Join(projectRoot, manifest))
+		if err != nil {
+			continue
+		}
+		var pkg struct {
+			Name string `json:"name"`
+		}
+		if json.Unmarshal(data, &pkg) == nil && strings.Contains(pkg.Name, "/") {
+			modules = append(modules, pkg.Name)
+		}
+	}
+	for _, m := range modules {
+		b.Add(anonymize.KindModule, m)
+	}
+	for _, m := range modules {
+		if org := moduleOrg(m); org != "" {
+			b.Add(anonymize.KindOrg, org)
+		}
+	}
+	for _, t := range doc.AnonymizeTerms {
+		b.Add(anonymize.KindTerm, t)
+	}
+	for _, parts := range contents {
+		for _, p := range parts {
+			for _, h := range anonymize.Hosts(p) {
+				b.Add(anonymize.KindHost, h)
+			}
+		}
+	}
+	return b.Mapping()
+}
+
+// moduleOrg returns the organization named by a module or package path:
+// "acme" for github.com/acme/api, git.acme.io/team/api, @acme/web and
+// acme/site.
+func moduleOrg(module string) string {
+	parts := strings.Split(strings.TrimPrefix(module, "@"), "/")
+	if len(parts) < 2 {
+		return ""
+	}
+	host := parts[0]
+	switch {
+	case !strings.Contains(host, "."):
+		// npm scope or composer vendor
+		return host
+	case codeHosts[host]:
+		return parts[1]
+	}
+	labels := strings.Split(host, ".")
+	return labels[len(labels)-2]
+}
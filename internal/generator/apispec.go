@@ -0,0 +1,356 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// renderAPISpec condenses an API description to what a reader needs to call
+// it: for a .proto file its services, RPCs, messages and enums, for an
+// OpenAPI (or Swagger 2) YAML or JSON document its endpoints with
+// parameters, request and response schemas, and its schemas. ok is false
+// for files that are neither.
+func renderAPISpec(rel string, data []byte) (summary []byte, ok bool) {
+	switch strings.ToLower(filepath.Ext(rel)) {
+	case ".proto":
+		return summarizeProto(data), true
+	case ".yaml", ".yml", ".json":
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil || len(doc.Content) == 0 {
+			return nil, false
+		}
+		root := doc.Content[0]
+		if field(root, "openapi") == nil && field(root, "swagger") == nil {
+			return nil, false
+		}
+		return summarizeOpenAPI(root), true
+	}
+	return nil, false
+}
+
+// field returns the value of key in mapping n, or nil.
+func field(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// fieldValue returns the scalar value of key in mapping n, or "".
+func fieldValue(n *yaml.Node, key string) string {
+	if v := field(n, key); v != nil && v.Kind == yaml.ScalarNode {
+		return v.Value
+	}
+	return ""
+}
+
+// httpMethods are the operation keys of an OpenAPI path item.
+var httpMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+func summarizeOpenAPI(root *yaml.Node) []byte {
+	var b bytes.Buffer
+	info := field(root, "info")
+	version := fieldValue(root, "openapi")
+	spec := "OpenAPI"
+	if version == "" {
+		spec, version = "Swagger", fieldValue(root, "swagger")
+	}
+	fmt.Fprintf(&b, "%s %s: %s %s\n", spec, version, fieldValue(info, "title"), fieldValue(info, "version"))
+
+	if paths := field(root, "paths"); paths != nil && paths.Kind == yaml.MappingNode {
+		b.WriteString("\nEndpoints:\n")
+		for i := 0; i+1 < len(paths.Content); i += 2 {
+			p, item := paths.Content[i].Value, paths.Content[i+1]
+			shared := field(item, "parameters")
+			for _, m := range httpMethods {
+				op := field(item, m)
+				if op == nil {
+					continue
+				}
+				fmt.Fprintf(&b, "  %-7s %s", strings.ToUpper(m), p)
+				if s := firstLine(fieldValue(op, "summary")); s != "" {
+					b.WriteString("  " + s)
+				}
+				b.WriteString("\n")
+				var params []string
+				for _, list := range []*yaml.Node{shared, field(op, "parameters")} {
+					if list == nil {
+						continue
+					}
+					for _, param := range list.Content {
+						if fieldValue(param, "in") == "body" {
+							fmt.Fprintf(&b, "          body: %s\n", schemaName(field(param, "schema")))
+							continue
+						}
+						params = append(params, paramSummary(param))
+					}
+				}
+				if len(params) > 0 {
+					fmt.Fprintf(&b, "          params: %s\n", strings.Join(params, ", "))
+				}
+				if body := field(op, "requestBody"); body != nil {
+					fmt.Fprintf(&b, "          body: %s\n", contentSchema(body))
+				}
+				if responses := field(op, "responses"); responses != nil && responses.Kind == yaml.MappingNode {
+					for j := 0; j+1 < len(responses.Content); j += 2 {
+						code, resp := responses.Content[j].Value, responses.Content[j+1]
+						s := schemaName(field(resp, "schema"))
+						if s == "" {
+							s = contentSchema(resp)
+						}
+						if s == "" {
+							s = firstLine(fieldValue(resp, "description"))
+						}
+						fmt.Fprintf(&b, "          %s: %s\n", code, s)
+					}
+				}
+			}
+		}
+	}
+
+	schemas := field(field(root, "components"), "schemas")
+	if schemas == nil {
+		schemas = field(root, "definitions")
+	}
+	if schemas != nil && schemas.Kind == yaml.MappingNode {
+		b.WriteString("\nSchemas:\n")
+		for i := 0; i+1 < len(schemas.Content); i += 2 {
+			fmt.Fprintf(&b, "  %s %s\n", schemas.Content[i].Value, schemaShape(schemas.Content[i+1]))
+		}
+	}
+	return b.Bytes()
+}
+
+// paramSummary renders a parameter as "name (in, type)", with "*" after
+// required names.
+func paramSummary(param *yaml.Node) string {
+	name := fieldValue(param, "name")
+	if fieldValue(param, "required") == "true" {
+		name += "*"
+	}
+	typ := schemaName(field(param, "schema"))
+	if typ == "" {
+		typ = fieldValue(param, "type")
+	}
+	if ref := fieldValue(param, "$ref"); ref != "" {
+		return refName(ref)
+	}
+	return fmt.Sprintf("%s (%s, %s)", name, fieldValue(param, "in"), typ)
+}
+
+// contentSchema returns the schema of the first media type of a request body
+// or response, or "".
+func contentSchema(n *yaml.Node) string {
+	if ref := fieldValue(n, "$ref"); ref != "" {
+		return refName(ref)
+	}
+	content := field(n, "content")
+	if content == nil || content.Kind != yaml.MappingNode || len(content.Content) < 2 {
+		return ""
+	}
+	return schemaName(field(content.Content[1], "schema"))
+}
+
+// schemaName names a schema briefly: the name of a $ref, "Pet[]" for arrays,
+// its type otherwise, and the shape of inline objects.
+func schemaName(s *yaml.Node) string {
+	if s == nil {
+		return ""
+	}
+	if ref := fieldValue(s, "$ref"); ref != "" {
+		return refName(ref)
+	}
+	switch t := fieldValue(s, "type"); {
+	case t == "array":
+		return schemaName(field(s, "items")) + "[]"
+	case t == "object" || t == "" && field(s, "properties") != nil:
+		if field(s, "properties") != nil {
+			return schemaShape(s)
+		}
+		return "object"
+	case t != "":
+		if f := fieldValue(s, "format"); f != "" {
+			return t + "(" + f + ")"
+		}
+		return t
+	}
+	for _, key := range []string{"oneOf", "anyOf", "allOf"} {
+		if list := field(s, key); list != nil {
+			var names []string
+			for _, item := range list.Content {
+				names = append(names, schemaName(item))
+			}
+			sep := " | "
+			if key == "allOf" {
+				sep = " & "
+			}
+			return strings.Join(names, sep)
+		}
+	}
+	return "any"
+}
+
+// schemaShape renders an object schema as "{id: integer, tag?: string}",
+// optional properties marked with "?", and other schemas by name.
+func schemaShape(s *yaml.Node) string {
+	props := field(s, "properties")
+	if props == nil || props.Kind != yaml.MappingNode {
+		if enum := field(s, "enum"); enum != nil {
+			var values []string
+			for _, v := range enum.Content {
+				values = append(values, v.Value)
+			}
+			return "enum(" + strings.Join(values, ", ") + ")"
+		}
+		return "= " + schemaName(s)
+	}
+	required := make(map[string]bool)
+	if list := field(s, "required"); list != nil {
+		for _, r := range list.Content {
+			required[r.Value] = true
+		}
+	}
+	var fields []string
+	for i := 0; i+1 < len(props.Content); i += 2 {
+		name := props.Content[i].Value
+		if !required[name] {
+			name += "?"
+		}
+		fields = append(fields, name+": "+schemaName(props.Content[i+1]))
+	}
+	return "{" + strings.Join(fields, ", ") + "}"
+}
+
+// refName is the last segment of a $ref: "Pet" for "#/components/schemas/Pet".
+func refName(ref string) string {
+	return ref[strings.LastIndexByte(ref, '/')+1:]
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
+}
+
+var (
+	protoBlock   = regexp.MustCompile(`^(service|message|enum|oneof)\s+(\w+)\s*\{$`)
+	protoRPC     = regexp.MustCompile(`^rpc\s+(\w+)\s*\(\s*(stream\s+)?([\w.]+)\s*\)\s*returns\s*\(\s*(stream\s+)?([\w.]+)\s*\)`)
+	protoField   = regexp.MustCompile(`^((?:repeated|optional|required)\s+)?(map\s*<[^>]+>|[\w.]+)\s+(\w+)\s*=`)
+	protoValue   = regexp.MustCompile(`^(\w+)\s*=`)
+	protoComment = regexp.MustCompile(`//.*$|/\*.*?\*/`)
+)
+
+// summarizeProto lists the package, services with their RPCs, and messages
+// and enums with their fields and values, one line each; nested messages
+// are named Outer.Inner.
+func summarizeProto(data []byte) []byte {
+	var b bytes.Buffer
+	type block struct {
+		kind, name string
+		items      []string
+	}
+	// all lists the blocks in the order they are declared
+	var stack, all []*block
+	// strip comments, then put every statement and brace on a line of its
+	// own so one-line blocks read like spread-out ones
+	var clean strings.Builder
+	inComment := false
+	for _, line := range strings.Split(string(data), "\n") {
+		line = protoComment.ReplaceAllString(line, "")
+		if inComment {
+			end := strings.Index(line, "*/")
+			if end < 0 {
+				continue
+			}
+			line, inComment = line[end+2:], false
+		}
+		if start := strings.Index(line, "/*"); start >= 0 {
+			line, inComment = line[:start], true
+		}
+		clean.WriteString(line + "\n")
+	}
+	split := strings.NewReplacer("{", "{\n", "}", "\n}\n", ";", ";\n")
+	for _, line := range strings.Split(split.Replace(clean.String()), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || line == ";":
+		case strings.HasPrefix(line, "package "):
+			fmt.Fprintf(&b, "package %s\n", strings.TrimSuffix(strings.TrimSpace(strings.TrimPrefix(line, "package ")), ";"))
+		case protoBlock.MatchString(line):
+			m := protoBlock.FindStringSubmatch(line)
+			name := m[2]
+			if m[1] != "service" && len(stack) > 0 && stack[len(stack)-1].kind == "message" {
+				name = stack[len(stack)-1].name + "." + name
+			}
+			blk := &block{kind: m[1], name: name}
+			if m[1] != "oneof" {
+				// oneof fields belong to the enclosing message
+				all = append(all, blk)
+			}
+			stack = append(stack, blk)
+		case strings.HasSuffix(line, "{"):
+			// rpc options, extend blocks and the like
+			if m := protoRPC.FindStringSubmatch(line); m != nil && len(stack) > 0 && stack[len(stack)-1].kind == "service" {
+				svc := stack[len(stack)-1]
+				svc.items = append(svc.items, fmt.Sprintf("rpc %s(%s%s) returns (%s%s)", m[1], m[2], m[3], m[4], m[5]))
+			}
+			stack = append(stack, &block{kind: "other"})
+		case line == "}" || line == "};":
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case len(stack) > 0:
+			cur := stack[len(stack)-1]
+			owner := cur
+			for i := len(stack) - 1; owner.kind == "oneof" && i > 0; i-- {
+				owner = stack[i-1]
+			}
+			switch owner.kind {
+			case "service":
+				if m := protoRPC.FindStringSubmatch(line); m != nil {
+					owner.items = append(owner.items, fmt.Sprintf("rpc %s(%s%s) returns (%s%s)", m[1], m[2], m[3], m[4], m[5]))
+				}
+			case "message":
+				if strings.HasPrefix(line, "option ") || strings.HasPrefix(line, "reserved ") {
+					break
+				}
+				if m := protoField.FindStringSubmatch(line); m != nil {
+					typ := strings.Join(strings.Fields(m[2]), "")
+					if m[1] != "" {
+						typ = strings.TrimSpace(m[1]) + " " + typ
+					}
+					owner.items = append(owner.items, m[3]+": "+typ)
+				}
+			case "enum":
+				if m := protoValue.FindStringSubmatch(line); m != nil && !strings.HasPrefix(line, "option") {
+					owner.items = append(owner.items, m[1])
+				}
+			}
+		}
+	}
+	prev := "service"
+	for _, blk := range all {
+		if blk.kind == "service" {
+			fmt.Fprintf(&b, "\nservice %s\n", blk.name)
+			for _, rpc := range blk.items {
+				fmt.Fprintf(&b, "  %s\n", rpc)
+			}
+		} else {
+			if prev == "service" {
+				b.WriteString("\n")
+			}
+			fmt.Fprintf(&b, "%s %s {%s}\n", blk.kind, blk.name, strings.Join(blk.items, ", "))
+		}
+		prev = blk.kind
+	}
+	return b.Bytes()
+}
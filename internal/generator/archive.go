@@ -0,0 +1,170 @@
+package generator
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go_project_context_maker/internal/signing"
+	"go_project_context_maker/internal/storage"
+)
+
+// archiveIndexName is the name of the table of contents written into archives.
+const archiveIndexName = "index.md"
+
+// archiveFile is one entry of an archive.
+type archiveFile struct {
+	name    string
+	content string
+}
+
+// WriteArchive writes outs, with their config sidecars and signatures and an
+// index.md listing the documents, into one archive at archivePath instead of
+// their output paths; the format follows its extension: .zip, .tar.gz (.tgz)
+// or .tar. Anonymization mappings, which must stay private, are written to
+// their usual paths rather than bundled.
+func WriteArchive(archivePath string, outs []Output, runID string) error {
+	var files []archiveFile
+	names := map[string]string{archiveIndexName: "the index"}
+	for _, o := range outs {
+		if o.Path == StdoutPath {
+			return fmt.Errorf("archive: document %s is written to stdout", o.Document)
+		}
+		name := archiveName(o.Path)
+		if other, dup := names[name]; dup {
+			return fmt.Errorf("archive: outputs %s and %s would both be stored as %s", other, o.Path, name)
+		}
+		names[name] = o.Path
+		files = append(files, archiveFile{name, o.Content})
+		if o.Sidecar != "" {
+			files = append(files, archiveFile{name + SidecarSuffix, o.Sidecar})
+		}
+		if o.Signature != "" {
+			files = append(files, archiveFile{name + signing.Suffix, o.Signature})
+		}
+		if o.Mapping != "" {
+			st, key, err := storage.Default().For(o.Path + AnonymizeSuffix)
+			if err != nil {
+				return err
+			}
+			if err := st.Put(key, []byte(o.Mapping), true); err != nil {
+				return fmt.Errorf("write anonymization mapping for %s: %w", o.Path, err)
+			}
+		}
+	}
+	files = append([]archiveFile{{archiveIndexName, archiveIndex(outs, runID)}}, files...)
+
+	format, err := ArchiveFormat(archivePath)
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	switch format {
+	case "zip":
+		err = writeZip(&b, files)
+	case "tar.gz":
+		gz := gzip.NewWriter(&b)
+		if err = writeTar(gz, files); err == nil {
+			err = gz.Close()
+		}
+	case "tar":
+		err = writeTar(&b, files)
+	}
+	if err != nil {
+		return fmt.Errorf("archive %s: %w", archivePath, err)
+	}
+	if dir := filepath.Dir(archivePath); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("archive %s: %w", archivePath, err)
+		}
+	}
+	if err := os.WriteFile(archivePath, b.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("archive %s: %w", archivePath, err)
+	}
+	return nil
+}
+
+// ArchiveFormat returns the format of an archive path by its extension:
+// "zip", "tar.gz" (also .tgz) or "tar".
+func ArchiveFormat(archivePath string) (string, error) {
+	lower := strings.ToLower(archivePath)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip", nil
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz", nil
+	case strings.HasSuffix(lower, ".tar"):
+		return "tar", nil
+	}
+	return "", fmt.Errorf("archive %s: unknown format (expected .zip, .tar.gz, .tgz or .tar)", archivePath)
+}
+
+// archiveName is where an output path is stored in an archive: relative
+// paths as they are, storage URLs without their scheme, and paths outside
+// the working directory by their base name.
+func archiveName(outPath string) string {
+	if _, rest, ok := strings.Cut(outPath, "://"); ok {
+		outPath = rest
+	}
+	name := path.Clean(filepath.ToSlash(outPath))
+	if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") || filepath.VolumeName(outPath) != "" {
+		name = path.Base(name)
+	}
+	return name
+}
+
+// archiveIndex lists the documents of outs with their outputs, file counts
+// and token estimates, linking each output to its entry.
+func archiveIndex(outs []Output, runID string) string {
+	var b strings.Builder
+	b.WriteString("# Context documents\n\n")
+	if runID != "" {
+		fmt.Fprintf(&b, "Run id: %s\n\n", runID)
+	}
+	b.WriteString("| Document | Outputs | Files | Tokens |\n|---|---|---|---|\n")
+	for _, d := range NewResult(runID, outs).Documents {
+		links := make([]string, len(d.Outputs))
+		for i, p := range d.Outputs {
+			name := archiveName(p)
+			links[i] = fmt.Sprintf("[%s](%s)", name, strings.ReplaceAll(name, " ", "%20"))
+		}
+		fmt.Fprintf(&b, "| %s | %s | %d | ~%d |\n", d.Name, strings.Join(links, ", "), len(d.Files), d.Tokens)
+	}
+	return b.String()
+}
+
+func writeZip(w io.Writer, files []archiveFile) error {
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, f.content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeTar(w io.Writer, files []archiveFile) error {
+	tw := tar.NewWriter(w)
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.name, Mode: 0o644, Size: int64(len(f.content)), ModTime: time.Now(), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(tw, f.content); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
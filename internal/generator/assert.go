@@ -0,0 +1,62 @@
+package generator
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	cfg "go_project_context_maker/internal/config"
+	"go_project_context_maker/internal/match"
+)
+
+// checkAssertions evaluates doc.Assertions against a rendered document and
+// returns one error listing every assertion that does not hold.
+func checkAssertions(doc cfg.Document, content string, files []FileStat) error {
+	a := doc.Assertions
+	if a == nil {
+		return nil
+	}
+	var failed []string
+
+	for _, glob := range a.Contains {
+		set, err := match.Compile([]string{glob})
+		if err != nil {
+			return fmt.Errorf("assertions for %s: contains: %w", doc.OutputPath, err)
+		}
+		if set.Empty() {
+			continue
+		}
+		found := false
+		for _, f := range files {
+			if set.Match(f.Path) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			failed = append(failed, fmt.Sprintf("no embedded file matches %q", glob))
+		}
+	}
+
+	for _, expr := range a.NotContains {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("assertions for %s: notContains %q: %w", doc.OutputPath, expr, err)
+		}
+		if loc := re.FindStringIndex(content); loc != nil {
+			line := strings.Count(content[:loc[0]], "\n") + 1
+			failed = append(failed, fmt.Sprintf("document matches %q at line %d", expr, line))
+		}
+	}
+
+	if a.MaxTokens > 0 {
+		if tokens := EstimateTokens(len(content)); tokens > a.MaxTokens {
+			failed = append(failed, fmt.Sprintf("~%d tokens exceeds maxTokens %d", tokens, a.MaxTokens))
+		}
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("assertions failed for %s:\n  - %s", doc.OutputPath, strings.Join(failed, "\n  - "))
+}
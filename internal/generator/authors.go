@@ -0,0 +1,85 @@
+package generator
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// filterAuthors keeps the files (relative to projectRoot) that are
+// predominantly written by authors: git blame attributes more than half of
+// their lines to them. An author is an email prefix ("alice@",
+// "alice@example.com") or a full name, compared case-insensitively. Files
+// git does not track have no authors and are dropped.
+func filterAuthors(ctx context.Context, projectRoot string, files, authors []string, onDisk bool, jobs int) ([]string, error) {
+	if !onDisk {
+		return nil, errors.New("authors needs the project on disk")
+	}
+	results := readFiles(files, jobs, func(rel string) fileResult {
+		r := fileResult{rel: rel}
+		lines, ours, err := blameShare(ctx, projectRoot, rel, authors)
+		r.err, r.filtered = err, err == nil && ours*2 <= lines
+		return r
+	})
+	out := files[:0]
+	for _, r := range results {
+		if r.err != nil {
+			return nil, r.err
+		}
+		if !r.filtered {
+			out = append(out, r.rel)
+		}
+	}
+	return out, nil
+}
+
+// blameShare counts the lines of rel and those git blame attributes to one
+// of authors.
+func blameShare(ctx context.Context, projectRoot, rel string, authors []string) (lines, ours int, err error) {
+	cmd := exec.CommandContext(ctx, "git", "blame", "--line-porcelain", "--", rel)
+	cmd.Dir = projectRoot
+	out, err := cmd.Output()
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		// untracked, or not a repository
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("authors: git blame %s: %w", rel, err)
+	}
+	var name string
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		line := sc.Text()
+		if v, ok := strings.CutPrefix(line, "author "); ok {
+			name = v
+		} else if v, ok := strings.CutPrefix(line, "author-mail "); ok {
+			lines++
+			if isAuthor(name, strings.Trim(v, "<>"), authors) {
+				ours++
+			}
+		}
+	}
+	return lines, ours, sc.Err()
+}
+
+func isAuthor(name, mail string, authors []string) bool {
+	for _, a := range authors {
+		a = strings.ToLower(strings.TrimSpace(a))
+		if a == "" {
+			continue
+		}
+		if strings.HasPrefix(strings.ToLower(mail), a) || strings.EqualFold(name, a) {
+			return true
+		}
+	}
+	return false
+}
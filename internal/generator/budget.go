@@ -0,0 +1,77 @@
+package generator
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// applyBudget enforces the maxTokens and maxBytes of a file or outline
+// source on its read results: while the content to embed is over either
+// limit, files are marked skipped in the order src.TrimBy picks, "largest"
+// (default) first, least recently modified ("oldest") first or from the
+// end of the embedding order ("last").
+func applyBudget(src cfg.Source, results []fileResult) error {
+	maxBytes, err := cfg.ParseSize(src.MaxBytes)
+	if err != nil {
+		return fmt.Errorf("maxBytes: %w", err)
+	}
+	if src.MaxTokens <= 0 && maxBytes <= 0 {
+		return nil
+	}
+	var candidates []int
+	size := 0
+	for i, r := range results {
+		if r.err != nil || r.filtered || r.skip != "" {
+			continue
+		}
+		candidates = append(candidates, i)
+		size += len(r.data)
+	}
+	over := func() bool {
+		return src.MaxTokens > 0 && EstimateTokens(size) > src.MaxTokens || maxBytes > 0 && int64(size) > maxBytes
+	}
+	if !over() {
+		return nil
+	}
+
+	switch strings.ToLower(src.TrimBy) {
+	case "", "largest":
+		slices.SortStableFunc(candidates, func(x, y int) int {
+			return cmp.Compare(len(results[y].data), len(results[x].data))
+		})
+	case "oldest":
+		slices.SortStableFunc(candidates, func(x, y int) int {
+			return modTime(results[x]).Compare(modTime(results[y]))
+		})
+	case "last":
+		slices.Reverse(candidates)
+	default:
+		return fmt.Errorf("unknown trimBy %q", src.TrimBy)
+	}
+	limit := fmt.Sprintf("maxTokens %d", src.MaxTokens)
+	if src.MaxTokens <= 0 {
+		limit = "maxBytes " + src.MaxBytes
+	}
+	for _, i := range candidates {
+		if !over() {
+			break
+		}
+		size -= len(results[i].data)
+		results[i].skip = "over the source budget (" + limit + ")"
+	}
+	return nil
+}
+
+// modTime is when r's file was last modified; placeholders of unreadable
+// files count as oldest.
+func modTime(r fileResult) time.Time {
+	if r.info == nil {
+		return time.Time{}
+	}
+	return r.info.ModTime()
+}
@@ -0,0 +1,63 @@
+package generator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// cacheFile returns where output of the given kind ("url", "command", "plugin") and
+// key is cached in the user cache dir, or "" when there is none.
+func cacheFile(kind, key string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(dir, "gpcm", kind, hex.EncodeToString(sum[:]))
+}
+
+// sourceKey identifies what a source produces: its whole definition and the
+// project it runs in, so changing any setting misses the cache.
+func sourceKey(projectRoot string, src cfg.Source) string {
+	def, _ := json.Marshal(src)
+	abs, err := filepath.Abs(projectRoot)
+	if err != nil {
+		abs = projectRoot
+	}
+	return abs + "\x00" + string(def)
+}
+
+// readCache returns the content of file and when it was written, unless it
+// is missing or older than ttl.
+func readCache(file string, ttl time.Duration) ([]byte, time.Time, bool) {
+	if file == "" {
+		return nil, time.Time{}, false
+	}
+	info, err := os.Stat(file)
+	if err != nil || time.Since(info.ModTime()) > ttl {
+		return nil, time.Time{}, false
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+	return data, info.ModTime(), true
+}
+
+// writeCache stores data in file; caching is best effort, so callers may
+// ignore the error.
+func writeCache(file string, data []byte) error {
+	if file == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0o644)
+}
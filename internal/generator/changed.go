@@ -0,0 +1,72 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"go_project_context_maker/internal/unorm"
+)
+
+// changedFiles returns the files below projectRoot (slash paths relative to
+// it, NFC) that differ from where HEAD branched off ref: committed, staged
+// and unstaged changes plus untracked files, without deleted ones.
+func changedFiles(ctx context.Context, projectRoot, ref string) (map[string]bool, error) {
+	if strings.HasPrefix(ref, "-") {
+		return nil, fmt.Errorf("changedSince: invalid ref %q", ref)
+	}
+	base, err := git(ctx, projectRoot, "merge-base", ref, "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("changedSince %s: %w", ref, err)
+	}
+	diff, err := git(ctx, projectRoot, "diff", "--name-only", "--relative", "--diff-filter=d", "-z", strings.TrimSpace(string(base)), "--")
+	if err != nil {
+		return nil, fmt.Errorf("changedSince %s: %w", ref, err)
+	}
+	untracked, err := git(ctx, projectRoot, "ls-files", "--others", "--exclude-standard", "-z")
+	if err != nil {
+		return nil, fmt.Errorf("changedSince %s: %w", ref, err)
+	}
+	changed := make(map[string]bool)
+	for _, name := range bytes.Split(append(diff, untracked...), []byte{0}) {
+		if len(name) > 0 {
+			changed[unorm.NFC(string(name))] = true
+		}
+	}
+	return changed, nil
+}
+
+// keepChanged returns the files found in changed.
+func keepChanged(files []string, changed map[string]bool) []string {
+	out := files[:0]
+	for _, rel := range files {
+		if changed[unorm.NFC(rel)] {
+			out = append(out, rel)
+		}
+	}
+	return out
+}
+
+// git runs git in dir and returns its standard output; the error carries
+// git's standard error.
+func git(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return nil, fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return out, nil
+}
@@ -0,0 +1,170 @@
+package generator
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// Upper halves (0x80-0xFF) of the single-byte code pages; the lower half is ASCII.
+const (
+	cp1251High = "ЂЃ‚ѓ„…†‡€‰Љ‹ЊЌЋЏђ‘’“”•–—\u0098™љ›њќћџ\u00a0ЎўЈ¤Ґ¦§Ё©Є«¬\u00ad®Ї°±Ііґµ¶·ё№є»јЅѕїАБВГДЕЖЗИЙКЛМНОПРСТУФХЦЧШЩЪЫЬЭЮЯабвгдежзийклмнопрстуфхцчшщъыьэюя"
+	cp1252High = "€\u0081‚ƒ„…†‡ˆ‰Š‹Œ\u008dŽ\u008f\u0090‘’“”•–—˜™š›œ\u009džŸ\u00a0¡¢£¤¥¦§¨©ª«¬\u00ad®¯°±²³´µ¶·¸¹º»¼½¾¿ÀÁÂÃÄÅÆÇÈÉÊËÌÍÎÏÐÑÒÓÔÕÖ×ØÙÚÛÜÝÞßàáâãäåæçèéêëìíîïðñòóôõö÷øùúûüýþÿ"
+	koi8rHigh  = "─│┌┐└┘├┤┬┴┼▀▄█▌▐░▒▓⌠■∙√≈≤≥\u00a0⌡°²·÷═║╒ё╓╔╕╖╗╘╙╚╛╜╝╞╟╠╡Ё╢╣╤╥╦╧╨╩╪╫╬©юабцдефгхийклмнопярстужвьызшэщчъЮАБЦДЕФГХИЙКЛМНОПЯРСТУЖВЬЫЗШЭЩЧЪ"
+)
+
+// charset decodes one encoding to UTF-8.
+type charset struct {
+	name   string
+	decode func([]byte) []byte
+}
+
+var (
+	cp1251  = charset{"windows-1251", singleByte(cp1251High)}
+	cp1252  = charset{"windows-1252", singleByte(cp1252High)}
+	latin1  = charset{"iso-8859-1", decodeLatin1}
+	koi8r   = charset{"koi8-r", singleByte(koi8rHigh)}
+	utf16le = charset{"utf-16le", func(b []byte) []byte { return decodeUTF16(b, binary.LittleEndian) }}
+	utf16be = charset{"utf-16be", func(b []byte) []byte { return decodeUTF16(b, binary.BigEndian) }}
+)
+
+// charsetNamed returns the charset for a source's encoding field; cfg.Encodings
+// lists the accepted names. ok is false for "utf-8", which needs no decoding.
+func charsetNamed(name string) (c charset, ok bool, err error) {
+	switch strings.ToLower(name) {
+	case "utf-8":
+		return charset{}, false, nil
+	case "windows-1251", "cp1251":
+		return cp1251, true, nil
+	case "windows-1252", "cp1252":
+		return cp1252, true, nil
+	case "iso-8859-1", "latin1":
+		return latin1, true, nil
+	case "koi8-r":
+		return koi8r, true, nil
+	case "utf-16le":
+		return utf16le, true, nil
+	case "utf-16be":
+		return utf16be, true, nil
+	}
+	return charset{}, false, fmt.Errorf("unknown encoding %q (expected one of %s)", name, strings.Join(cfg.Encodings, ", "))
+}
+
+// detectCharset guesses the encoding of data that is not valid UTF-8: a
+// UTF-16 byte order mark wins; otherwise Cyrillic text, whose letters are all
+// high bytes, is mostly words of three or more of them in a row, where
+// Western European text has a few accented letters between ASCII ones.
+func detectCharset(data []byte) charset {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return utf16le
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return utf16be
+	}
+	high, inWords, run := 0, 0, 0
+	for i := 0; i <= len(data); i++ {
+		if i < len(data) && data[i] >= 0x80 {
+			high++
+			run++
+			continue
+		}
+		if run >= 3 {
+			inWords += run
+		}
+		run = 0
+	}
+	if high > 0 && inWords*2 >= high {
+		return cp1251
+	}
+	return cp1252
+}
+
+// decodeText converts data to UTF-8 according to src.Encoding and
+// src.InvalidUTF8Policy. Without an encoding, valid UTF-8 is returned as is
+// and anything else is "convert"ed from a detected encoding (the default),
+// has invalid bytes "replace"d with U+FFFD or is left out: skip is then the
+// reason.
+func decodeText(src cfg.Source, data []byte) (out []byte, skip string, err error) {
+	c, convert, err := charsetNamed(cmp.Or(src.Encoding, "utf-8"))
+	if err != nil {
+		return nil, "", err
+	}
+	if convert {
+		return c.decode(trimBOM(data, c)), "", nil
+	}
+	if utf8.Valid(data) {
+		return data, "", nil
+	}
+	switch strings.ToLower(src.InvalidUTF8Policy) {
+	case "", "convert":
+		if src.Encoding == "" {
+			c := detectCharset(data)
+			return c.decode(trimBOM(data, c)), "", nil
+		}
+		// an explicit utf-8 is not second-guessed: only repair it
+		return bytes.ToValidUTF8(data, []byte("\uFFFD")), "", nil
+	case "replace":
+		return bytes.ToValidUTF8(data, []byte("\uFFFD")), "", nil
+	case "skip":
+		return nil, "not valid UTF-8", nil
+	}
+	return nil, "", fmt.Errorf("unknown invalidUTF8Policy %q", src.InvalidUTF8Policy)
+}
+
+// trimBOM drops the UTF-16 byte order mark matching c.
+func trimBOM(data []byte, c charset) []byte {
+	switch c.name {
+	case utf16le.name:
+		return bytes.TrimPrefix(data, []byte{0xFF, 0xFE})
+	case utf16be.name:
+		return bytes.TrimPrefix(data, []byte{0xFE, 0xFF})
+	}
+	return data
+}
+
+// singleByte returns a decoder for a code page whose upper half is high.
+func singleByte(high string) func([]byte) []byte {
+	table := []rune(high)
+	return func(data []byte) []byte {
+		out := make([]byte, 0, len(data)+len(data)/2)
+		for _, b := range data {
+			if b < 0x80 {
+				out = append(out, b)
+				continue
+			}
+			out = utf8.AppendRune(out, table[b-0x80])
+		}
+		return out
+	}
+}
+
+func decodeLatin1(data []byte) []byte {
+	out := make([]byte, 0, len(data)+len(data)/4)
+	for _, b := range data {
+		out = utf8.AppendRune(out, rune(b))
+	}
+	return out
+}
+
+// decodeUTF16 decodes UTF-16 in the given byte order; a trailing odd byte
+// and unpaired surrogates become U+FFFD.
+func decodeUTF16(data []byte, order binary.ByteOrder) []byte {
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		units = append(units, order.Uint16(data[i:]))
+	}
+	out := make([]byte, 0, len(data))
+	for _, r := range utf16.Decode(units) {
+		out = utf8.AppendRune(out, r)
+	}
+	if len(data)%2 == 1 {
+		out = utf8.AppendRune(out, utf8.RuneError)
+	}
+	return out
+}
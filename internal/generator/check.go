@@ -0,0 +1,178 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/json"
+	"html"
+	"regexp"
+
+	cfg "go_project_context_maker/internal/config"
+	"go_project_context_maker/internal/storage"
+)
+
+// runIDRe finds the run id embedded by the markdown, xml, text and html
+// headers, at the top of markdown front matter, in the file summary of a
+// repomix pack, or in the first entry of a json manifest, quoted.
+// jsonl-chunks and gitingest embed none.
+var runIDRe = regexp.MustCompile(`^(?:<!-- run-id: (.+?) -->|---\nrunId: (.+)|<context run_id="(.*?)"|run-id: (.+)|(?s:.*?)<meta name="run-id" content="(.*?)">|This file is a merged representation (?s:.*?)\n<additional_info>\nrun-id: (.+)|\[\n  \{\n    "runId": (?P<json>"(?:[^"\\\n]|\\.)*"))`)
+
+// jsonRunID is the runIDRe group of the json run id.
+var jsonRunID = runIDRe.SubexpIndex("json")
+
+// tookRe matches the timing in the stats footer, which differs on every run.
+var tookRe = regexp.MustCompile(`generated in [0-9.]+[a-zµ]+`)
+
+// derivedRe matches the figures that follow from the byte content of embedded
+// files: token estimates in the stats footer and the json size and sha256.
+var derivedRe = regexp.MustCompile(`~[0-9]+ tokens|"size": ?[0-9]+|"sha256": ?"[0-9a-f]*"`)
+
+// Stale renders every document that is written to a file and returns how
+// the outputs that are missing or whose content would change differ from
+// what is written (see WriteChanges). The run id
+// stored in each existing document is reused and the footer timing is
+// ignored, so only real content changes count. With opts.IgnoreWhitespace,
+// formatter churn (whitespace and line endings) does not count either.
+// Hooks are not run: checking leaves the project as it is.
+func Stale(c cfg.Config, projectRoot string, opts Options) ([]OutputChange, error) {
+	var stale []OutputChange
+	for _, doc := range c.Documents {
+		// the run id is read from the document or, when split, its first part
+		runID, files := "", false
+		for _, t := range doc.Targets() {
+			if t.Path == StdoutPath {
+				continue
+			}
+			files = true
+			for _, p := range []string{t.Path, partPath(t.Path, 1)} {
+				if runID != "" {
+					break
+				}
+				data, err := readOutput(opts.Storage, p)
+				if err != nil {
+					return nil, err
+				}
+				runID = existingRunID(data)
+			}
+		}
+		if !files {
+			continue
+		}
+
+		one := c
+		one.Documents = []cfg.Document{doc}
+		o := opts
+		o.RunID, o.NoHooks = runID, true
+		outs, err := Render(one, projectRoot, o)
+		if err != nil {
+			return nil, err
+		}
+		for _, out := range outs {
+			if out.Path == StdoutPath {
+				continue
+			}
+			existing, err := readOutput(opts.Storage, out.Path)
+			if err != nil {
+				return nil, err
+			}
+			if existing == nil || !sameContent(existing, []byte(out.Content), opts.IgnoreWhitespace) {
+				stale = append(stale, compareOutput(out, existing))
+			}
+		}
+	}
+	return stale, nil
+}
+
+// existingRunID returns the run id embedded at the top of a generated
+// document, or "" when there is none (e.g. jsonl-chunks output).
+func existingRunID(data []byte) string {
+	head := data[:min(len(data), 4096)]
+	m := runIDRe.FindSubmatch(head)
+	if m == nil {
+		return ""
+	}
+	for i, g := range m {
+		switch {
+		case i == 0 || len(g) == 0:
+		case i == jsonRunID:
+			var id string
+			if json.Unmarshal(g, &id) != nil {
+				return ""
+			}
+			return id
+		default:
+			// xml and html escape the attribute value
+			return html.UnescapeString(string(g))
+		}
+	}
+	return ""
+}
+
+func sameContent(a, b []byte, ignoreWhitespace bool) bool {
+	a, b = volatileFrontMatter(a), volatileFrontMatter(b)
+	a, b = tookRe.ReplaceAll(a, nil), tookRe.ReplaceAll(b, nil)
+	if ignoreWhitespace {
+		return equalIgnoringWhitespace(derivedRe.ReplaceAll(a, nil), derivedRe.ReplaceAll(b, nil))
+	}
+	return bytes.Equal(a, b)
+}
+
+// equalIgnoringWhitespace reports whether a and b are equal once all
+// whitespace, line endings included, is removed.
+func equalIgnoringWhitespace(a, b []byte) bool {
+	next := func(s []byte, i int) int {
+		for i < len(s) && isSpace(s[i]) {
+			i++
+		}
+		return i
+	}
+	i, j := next(a, 0), next(b, 0)
+	for i < len(a) && j < len(b) {
+		if a[i] != b[j] {
+			return false
+		}
+		i, j = next(a, i+1), next(b, j+1)
+	}
+	return i == len(a) && j == len(b)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+// WithoutUnchanged returns outs less the outputs whose stored file already
+// holds the same content apart from the run id and the footer timing, so
+// regenerating committed documents rewrites only those that really changed.
+// Outputs to stdout are always kept.
+func WithoutUnchanged(backends storage.Backends, outs []Output) ([]Output, error) {
+	var kept []Output
+	for _, o := range outs {
+		if o.Path == StdoutPath {
+			kept = append(kept, o)
+			continue
+		}
+		existing, err := readOutput(backends, o.Path)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			if id, cur := existingRunID(existing), existingRunID([]byte(o.Content)); id != "" && cur != "" {
+				// front matter repeats the run id below the header; xml and
+				// html carry it escaped, json quoted in every entry
+				existing = bytes.ReplaceAll(existing, []byte(id), []byte(cur))
+				existing = bytes.ReplaceAll(existing, []byte(html.EscapeString(id)), []byte(html.EscapeString(cur)))
+				existing = bytes.ReplaceAll(existing, jsonQuote(id), jsonQuote(cur))
+			}
+			if sameContent(existing, []byte(o.Content), false) {
+				continue
+			}
+		}
+		kept = append(kept, o)
+	}
+	return kept, nil
+}
+
+// jsonQuote returns s as json.Marshal writes it in a string.
+func jsonQuote(s string) []byte {
+	q, _ := json.Marshal(s)
+	return q
+}
@@ -0,0 +1,49 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+func TestStaleAfterGenerate(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []string{"markdown", "xml", "html", "text", "json", "jsonl-chunks", "repomix", "gitingest"} {
+		t.Run(format, func(t *testing.T) {
+			c := cfg.Config{Documents: []cfg.Document{{
+				OutputPath:   filepath.Join(t.TempDir(), "ctx.out"),
+				OutputFormat: format,
+				Description:  "Test project",
+				Sources:      []cfg.Source{{Type: "file", SourcePaths: []string{"."}, FilePattern: cfg.Patterns{"*.go"}}},
+			}}}
+			if _, err := Generate(c, root, Options{RunID: `run-1 "a&b"`}); err != nil {
+				t.Fatal(err)
+			}
+
+			stale, err := Stale(c, root, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(stale) > 0 {
+				t.Errorf("check after generate reports %s stale", stale[0].Path)
+			}
+
+			outs, err := Render(c, root, Options{RunID: "run-2"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			kept, err := WithoutUnchanged(nil, outs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(kept) > 0 {
+				t.Errorf("minimal churn rewrites %s", kept[0].Path)
+			}
+		})
+	}
+}
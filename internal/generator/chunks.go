@@ -0,0 +1,109 @@
+package generator
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// Default chunk size and overlap of the jsonl-chunks format, in estimated
+// tokens.
+const (
+	defaultChunkSize    = 512
+	defaultChunkOverlap = 64
+)
+
+// chunkRecord is one line of the jsonl-chunks format.
+type chunkRecord struct {
+	Doc        string `json:"doc"`
+	Path       string `json:"path"`
+	ChunkIndex int    `json:"chunk_index"`
+	StartLine  int    `json:"start_line"`
+	EndLine    int    `json:"end_line"`
+	Text       string `json:"text"`
+}
+
+// chunksFormat writes every embedded file as overlapping chunks of whole
+// lines, one JSON record per line, ready for an embedding pipeline. Like
+// the json format it leaves out trees, command output and the footer.
+type chunksFormat struct {
+	doc           string
+	size, overlap int
+}
+
+func (f *chunksFormat) header(_ *strings.Builder, doc cfg.Document, _ string) {
+	f.doc = cmp.Or(doc.Name, doc.OutputPath)
+	f.size = cmp.Or(doc.ChunkSize, defaultChunkSize)
+	f.overlap = cmp.Or(doc.ChunkOverlap, defaultChunkOverlap)
+	if f.overlap >= f.size {
+		f.overlap = f.size / 2
+	}
+}
+
+func (*chunksFormat) tree(*strings.Builder, cfg.Source, string) {}
+
+func (*chunksFormat) noFiles(*strings.Builder, cfg.Source) {}
+
+func (f *chunksFormat) file(b *strings.Builder, _ *template.Template, v FileView) error {
+	for i, c := range chunkLines(v.Content, f.size, f.overlap) {
+		data, err := json.Marshal(chunkRecord{Doc: f.doc, Path: v.Path, ChunkIndex: i, StartLine: c.start, EndLine: c.end, Text: c.text})
+		if err != nil {
+			return fmt.Errorf("encode chunk of %s: %w", v.Path, err)
+		}
+		b.Write(data)
+		b.WriteByte('\n')
+	}
+	return nil
+}
+
+func (*chunksFormat) command(*strings.Builder, string, []byte) {}
+
+func (*chunksFormat) block(*strings.Builder, string, string, []byte) {}
+
+func (*chunksFormat) snapshot(*strings.Builder, string) {}
+
+func (*chunksFormat) footer(*strings.Builder, string) {}
+
+func (*chunksFormat) part(*strings.Builder, int, int) {}
+
+func (*chunksFormat) finish(*strings.Builder) error { return nil }
+
+// chunk is a run of whole lines, numbered from 1.
+type chunk struct {
+	start, end int
+	text       string
+}
+
+// chunkLines cuts content into chunks of whole lines of at most size
+// estimated tokens, each repeating up to overlap tokens of lines from the
+// end of the one before. A line longer than size is a chunk of its own.
+func chunkLines(content string, size, overlap int) []chunk {
+	lines := strings.SplitAfter(content, "\n")
+	if n := len(lines); lines[n-1] == "" {
+		lines = lines[:n-1]
+	}
+	var chunks []chunk
+	for start := 0; start < len(lines); {
+		end, used := start, 0
+		for end < len(lines) && (end == start || used+EstimateTokens(len(lines[end])) <= size) {
+			used += EstimateTokens(len(lines[end]))
+			end++
+		}
+		chunks = append(chunks, chunk{start: start + 1, end: end, text: strings.Join(lines[start:end], "")})
+		if end == len(lines) {
+			break
+		}
+		// step back over the lines that fit the overlap, always advancing
+		next, kept := end, 0
+		for next > start+1 && kept+EstimateTokens(len(lines[next-1])) <= overlap {
+			kept += EstimateTokens(len(lines[next-1]))
+			next--
+		}
+		start = next
+	}
+	return chunks
+}
@@ -0,0 +1,186 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// runCommandSource runs src.Cmd with src.Args and returns a display title and
+// the stdout to embed. Non-zero exit status is handled according to src.OnError:
+//   - "fail" (default): abort generation with an error
+//   - "skip": ok is false and nothing is embedded
+//   - "stderr": output is stdout followed by stderr and the exit code
+//
+// A program that cannot be found is reported as an unavailableError
+// whatever onError says, and a cancelled ctx as ctx's error.
+//
+// With src.CacheTTL, the output of a successful run is kept in the user
+// cache dir, keyed by the source definition and project, and reused for
+// that long instead of running the command again; refresh ignores it.
+func runCommandSource(parent context.Context, projectRoot string, src cfg.Source, refresh bool) (title string, output []byte, ok bool, err error) {
+	if strings.TrimSpace(src.Cmd) == "" {
+		return "", nil, false, errors.New("command source: cmd is required")
+	}
+
+	onError := strings.ToLower(strings.TrimSpace(src.OnError))
+	switch onError {
+	case "", "fail", "skip", "stderr":
+	default:
+		return "", nil, false, fmt.Errorf("command source: unknown onError %q", src.OnError)
+	}
+
+	title = strings.TrimSpace(strings.Join(append([]string{src.Cmd}, src.Args...), " "))
+	file := ""
+	if src.CacheTTL != "" {
+		ttl, err := time.ParseDuration(src.CacheTTL)
+		if err != nil {
+			return "", nil, false, fmt.Errorf("command source: invalid cacheTTL %q: %w", src.CacheTTL, err)
+		}
+		file = cacheFile("command", sourceKey(projectRoot, src))
+		if data, _, ok := readCache(file, ttl); ok && !refresh {
+			return title, data, true, nil
+		}
+	}
+
+	ctx := parent
+	if src.Timeout != "" {
+		d, err := time.ParseDuration(src.Timeout)
+		if err != nil {
+			return "", nil, false, fmt.Errorf("command source: invalid timeout %q: %w", src.Timeout, err)
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+
+	dir := projectRoot
+	if src.Workdir != "" {
+		if filepath.IsAbs(src.Workdir) {
+			dir = src.Workdir
+		} else {
+			dir = filepath.Join(projectRoot, src.Workdir)
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, src.Cmd, src.Args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	runErr := cmd.Run()
+	if err := parent.Err(); err != nil {
+		return title, nil, false, err
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		runErr = fmt.Errorf("timed out after %s", src.Timeout)
+	}
+
+	if runErr != nil && toolMissing(runErr) {
+		return title, nil, false, &unavailableError{feature: "command source", detail: fmt.Sprintf("%s: %v", title, runErr)}
+	}
+	if runErr != nil {
+		var exitErr *exec.ExitError
+		isExit := errors.As(runErr, &exitErr) && ctx.Err() == nil
+		switch {
+		case onError == "skip":
+			return title, nil, false, nil
+		case onError == "stderr" && isExit:
+			// fall through, including stderr in the output
+		default:
+			return title, nil, false, fmt.Errorf("command %q: %w", title, runErr)
+		}
+	}
+
+	var out bytes.Buffer
+	writeWithNewline(&out, stdout.Bytes())
+	if runErr != nil {
+		writeWithNewline(&out, stderr.Bytes())
+		fmt.Fprintf(&out, "(exit code %d)\n", cmd.ProcessState.ExitCode())
+	} else {
+		// caching is best effort
+		_ = writeCache(file, out.Bytes())
+	}
+	return title, out.Bytes(), true, nil
+}
+
+// writeWithNewline writes data and makes sure it ends with a newline.
+func writeWithNewline(b *bytes.Buffer, data []byte) {
+	b.Write(data)
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		b.WriteByte('\n')
+	}
+}
+
+// runFilter pipes data through src.FilterCommand (run by the system shell in
+// projectRoot, with GPCM_FILE set to rel) and returns its stdout.
+// skip is true when the filter failed and src.FilterOnError is "skip";
+// with "raw" the unfiltered data is returned instead. A missing shell or
+// program is an unavailableError; a cancelled ctx fails whatever the policy.
+func runFilter(parent context.Context, projectRoot, rel string, data []byte, src cfg.Source) (out []byte, skip bool, err error) {
+	policy := strings.ToLower(strings.TrimSpace(src.FilterOnError))
+	switch policy {
+	case "", "fail", "skip", "raw":
+	default:
+		return nil, false, fmt.Errorf("filterCommand: unknown filterOnError %q", src.FilterOnError)
+	}
+
+	ctx := parent
+	if src.FilterTimeout != "" {
+		d, err := time.ParseDuration(src.FilterTimeout)
+		if err != nil {
+			return nil, false, fmt.Errorf("filterCommand: invalid filterTimeout %q: %w", src.FilterTimeout, err)
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", src.FilterCommand)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", src.FilterCommand)
+	}
+	cmd.Dir = projectRoot
+	cmd.Env = append(os.Environ(), "GPCM_FILE="+rel)
+	cmd.Stdin = bytes.NewReader(data)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	runErr := cmd.Run()
+	if err := parent.Err(); err != nil {
+		return nil, false, err
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		runErr = fmt.Errorf("timed out after %s", src.FilterTimeout)
+	}
+	if runErr == nil {
+		return stdout.Bytes(), false, nil
+	}
+	if toolMissing(runErr) {
+		return nil, false, &unavailableError{feature: "filterCommand", detail: fmt.Sprintf("%s: %v", src.FilterCommand, runErr)}
+	}
+	switch policy {
+	case "skip":
+		return nil, true, nil
+	case "raw":
+		return data, false, nil
+	}
+	msg := strings.TrimSpace(stderr.String())
+	if msg != "" {
+		return nil, false, fmt.Errorf("filter %q on %s: %w: %s", src.FilterCommand, rel, runErr, msg)
+	}
+	return nil, false, fmt.Errorf("filter %q on %s: %w", src.FilterCommand, rel, runErr)
+}
@@ -0,0 +1,162 @@
+package generator
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// OutputChange compares a rendered output with the file it would replace.
+type OutputChange struct {
+	Path     string
+	Exists   bool // the output already exists
+	Changed  bool // its content differs, ignoring the run id
+	Inserted int  // lines added
+	Deleted  int  // lines removed
+
+	// Embedded files added, removed and changed, by their heading;
+	// only known for markdown documents
+	AddedFiles, RemovedFiles, ChangedFiles []string
+}
+
+// Changes compares every output written to a file with what is stored, for
+// a look before overwriting hand-edited bundles.
+func Changes(outs []Output) ([]OutputChange, error) {
+	var changes []OutputChange
+	for _, o := range outs {
+		if o.Path == StdoutPath {
+			continue
+		}
+		old, err := readOutput(nil, o.Path)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, compareOutput(o, old))
+	}
+	return changes, nil
+}
+
+// compareOutput compares o with old, its current content (nil when there
+// is none).
+func compareOutput(o Output, old []byte) OutputChange {
+	c := OutputChange{Path: o.Path}
+	if old == nil {
+		return c
+	}
+	c.Exists = true
+	prev := string(old)
+	if id, cur := existingRunID(old), existingRunID([]byte(o.Content)); id != "" && cur != "" {
+		prev = strings.Replace(prev, id, cur, 1)
+	}
+	if prev != o.Content {
+		c.Changed = true
+		for _, e := range myersDiff(splitLines([]byte(prev)), splitLines([]byte(o.Content))) {
+			switch e.op {
+			case opInsert:
+				c.Inserted++
+			case opDelete:
+				c.Deleted++
+			}
+		}
+		c.AddedFiles, c.RemovedFiles, c.ChangedFiles = compareSections(fileSections(prev), fileSections(o.Content))
+	}
+	return c
+}
+
+// WriteChanges prints changes as a short summary, one line per output and
+// one per embedded file added (+), removed (-) or changed (~).
+func WriteChanges(w io.Writer, changes []OutputChange) {
+	for _, c := range changes {
+		switch {
+		case !c.Exists:
+			fmt.Fprintf(w, "%s: new\n", c.Path)
+			continue
+		case !c.Changed:
+			fmt.Fprintf(w, "%s: unchanged\n", c.Path)
+			continue
+		}
+		fmt.Fprintf(w, "%s: changed (+%d -%d lines)\n", c.Path, c.Inserted, c.Deleted)
+		for _, list := range []struct {
+			mark  string
+			paths []string
+		}{{"+", c.AddedFiles}, {"-", c.RemovedFiles}, {"~", c.ChangedFiles}} {
+			for _, p := range list.paths {
+				fmt.Fprintf(w, "  %s %s\n", list.mark, p)
+			}
+		}
+	}
+}
+
+// fileSections splits a markdown document at the headings of embedded
+// files, the deepest headings outside code fences ("### " at the default
+// headingLevel), and returns the text under each.
+func fileSections(doc string) map[string]string {
+	lines := strings.SplitAfter(doc, "\n")
+	levels := make([]int, len(lines))
+	deepest, fence := 0, ""
+	for i, line := range lines {
+		trimmed := strings.TrimRight(line, "\r\n")
+		switch {
+		case fence != "":
+			if trimmed == fence {
+				fence = ""
+			}
+		case strings.HasPrefix(trimmed, "```"):
+			fence = trimmed[:len(trimmed)-len(strings.TrimLeft(trimmed, "`"))]
+		default:
+			levels[i] = headingLevel(trimmed)
+			deepest = max(deepest, levels[i])
+		}
+	}
+	sections := make(map[string]string)
+	var name string
+	var body strings.Builder
+	flush := func() {
+		if name != "" {
+			sections[name] = body.String()
+		}
+		body.Reset()
+	}
+	for i, line := range lines {
+		if deepest > 0 && levels[i] == deepest {
+			flush()
+			name = strings.TrimRight(line[deepest+1:], "\r\n")
+			continue
+		}
+		body.WriteString(line)
+	}
+	flush()
+	return sections
+}
+
+// headingLevel returns the level of an ATX heading line (one to six "#" and
+// a space), or 0 for other lines.
+func headingLevel(line string) int {
+	n := len(line) - len(strings.TrimLeft(line, "#"))
+	if n < 1 || n > 6 || !strings.HasPrefix(line[n:], " ") {
+		return 0
+	}
+	return n
+}
+
+func compareSections(old, cur map[string]string) (added, removed, changed []string) {
+	for name, text := range cur {
+		prev, ok := old[name]
+		switch {
+		case !ok:
+			added = append(added, name)
+		case prev != text:
+			changed = append(changed, name)
+		}
+	}
+	for name := range old {
+		if _, ok := cur[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return added, removed, changed
+}
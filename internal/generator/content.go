@@ -0,0 +1,113 @@
+package generator
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// contentFilter keeps files by what they contain (contentMatch and
+// contentExclude). Files are scanned line by line and the scan stops as
+// soon as the outcome is known.
+type contentFilter struct {
+	match   []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// newContentFilter compiles the source's content patterns; it returns nil
+// when the source has none.
+func newContentFilter(src cfg.Source) (*contentFilter, error) {
+	if len(src.ContentMatch) == 0 && len(src.ContentExclude) == 0 {
+		return nil, nil
+	}
+	f := &contentFilter{}
+	for _, l := range []struct {
+		key   string
+		exprs []string
+		dst   *[]*regexp.Regexp
+	}{{"contentMatch", src.ContentMatch, &f.match}, {"contentExclude", src.ContentExclude, &f.exclude}} {
+		for _, expr := range l.exprs {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", l.key, err)
+			}
+			*l.dst = append(*l.dst, re)
+		}
+	}
+	return f, nil
+}
+
+// keep reports whether content read from r passes the filter: some line
+// matches a contentMatch pattern (when there are any) and no line matches a
+// contentExclude pattern.
+func (f *contentFilter) keep(r io.Reader) (bool, error) {
+	matched := len(f.match) == 0
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		line := sc.Bytes()
+		for _, re := range f.exclude {
+			if re.Match(line) {
+				return false, nil
+			}
+		}
+		if !matched {
+			for _, re := range f.match {
+				if re.Match(line) {
+					matched = true
+					break
+				}
+			}
+		}
+		if matched && len(f.exclude) == 0 {
+			return true, nil
+		}
+	}
+	return matched, sc.Err()
+}
+
+// keepData is keep for content already in memory.
+func (f *contentFilter) keepData(rel string, data []byte) (bool, error) {
+	ok, err := f.keep(bytes.NewReader(data))
+	if err != nil {
+		return false, fmt.Errorf("scan %s: %w", rel, err)
+	}
+	return ok, nil
+}
+
+// filterContent drops the files (relative to projectRoot) that do not pass
+// f, streaming each file instead of reading it whole. It is used by sources
+// that do not read the files anyway, such as trees.
+func filterContent(fsys sourceFS, projectRoot string, files []string, f *contentFilter, jobs int) ([]string, error) {
+	results := readFiles(files, jobs, func(rel string) fileResult {
+		r := fileResult{rel: rel}
+		fh, err := fsys.Open(filepath.Join(projectRoot, rel))
+		if err != nil {
+			r.err = err
+			return r
+		}
+		defer fh.Close()
+		ok, err := f.keep(fh)
+		if err != nil {
+			r.err = fmt.Errorf("scan %s: %w", rel, err)
+		} else if !ok {
+			r.skip = "content filter"
+		}
+		return r
+	})
+	kept := files[:0:0]
+	for _, r := range results {
+		if r.err != nil {
+			return nil, r.err
+		}
+		if r.skip == "" {
+			kept = append(kept, r.rel)
+		}
+	}
+	return kept, nil
+}
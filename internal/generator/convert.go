@@ -0,0 +1,472 @@
+package generator
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// maxZipPart bounds each part read from a docx or xlsx archive, so a
+// crafted file cannot expand without limit.
+const maxZipPart = 64 << 20
+
+// converter flattens a rich file to text, returning it with its code fence
+// language.
+type converter func(data []byte) ([]byte, string, error)
+
+// converters implements the formats a source may list under convert, by
+// file extension.
+var converters = map[string]converter{
+	"ipynb": convertNotebook,
+	"docx":  convertDocx,
+	"xlsx":  convertXlsx,
+}
+
+// convertRich flattens rel when its extension is one of src's convert
+// formats; ok is false for every other file.
+func convertRich(src cfg.Source, rel string, data []byte) (out []byte, lang string, ok bool, err error) {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(rel), "."))
+	if !slices.ContainsFunc(src.Convert, func(f string) bool { return strings.EqualFold(f, ext) }) {
+		return nil, "", false, nil
+	}
+	conv, found := converters[ext]
+	if !found {
+		return nil, "", false, nil
+	}
+	out, lang, err = conv(data)
+	if err != nil {
+		return nil, "", true, fmt.Errorf("convert %s: %w", rel, err)
+	}
+	return out, lang, true, nil
+}
+
+// notebook is the part of a Jupyter notebook (nbformat 4) that is embedded.
+type notebook struct {
+	Metadata struct {
+		Kernelspec struct {
+			Language string `json:"language"`
+		} `json:"kernelspec"`
+		LanguageInfo struct {
+			Name string `json:"name"`
+		} `json:"language_info"`
+	} `json:"metadata"`
+	Cells []struct {
+		CellType string           `json:"cell_type"`
+		Source   notebookText     `json:"source"`
+		Outputs  []notebookOutput `json:"outputs"`
+	} `json:"cells"`
+}
+
+type notebookOutput struct {
+	OutputType string                  `json:"output_type"`
+	Text       notebookText            `json:"text"`  // stream
+	Data       map[string]notebookText `json:"data"`  // execute_result, display_data
+	EName      string                  `json:"ename"` // error
+	EValue     string                  `json:"evalue"`
+}
+
+// notebookText is a multiline string, stored as one string or as a list of
+// lines.
+type notebookText string
+
+func (t *notebookText) UnmarshalJSON(data []byte) error {
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err == nil {
+		*t = notebookText(strings.Join(lines, ""))
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		// binary outputs such as images are objects in some writers
+		*t = ""
+		return nil
+	}
+	*t = notebookText(s)
+	return nil
+}
+
+// convertNotebook writes the markdown cells as they are and the code cells
+// as fenced blocks, each followed by its text output. Images and other
+// binary outputs are replaced by a note.
+func convertNotebook(data []byte) ([]byte, string, error) {
+	var nb notebook
+	if err := json.Unmarshal(data, &nb); err != nil {
+		return nil, "", fmt.Errorf("notebook: %w", err)
+	}
+	lang := strings.ToLower(nb.Metadata.LanguageInfo.Name)
+	if lang == "" {
+		lang = strings.ToLower(nb.Metadata.Kernelspec.Language)
+	}
+	var b strings.Builder
+	block := func(info, text string) {
+		text = strings.TrimRight(text, "\n") + "\n"
+		fence := codeFence(text)
+		fmt.Fprintf(&b, "%s%s\n%s%s\n\n", fence, info, text, fence)
+	}
+	for _, c := range nb.Cells {
+		src := string(c.Source)
+		switch c.CellType {
+		case "markdown":
+			if strings.TrimSpace(src) != "" {
+				b.WriteString(strings.TrimRight(src, "\n") + "\n\n")
+			}
+		case "code":
+			if strings.TrimSpace(src) == "" {
+				continue
+			}
+			block(lang, src)
+			for _, o := range c.Outputs {
+				switch {
+				case o.OutputType == "stream":
+					block("text", string(o.Text))
+				case o.OutputType == "error":
+					block("text", o.EName+": "+o.EValue)
+				case o.Data["text/plain"] != "":
+					block("text", string(o.Data["text/plain"]))
+				case len(o.Data) > 0:
+					mimes := make([]string, 0, len(o.Data))
+					for mime := range o.Data {
+						mimes = append(mimes, mime)
+					}
+					slices.Sort(mimes)
+					fmt.Fprintf(&b, "[%s output not embedded]\n\n", strings.Join(mimes, ", "))
+				}
+			}
+		default: // raw
+			if strings.TrimSpace(src) != "" {
+				block("", src)
+			}
+		}
+	}
+	return []byte(strings.TrimRight(b.String(), "\n") + "\n"), "md", nil
+}
+
+// docxHeading returns the heading level of a paragraph style: 1 to 6 for
+// Heading1 to Heading6, 1 for Title, 0 for the rest.
+func docxHeading(attrs []xml.Attr) int {
+	for _, a := range attrs {
+		if a.Name.Local != "val" {
+			continue
+		}
+		if a.Value == "Title" {
+			return 1
+		}
+		if n, err := strconv.Atoi(strings.TrimPrefix(a.Value, "Heading")); err == nil && n >= 1 && n <= 6 {
+			return n
+		}
+	}
+	return 0
+}
+
+// zipPart reads the part called name from an Office Open XML archive; ok
+// is false when there is none.
+func zipPart(zr *zip.Reader, name string) (data []byte, ok bool, err error) {
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, true, err
+		}
+		defer rc.Close()
+		data, err = io.ReadAll(io.LimitReader(rc, maxZipPart+1))
+		if err != nil {
+			return nil, true, err
+		}
+		if len(data) > maxZipPart {
+			return nil, true, fmt.Errorf("%s is larger than %d bytes", name, maxZipPart)
+		}
+		return data, true, nil
+	}
+	return nil, false, nil
+}
+
+// convertDocx writes the paragraphs of a Word document as lines of text,
+// headings (styles Heading1 to Heading6, and Title) as markdown headings and
+// table cells separated by " | ".
+func convertDocx(data []byte) ([]byte, string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, "", fmt.Errorf("docx: %w", err)
+	}
+	doc, ok, err := zipPart(zr, "word/document.xml")
+	if err != nil {
+		return nil, "", fmt.Errorf("docx: %w", err)
+	}
+	if !ok {
+		return nil, "", errors.New("docx: no word/document.xml")
+	}
+
+	var b, para strings.Builder
+	heading := 0
+	inText := false
+	var cells []string // cells of the table row being read
+	depth := 0         // nesting of tables
+	dec := xml.NewDecoder(bytes.NewReader(doc))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("docx: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				para.Reset()
+				heading = 0
+			case "pStyle":
+				heading = docxHeading(t.Attr)
+			case "t":
+				inText = true
+			case "tab":
+				para.WriteByte('\t')
+			case "br", "cr":
+				para.WriteByte('\n')
+			case "tbl":
+				depth++
+			case "tr":
+				if depth == 1 {
+					cells = cells[:0]
+				}
+			case "tc":
+				if depth == 1 {
+					cells = append(cells, "")
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				text := strings.TrimSpace(para.String())
+				switch {
+				case depth > 0 && len(cells) > 0:
+					cells[len(cells)-1] = strings.TrimSpace(cells[len(cells)-1] + " " + text)
+				case text == "":
+				case heading > 0:
+					fmt.Fprintf(&b, "%s %s\n\n", strings.Repeat("#", heading), text)
+				default:
+					b.WriteString(text + "\n\n")
+				}
+			case "tr":
+				if depth == 1 {
+					b.WriteString(strings.Join(cells, " | ") + "\n")
+				}
+			case "tbl":
+				depth--
+				if depth == 0 {
+					b.WriteString("\n")
+				}
+			}
+		case xml.CharData:
+			if inText {
+				para.Write(t)
+			}
+		}
+	}
+	out := blankRunRe.ReplaceAllString(strings.TrimSpace(b.String()), "\n\n")
+	return []byte(out + "\n"), "md", nil
+}
+
+// convertXlsx writes every sheet of an Excel workbook as CSV, in workbook
+// order, each after a "# sheet: <name>" line. Cells hold their stored
+// values: formulas give their last computed result, dates their serial
+// number.
+func convertXlsx(data []byte) ([]byte, string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, "", fmt.Errorf("xlsx: %w", err)
+	}
+	part := func(name string) ([]byte, error) {
+		data, _, err := zipPart(zr, name)
+		if err != nil {
+			return nil, fmt.Errorf("xlsx: %w", err)
+		}
+		return data, nil
+	}
+
+	var shared []string
+	if sst, err := part("xl/sharedStrings.xml"); err != nil {
+		return nil, "", err
+	} else if sst != nil {
+		var v struct {
+			Items []xlsxText `xml:"si"`
+		}
+		if err := xml.Unmarshal(sst, &v); err != nil {
+			return nil, "", fmt.Errorf("xlsx: shared strings: %w", err)
+		}
+		for _, si := range v.Items {
+			shared = append(shared, si.String())
+		}
+	}
+
+	wb, err := part("xl/workbook.xml")
+	if err != nil {
+		return nil, "", err
+	}
+	if wb == nil {
+		return nil, "", errors.New("xlsx: no xl/workbook.xml")
+	}
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xml.Unmarshal(wb, &workbook); err != nil {
+		return nil, "", fmt.Errorf("xlsx: workbook: %w", err)
+	}
+	rels, err := part("xl/_rels/workbook.xml.rels")
+	if err != nil {
+		return nil, "", err
+	}
+	var relations struct {
+		Rels []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if rels != nil {
+		if err := xml.Unmarshal(rels, &relations); err != nil {
+			return nil, "", fmt.Errorf("xlsx: relationships: %w", err)
+		}
+	}
+
+	var b bytes.Buffer
+	for i, sheet := range workbook.Sheets {
+		target := fmt.Sprintf("worksheets/sheet%d.xml", i+1)
+		for _, r := range relations.Rels {
+			if r.ID == sheet.RID {
+				target = r.Target
+			}
+		}
+		name := path.Clean("xl/" + target)
+		if strings.HasPrefix(target, "/") {
+			name = strings.TrimPrefix(target, "/")
+		}
+		ws, err := part(name)
+		if err != nil {
+			return nil, "", err
+		}
+		if ws == nil {
+			continue
+		}
+		rows, err := xlsxRows(ws, shared)
+		if err != nil {
+			return nil, "", fmt.Errorf("xlsx: sheet %s: %w", sheet.Name, err)
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "# sheet: %s\n", sheet.Name)
+		w := csv.NewWriter(&b)
+		if err := w.WriteAll(rows); err != nil {
+			return nil, "", err
+		}
+	}
+	return b.Bytes(), "csv", nil
+}
+
+// xlsxText is rich or plain text in a shared string or an inline string.
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (x xlsxText) String() string {
+	if len(x.Runs) == 0 {
+		return x.T
+	}
+	var b strings.Builder
+	for _, r := range x.Runs {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+// xlsxRows reads the cell values of a worksheet, placing each cell in the
+// column its reference names so empty cells keep their place.
+func xlsxRows(ws []byte, shared []string) ([][]string, error) {
+	var sheet struct {
+		Rows []struct {
+			Cells []struct {
+				Ref    string   `xml:"r,attr"`
+				Type   string   `xml:"t,attr"`
+				Value  string   `xml:"v"`
+				Inline xlsxText `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.Unmarshal(ws, &sheet); err != nil {
+		return nil, err
+	}
+	rows := make([][]string, 0, len(sheet.Rows))
+	for _, r := range sheet.Rows {
+		var row []string
+		for _, c := range r.Cells {
+			v := c.Value
+			switch c.Type {
+			case "s":
+				if n, err := strconv.Atoi(v); err == nil && n >= 0 && n < len(shared) {
+					v = shared[n]
+				}
+			case "inlineStr":
+				v = c.Inline.String()
+			case "b":
+				v = map[string]string{"0": "FALSE", "1": "TRUE"}[v]
+			}
+			col := len(row)
+			if n := xlsxColumn(c.Ref); n >= col && n < col+16384 {
+				col = n
+			}
+			for len(row) < col {
+				row = append(row, "")
+			}
+			row = append(row, v)
+		}
+		rows = append(rows, row)
+	}
+	// the CSV writer needs no equal lengths, but readers do
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+	for i := range rows {
+		for len(rows[i]) < width {
+			rows[i] = append(rows[i], "")
+		}
+	}
+	return rows, nil
+}
+
+// xlsxColumn returns the zero-based column of a cell reference such as
+// "C7", or -1 when there is none.
+func xlsxColumn(ref string) int {
+	col := 0
+	i := 0
+	for ; i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z'; i++ {
+		col = col*26 + int(ref[i]-'A'+1)
+	}
+	if i == 0 {
+		return -1
+	}
+	return col - 1
+}
@@ -0,0 +1,305 @@
+package generator
+
+import (
+	"cmp"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"math"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// coreHistory is how many recent commits count towards a file's changes.
+const coreHistory = 500
+
+// FileClass tells whether a file is core to the project or periphery.
+type FileClass struct {
+	Path    string  `json:"path"`
+	FanIn   int     `json:"fanIn"`   // files importing it (Go: packages importing its package)
+	Changes int     `json:"changes"` // commits touching it among the last 500
+	Score   float64 `json:"score"`   // fan-in and changes, each relative to the most of the set: 0 to 2
+	Core    bool    `json:"core"`
+}
+
+// classifyFiles ranks files, slash-separated paths relative to
+// projectRoot, by how many of the others import them and how often git
+// history changed them; the best quarter with a score above 0 is core. The
+// result is ordered by score, highest first. Without git only fan-in
+// counts; a missing git binary is an unavailable feature.
+func classifyFiles(fsys sourceFS, projectRoot string, files []string, history bool, degrade *degrader) ([]FileClass, error) {
+	fanIn := importFanIn(fsys, projectRoot, files)
+	var changes map[string]int
+	if history {
+		var err error
+		if changes, err = gitChanges(projectRoot); err != nil {
+			if toolMissing(err) {
+				err = &unavailableError{feature: "core classification", detail: "git: " + err.Error()}
+			}
+			if err := degrade.handle(err, "files classified by imports alone"); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	maxFanIn, maxChanges := 0, 0
+	for _, f := range files {
+		maxFanIn, maxChanges = max(maxFanIn, fanIn[f]), max(maxChanges, changes[f])
+	}
+	classes := make([]FileClass, len(files))
+	for i, f := range files {
+		c := FileClass{Path: f, FanIn: fanIn[f], Changes: changes[f]}
+		if maxFanIn > 0 {
+			c.Score += float64(c.FanIn) / float64(maxFanIn)
+		}
+		if maxChanges > 0 {
+			c.Score += float64(c.Changes) / float64(maxChanges)
+		}
+		c.Score = math.Round(c.Score*100) / 100
+		classes[i] = c
+	}
+	slices.SortStableFunc(classes, func(a, b FileClass) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score), strings.Compare(a.Path, b.Path))
+	})
+	quarter := (len(classes) + 3) / 4
+	for i := range classes[:quarter] {
+		classes[i].Core = classes[i].Score > 0
+	}
+	return classes, nil
+}
+
+// coreOrder applies a source's core setting to files: "first" moves core
+// files to the front and "only" drops the periphery. Both keep the order
+// within a group.
+func coreOrder(src cfg.Source, classes []FileClass, files []string) []string {
+	core := make(map[string]bool)
+	for _, c := range classes {
+		core[c.Path] = c.Core
+	}
+	out := make([]string, 0, len(files))
+	for _, f := range files {
+		if core[f] {
+			out = append(out, f)
+		}
+	}
+	if strings.EqualFold(src.Core, "only") {
+		return out
+	}
+	for _, f := range files {
+		if !core[f] {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// gitChanges counts the commits among the last coreHistory that touched
+// each file below dir, by path relative to dir. Outside a work tree the
+// counts are empty; only a missing git binary is an error.
+func gitChanges(dir string) (map[string]int, error) {
+	cmd := exec.Command("git", "log", "-n", strconv.Itoa(coreHistory), "--format=", "--name-only", "--relative", "--", ".")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		if toolMissing(err) {
+			return nil, err
+		}
+		return nil, nil
+	}
+	changes := make(map[string]int)
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			changes[line]++
+		}
+	}
+	return changes, nil
+}
+
+var (
+	jsSpecRe     = regexp.MustCompile(`(?m)(?:\bfrom\s*|^\s*import\s*|\brequire\(\s*|\bimport\(\s*)['"](\.{1,2}/[^'"]+)['"]`)
+	pyFromSpecRe = regexp.MustCompile(`(?m)^\s*from\s+(\.*[\w.]*)\s+import\b`)
+)
+
+// jsExtensions are tried, in order, for a relative JS/TS import without
+// one, also as dir/index.<ext>.
+var jsExtensions = []string{".ts", ".tsx", ".js", ".jsx", ".mjs", ".cjs", ".mts", ".cts"}
+
+// importFanIn counts, for every file, the files of the set that import it:
+// Go files through their package (each importing package counts once),
+// JS/TS files through relative imports and Python files through relative
+// and project-absolute "from" imports.
+func importFanIn(fsys sourceFS, projectRoot string, files []string) map[string]int {
+	set := make(map[string]bool, len(files))
+	goDirs := make(map[string][]string) // package dir -> its Go files
+	for _, f := range files {
+		set[f] = true
+		if strings.HasSuffix(f, ".go") {
+			goDirs[path.Dir(f)] = append(goDirs[path.Dir(f)], f)
+		}
+	}
+	modulePath := goModulePath(fsys, projectRoot)
+	importers := make(map[string]map[string]bool) // file -> importing files or packages
+	add := func(target, from string) {
+		if importers[target] == nil {
+			importers[target] = make(map[string]bool)
+		}
+		importers[target][from] = true
+	}
+
+	for _, f := range files {
+		data, err := fsys.ReadFile(filepath.Join(projectRoot, filepath.FromSlash(f)))
+		if err != nil {
+			continue
+		}
+		dir := path.Dir(f)
+		switch ext := strings.ToLower(path.Ext(f)); {
+		case ext == ".go" && modulePath != "":
+			parsed, err := parser.ParseFile(token.NewFileSet(), f, data, parser.ImportsOnly)
+			if err != nil {
+				continue
+			}
+			for _, spec := range parsed.Imports {
+				p, _ := strconv.Unquote(spec.Path.Value)
+				rest, ok := strings.CutPrefix(p, modulePath)
+				if !ok || (rest != "" && rest[0] != '/') {
+					continue
+				}
+				target := cmp.Or(strings.TrimPrefix(rest, "/"), ".")
+				if target == dir {
+					continue
+				}
+				for _, g := range goDirs[target] {
+					add(g, dir)
+				}
+			}
+		case slices.Contains(jsExtensions, ext):
+			for _, m := range jsSpecRe.FindAllStringSubmatch(string(data), -1) {
+				if target := resolveJSImport(set, path.Join(dir, m[1])); target != "" && target != f {
+					add(target, f)
+				}
+			}
+		case ext == ".py":
+			for _, m := range pyFromSpecRe.FindAllStringSubmatch(string(data), -1) {
+				if target := resolvePyImport(set, dir, m[1]); target != "" && target != f {
+					add(target, f)
+				}
+			}
+		}
+	}
+
+	fanIn := make(map[string]int, len(importers))
+	for f, from := range importers {
+		fanIn[f] = len(from)
+	}
+	return fanIn
+}
+
+func resolveJSImport(set map[string]bool, p string) string {
+	if set[p] {
+		return p
+	}
+	for _, base := range []string{p, p + "/index"} {
+		for _, ext := range jsExtensions {
+			if set[base+ext] {
+				return base + ext
+			}
+		}
+	}
+	return ""
+}
+
+// resolvePyImport finds the module of "from <mod> import": relative to
+// dir when mod starts with dots, else relative to the project root.
+func resolvePyImport(set map[string]bool, dir, mod string) string {
+	dots := len(mod) - len(strings.TrimLeft(mod, "."))
+	base := ""
+	if dots > 0 {
+		base = dir
+		for range dots - 1 {
+			base = path.Dir(base)
+		}
+	}
+	name := strings.ReplaceAll(mod[dots:], ".", "/")
+	p := path.Join(base, name)
+	for _, candidate := range []string{p + ".py", path.Join(p, "__init__.py")} {
+		if set[candidate] {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// DocumentClasses is the classification of the files a document embeds.
+type DocumentClasses struct {
+	Document string      `json:"document"`
+	Files    []FileClass `json:"files"`
+}
+
+// Classify classifies, per document, the files matched by its file and
+// outline sources as core or periphery, the way their core setting does.
+func Classify(c cfg.Config, projectRoot string, opts Options) ([]DocumentClasses, error) {
+	if err := opts.setup(c, projectRoot); err != nil {
+		return nil, err
+	}
+	var out []DocumentClasses
+	for _, doc := range c.Documents {
+		name := cmp.Or(doc.Name, doc.Targets()[0].Path)
+		opts.degrade = &degrader{doc: name, strict: opts.StrictFeatures, warn: opts.warn}
+		var files []string
+		seen := make(map[string]bool)
+		for _, src := range doc.Sources {
+			if kind := strings.ToLower(src.Type); kind != "file" && kind != "outline" {
+				continue
+			}
+			paths, _, err := splitSelectors(projectRoot, src.SourcePaths)
+			if err != nil {
+				return nil, err
+			}
+			matched, err := sourceFiles(opts.files, projectRoot, paths, src, nil)
+			if err != nil {
+				return nil, fmt.Errorf("collect files for %q: %w", src.Type, err)
+			}
+			for _, f := range matched {
+				if !seen[f] {
+					seen[f] = true
+					files = append(files, f)
+				}
+			}
+		}
+		classes, err := classifyFiles(opts.files, projectRoot, files, opts.FS == nil, opts.degrade)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, DocumentClasses{Document: name, Files: classes})
+	}
+	return out, nil
+}
+
+// WriteClasses prints, per document, every file with its class, fan-in,
+// changes and score, core files first.
+func WriteClasses(w io.Writer, docs []DocumentClasses) {
+	for _, d := range docs {
+		core := 0
+		for _, f := range d.Files {
+			if f.Core {
+				core++
+			}
+		}
+		fmt.Fprintf(w, "%s: %d files, %d core\n", d.Document, len(d.Files), core)
+		for _, f := range d.Files {
+			class := "periphery"
+			if f.Core {
+				class = "core"
+			}
+			fmt.Fprintf(w, "  %-9s %4d in %5d changes %5.2f  %s\n", class, f.FanIn, f.Changes, f.Score, f.Path)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package generator
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// coverage is the statement coverage of files, in percent, keyed by their
+// slash-separated path relative to the project root.
+type coverage map[string]float64
+
+// loadCoverage reads a Go coverage profile (go test -coverprofile) at
+// profile, relative to projectRoot. Files are named by import path in the
+// profile; those of modulePath, and absolute paths under the root, are
+// mapped to project files and the others ignored. A block reported by
+// several test binaries counts as covered when any of them ran it.
+func loadCoverage(fsys sourceFS, projectRoot, profile, modulePath string) (coverage, error) {
+	if !filepath.IsAbs(profile) {
+		profile = filepath.Join(projectRoot, profile)
+	}
+	data, err := fsys.ReadFile(profile)
+	if err != nil {
+		return nil, fmt.Errorf("coverageProfile: %w", err)
+	}
+	rootAbs, err := filepath.Abs(projectRoot)
+	if err != nil {
+		return nil, fmt.Errorf("resolve root: %w", err)
+	}
+
+	type block struct {
+		stmts   int
+		covered bool
+	}
+	blocks := make(map[string]map[string]*block) // file -> position -> block
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+		// name.go:12.34,15.2 3 1
+		fields := strings.Fields(line)
+		i := -1
+		if len(fields) == 3 {
+			i = strings.LastIndexByte(fields[0], ':')
+		}
+		if i < 0 {
+			return nil, fmt.Errorf("coverageProfile %s:%d: malformed line %q", filepath.Base(profile), n, line)
+		}
+		stmts, err1 := strconv.Atoi(fields[1])
+		count, err2 := strconv.Atoi(fields[2])
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("coverageProfile %s:%d: malformed line %q", filepath.Base(profile), n, line)
+		}
+		rel, ok := coverageFile(fields[0][:i], rootAbs, modulePath)
+		if !ok {
+			continue
+		}
+		if blocks[rel] == nil {
+			blocks[rel] = make(map[string]*block)
+		}
+		b := blocks[rel][fields[0][i+1:]]
+		if b == nil {
+			b = &block{stmts: stmts}
+			blocks[rel][fields[0][i+1:]] = b
+		}
+		b.covered = b.covered || count > 0
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("coverageProfile: %w", err)
+	}
+
+	cov := make(coverage, len(blocks))
+	for rel, bs := range blocks {
+		total, covered := 0, 0
+		for _, b := range bs {
+			total += b.stmts
+			if b.covered {
+				covered += b.stmts
+			}
+		}
+		if total == 0 {
+			cov[rel] = 100
+			continue
+		}
+		cov[rel] = 100 * float64(covered) / float64(total)
+	}
+	return cov, nil
+}
+
+// coverageFile maps a file named in a coverage profile to its path
+// relative to the project root.
+func coverageFile(name, rootAbs, modulePath string) (string, bool) {
+	if filepath.IsAbs(name) {
+		rel, err := filepath.Rel(rootAbs, name)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", false
+		}
+		return filepath.ToSlash(rel), true
+	}
+	if modulePath == "" {
+		return "", false
+	}
+	rel, ok := strings.CutPrefix(name, modulePath+"/")
+	return path.Clean(rel), ok
+}
+
+// below keeps the files covered less than percent; files the profile does
+// not list are left out.
+func (c coverage) below(files []string, percent float64) []string {
+	return slices.DeleteFunc(slices.Clone(files), func(f string) bool {
+		pct, ok := c[f]
+		return !ok || pct >= percent
+	})
+}
+
+// sort orders files least covered first; files the profile does not list
+// go last, in their previous order.
+func (c coverage) sort(files []string) []string {
+	files = slices.Clone(files)
+	slices.SortStableFunc(files, func(a, b string) int {
+		pa, okA := c[a]
+		pb, okB := c[b]
+		if okA != okB {
+			if okA {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Compare(pa, pb)
+	})
+	return files
+}
+
+// note describes the coverage of rel for the file's annotation.
+func (c coverage) note(rel string) string {
+	pct, ok := c[rel]
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%.1f%% of statements covered", pct)
+}
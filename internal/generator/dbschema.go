@@ -0,0 +1,184 @@
+package generator
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// migrationVersion is the version prefix of a migration file name:
+// "0003" in "0003_users.up.sql", "20240101120000" in goose and
+// golang-migrate names, "2" in Flyway's "V2__users.sql".
+var migrationVersion = regexp.MustCompile(`^[Vv]?(\d+)`)
+
+// renderMigrations reads the migration files (relative to projectRoot) in
+// version order, leaving out down migrations, and concatenates them, each
+// after a "-- path" line, so the schema reads as the sequence that built it.
+func renderMigrations(fsys sourceFS, projectRoot string, files []string, jobs int) (schema []byte, count int, err error) {
+	var ups []string
+	for _, rel := range files {
+		if !strings.Contains(strings.ToLower(filepath.Base(rel)), ".down.") {
+			ups = append(ups, rel)
+		}
+	}
+	slices.SortFunc(ups, func(x, y string) int {
+		vx, vy := migrationVersion.FindStringSubmatch(filepath.Base(x)), migrationVersion.FindStringSubmatch(filepath.Base(y))
+		switch {
+		case vx != nil && vy != nil:
+			// compare as numbers, whatever their zero padding
+			nx, ny := strings.TrimLeft(vx[1], "0"), strings.TrimLeft(vy[1], "0")
+			if c := cmp.Or(cmp.Compare(len(nx), len(ny)), strings.Compare(nx, ny)); c != 0 {
+				return c
+			}
+		case vx != nil:
+			return -1
+		case vy != nil:
+			return 1
+		}
+		return cmp.Or(strings.Compare(filepath.Base(x), filepath.Base(y)), strings.Compare(x, y))
+	})
+	results := readFiles(ups, jobs, func(rel string) fileResult {
+		r := fileResult{rel: rel}
+		r.data, r.err = fsys.ReadFile(filepath.Join(projectRoot, rel))
+		return r
+	})
+	var b bytes.Buffer
+	for i, r := range results {
+		if r.err != nil {
+			return nil, 0, fmt.Errorf("db-schema migration %s: %w", r.rel, r.err)
+		}
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "-- %s\n", filepath.ToSlash(r.rel))
+		writeWithNewline(&b, bytes.TrimSpace(r.data))
+	}
+	return b.Bytes(), len(results), nil
+}
+
+// dumpSchema connects to the database whose URL is in the environment
+// variable src.DSNEnv and returns a title and its schema, as dumped by the
+// client of its scheme: pg_dump for postgres://, mysqldump for mysql://,
+// sqlite3 for sqlite: (relative paths are taken from projectRoot). The URL
+// is never part of the title or errors, as it usually holds a password.
+// A client that is not installed is reported as an unavailableError.
+func dumpSchema(parent context.Context, projectRoot string, src cfg.Source) (title string, schema []byte, err error) {
+	dsn := os.Getenv(src.DSNEnv)
+	if dsn == "" {
+		return "", nil, fmt.Errorf("db-schema source: %s is not set", src.DSNEnv)
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", nil, fmt.Errorf("db-schema source: %s is not a database URL", src.DSNEnv)
+	}
+
+	ctx := parent
+	if src.Timeout != "" {
+		d, err := time.ParseDuration(src.Timeout)
+		if err != nil {
+			return "", nil, fmt.Errorf("db-schema source: invalid timeout %q: %w", src.Timeout, err)
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+
+	var cmd *exec.Cmd
+	scheme := strings.ToLower(u.Scheme)
+	switch scheme {
+	case "postgres", "postgresql":
+		cmd = exec.CommandContext(ctx, "pg_dump", "--schema-only", "--no-owner", "--no-privileges", "--dbname="+dsn)
+	case "mysql":
+		db := strings.TrimPrefix(u.Path, "/")
+		if db == "" {
+			return "", nil, fmt.Errorf("db-schema source: %s names no database", src.DSNEnv)
+		}
+		args := []string{"--no-data", "--compact", "--skip-comments"}
+		if host := u.Hostname(); host != "" {
+			args = append(args, "--host="+host)
+		}
+		if port := u.Port(); port != "" {
+			args = append(args, "--port="+port)
+		}
+		if user := u.User.Username(); user != "" {
+			args = append(args, "--user="+user)
+		}
+		cmd = exec.CommandContext(ctx, "mysqldump", append(args, "--", db)...)
+		if pass, ok := u.User.Password(); ok {
+			// kept off the command line, where other users could read it
+			cmd.Env = append(os.Environ(), "MYSQL_PWD="+pass)
+		}
+	case "sqlite", "sqlite3", "file":
+		file := cmp.Or(u.Opaque, u.Host+u.Path)
+		if file == "" {
+			return "", nil, fmt.Errorf("db-schema source: %s names no database file", src.DSNEnv)
+		}
+		cmd = exec.CommandContext(ctx, "sqlite3", "-readonly", file, ".schema")
+	default:
+		return "", nil, fmt.Errorf("db-schema source: unsupported database scheme %q in %s (expected postgres, mysql or sqlite)", u.Scheme, src.DSNEnv)
+	}
+	cmd.Dir = projectRoot
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	title = fmt.Sprintf("Schema of the %s database in $%s", scheme, src.DSNEnv)
+	out, err := cmd.Output()
+	if err := parent.Err(); err != nil {
+		return title, nil, err
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return title, nil, fmt.Errorf("db-schema source: %s timed out after %s", cmd.Args[0], src.Timeout)
+	}
+	if err != nil {
+		if toolMissing(err) {
+			return title, nil, &unavailableError{feature: "db-schema source", detail: fmt.Sprintf("%s: %v", cmd.Args[0], err)}
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			err = fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return title, nil, fmt.Errorf("db-schema source: %s: %w", cmd.Args[0], err)
+	}
+	return title, cleanDump(out), nil
+}
+
+// cleanDump drops the comments and session settings dump tools surround the
+// DDL with, and squeezes runs of blank lines.
+func cleanDump(out []byte) []byte {
+	var b bytes.Buffer
+	blank := true
+	for _, line := range strings.Split(string(out), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "--"),
+			strings.HasPrefix(trimmed, "SET "),
+			strings.HasPrefix(trimmed, "SELECT pg_catalog.set_config("),
+			strings.HasPrefix(trimmed, "/*!") && strings.HasSuffix(trimmed, "*/;"):
+			continue
+		case trimmed == "":
+			if !blank {
+				b.WriteString("\n")
+			}
+			blank = true
+			continue
+		}
+		b.WriteString(line + "\n")
+		blank = false
+	}
+	if b.Len() == 0 {
+		return []byte("(no tables)\n")
+	}
+	return append(bytes.TrimRight(b.Bytes(), "\n"), '\n')
+}
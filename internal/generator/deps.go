@@ -0,0 +1,294 @@
+package generator
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// depGraph is a directed graph of packages or modules; nodes are listed
+// in order and edges point from a node to the nodes it depends on.
+type depGraph struct {
+	title string
+	nodes []string
+	edges map[string][]string
+	notes map[string]string // per target, e.g. "v3.0.1 (indirect)"
+}
+
+// renderDeps builds the graph of a deps source: the imports between the
+// packages of the Go module in workdir (default the project root), or the
+// requirements of its go.mod.
+func renderDeps(ctx context.Context, fsys sourceFS, projectRoot string, src cfg.Source, history bool, degrade *degrader) (title string, body []byte, lang string, err error) {
+	dir := projectRoot
+	if src.Workdir != "" {
+		dir = src.Workdir
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(projectRoot, src.Workdir)
+		}
+	}
+	var g depGraph
+	if strings.EqualFold(src.Graph, "modules") {
+		g, err = moduleGraph(fsys, dir)
+	} else {
+		g, err = packageGraph(ctx, fsys, dir, history, degrade)
+	}
+	if err != nil {
+		return "", nil, "", err
+	}
+	if strings.EqualFold(src.GraphFormat, "mermaid") {
+		return g.title, []byte(g.mermaid()), "mermaid", nil
+	}
+	return g.title, []byte(g.text()), "", nil
+}
+
+// packageGraph lists the packages of the module in dir and their imports
+// of each other. It asks go list, which honours build constraints; without
+// a go binary, or when reading from a snapshot rather than the work tree,
+// the imports are read from the non-test source files instead.
+func packageGraph(ctx context.Context, fsys sourceFS, dir string, useGo bool, degrade *degrader) (depGraph, error) {
+	modulePath := goModulePath(fsys, dir)
+	if modulePath == "" {
+		return depGraph{}, fmt.Errorf("deps source: no go.mod with a module line in %s", dir)
+	}
+	var imports map[string][]string
+	if useGo {
+		var err error
+		if imports, err = goListImports(ctx, dir); err != nil {
+			if toolMissing(err) {
+				err = &unavailableError{feature: "deps", detail: "go: " + err.Error()}
+			}
+			if err := degrade.handle(err, "package imports read from the source files"); err != nil {
+				return depGraph{}, err
+			}
+		}
+	}
+	if imports == nil {
+		var err error
+		if imports, err = parseImports(fsys, dir); err != nil {
+			return depGraph{}, err
+		}
+	}
+
+	// import path -> path relative to the module, "." for its root
+	short := func(p string) (string, bool) {
+		rest, ok := strings.CutPrefix(p, modulePath)
+		if !ok || (rest != "" && rest[0] != '/') {
+			return "", false
+		}
+		return cmp.Or(strings.TrimPrefix(rest, "/"), "."), true
+	}
+	g := depGraph{edges: make(map[string][]string)}
+	count := 0
+	for pkg, deps := range imports {
+		from, ok := short(pkg)
+		if !ok {
+			continue
+		}
+		g.nodes = append(g.nodes, from)
+		for _, d := range deps {
+			if to, ok := short(d); ok && to != from && !slices.Contains(g.edges[from], to) {
+				g.edges[from] = append(g.edges[from], to)
+				count++
+			}
+		}
+		slices.Sort(g.edges[from])
+	}
+	slices.Sort(g.nodes)
+	g.title = fmt.Sprintf("Package graph of %s (%s, %s)", modulePath, countOf(len(g.nodes), "package"), countOf(count, "import"))
+	return g, nil
+}
+
+// goListImports runs go list in dir and returns the imports of every
+// package of the module by import path.
+func goListImports(ctx context.Context, dir string) (map[string][]string, error) {
+	cmd := exec.CommandContext(ctx, "go", "list", "-e", "-f", "{{.ImportPath}}{{range .Imports}} {{.}}{{end}}", "./...")
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err != nil {
+		if toolMissing(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("go list in %s: %w: %s", dir, err, strings.TrimSpace(stderr.String()))
+	}
+	imports := make(map[string][]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			imports[fields[0]] = fields[1:]
+		}
+	}
+	return imports, nil
+}
+
+// parseImports reads the imports of the non-test Go files below dir,
+// skipping vendor and testdata, by package import path.
+func parseImports(fsys sourceFS, dir string) (map[string][]string, error) {
+	modulePath := goModulePath(fsys, dir)
+	files, err := collectFiles(fsys, dir, []string{"."}, "*.go,!*_test.go", []string{"vendor/", "testdata/"})
+	if err != nil {
+		return nil, fmt.Errorf("collect files for \"deps\": %w", err)
+	}
+	imports := make(map[string][]string)
+	for _, f := range files {
+		data, err := fsys.ReadFile(filepath.Join(dir, filepath.FromSlash(f)))
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", f, err)
+		}
+		parsed, err := parser.ParseFile(token.NewFileSet(), f, data, parser.ImportsOnly)
+		if err != nil {
+			continue
+		}
+		pkg := modulePath
+		if d := path.Dir(f); d != "." {
+			pkg += "/" + d
+		}
+		if _, ok := imports[pkg]; !ok {
+			imports[pkg] = nil
+		}
+		for _, spec := range parsed.Imports {
+			p, _ := strconv.Unquote(spec.Path.Value)
+			imports[pkg] = append(imports[pkg], p)
+		}
+	}
+	return imports, nil
+}
+
+// moduleGraph lists the requirements in the go.mod of dir, with their
+// versions and replacements.
+func moduleGraph(fsys sourceFS, dir string) (depGraph, error) {
+	data, err := fsys.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return depGraph{}, fmt.Errorf("deps source: read go.mod: %w", err)
+	}
+	var module, goVersion string
+	var reqs []string
+	notes := make(map[string]string)
+	replaces := make(map[string]string)
+	block := "" // directive of the open "require (" or "replace (" block
+	for _, line := range strings.Split(string(data), "\n") {
+		line, comment, _ := strings.Cut(line, "//")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		directive := block
+		switch {
+		case fields[0] == ")":
+			block = ""
+			continue
+		case block != "":
+		case len(fields) == 2 && fields[1] == "(":
+			block = fields[0]
+			continue
+		case fields[0] == "module" && len(fields) > 1:
+			module = strings.Trim(fields[1], "\"")
+			continue
+		case fields[0] == "go" && len(fields) > 1:
+			goVersion = fields[1]
+			continue
+		default:
+			directive, fields = fields[0], fields[1:]
+		}
+		switch {
+		case directive == "require" && len(fields) >= 2:
+			reqs = append(reqs, fields[0])
+			notes[fields[0]] = fields[1]
+			if strings.TrimSpace(comment) == "indirect" {
+				notes[fields[0]] += " (indirect)"
+			}
+		case directive == "replace":
+			if i := slices.Index(fields, "=>"); i > 0 && i+1 < len(fields) {
+				replaces[fields[0]] = strings.Join(fields[i+1:], " ")
+			}
+		}
+	}
+	if module == "" {
+		return depGraph{}, fmt.Errorf("deps source: go.mod in %s has no module line", dir)
+	}
+	for r, to := range replaces {
+		if _, ok := notes[r]; ok {
+			notes[r] += " => " + to
+		}
+	}
+	title := fmt.Sprintf("Module graph of %s (%s)", module, countOf(len(reqs), "requirement"))
+	if goVersion != "" {
+		title = fmt.Sprintf("Module graph of %s (go %s, %s)", module, goVersion, countOf(len(reqs), "requirement"))
+	}
+	return depGraph{
+		title: title,
+		nodes: []string{module},
+		edges: map[string][]string{module: reqs},
+		notes: notes,
+	}, nil
+}
+
+// text renders the graph as one line per node followed by its edges.
+func (g depGraph) text() string {
+	var b strings.Builder
+	for _, n := range g.nodes {
+		b.WriteString(n + "\n")
+		for _, to := range g.edges[n] {
+			b.WriteString("  -> " + to)
+			if note := g.notes[to]; note != "" {
+				b.WriteString(" " + note)
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// mermaid renders the graph as a left-to-right Mermaid flowchart.
+func (g depGraph) mermaid() string {
+	ids := make(map[string]string)
+	var b strings.Builder
+	b.WriteString("graph LR\n")
+	node := func(n string) string {
+		if id, ok := ids[n]; ok {
+			return id
+		}
+		id := "n" + strconv.Itoa(len(ids))
+		ids[n] = id
+		label := n
+		if note := g.notes[n]; note != "" {
+			label += " " + note
+		}
+		fmt.Fprintf(&b, "  %s[\"%s\"]\n", id, strings.ReplaceAll(label, `"`, "#quot;"))
+		return id
+	}
+	for _, n := range g.nodes {
+		node(n)
+	}
+	var edges []string
+	for _, n := range g.nodes {
+		for _, to := range g.edges[n] {
+			edges = append(edges, fmt.Sprintf("  %s --> %s\n", node(n), node(to)))
+		}
+	}
+	for _, e := range edges {
+		b.WriteString(e)
+	}
+	return b.String()
+}
+
+func countOf(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,212 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// maxDiffEdits bounds the edit distance explored by myersDiff; beyond it the
+// files are reported as a full replacement to keep memory use predictable.
+const maxDiffEdits = 4000
+
+type editOp int
+
+const (
+	opEqual editOp = iota
+	opDelete
+	opInsert
+)
+
+type edit struct {
+	op   editOp
+	a, b int // line indexes in the old and new text
+}
+
+// unifiedDiff returns a unified diff between a and b, labeled with the given
+// names, or "" when they are equal.
+func unifiedDiff(nameA, nameB string, a, b []byte) string {
+	la, lb := splitLines(a), splitLines(b)
+	edits := myersDiff(la, lb)
+
+	var out strings.Builder
+	for start := 0; start < len(edits); {
+		// find next change
+		for start < len(edits) && edits[start].op == opEqual {
+			start++
+		}
+		if start == len(edits) {
+			break
+		}
+		lo := max(start-diffContext, 0)
+		end := start
+		// extend the hunk while changes are within 2*context of each other
+		for i := start; i < len(edits); i++ {
+			if edits[i].op != opEqual {
+				end = i
+				continue
+			}
+			if i-end > 2*diffContext {
+				break
+			}
+		}
+		hi := min(end+diffContext+1, len(edits))
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", nameA, nameB)
+		}
+		writeHunk(&out, edits[lo:hi], la, lb)
+		start = hi
+	}
+	return out.String()
+}
+
+func writeHunk(out *strings.Builder, edits []edit, la, lb []string) {
+	startA, startB := -1, -1
+	countA, countB := 0, 0
+	for _, e := range edits {
+		if e.op != opInsert {
+			if startA < 0 {
+				startA = e.a
+			}
+			countA++
+		}
+		if e.op != opDelete {
+			if startB < 0 {
+				startB = e.b
+			}
+			countB++
+		}
+	}
+	// unified diff line numbers are 1-based; an empty range points at the line before
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(startA, countA, edits[0].a), hunkRange(startB, countB, edits[0].b))
+	for _, e := range edits {
+		switch e.op {
+		case opEqual:
+			out.WriteString(" " + la[e.a])
+		case opDelete:
+			out.WriteString("-" + la[e.a])
+		case opInsert:
+			out.WriteString("+" + lb[e.b])
+		}
+	}
+}
+
+func hunkRange(start, count, fallback int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", fallback)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// splitLines splits text into newline-terminated lines; a missing final
+// newline is marked the way diff(1) does.
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	parts := bytes.SplitAfter(data, []byte{'\n'})
+	if len(parts[len(parts)-1]) == 0 {
+		parts = parts[:len(parts)-1]
+	}
+	lines := make([]string, len(parts))
+	for i, p := range parts {
+		lines[i] = string(p)
+	}
+	if last := lines[len(lines)-1]; !strings.HasSuffix(last, "\n") {
+		lines[len(lines)-1] = last + "\n\\ No newline at end of file\n"
+	}
+	return lines
+}
+
+// myersDiff computes a shortest edit script from a to b (Myers, 1986).
+func myersDiff(a, b []string) []edit {
+	n, m := len(a), len(b)
+	maxD := n + m
+	if maxD > maxDiffEdits {
+		maxD = maxDiffEdits
+	}
+	offset := maxD
+	v := make([]int, 2*maxD+2)
+	var trace [][]int
+
+	for d := 0; d <= maxD; d++ {
+		snapshot := make([]int, len(v))
+		copy(snapshot, v)
+		trace = append(trace, snapshot)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b, offset, d)
+			}
+		}
+	}
+	return replaceAll(n, m)
+}
+
+// replaceAll is the fallback edit script: delete every old line, insert every new one.
+func replaceAll(n, m int) []edit {
+	edits := make([]edit, 0, n+m)
+	for i := 0; i < n; i++ {
+		edits = append(edits, edit{opDelete, i, 0})
+	}
+	for j := 0; j < m; j++ {
+		edits = append(edits, edit{opInsert, n, j})
+	}
+	return edits
+}
+
+func backtrack(trace [][]int, a, b []string, offset, d int) []edit {
+	x, y := len(a), len(b)
+	var edits []edit
+	for ; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			edits = append(edits, edit{opEqual, x, y})
+		}
+		if x == prevX {
+			y--
+			edits = append(edits, edit{opInsert, x, y})
+		} else {
+			x--
+			edits = append(edits, edit{opDelete, x, y})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		edits = append(edits, edit{opEqual, x, y})
+	}
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
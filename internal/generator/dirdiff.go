@@ -0,0 +1,120 @@
+package generator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// dirDiff is the result of comparing two directory trees.
+type dirDiff struct {
+	left, right string   // the configured paths, used as labels
+	onlyLeft    []string // relative paths present only in left
+	onlyRight   []string // relative paths present only in right
+	differing   []string // relative paths whose contents differ
+	diffs       []string // unified diffs for differing, when requested
+}
+
+// runDirDiff compares src.Left and src.Right (relative to projectRoot).
+// Both sides are filtered by src.FilePattern and src.ExcludePaths, with
+// exclude globs matched against paths relative to each side. With
+// src.IgnoreWhitespace, files differing only in whitespace count as equal.
+func runDirDiff(fsys sourceFS, projectRoot string, src cfg.Source) (dirDiff, error) {
+	d := dirDiff{left: src.Left, right: src.Right}
+	if strings.TrimSpace(src.Left) == "" || strings.TrimSpace(src.Right) == "" {
+		return d, errors.New("dirdiff source: left and right are required")
+	}
+
+	leftAbs, rightAbs := resolveUnder(projectRoot, src.Left), resolveUnder(projectRoot, src.Right)
+	for _, dir := range []string{leftAbs, rightAbs} {
+		info, err := fsys.Stat(dir)
+		if err != nil {
+			return d, fmt.Errorf("dirdiff source: %w", err)
+		}
+		if !info.IsDir() {
+			return d, fmt.Errorf("dirdiff source: %s is not a directory", dir)
+		}
+	}
+
+	leftFiles, err := sourceFiles(fsys, leftAbs, []string{"*"}, src, nil)
+	if err != nil {
+		return d, fmt.Errorf("collect files in %s: %w", src.Left, err)
+	}
+	rightFiles, err := sourceFiles(fsys, rightAbs, []string{"*"}, src, nil)
+	if err != nil {
+		return d, fmt.Errorf("collect files in %s: %w", src.Right, err)
+	}
+
+	// both lists are sorted: merge them
+	i, j := 0, 0
+	for i < len(leftFiles) || j < len(rightFiles) {
+		switch {
+		case j == len(rightFiles) || (i < len(leftFiles) && leftFiles[i] < rightFiles[j]):
+			d.onlyLeft = append(d.onlyLeft, leftFiles[i])
+			i++
+		case i == len(leftFiles) || rightFiles[j] < leftFiles[i]:
+			d.onlyRight = append(d.onlyRight, rightFiles[j])
+			j++
+		default:
+			rel := leftFiles[i]
+			i++
+			j++
+			a, err := fsys.ReadFile(filepath.Join(leftAbs, rel))
+			if err != nil {
+				return d, fmt.Errorf("read %s: %w", rel, err)
+			}
+			b, err := fsys.ReadFile(filepath.Join(rightAbs, rel))
+			if err != nil {
+				return d, fmt.Errorf("read %s: %w", rel, err)
+			}
+			if bytes.Equal(a, b) || (src.IgnoreWhitespace && equalIgnoringWhitespace(a, b)) {
+				continue
+			}
+			d.differing = append(d.differing, rel)
+			if src.UnifiedDiff {
+				nameA := path.Join(filepath.ToSlash(src.Left), rel)
+				nameB := path.Join(filepath.ToSlash(src.Right), rel)
+				if isBinary(a) || isBinary(b) {
+					d.diffs = append(d.diffs, fmt.Sprintf("Binary files %s and %s differ\n", nameA, nameB))
+				} else {
+					d.diffs = append(d.diffs, unifiedDiff(nameA, nameB, a, b))
+				}
+			}
+		}
+	}
+	return d, nil
+}
+
+// summary lists the three groups with their counts.
+func (d dirDiff) summary() []byte {
+	var b bytes.Buffer
+	group := func(title string, paths []string) {
+		fmt.Fprintf(&b, "%s (%d)\n", title, len(paths))
+		for _, p := range paths {
+			fmt.Fprintf(&b, "  %s\n", p)
+		}
+	}
+	group("Only in "+d.left, d.onlyLeft)
+	group("Only in "+d.right, d.onlyRight)
+	group("Differing", d.differing)
+	return b.Bytes()
+}
+
+// isBinary reports whether data looks binary, the way git decides: a NUL
+// byte within the first 8000 bytes.
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0
+}
+
+// resolveUnder returns p unchanged if absolute, otherwise joined to root.
+func resolveUnder(root, p string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(root, p)
+}
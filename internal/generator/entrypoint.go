@@ -0,0 +1,51 @@
+package generator
+
+import (
+	"path"
+	"strings"
+)
+
+// entrypointNames are base names that start a program wherever they are.
+var entrypointNames = setOf("main.go", "manage.py", "__main__.py", "wsgi.py", "asgi.py",
+	"main.rs", "main.c", "main.cpp", "Main.java", "Program.cs", "artisan")
+
+// rootEntrypointNames start a program when they sit at the project root or
+// directly in a src/ or public/ directory (index.ts of a package, index.php
+// of a web app).
+var rootEntrypointNames = setOf("index.js", "index.mjs", "index.cjs", "index.ts", "index.jsx", "index.tsx",
+	"main.js", "main.ts", "server.js", "server.ts", "app.js", "app.ts", "main.py", "app.py", "index.php")
+
+// isEntrypoint reports whether the slash-separated path rel looks like the
+// place a program starts: main.go and every Go file directly in cmd/<name>/,
+// index.ts, manage.py and the like.
+func isEntrypoint(rel string) bool {
+	dir, base := path.Split(rel)
+	dir = strings.TrimSuffix(dir, "/")
+	switch {
+	case entrypointNames[base]:
+		return true
+	case strings.HasSuffix(base, ".go") && !strings.HasSuffix(base, "_test.go"):
+		return dir != "" && path.Base(path.Dir(dir)) == "cmd"
+	case rootEntrypointNames[base]:
+		d := path.Base(dir)
+		return dir == "" || d == "src" || d == "public"
+	}
+	return false
+}
+
+// entrypointsFirst moves the entry points among files to the front, keeping
+// the order within both groups.
+func entrypointsFirst(files []string) []string {
+	out := make([]string, 0, len(files))
+	for _, f := range files {
+		if isEntrypoint(f) {
+			out = append(out, f)
+		}
+	}
+	for _, f := range files {
+		if !isEntrypoint(f) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
@@ -0,0 +1,88 @@
+package generator
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// retryDelays are the pauses before the further attempts of a document with
+// failurePolicy retry.
+var retryDelays = []time.Duration{time.Second, 2 * time.Second}
+
+// sleep pauses for d, or until ctx is done and returns its error.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// DocumentFailure is a document left out of a run by its failurePolicy.
+type DocumentFailure struct {
+	Document string
+	Err      error
+}
+
+// FailedDocumentsError lists the documents that failed while the others
+// were rendered (failurePolicy continue or retry).
+type FailedDocumentsError struct {
+	Failures []DocumentFailure
+}
+
+func (e *FailedDocumentsError) Error() string {
+	msgs := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		msgs[i] = fmt.Sprintf("%s: %v", f.Document, f.Err)
+	}
+	return fmt.Sprintf("%d document(s) failed: %s", len(e.Failures), strings.Join(msgs, "; "))
+}
+
+// renderIsolated renders doc so that its failure, a panic included, stays
+// its own: with failurePolicy retry it is attempted again after each of
+// retryDelays, and a final failure is reported as a document_failed event.
+func renderIsolated(c cfg.Config, doc cfg.Document, projectRoot string, opts Options) ([]Output, error) {
+	attempts := 1
+	if strings.EqualFold(doc.FailurePolicy, "retry") {
+		attempts += len(retryDelays)
+	}
+	name := cmp.Or(doc.Name, doc.Targets()[0].Path)
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		var outs []Output
+		if outs, err = renderRecovered(c, doc, projectRoot, opts); err == nil {
+			return outs, nil
+		}
+		if attempt < attempts {
+			if opts.ctx().Err() != nil {
+				break
+			}
+			opts.warn(Warning{Document: name, Msg: fmt.Sprintf("attempt %d of %d failed, retrying: %v", attempt, attempts, err)})
+			if err := sleep(opts.ctx(), retryDelays[attempt-1]); err != nil {
+				break
+			}
+		}
+	}
+	if p := strings.ToLower(doc.FailurePolicy); p == "continue" || p == "retry" {
+		opts.progress(Event{Event: EventDocumentFailed, Document: name, Msg: err.Error()})
+	}
+	return nil, err
+}
+
+// renderRecovered is renderOne with a panic turned into an error.
+func renderRecovered(c cfg.Config, doc cfg.Document, projectRoot string, opts Options) (outs []Output, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return renderOne(c, doc, projectRoot, opts)
+}
@@ -0,0 +1,65 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"sync"
+)
+
+// unavailablePrefix starts the message of warnings about configured
+// features this machine cannot provide.
+const unavailablePrefix = "unavailable: "
+
+// unavailableError reports that a feature needs a tool missing on this
+// platform, such as the executable of a command source or the shell that
+// runs filterCommand. Unless Options.StrictFeatures is set, generation goes
+// on without the feature and reports it as a warning.
+type unavailableError struct {
+	feature string // config key of the feature, e.g. "filterCommand"
+	detail  string
+}
+
+func (e *unavailableError) Error() string {
+	return fmt.Sprintf("%s is unavailable: %s", e.feature, e.detail)
+}
+
+// toolMissing reports whether err from running a command means the program
+// could not be found: exec's lookup failed, or the shell exited with 127
+// ("command not found").
+func toolMissing(err error) bool {
+	var exitErr *exec.ExitError
+	return errors.Is(err, exec.ErrNotFound) || errors.As(err, &exitErr) && exitErr.ExitCode() == 127
+}
+
+// degrader turns unavailableErrors into one warning per feature and
+// document, or keeps them as errors under StrictFeatures. It is safe for
+// concurrent use by file workers.
+type degrader struct {
+	doc    string
+	strict bool
+	warn   func(Warning)
+
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+// handle returns err unless it is an unavailableError to degrade from;
+// then it warns (once per feature) and returns nil, and the caller carries
+// on without the feature, doing what fallback describes.
+func (d *degrader) handle(err error, fallback string) error {
+	var ue *unavailableError
+	if d == nil || d.strict || !errors.As(err, &ue) {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.seen[ue.feature] {
+		if d.seen == nil {
+			d.seen = make(map[string]bool)
+		}
+		d.seen[ue.feature] = true
+		d.warn(Warning{Document: d.doc, Path: ue.feature, Msg: unavailablePrefix + ue.detail + "; " + fallback})
+	}
+	return nil
+}
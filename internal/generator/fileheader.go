@@ -0,0 +1,66 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"strings"
+)
+
+// fileHeader renders the metadata shown under an embedded file's heading,
+// e.g. "4.2 KiB · 180 lines · sha256 9f86d0… · modified 2024-05-01 09:30 ·
+// last commit 1a2b3c4 2024-04-30 by Alice". Size, lines and hash describe
+// the file on disk, before decoding, filters and transforms. It is empty
+// without fields.
+func fileHeader(ctx context.Context, projectRoot, rel string, fields []string, info fs.FileInfo, data []byte, onDisk bool) (string, error) {
+	var parts []string
+	for _, f := range fields {
+		switch strings.ToLower(f) {
+		case "size":
+			parts = append(parts, humanBytes(int(info.Size())))
+		case "lines":
+			parts = append(parts, fmt.Sprintf("%d lines", countLines(data)))
+		case "sha256":
+			sum := sha256.Sum256(data)
+			parts = append(parts, "sha256 "+hex.EncodeToString(sum[:]))
+		case "modtime":
+			parts = append(parts, "modified "+info.ModTime().Format("2006-01-02 15:04"))
+		case "commit":
+			if !onDisk {
+				return "", errors.New("fileHeader commit needs the project on disk")
+			}
+			commit, err := lastCommit(ctx, projectRoot, rel)
+			if err != nil {
+				return "", err
+			}
+			if commit != "" {
+				parts = append(parts, commit)
+			}
+		}
+	}
+	return strings.Join(parts, " · "), nil
+}
+
+// lastCommit describes the newest commit touching rel as "last commit
+// 1a2b3c4 2024-04-30 by Alice", or returns "" for files git does not track.
+func lastCommit(ctx context.Context, projectRoot, rel string) (string, error) {
+	out, err := git(ctx, projectRoot, "log", "-1", "--format=%h%x00%cs%x00%an", "--", rel)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		// not a repository
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("fileHeader: %w", err)
+	}
+	f := bytes.Split(bytes.TrimSpace(out), []byte{0})
+	if len(f) != 3 {
+		return "", nil
+	}
+	return fmt.Sprintf("last commit %s %s by %s", f[0], f[1], f[2]), nil
+}
@@ -0,0 +1,189 @@
+package generator
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ReadFileList reads a newline-separated list of paths, such as the output
+// of git diff --name-only or fzf -m. Blank lines are skipped and surrounding
+// whitespace, including a "\r" before the newline, is trimmed. An empty
+// list is not nil: as Options.FileList it selects no files.
+func ReadFileList(r io.Reader) ([]string, error) {
+	list := []string{}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" {
+			list = append(list, line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read file list: %w", err)
+	}
+	return list, nil
+}
+
+// documentFileList returns the file list a document's sources take their
+// files from: Options.FileList, or the document's filesFrom file (relative
+// to the project root), or nil when the document walks its sourcePaths.
+// Entries are made slash-separated and relative to rootAbs; absolute ones
+// outside it are dropped.
+func documentFileList(opts Options, rootAbs, filesFrom string) ([]string, error) {
+	list := opts.FileList
+	if list == nil && filesFrom != "" {
+		name := filesFrom
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(rootAbs, name)
+		}
+		data, err := opts.files.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("filesFrom: %w", err)
+		}
+		if list, err = ReadFileList(bytes.NewReader(data)); err != nil {
+			return nil, fmt.Errorf("filesFrom: %w", err)
+		}
+	}
+	if list == nil {
+		return nil, nil
+	}
+	rels := make([]string, 0, len(list))
+	for _, p := range list {
+		p = filepath.FromSlash(p)
+		if filepath.IsAbs(p) {
+			rel, err := filepath.Rel(rootAbs, p)
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				continue
+			}
+			p = rel
+		}
+		rels = append(rels, path.Clean(filepath.ToSlash(p)))
+	}
+	slices.Sort(rels)
+	return slices.Compact(rels), nil
+}
+
+// listedFS walks the files of a list instead of directories: WalkDir
+// visits the listed files below the start, and the directories leading to
+// them, so excludes and patterns apply as usual. Listed files that no
+// longer exist are passed over, or with missing visited as if they did, to
+// find the sources a deleted file belonged to. Other calls go to the
+// underlying sourceFS.
+type listedFS struct {
+	sourceFS
+	rootAbs string
+	files   []string // slash-separated, relative to rootAbs, sorted
+	missing bool
+}
+
+func (l listedFS) WalkDir(start string, fn fs.WalkDirFunc) error {
+	info, err := l.Stat(start)
+	if err != nil {
+		return fn(start, nil, err)
+	}
+	if err := fn(start, fs.FileInfoToDirEntry(info), nil); err != nil || !info.IsDir() {
+		if errors.Is(err, fs.SkipDir) || errors.Is(err, fs.SkipAll) {
+			return nil
+		}
+		return err
+	}
+	prefix, err := filepath.Rel(l.rootAbs, start)
+	if err != nil {
+		return err
+	}
+	prefix = filepath.ToSlash(prefix)
+
+	entered := make(map[string]bool)
+	var skipped []string // directories fn skipped
+	visit := func(rel string) (bool, error) {
+		abs := filepath.Join(l.rootAbs, filepath.FromSlash(rel))
+		var entry fs.DirEntry
+		switch info, err := l.Stat(abs); {
+		case errors.Is(err, fs.ErrNotExist) && l.missing:
+			entry = missingEntry{name: path.Base(rel), dir: entered[rel]}
+		case errors.Is(err, fs.ErrNotExist):
+			return false, nil
+		case err != nil:
+			return false, fn(abs, nil, err)
+		default:
+			entry = fs.FileInfoToDirEntry(info)
+		}
+		switch err := fn(abs, entry, nil); {
+		case errors.Is(err, fs.SkipDir) && entry.IsDir():
+			skipped = append(skipped, rel+"/")
+			return false, nil
+		case errors.Is(err, fs.SkipDir):
+			return true, nil
+		case err != nil:
+			return false, err
+		}
+		return true, nil
+	}
+
+files:
+	for _, rel := range l.files {
+		if prefix != "." && !strings.HasPrefix(rel, prefix+"/") {
+			continue
+		}
+		for _, s := range skipped {
+			if strings.HasPrefix(rel, s) {
+				continue files
+			}
+		}
+		// the directories between start and the file, outermost first
+		var dirs []string
+		for d := path.Dir(rel); d != "." && d != prefix; d = path.Dir(d) {
+			dirs = append(dirs, d)
+		}
+		for i := len(dirs) - 1; i >= 0; i-- {
+			if entered[dirs[i]] {
+				continue
+			}
+			entered[dirs[i]] = true
+			ok, err := visit(dirs[i])
+			if err != nil {
+				return ignoreSkipAll(err)
+			}
+			if !ok {
+				continue files
+			}
+		}
+		if _, err := visit(rel); err != nil {
+			return ignoreSkipAll(err)
+		}
+	}
+	return nil
+}
+
+// missingEntry stands for a listed path that is not on disk.
+type missingEntry struct {
+	name string
+	dir  bool
+}
+
+func (e missingEntry) Name() string { return e.name }
+func (e missingEntry) IsDir() bool  { return e.dir }
+func (e missingEntry) Type() fs.FileMode {
+	if e.dir {
+		return fs.ModeDir
+	}
+	return 0
+}
+func (e missingEntry) Info() (fs.FileInfo, error) { return nil, fs.ErrNotExist }
+
+// ignoreSkipAll is err, or nil when it is fs.SkipAll, which ends a walk
+// without failing it.
+func ignoreSkipAll(err error) error {
+	if errors.Is(err, fs.SkipAll) {
+		return nil
+	}
+	return err
+}
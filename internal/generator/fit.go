@@ -0,0 +1,135 @@
+package generator
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// DocumentFit tells whether a document fits a token budget and, when it
+// does not, which sources to demote.
+type DocumentFit struct {
+	Document string          `json:"document"`
+	Tokens   int             `json:"tokens"` // estimated tokens of the largest output (part)
+	Budget   int             `json:"budget"`
+	Fits     bool            `json:"fits"`
+	Demote   []FitSuggestion `json:"demote,omitempty"`
+	// StillOver is set when even every suggestion together does not make
+	// the document fit
+	StillOver bool `json:"stillOver,omitempty"`
+}
+
+// FitSuggestion is a change to one source and the tokens it saves.
+type FitSuggestion struct {
+	Source int    `json:"source"` // index into the document's sources
+	Desc   string `json:"desc"`   // e.g. "file internal, pkg"
+	Change string `json:"change"` // e.g. "contentMode: reference"
+	Saves  int    `json:"saves"`
+}
+
+// Fit renders every document and compares its largest output with budget
+// tokens. For documents over budget it renders variants with one file
+// source demoted (to an outline, or to a reference list) and suggests the
+// demotions that save the most, until the estimate fits.
+func Fit(c cfg.Config, projectRoot string, budget int, opts Options) ([]DocumentFit, error) {
+	opts.Log = io.Discard // variants repeat the warnings of the document
+	var fits []DocumentFit
+	for _, doc := range c.Documents {
+		doc.Assertions = nil // a budget assertion would fail the variants
+		tokens, err := largestOutput(c, doc, projectRoot, opts)
+		if err != nil {
+			return nil, err
+		}
+		f := DocumentFit{Document: cmp.Or(doc.Name, doc.Targets()[0].Path), Tokens: tokens, Budget: budget, Fits: tokens <= budget}
+		if !f.Fits {
+			if f.Demote, err = demotions(c, doc, projectRoot, tokens, opts); err != nil {
+				return nil, err
+			}
+			over := tokens - budget
+			kept := f.Demote[:0]
+			for _, s := range f.Demote {
+				if over <= 0 {
+					break
+				}
+				kept = append(kept, s)
+				over -= s.Saves
+			}
+			f.Demote, f.StillOver = kept, over > 0
+		}
+		fits = append(fits, f)
+	}
+	return fits, nil
+}
+
+// demotions renders doc with each file or outline source demoted in turn
+// and returns the best change per source, most tokens saved first.
+func demotions(c cfg.Config, doc cfg.Document, projectRoot string, tokens int, opts Options) ([]FitSuggestion, error) {
+	var out []FitSuggestion
+	for i, src := range doc.Sources {
+		kind := strings.ToLower(src.Type)
+		if (kind != "file" && kind != "outline") || strings.EqualFold(src.ContentMode, "reference") {
+			continue
+		}
+		var best FitSuggestion
+		for _, change := range []string{"type: outline", "contentMode: reference"} {
+			if change == "type: outline" && kind == "outline" {
+				continue
+			}
+			variant := doc
+			variant.Sources = slices.Clone(doc.Sources)
+			if change == "type: outline" {
+				variant.Sources[i].Type = "outline"
+			} else {
+				variant.Sources[i].ContentMode = "reference"
+			}
+			after, err := largestOutput(c, variant, projectRoot, opts)
+			if err != nil {
+				return nil, err
+			}
+			// an outline that saves a little is preferred over a reference
+			// list that saves a little more
+			if saves := tokens - after; saves > best.Saves*5/4 {
+				best = FitSuggestion{Source: i, Desc: src.Type + " " + strings.Join(src.SourcePaths, ", "), Change: change, Saves: saves}
+			}
+		}
+		if best.Saves > 0 {
+			out = append(out, best)
+		}
+	}
+	slices.SortStableFunc(out, func(a, b FitSuggestion) int { return b.Saves - a.Saves })
+	return out, nil
+}
+
+func largestOutput(c cfg.Config, doc cfg.Document, projectRoot string, opts Options) (int, error) {
+	c.Documents = []cfg.Document{doc}
+	outs, err := Render(c, projectRoot, opts)
+	if err != nil {
+		return 0, err
+	}
+	largest := 0
+	for _, o := range outs {
+		largest = max(largest, EstimateTokens(len(o.Content)))
+	}
+	return largest, nil
+}
+
+// WriteFit prints one line per document and its suggested demotions.
+func WriteFit(w io.Writer, fits []DocumentFit) {
+	for _, f := range fits {
+		if f.Fits {
+			fmt.Fprintf(w, "%s: fits (~%d of %d tokens)\n", f.Document, f.Tokens, f.Budget)
+			continue
+		}
+		fmt.Fprintf(w, "%s: does not fit (~%d of %d tokens, %d over)\n", f.Document, f.Tokens, f.Budget, f.Tokens-f.Budget)
+		for _, s := range f.Demote {
+			fmt.Fprintf(w, "  source %d (%s): %s saves ~%d tokens\n", s.Source+1, s.Desc, s.Change, s.Saves)
+		}
+		if f.StillOver {
+			fmt.Fprintf(w, "  still over with all of these: split the document (splitBy) or narrow its sources\n")
+		}
+	}
+}
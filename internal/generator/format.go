@@ -0,0 +1,477 @@
+package generator
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// formatter writes the pieces of a document in one output format.
+// A new formatter is created for every document.
+type formatter interface {
+	header(b *strings.Builder, doc cfg.Document, runID string)
+	// tree renders a directory tree; tree is empty when nothing matched.
+	tree(b *strings.Builder, src cfg.Source, tree string)
+	noFiles(b *strings.Builder, src cfg.Source)
+	file(b *strings.Builder, tmpl *template.Template, v FileView) error
+	command(b *strings.Builder, title string, output []byte)
+	// block renders titled preformatted text; lang is a syntax hint and may be empty.
+	block(b *strings.Builder, title, lang string, body []byte)
+	// snapshot embeds the effective configuration, collapsed where the format allows.
+	snapshot(b *strings.Builder, yamlText string)
+	footer(b *strings.Builder, text string)
+	// part notes which part of a split document this is.
+	part(b *strings.Builder, n, total int)
+	finish(b *strings.Builder) error
+}
+
+// formatByExt maps output file extensions to formats for documents that do
+// not set outputFormat.
+var formatByExt = map[string]string{
+	".md":       "markdown",
+	".markdown": "markdown",
+	".xml":      "xml",
+	".html":     "html",
+	".htm":      "html",
+	".txt":      "text",
+	".json":     "json",
+	".jsonl":    "jsonl-chunks",
+}
+
+// resolveFormat returns the explicit format, or the one implied by the
+// output path's extension, defaulting to markdown.
+func resolveFormat(format, outputPath string) string {
+	if f := strings.ToLower(strings.TrimSpace(format)); f != "" {
+		return f
+	}
+	if f, ok := formatByExt[strings.ToLower(filepath.Ext(outputPath))]; ok {
+		return f
+	}
+	return "markdown"
+}
+
+// ResolveFormat is resolveFormat for callers outside the package.
+func ResolveFormat(format, outputPath string) string {
+	return resolveFormat(format, outputPath)
+}
+
+// defaultHeadingLevel is the level of file, command and block headings in
+// documents that do not set headingLevel.
+const defaultHeadingLevel = 3
+
+// newFormatter returns the formatter for a resolved format name; level is
+// the document's headingLevel, 0 meaning the default.
+func newFormatter(name string, level int) (formatter, error) {
+	level = min(max(cmp.Or(level, defaultHeadingLevel), 1), 6)
+	switch name {
+	case "markdown", "md":
+		return markdownFormat{level}, nil
+	case "xml":
+		return &xmlFormat{}, nil
+	case "html":
+		return &htmlFormat{level: level}, nil
+	case "text", "txt":
+		return textFormat{}, nil
+	case "json":
+		return &jsonFormat{}, nil
+	case "jsonl-chunks":
+		return &chunksFormat{}, nil
+	case "repomix":
+		return &repomixFormat{}, nil
+	case "gitingest":
+		return &gitingestFormat{}, nil
+	default:
+		return nil, fmt.Errorf("unknown outputFormat %q", name)
+	}
+}
+
+// codeFence returns a backtick fence for content: three backticks, or one
+// more than the longest backtick run in content, so embedded markdown with
+// fences of its own cannot close the block early (CommonMark 4.5).
+func codeFence(content string) string {
+	longest, run := 0, 0
+	for i := 0; i < len(content); i++ {
+		if content[i] == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+// markdownFormat is the default layout: headings and fenced code blocks.
+// Sections get headings of level; the title is two levels above them.
+type markdownFormat struct {
+	level int
+}
+
+// hashes returns the heading marker of a level relative to sections:
+// "###" for 0 at the default level, "#" for -2.
+func (f markdownFormat) hashes(rel int) string {
+	return strings.Repeat("#", max(f.level+rel, 1))
+}
+
+func (f markdownFormat) header(b *strings.Builder, doc cfg.Document, runID string) {
+	if runID != "" {
+		fmt.Fprintf(b, "<!-- run-id: %s -->\n\n", runID)
+	}
+	if doc.Description != "" {
+		fmt.Fprintf(b, "%s %s\n\n", f.hashes(-2), doc.Description)
+	}
+}
+
+func (markdownFormat) tree(b *strings.Builder, src cfg.Source, tree string) {
+	if tree == "" {
+		fmt.Fprintf(b, "```\n(no matches for %q in %v)\n```\n\n", src.FilePattern.String(), src.SourcePaths)
+		return
+	}
+	// Put tree into code block for readability
+	fence, lang := codeFence(tree), ""
+	if f := strings.ToLower(src.TreeFormat); f == treeMermaid || f == treeMindmap {
+		lang = "mermaid"
+	}
+	fmt.Fprintf(b, "%s%s\n%s\n%s\n\n", fence, lang, tree, fence)
+}
+
+func (markdownFormat) noFiles(b *strings.Builder, src cfg.Source) {
+	fmt.Fprintf(b, "_No files matched %q under %v_\n\n", src.FilePattern.String(), src.SourcePaths)
+}
+
+func (f markdownFormat) file(b *strings.Builder, tmpl *template.Template, v FileView) error {
+	v.Heading = f.hashes(0)
+	return tmpl.Execute(b, v)
+}
+
+func (f markdownFormat) command(b *strings.Builder, title string, output []byte) {
+	fence := codeFence(string(output))
+	fmt.Fprintf(b, "%s $ %s\n\n%s\n%s%s\n\n", f.hashes(0), title, fence, output, fence)
+}
+
+func (f markdownFormat) block(b *strings.Builder, title, lang string, body []byte) {
+	fence := codeFence(string(body))
+	fmt.Fprintf(b, "%s %s\n\n%s%s\n%s%s\n\n", f.hashes(0), title, fence, lang, body, fence)
+}
+
+func (markdownFormat) snapshot(b *strings.Builder, yamlText string) {
+	fence := codeFence(yamlText)
+	fmt.Fprintf(b, "<details>\n<summary>Effective configuration</summary>\n\n%syaml\n%s%s\n\n</details>\n\n", fence, yamlText, fence)
+}
+
+func (markdownFormat) footer(b *strings.Builder, text string) {
+	fmt.Fprintf(b, "---\n\n_%s_\n", text)
+}
+
+func (markdownFormat) part(b *strings.Builder, n, total int) {
+	fmt.Fprintf(b, "_Part %d of %d_\n\n", n, total)
+}
+
+func (markdownFormat) finish(*strings.Builder) error { return nil }
+
+// xmlFormat wraps every file in <document> tags, as recommended by several
+// LLM providers for long context. Contents are embedded verbatim (not
+// entity-escaped) so code stays readable; attribute values and paths are escaped.
+type xmlFormat struct {
+	index int
+}
+
+func (f *xmlFormat) header(b *strings.Builder, doc cfg.Document, runID string) {
+	b.WriteString("<context")
+	if runID != "" {
+		fmt.Fprintf(b, " run_id=%q", html.EscapeString(runID))
+	}
+	b.WriteString(">\n")
+	if doc.Description != "" {
+		fmt.Fprintf(b, "<description>%s</description>\n", html.EscapeString(doc.Description))
+	}
+}
+
+func (f *xmlFormat) tree(b *strings.Builder, src cfg.Source, tree string) {
+	if tree == "" {
+		fmt.Fprintf(b, "<file_tree>(no matches for %s in %s)</file_tree>\n",
+			html.EscapeString(fmt.Sprintf("%q", src.FilePattern.String())), html.EscapeString(fmt.Sprint(src.SourcePaths)))
+		return
+	}
+	fmt.Fprintf(b, "<file_tree>\n%s</file_tree>\n", tree)
+}
+
+func (f *xmlFormat) noFiles(b *strings.Builder, src cfg.Source) {
+	fmt.Fprintf(b, "<!-- no files matched %s under %s -->\n",
+		html.EscapeString(fmt.Sprintf("%q", src.FilePattern.String())), html.EscapeString(fmt.Sprint(src.SourcePaths)))
+}
+
+func (f *xmlFormat) file(b *strings.Builder, _ *template.Template, v FileView) error {
+	f.index++
+	fmt.Fprintf(b, "<document index=\"%d\">\n<source>%s</source>\n", f.index, html.EscapeString(v.Path))
+	if v.Note != "" {
+		fmt.Fprintf(b, "<note>%s</note>\n", html.EscapeString(v.Note))
+	}
+	fmt.Fprintf(b, "<contents>\n%s</contents>\n</document>\n", v.Content)
+	return nil
+}
+
+func (f *xmlFormat) command(b *strings.Builder, title string, output []byte) {
+	fmt.Fprintf(b, "<command_output command=\"%s\">\n%s</command_output>\n", html.EscapeString(title), output)
+}
+
+func (f *xmlFormat) block(b *strings.Builder, title, lang string, body []byte) {
+	fmt.Fprintf(b, "<block title=\"%s\"", html.EscapeString(title))
+	if lang != "" {
+		fmt.Fprintf(b, " lang=\"%s\"", html.EscapeString(lang))
+	}
+	fmt.Fprintf(b, ">\n%s</block>\n", body)
+}
+
+func (f *xmlFormat) snapshot(b *strings.Builder, yamlText string) {
+	fmt.Fprintf(b, "<config_snapshot format=\"yaml\">\n%s</config_snapshot>\n", html.EscapeString(yamlText))
+}
+
+func (f *xmlFormat) footer(b *strings.Builder, text string) {
+	fmt.Fprintf(b, "<stats>%s</stats>\n", html.EscapeString(text))
+}
+
+func (f *xmlFormat) part(b *strings.Builder, n, total int) {
+	fmt.Fprintf(b, "<part index=\"%d\" total=\"%d\"/>\n", n, total)
+}
+
+func (f *xmlFormat) finish(b *strings.Builder) error {
+	b.WriteString("</context>\n")
+	return nil
+}
+
+// textFormat is plain text without markup, for tools that do not render markdown.
+type textFormat struct{}
+
+func (textFormat) header(b *strings.Builder, doc cfg.Document, runID string) {
+	if runID != "" {
+		fmt.Fprintf(b, "run-id: %s\n\n", runID)
+	}
+	if doc.Description != "" {
+		fmt.Fprintf(b, "%s\n%s\n\n", doc.Description, strings.Repeat("=", len([]rune(doc.Description))))
+	}
+}
+
+func (textFormat) tree(b *strings.Builder, src cfg.Source, tree string) {
+	if tree == "" {
+		fmt.Fprintf(b, "(no matches for %q in %v)\n\n", src.FilePattern.String(), src.SourcePaths)
+		return
+	}
+	fmt.Fprintf(b, "%s\n", tree)
+}
+
+func (textFormat) noFiles(b *strings.Builder, src cfg.Source) {
+	fmt.Fprintf(b, "(no files matched %q under %v)\n\n", src.FilePattern.String(), src.SourcePaths)
+}
+
+func (textFormat) file(b *strings.Builder, _ *template.Template, v FileView) error {
+	fmt.Fprintf(b, "==> %s <==\n", v.Path)
+	if v.Note != "" {
+		fmt.Fprintf(b, "%s\n", v.Note)
+	}
+	fmt.Fprintf(b, "%s\n", v.Content)
+	return nil
+}
+
+func (textFormat) command(b *strings.Builder, title string, output []byte) {
+	fmt.Fprintf(b, "==> $ %s <==\n%s\n", title, output)
+}
+
+func (textFormat) block(b *strings.Builder, title, _ string, body []byte) {
+	fmt.Fprintf(b, "==> %s <==\n%s\n", title, body)
+}
+
+func (textFormat) snapshot(b *strings.Builder, yamlText string) {
+	fmt.Fprintf(b, "==> effective configuration <==\n%s\n", yamlText)
+}
+
+func (textFormat) footer(b *strings.Builder, text string) {
+	fmt.Fprintf(b, "-- %s\n", text)
+}
+
+func (textFormat) part(b *strings.Builder, n, total int) {
+	fmt.Fprintf(b, "Part %d of %d\n\n", n, total)
+}
+
+func (textFormat) finish(*strings.Builder) error { return nil }
+
+// htmlFormat produces a standalone HTML page: code blocks highlighted and
+// a sidebar linking every section, hidden when printed (e.g. to PDF).
+type htmlFormat struct {
+	sections toc
+	level    int // of section headings; the title is two levels above
+}
+
+// htmlStyle is the stylesheet of HTML documents.
+const htmlStyle = `body{font-family:system-ui,sans-serif;margin:0 0 0 18rem;padding:1rem 2rem;line-height:1.45}
+nav{position:fixed;top:0;left:0;bottom:0;width:16rem;overflow:auto;padding:1rem;background:#f6f8fa;border-right:1px solid #d0d7de;font-size:.85rem}
+nav ol{padding-left:1.2rem}nav a{color:#0969da;text-decoration:none;word-break:break-all}
+pre{background:#f6f8fa;padding:.75rem;overflow:auto;font-size:.85rem}
+.c{color:#6e7781;font-style:italic}.s{color:#0a3069}.k{color:#cf222e;font-weight:600}.n{color:#0550ae}
+@media print{body{margin:0}nav{display:none}pre{white-space:pre-wrap}}
+`
+
+func (f *htmlFormat) header(b *strings.Builder, doc cfg.Document, runID string) {
+	f.sections = toc{}
+	title := doc.Description
+	if title == "" {
+		title = doc.OutputPath
+	}
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	if runID != "" {
+		fmt.Fprintf(b, "<meta name=\"run-id\" content=\"%s\">\n", html.EscapeString(runID))
+	}
+	fmt.Fprintf(b, "<title>%s</title>\n<style>\n%s</style>\n</head>\n<body>\n", html.EscapeString(title), htmlStyle)
+	if doc.Description != "" {
+		level := max(f.level-2, 1)
+		fmt.Fprintf(b, "<h%d>%s</h%d>\n", level, html.EscapeString(doc.Description), level)
+	}
+}
+
+// heading writes a section heading with an id for the sidebar.
+func (f *htmlFormat) heading(b *strings.Builder, title, kind, path string) {
+	id := f.sections.add(title, kind, path)
+	fmt.Fprintf(b, "<h%d id=\"%s\">%s</h%d>\n", f.level, id, html.EscapeString(title), f.level)
+}
+
+func (f *htmlFormat) tree(b *strings.Builder, src cfg.Source, tree string) {
+	if tree == "" {
+		fmt.Fprintf(b, "<pre>(no matches for %s in %s)</pre>\n",
+			html.EscapeString(fmt.Sprintf("%q", src.FilePattern.String())), html.EscapeString(fmt.Sprint(src.SourcePaths)))
+		return
+	}
+	f.heading(b, "Tree of "+strings.Join(src.SourcePaths, ", "), "tree", strings.Join(src.SourcePaths, " "))
+	fmt.Fprintf(b, "<pre>%s</pre>\n", html.EscapeString(tree))
+}
+
+func (*htmlFormat) noFiles(b *strings.Builder, src cfg.Source) {
+	fmt.Fprintf(b, "<p><em>No files matched %s under %s</em></p>\n",
+		html.EscapeString(fmt.Sprintf("%q", src.FilePattern.String())), html.EscapeString(fmt.Sprint(src.SourcePaths)))
+}
+
+func (f *htmlFormat) file(b *strings.Builder, _ *template.Template, v FileView) error {
+	f.heading(b, v.Path, "file", v.Path)
+	if v.Note != "" {
+		fmt.Fprintf(b, "<p><em>%s</em></p>\n", html.EscapeString(v.Note))
+	}
+	if v.Lang != "" {
+		fmt.Fprintf(b, "<pre><code class=\"language-%s\">", html.EscapeString(v.Lang))
+	} else {
+		b.WriteString("<pre><code>")
+	}
+	fmt.Fprintf(b, "%s</code></pre>\n", highlightHTML(v.Path, v.Lang, v.Content))
+	return nil
+}
+
+func (f *htmlFormat) command(b *strings.Builder, title string, output []byte) {
+	f.heading(b, "$ "+title, "command", title)
+	fmt.Fprintf(b, "<pre>%s</pre>\n", html.EscapeString(string(output)))
+}
+
+func (f *htmlFormat) block(b *strings.Builder, title, lang string, body []byte) {
+	f.heading(b, title, "block", title)
+	if lang != "" {
+		fmt.Fprintf(b, "<pre><code class=\"language-%s\">", html.EscapeString(lang))
+	} else {
+		b.WriteString("<pre><code>")
+	}
+	fmt.Fprintf(b, "%s</code></pre>\n", highlightHTML("", lang, string(body)))
+}
+
+func (*htmlFormat) snapshot(b *strings.Builder, yamlText string) {
+	fmt.Fprintf(b, "<details>\n<summary>Effective configuration</summary>\n<pre><code class=\"language-yaml\">%s</code></pre>\n</details>\n", html.EscapeString(yamlText))
+}
+
+func (*htmlFormat) footer(b *strings.Builder, text string) {
+	fmt.Fprintf(b, "<hr>\n<p><em>%s</em></p>\n", html.EscapeString(text))
+}
+
+func (*htmlFormat) part(b *strings.Builder, n, total int) {
+	fmt.Fprintf(b, "<p><em>Part %d of %d</em></p>\n", n, total)
+}
+
+// finish closes the page with the sidebar, which is placed by the
+// stylesheet; written last, it is complete without rewriting the page.
+func (f *htmlFormat) finish(b *strings.Builder) error {
+	if len(f.sections.entries) > 0 {
+		b.WriteString("<nav>\n<strong>Contents</strong>\n<ol>\n")
+		for _, e := range f.sections.entries {
+			fmt.Fprintf(b, "<li><a href=\"#%s\">%s</a></li>\n", e.id, html.EscapeString(e.title))
+		}
+		b.WriteString("</ol>\n</nav>\n")
+	}
+	b.WriteString("</body>\n</html>\n")
+	return nil
+}
+
+// jsonEntry is one file in the JSON manifest.
+type jsonEntry struct {
+	RunID    string `json:"runId,omitempty"`
+	Path     string `json:"path"`
+	Language string `json:"language"`
+	Size     int    `json:"size"`
+	SHA256   string `json:"sha256"`
+	Content  string `json:"content"`
+}
+
+// jsonFormat emits a machine-readable array of embedded files for embedding
+// pipelines and other tooling. Trees, command output, directory diffs,
+// config snapshots and the footer are not part of the manifest; use
+// configSnapshot: sidecar instead.
+type jsonFormat struct {
+	runID   string
+	entries []jsonEntry
+}
+
+func (f *jsonFormat) header(_ *strings.Builder, _ cfg.Document, runID string) {
+	f.runID = runID
+}
+
+func (*jsonFormat) tree(*strings.Builder, cfg.Source, string) {}
+
+func (*jsonFormat) noFiles(*strings.Builder, cfg.Source) {}
+
+func (f *jsonFormat) file(_ *strings.Builder, _ *template.Template, v FileView) error {
+	sum := sha256.Sum256([]byte(v.Content))
+	f.entries = append(f.entries, jsonEntry{
+		RunID:    f.runID,
+		Path:     v.Path,
+		Language: v.Lang,
+		Size:     len(v.Content),
+		SHA256:   hex.EncodeToString(sum[:]),
+		Content:  v.Content,
+	})
+	return nil
+}
+
+func (*jsonFormat) command(*strings.Builder, string, []byte) {}
+
+func (*jsonFormat) block(*strings.Builder, string, string, []byte) {}
+
+func (*jsonFormat) snapshot(*strings.Builder, string) {}
+
+func (*jsonFormat) footer(*strings.Builder, string) {}
+
+func (*jsonFormat) part(*strings.Builder, int, int) {}
+
+func (f *jsonFormat) finish(b *strings.Builder) error {
+	entries := f.entries
+	if entries == nil {
+		entries = []jsonEntry{}
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode json manifest: %w", err)
+	}
+	b.Write(data)
+	b.WriteByte('\n')
+	return nil
+}
@@ -0,0 +1,65 @@
+package generator
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+func TestJSONManifestRunID(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a.go", "b.go"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte("package p\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sources := []cfg.Source{{Type: "file", SourcePaths: []string{"."}, FilePattern: cfg.Patterns{"*.go"}}}
+	c := cfg.Config{Documents: []cfg.Document{{
+		Outputs: []cfg.Output{{Path: "ctx.md"}, {Path: "ctx.json"}},
+		Sources: sources,
+	}}}
+
+	for _, runID := range []string{"run-1", `ci/42 "a&b" <x>`} {
+		outs, err := Render(c, root, Options{RunID: runID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(outs) != 2 {
+			t.Fatalf("got %d outputs, want 2", len(outs))
+		}
+		var entries []jsonEntry
+		if err := json.Unmarshal([]byte(outs[1].Content), &entries); err != nil {
+			t.Fatalf("decode %s: %v", outs[1].Path, err)
+		}
+		if len(entries) != 2 {
+			t.Fatalf("%s lists %d files, want 2", outs[1].Path, len(entries))
+		}
+		for _, e := range entries {
+			if e.RunID != runID {
+				t.Errorf("%s: %s has runId %q, want %q", outs[1].Path, e.Path, e.RunID, runID)
+			}
+		}
+		if md, js := existingRunID([]byte(outs[0].Content)), existingRunID([]byte(outs[1].Content)); md != runID || js != runID {
+			t.Errorf("run ids read back: markdown %q, json %q, want %q", md, js, runID)
+		}
+	}
+
+	// deterministic documents have no run id to embed
+	c.Deterministic = true
+	outs, err := Render(c, root, Options{RunID: "run-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []map[string]any
+	if err := json.Unmarshal([]byte(outs[1].Content), &entries); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if _, ok := e["runId"]; ok {
+			t.Errorf("deterministic %s: entry %v has a runId", outs[1].Path, e["path"])
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package generator
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os/exec"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// frontMatterMarker holds the place of the front matter at the top of every
+// part of a markdown document with frontMatter until its counts are known.
+const frontMatterMarker = "\x00frontmatter\x00"
+
+// frontMatter is the metadata that tells how current a document is.
+type frontMatter struct {
+	generated  time.Time // zero for deterministic documents
+	commit     string    // empty outside a git work tree
+	branch     string
+	configHash string
+	version    string
+}
+
+// newFrontMatter gathers the metadata of doc; deterministic documents get
+// neither the time nor commit and branch. A missing git binary is an
+// unavailable feature: the front matter is written without commit and
+// branch.
+func newFrontMatter(c cfg.Config, doc cfg.Document, projectRoot string, opts Options) (*frontMatter, error) {
+	fm := &frontMatter{version: toolVersion()}
+	if !doc.Deterministic {
+		fm.generated = time.Now().UTC()
+	}
+
+	c.Documents = []cfg.Document{doc}
+	eff, err := Effective(c, projectRoot)
+	if err != nil {
+		return nil, err
+	}
+	eff.ProjectPath = "" // the same config hashes alike on every machine
+	data, err := yaml.Marshal(eff)
+	if err != nil {
+		return nil, fmt.Errorf("encode config for front matter: %w", err)
+	}
+	fm.configHash = fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+	if doc.Deterministic {
+		return fm, nil
+	}
+
+	commit, err := gitRevParse(projectRoot, "HEAD")
+	if err != nil {
+		if toolMissing(err) {
+			err = &unavailableError{feature: "frontMatter", detail: "git: " + err.Error()}
+		}
+		if err := opts.degrade.handle(err, "front matter written without commit and branch"); err != nil {
+			return nil, err
+		}
+		return fm, nil
+	}
+	fm.commit = commit
+	fm.branch, _ = gitRevParse(projectRoot, "--abbrev-ref", "HEAD")
+	return fm, nil
+}
+
+// gitRevParse runs git rev-parse in dir. Failures other than a missing git
+// binary (not a repository, no commits yet) yield an empty result.
+func gitRevParse(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"rev-parse"}, args...)...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		if toolMissing(err) {
+			return "", err
+		}
+		return "", nil
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// toolVersion is the module version of the binary, or its VCS revision
+// for builds from a checkout.
+func toolVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			return "devel+" + s.Value[:min(12, len(s.Value))]
+		}
+	}
+	return "devel"
+}
+
+// render returns the YAML front matter for a part embedding files files in
+// content; runId comes first so check finds it.
+func (fm *frontMatter) render(runID string, files int, content string) string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	if runID != "" {
+		fmt.Fprintf(&b, "runId: %s\n", runID)
+	}
+	if !fm.generated.IsZero() {
+		fmt.Fprintf(&b, "generated: %s\n", fm.generated.Format(time.RFC3339))
+	}
+	if fm.commit != "" {
+		fmt.Fprintf(&b, "commit: %s\n", fm.commit)
+		fmt.Fprintf(&b, "branch: %s\n", fm.branch)
+	}
+	fmt.Fprintf(&b, "configHash: %s\n", fm.configHash)
+	fmt.Fprintf(&b, "toolVersion: %s\n", fm.version)
+	fmt.Fprintf(&b, "files: %d\n", files)
+	fmt.Fprintf(&b, "tokens: %d\n", EstimateTokens(len(content)))
+	b.WriteString("---\n\n")
+	return b.String()
+}
+
+// volatileFrontMatter drops the fields of a leading front matter that
+// change without the content changing (time, commit and branch), so check
+// compares only what matters.
+func volatileFrontMatter(data []byte) []byte {
+	if !bytes.HasPrefix(data, []byte("---\n")) {
+		return data
+	}
+	end := bytes.Index(data[4:], []byte("\n---\n"))
+	if end < 0 {
+		return data
+	}
+	head, rest := data[:4+end+1], data[4+end+1:]
+	var kept []byte
+	for _, line := range bytes.SplitAfter(head, []byte("\n")) {
+		if bytes.HasPrefix(line, []byte("generated: ")) || bytes.HasPrefix(line, []byte("commit: ")) || bytes.HasPrefix(line, []byte("branch: ")) {
+			continue
+		}
+		kept = append(kept, line...)
+	}
+	return append(kept, rest...)
+}
@@ -0,0 +1,127 @@
+package generator
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// sourceFS is the filesystem sources are read from. Names are OS paths
+// built from the project root, so the rest of the generator does not care
+// whether files come from disk or from a caller-supplied fs.FS.
+type sourceFS interface {
+	Stat(name string) (fs.FileInfo, error)
+	ReadFile(name string) ([]byte, error)
+	Open(name string) (fs.File, error)
+	Glob(pattern string) ([]string, error)
+	WalkDir(root string, fn fs.WalkDirFunc) error
+}
+
+// osFS reads from disk; walk is the configured traversal backend.
+type osFS struct {
+	walk walkFunc
+}
+
+func (osFS) Stat(name string) (fs.FileInfo, error)          { return os.Stat(name) }
+func (osFS) ReadFile(name string) ([]byte, error)           { return os.ReadFile(name) }
+func (osFS) Open(name string) (fs.File, error)              { return os.Open(name) }
+func (osFS) Glob(pattern string) ([]string, error)          { return filepath.Glob(pattern) }
+func (o osFS) WalkDir(root string, fn fs.WalkDirFunc) error { return o.walk(root, fn) }
+
+// cancelFS stops walks and reads once ctx is done, so collecting and
+// reading the files of a large tree ends promptly on cancellation.
+type cancelFS struct {
+	sourceFS
+	ctx context.Context
+}
+
+func (c cancelFS) ReadFile(name string) ([]byte, error) {
+	if err := c.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.sourceFS.ReadFile(name)
+}
+
+func (c cancelFS) Open(name string) (fs.File, error) {
+	if err := c.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.sourceFS.Open(name)
+}
+
+func (c cancelFS) WalkDir(root string, fn fs.WalkDirFunc) error {
+	return c.sourceFS.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err := c.ctx.Err(); err != nil {
+			return err
+		}
+		return fn(p, d, err)
+	})
+}
+
+// mappedFS serves an fs.FS as if it were mounted at root. Paths outside
+// root do not exist.
+type mappedFS struct {
+	fsys fs.FS
+	root string // absolute
+}
+
+// name converts an OS path under root to an fs.FS name.
+func (m mappedFS) name(op, p string) (string, error) {
+	rel, err := filepath.Rel(m.root, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", &fs.PathError{Op: op, Path: p, Err: fs.ErrNotExist}
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+func (m mappedFS) Stat(p string) (fs.FileInfo, error) {
+	name, err := m.name("stat", p)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Stat(m.fsys, name)
+}
+
+func (m mappedFS) ReadFile(p string) ([]byte, error) {
+	name, err := m.name("open", p)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(m.fsys, name)
+}
+
+func (m mappedFS) Open(p string) (fs.File, error) {
+	name, err := m.name("open", p)
+	if err != nil {
+		return nil, err
+	}
+	return m.fsys.Open(name)
+}
+
+func (m mappedFS) Glob(pattern string) ([]string, error) {
+	name, err := m.name("glob", pattern)
+	if err != nil {
+		return nil, nil
+	}
+	matches, err := fs.Glob(m.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	for i, match := range matches {
+		matches[i] = filepath.Join(m.root, filepath.FromSlash(match))
+	}
+	return matches, nil
+}
+
+func (m mappedFS) WalkDir(root string, fn fs.WalkDirFunc) error {
+	name, err := m.name("walk", root)
+	if err != nil {
+		return fn(root, nil, err)
+	}
+	return fs.WalkDir(m.fsys, name, func(p string, d fs.DirEntry, err error) error {
+		return fn(filepath.Join(m.root, filepath.FromSlash(path.Clean(p))), d, err)
+	})
+}
@@ -0,0 +1,106 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	cfg "go_project_context_maker/internal/config"
+	"go_project_context_maker/internal/match"
+	"go_project_context_maker/internal/unorm"
+)
+
+// generatedPatterns name files that are generated or machine-maintained
+// whatever they contain: protobuf and gRPC stubs, minified bundles, source
+// maps and lockfiles.
+var generatedPatterns = []string{
+	"*.pb.go", "*_pb.go", "*.pb.gw.go", "*_pb2.py", "*_pb2_grpc.py", "*_pb.js", "*_pb.d.ts", "*_grpc_pb.js",
+	"zz_generated.*", "*.min.js", "*.min.css", "*.map",
+	"go.sum", "go.work.sum", "package-lock.json", "npm-shrinkwrap.json", "yarn.lock", "pnpm-lock.yaml", "bun.lockb",
+	"composer.lock", "Cargo.lock", "Gemfile.lock", "poetry.lock", "Pipfile.lock", "uv.lock", "mix.lock", "pubspec.lock",
+}
+
+// generatedHeaderRe matches the markers generators put near the top of a
+// file: Go's "// Code generated ... DO NOT EDIT.", "@generated" and
+// "auto-generated ... do not modify" comments.
+var generatedHeaderRe = regexp.MustCompile(`(?im)^\W*(?:code generated\b.*\bdo not edit\b|(?:auto-?|automatically )generated\b.*\bdo not (?:edit|modify)\b|.*@generated\b)`)
+
+// generatedScanBytes is how much of each file is read to detect markers and
+// minified code.
+const generatedScanBytes = 64 << 10
+
+// minifiedExts are checked for minified code: long lines, few of them.
+var minifiedExts = []string{".js", ".mjs", ".cjs", ".css"}
+
+// dropGenerated leaves out the files (relative to projectRoot) that are
+// generated: by name (built-in patterns and src.GeneratedPatterns), by a
+// generator's marker in the first lines, or, for JavaScript and CSS, by
+// minified content. It returns the kept files and how many were dropped.
+func dropGenerated(fsys sourceFS, projectRoot string, files []string, src cfg.Source, jobs int) ([]string, int, error) {
+	names, err := match.Compile(slices.Concat(generatedPatterns, src.GeneratedPatterns))
+	if err != nil {
+		return nil, 0, fmt.Errorf("generatedPatterns: %w", err)
+	}
+	results := readFiles(files, jobs, func(rel string) fileResult {
+		r := fileResult{rel: rel}
+		if names.Match(unorm.NFC(rel)) {
+			r.filtered = true
+			return r
+		}
+		fh, err := fsys.Open(filepath.Join(projectRoot, rel))
+		if err != nil {
+			r.err = err
+			return r
+		}
+		defer fh.Close()
+		head, err := io.ReadAll(io.LimitReader(fh, generatedScanBytes))
+		if err != nil {
+			r.err = fmt.Errorf("read %s: %w", rel, err)
+			return r
+		}
+		r.filtered = isGenerated(rel, head)
+		return r
+	})
+	kept := files[:0:0]
+	for _, r := range results {
+		if r.err != nil {
+			return nil, 0, r.err
+		}
+		if !r.filtered {
+			kept = append(kept, r.rel)
+		}
+	}
+	return kept, len(files) - len(kept), nil
+}
+
+// isGenerated inspects the start of a file: a generator's marker within its
+// first 30 lines, or minified JavaScript or CSS.
+func isGenerated(rel string, head []byte) bool {
+	top := head
+	for i, n := 0, 0; i < len(head); i++ {
+		if head[i] == '\n' {
+			if n++; n == 30 {
+				top = head[:i]
+				break
+			}
+		}
+	}
+	if generatedHeaderRe.Match(top) {
+		return true
+	}
+	if !slices.Contains(minifiedExts, strings.ToLower(path.Ext(rel))) || len(head) < 2048 {
+		return false
+	}
+	// a bundle is a few very long lines
+	lines := bytes.Count(head, []byte{'\n'}) + 1
+	longest := 0
+	for _, line := range bytes.Split(head, []byte{'\n'}) {
+		longest = max(longest, len(line))
+	}
+	return longest > 1000 && len(head)/lines > 300
+}
@@ -1,109 +1,1674 @@
 package generator
 
 import (
+	"cmp"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"sort"
 	"strings"
+	"text/template"
+	"time"
 
 	cfg "go_project_context_maker/internal/config"
+	"go_project_context_maker/internal/match"
+	"go_project_context_maker/internal/signing"
+	"go_project_context_maker/internal/storage"
+	"go_project_context_maker/internal/unorm"
 )
 
-func Generate(c cfg.Config, projectRoot string) error {
-	for _, doc := range c.Documents {
-		var b strings.Builder
+// StdoutPath is the outputPath value that streams a document to stdout.
+const StdoutPath = "-"
 
-		if doc.Description != "" {
-			fmt.Fprintf(&b, "# %s\n\n", doc.Description)
+// Output is a rendered document together with the path it is written to.
+type Output struct {
+	Path      string
+	Content   string
+	Files     []FileStat  // files embedded by file/outline sources, in output order
+	Sidecar   string      // effective config written to Path+SidecarSuffix; empty when not requested
+	Mapping   string      // anonymization mapping written to Path+AnonymizeSuffix; empty unless anonymized
+	Signature string      // detached signature written to Path+signing.Suffix; set by Sign
+	Mode      fs.FileMode // permissions of the files written to disk; 0 means 0644
+
+	// Document names the document the output belongs to: its name, or its
+	// first output path. Outputs of one document are adjacent and share the
+	// fields below.
+	Document       string
+	Warnings       []Warning     // skipped files and other findings while rendering
+	NothingMatched bool          // the document's sources matched no files at all
+	Took           time.Duration // time spent rendering the document
+
+	// Streamed is set when Options.Stream wrote the output to Path while
+	// rendering: Content is then empty and Size is its length in bytes.
+	Streamed bool
+	Size     int
+
+	target int // index into the document's Targets
+}
+
+// Len is the length of the output in bytes, streamed or not.
+func (o Output) Len() int {
+	if o.Streamed {
+		return o.Size
+	}
+	return len(o.Content)
+}
+
+// FileStat describes one embedded file.
+type FileStat struct {
+	Path   string
+	Bytes  int
+	Lines  int
+	SHA256 string // hex digest of the embedded content
+}
+
+// Options holds per-run settings that are not part of the config file.
+type Options struct {
+	// RunID correlates a generated bundle with logs and CI runs; it is
+	// embedded at the top of every document when set.
+	RunID string
+	// Stdout receives documents whose output path is "-"; defaults to os.Stdout.
+	Stdout io.Writer
+	// Log receives warnings; defaults to os.Stderr.
+	Log io.Writer
+
+	// Jobs is the number of documents rendered in parallel, and of files
+	// read and processed in parallel per source; 0 means
+	// runtime.GOMAXPROCS(0). Warn, Progress and Log are never called
+	// concurrently.
+	Jobs int
+
+	// FS, when set, is read instead of the disk, as if mounted at the project
+	// root: embedded filesystems, zip archives (zip.Reader) or in-memory trees
+	// (fstest.MapFS). Source paths outside the root then match nothing, and
+	// command sources and filter commands still run on the host.
+	FS fs.FS
+
+	// IgnoreWhitespace makes Stale treat documents that differ only in
+	// whitespace and line endings (and the sizes, hashes and token estimates
+	// derived from them) as unchanged.
+	IgnoreWhitespace bool
+
+	// Warn receives non-fatal findings such as skipped files and license
+	// policy warnings; nil prints them to Log.
+	Warn func(Warning)
+
+	// Storage writes and reads outputs whose path has a URL scheme
+	// ("s3://bucket/key.md", "mem://api.md"); nil means storage.Default.
+	Storage storage.Backends
+
+	// NoHooks skips the documents' preGenerate and postGenerate hooks, for
+	// dry runs.
+	NoHooks bool
+
+	// StrictFeatures makes a configured feature this machine cannot provide,
+	// such as a command source whose program is not installed, fail the run
+	// instead of being left out with a warning.
+	StrictFeatures bool
+
+	// Stream writes documents to their files while they are rendered,
+	// through a buffered temporary file renamed into place, instead of
+	// building them in memory, so memory stays flat however large they get.
+	// Their outputs come back Streamed, without Content, and WriteOutputs
+	// leaves them alone. Documents that need their whole text (toc,
+	// frontMatter, splitting, source ids, pipeline stages, redact,
+	// assertions, anonymize, deterministic) or write elsewhere than local
+	// files are rendered in memory as usual.
+	Stream bool
+
+	// Refresh ignores url responses and command output cached through
+	// cacheTTL: sources are fetched and run again and the cache updated.
+	Refresh bool
+
+	// FileList, when not nil, is where the sources of every document take
+	// their files from instead of walking sourcePaths, over the documents'
+	// filesFrom: paths relative to the project root, or absolute. See
+	// ReadFileList.
+	FileList []string
+
+	// Providers implement source types besides the built-in ones, by type
+	// name, over the config's plugins of the same name.
+	Providers map[string]SourceProvider
+
+	// Progress, when set, receives an Event as each document starts, embeds
+	// a file, warns and finishes.
+	Progress func(Event)
+
+	// Context, when set, cancels the run: walks and file reads stop, and
+	// commands, fetches and llm requests in flight are aborted. The run
+	// fails with the context's error whatever the failurePolicy.
+	Context context.Context
+
+	files    sourceFS         // resolved filesystem, set by Render
+	comments commentRegistry  // built-in and configured comment syntaxes, set by Render
+	langs    languageRegistry // the config's languageMap, set by Render
+	llm      *summarizer      // the config's llm endpoint for summarize, set by Render
+	degrade  *degrader        // per-document handling of unavailable features, set by Render
+
+	providers map[string]SourceProvider // the config's plugins and Providers, set by Render
+}
+
+// Warning is a non-fatal finding about one file of a document.
+type Warning struct {
+	Document string `json:"document"`         // output path of the document
+	Source   int    `json:"source,omitempty"` // 1-based index of the source it concerns, when known
+	Path     string `json:"path"`             // file relative to the project root
+	Msg      string `json:"msg"`
+}
+
+func (w Warning) String() string {
+	doc := w.Document
+	if w.Source > 0 {
+		doc = fmt.Sprintf("%s: source %d", w.Document, w.Source)
+	}
+	if w.Path == "" {
+		return fmt.Sprintf("%s: %s", doc, w.Msg)
+	}
+	return fmt.Sprintf("%s: %s: %s", doc, w.Path, w.Msg)
+}
+
+func (o Options) ctx() context.Context {
+	if o.Context != nil {
+		return o.Context
+	}
+	return context.Background()
+}
+
+func (o Options) jobs() int {
+	if o.Jobs > 0 {
+		return o.Jobs
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// setup prepares the unexported fields for rendering c: the file system
+// sources are read from, the comment syntaxes, the languages and the
+// source providers.
+func (o *Options) setup(c cfg.Config, projectRoot string) error {
+	o.providers = providers(c.Plugins, o.Providers)
+	walk, err := walkerFor(c.WalkBackend)
+	if err != nil {
+		return err
+	}
+	o.files = osFS{walk: walk}
+	if o.comments, err = newCommentRegistry(c.CommentSyntaxes); err != nil {
+		return err
+	}
+	o.langs = newLanguageRegistry(c.LanguageMap)
+	if o.llm, err = newSummarizer(c.LLM); err != nil {
+		return err
+	}
+	if o.FS != nil {
+		rootAbs, err := filepath.Abs(projectRoot)
+		if err != nil {
+			return fmt.Errorf("resolve root: %w", err)
+		}
+		o.files = mappedFS{fsys: o.FS, root: rootAbs}
+	}
+	if o.Context != nil {
+		o.files = cancelFS{sourceFS: o.files, ctx: o.Context}
+	}
+	return nil
+}
+
+func (o Options) warn(w Warning) {
+	if o.Warn != nil {
+		o.Warn(w)
+		return
+	}
+	o.logf("warning: %s\n", w)
+}
+
+func (o Options) logf(format string, args ...any) {
+	w := o.Log
+	if w == nil {
+		w = os.Stderr
+	}
+	fmt.Fprintf(w, format, args...)
+}
+
+// Generate renders all documents, writes them to their output paths, runs
+// their postGenerate hooks and returns what each document contains and left
+// out. When documents fail
+// under failurePolicy continue or retry, the others are still written and
+// the *FailedDocumentsError is returned with their result.
+func Generate(c cfg.Config, projectRoot string, opts Options) (Result, error) {
+	outs, err := Render(c, projectRoot, opts)
+	var failed *FailedDocumentsError
+	if err != nil && !errors.As(err, &failed) {
+		return Result{}, err
+	}
+	if err := WriteOutputsTo(opts.Storage, outs, opts.Stdout); err != nil {
+		return Result{}, err
+	}
+	if err := RunPostHooks(c, projectRoot, outs, opts); err != nil {
+		return Result{}, err
+	}
+	return NewResult(opts.RunID, outs), err
+}
+
+// WriteOutputs writes rendered documents to their paths, creating parent
+// directories; documents with StdoutPath go to stdout (os.Stdout when nil).
+// Paths with a URL scheme go to the storage.Default backends.
+func WriteOutputs(outs []Output, stdout io.Writer) error {
+	return WriteOutputsTo(nil, outs, stdout)
+}
+
+// WriteOutputsTo is WriteOutputs with the backends that store paths with a
+// URL scheme, such as "mem://" for a storage.Memory; nil means
+// storage.Default.
+func WriteOutputsTo(backends storage.Backends, outs []Output, stdout io.Writer) error {
+	if backends == nil {
+		backends = storage.Default()
+	}
+	for _, o := range outs {
+		if o.Path == StdoutPath {
+			w := stdout
+			if w == nil {
+				w = os.Stdout
+			}
+			if _, err := io.WriteString(w, o.Content); err != nil {
+				return fmt.Errorf("write output to stdout: %w", err)
+			}
+			continue
+		}
+		put := func(path, content string, private bool) error {
+			st, key, err := backends.For(path)
+			if err != nil {
+				return err
+			}
+			if ms, ok := st.(storage.ModeStorage); ok && o.Mode != 0 && !private {
+				return ms.PutMode(key, []byte(content), o.Mode)
+			}
+			// other backends only tell private from shared
+			return st.Put(key, []byte(content), private || o.Mode != 0 && o.Mode&0o077 == 0)
+		}
+		if !o.Streamed {
+			if err := put(o.Path, o.Content, false); err != nil {
+				return fmt.Errorf("write output %s: %w", o.Path, err)
+			}
+		}
+		if o.Sidecar != "" {
+			if err := put(o.Path+SidecarSuffix, o.Sidecar, false); err != nil {
+				return fmt.Errorf("write config sidecar for %s: %w", o.Path, err)
+			}
+		}
+		if o.Mapping != "" {
+			if err := put(o.Path+AnonymizeSuffix, o.Mapping, true); err != nil {
+				return fmt.Errorf("write anonymization mapping for %s: %w", o.Path, err)
+			}
+		}
+		if o.Signature != "" {
+			if err := put(o.Path+signing.Suffix, o.Signature, false); err != nil {
+				return fmt.Errorf("write signature for %s: %w", o.Path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Sign signs every output written to a file with the SSH private key in
+// keyFile; documents streamed to stdout are left unsigned.
+func Sign(outs []Output, keyFile string) error {
+	for i := range outs {
+		if outs[i].Path == StdoutPath {
+			continue
+		}
+		sig, err := signing.Sign(keyFile, []byte(outs[i].Content))
+		if err != nil {
+			return fmt.Errorf("%s: %w", outs[i].Path, err)
+		}
+		outs[i].Signature = string(sig)
+	}
+	return nil
+}
+
+// readOutput returns the current content at an output path, or nil when
+// there is none.
+func readOutput(backends storage.Backends, path string) ([]byte, error) {
+	if backends == nil {
+		backends = storage.Default()
+	}
+	st, key, err := backends.For(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := st.Get(key)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return data, nil
+}
+
+// Render builds all documents in memory without writing them, up to
+// opts.Jobs at once. A document that fails stops the run unless its
+// failurePolicy is continue or retry; then the outputs of the other
+// documents are returned, in config order, together with a
+// *FailedDocumentsError.
+func Render(c cfg.Config, projectRoot string, opts Options) ([]Output, error) {
+	c, err := c.Compose()
+	if err != nil {
+		return nil, err
+	}
+	// a document failing under failurePolicy abortAll cancels ctx, which
+	// the file system built by setup watches too
+	parent := opts.ctx()
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+	opts.Context = ctx
+	if err := opts.setup(c, projectRoot); err != nil {
+		return nil, err
+	}
+
+	outs := make([]Output, 0, len(c.Documents))
+	var failed FailedDocumentsError
+	for i, r := range renderAll(c, projectRoot, opts, cancel) {
+		doc, rendered, err := c.Documents[i], r.outs, r.err
+		if err != nil {
+			if err := parent.Err(); err != nil {
+				return nil, err
+			}
+			if r.interrupted {
+				// stopped by the failure of a later document, reported below
+				continue
+			}
+			if policy := strings.ToLower(doc.FailurePolicy); policy != "continue" && policy != "retry" {
+				return nil, err
+			}
+			failed.Failures = append(failed.Failures, DocumentFailure{Document: cmp.Or(doc.Name, doc.Targets()[0].Path), Err: err})
+			continue
+		}
+		outs = append(outs, rendered...)
+	}
+	if len(failed.Failures) > 0 {
+		return outs, &failed
+	}
+	return outs, nil
+}
+
+// renderOne renders one document of c into its outputs.
+func renderOne(c cfg.Config, doc cfg.Document, projectRoot string, opts Options) ([]Output, error) {
+	var outs []Output
+	if doc.LicensePolicy == nil {
+		doc.LicensePolicy = c.LicensePolicy
+	}
+	if doc.Redact == nil {
+		doc.Redact = c.Redact
+	}
+	dopts := opts
+	if c.Deterministic {
+		doc.Deterministic = true
+	}
+	if doc.Deterministic {
+		dopts.RunID = ""
+	}
+	fileMode, err := doc.FileMode()
+	if err != nil {
+		return nil, err
+	}
+	mode, err := snapshotMode(c, doc)
+	if err != nil {
+		return nil, err
+	}
+	var snapshot string
+	if mode == "appendix" || mode == "sidecar" {
+		if snapshot, err = configSnapshot(c, doc, projectRoot, dopts.RunID); err != nil {
+			return nil, err
+		}
+	}
+	appendix := ""
+	if mode == "appendix" {
+		appendix = snapshot
+	}
+	targets := doc.Targets()
+	if doc.OutputPath == "" {
+		// warnings and errors name the document by its first output
+		doc.OutputPath = targets[0].Path
+	}
+	name := cmp.Or(doc.Name, doc.OutputPath)
+	opts.progress(Event{Event: EventDocumentStarted, Document: name})
+	started := time.Now()
+	var warnings []Warning
+	dopts.Warn = func(w Warning) {
+		warnings = append(warnings, w)
+		opts.progress(Event{Event: EventWarning, Document: name, Path: w.Path, Msg: w.Msg})
+		opts.warn(w)
+	}
+	dopts.degrade = &degrader{doc: doc.OutputPath, strict: opts.StrictFeatures, warn: dopts.Warn}
+	var fm *frontMatter
+	if doc.FrontMatter {
+		if fm, err = newFrontMatter(c, doc, projectRoot, dopts); err != nil {
+			return nil, err
+		}
+	}
+	var streams []*streamSink
+	if opts.Stream && streamable(doc, targets) {
+		if streams, err = openStreams(targets, fileMode); err != nil {
+			return nil, fmt.Errorf("write output: %w", err)
+		}
+		// a no-op once they are committed
+		defer abortStreams(streams)
+	}
+	contents, files, nothingMatched, err := renderDocument(doc, projectRoot, appendix, fm, targets, writers(streams), dopts)
+	if err != nil {
+		return nil, err
+	}
+	mapping, err := runPipeline(doc, projectRoot, targets, contents, slices.Concat(files...), &snapshot, dopts)
+	if err != nil {
+		return nil, err
+	}
+	if err := commitStreams(streams); err != nil {
+		return nil, fmt.Errorf("write output: %w", err)
+	}
+	took := time.Since(started)
+	for i, parts := range contents {
+		for j, content := range parts {
+			if doc.Deterministic {
+				content = lfLineEndings(content)
+			}
+			o := Output{Path: targets[i].Path, Content: content, Files: files[j], Mapping: mapping, Mode: fileMode,
+				Document: name, Warnings: warnings,
+				NothingMatched: nothingMatched, Took: took, target: i}
+			if len(parts) > 1 {
+				o.Path = partPath(targets[i].Path, j+1)
+			}
+			if streams != nil {
+				o.Streamed, o.Size = true, streams[i].n
+			}
+			if mode == "sidecar" {
+				o.Sidecar = snapshot
+			}
+			outs = append(outs, o)
+		}
+	}
+	if opts.Progress != nil {
+		stats := NewResult(opts.RunID, outs).Documents[0]
+		opts.progress(Event{Event: EventDocumentFinished, Document: name, Stats: &stats})
+	}
+	return outs, nil
+}
+
+// encoding is one output format of the document being rendered.
+type encoding struct {
+	out          formatter
+	b            strings.Builder   // the current part
+	parts        []string          // finished parts
+	captured     map[string]string // output of sources with an id, for {{ source "id" }}
+	pending      string            // capture text in finished parts
+	captureStart int
+	toc          bool // the part starts with tocMarker
+	flushed      int  // bytes already handed to the encoding's sink
+}
+
+// renderDocument renders one document into every target format from a
+// single pass over its sources. It returns the parts of each encoding (one
+// unless the document is split), the files embedded in each part, and
+// whether the document has path-based sources that all matched no files.
+// appendix, when not empty, is the config snapshot embedded at the end;
+// fm, when set, is the front matter starting every markdown part. sinks,
+// when set, receive each encoding while it is rendered (see streamable),
+// and the parts returned are empty.
+func renderDocument(doc cfg.Document, projectRoot, appendix string, fm *frontMatter, targets []cfg.Output, sinks []io.Writer, opts Options) ([][]string, [][]FileStat, bool, error) {
+	var stats []FileStat
+	excluded := 0
+	// with dedupeFiles, files (or slices) already embedded by an earlier
+	// source of the document are left out and counted
+	embedded, duplicates := make(map[string]bool), 0
+	name := cmp.Or(doc.Name, doc.OutputPath)
+	pathSources, matched := 0, 0
+
+	gate, err := newLicenseGate(opts.files, projectRoot, doc.LicensePolicy)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	modulePath := goModulePath(opts.files, projectRoot)
+	annotate := func(src cfg.Source, rel string, data []byte) string {
+		if !src.AnnotateGo || !strings.EqualFold(filepath.Ext(rel), ".go") {
+			return ""
+		}
+		return goAnnotation(rel, data, modulePath)
+	}
+	// root is the root of the source being rendered
+	var root sourceRoot
+	showPath := func(rel string) string {
+		p := displayPath(doc.PathStyle, doc.RepoPrefix, projectRoot, rel)
+		if shown, ok := root.show(rel); ok && (doc.PathStyle == "" || strings.EqualFold(doc.PathStyle, "relative")) {
+			// below the root's name rather than "../"
+			p = shown
+		}
+		if strings.EqualFold(doc.PathSeparator, "native") {
+			p = filepath.FromSlash(p)
+		}
+		return p
+	}
+	// process applies the source's filter command, content transforms,
+	// transforms steps, line length and size limits and line numbering
+	// (starting at first) to embedded content; skip says why a file is left
+	// out and long counts the lines over maxLineLength
+	process := func(src cfg.Source, rel string, data []byte, first int) (_ []byte, long int, skip string, _ error) {
+		if strings.TrimSpace(src.FilterCommand) != "" {
+			out, skipped, err := runFilter(opts.ctx(), projectRoot, rel, data, src)
+			switch {
+			case err != nil:
+				if err := opts.degrade.handle(err, "files embedded unfiltered"); err != nil {
+					return nil, 0, "", err
+				}
+			case skipped:
+				return nil, 0, "filter command failed", nil
+			default:
+				data = out
+			}
+		}
+		data = applyTransforms(src, rel, data, modulePath, opts.comments)
+		if len(src.Transforms) > 0 {
+			var err error
+			data, err = runTransforms(src.Transforms, transformFile{rel: rel, data: data, first: first, modulePath: modulePath, comments: opts.comments})
+			if err != nil {
+				return nil, 0, "", err
+			}
+		}
+		data, long, err := limitLineLength(src, data)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		data, dropped, skipped, err := applySizeLimits(src, rel, data)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		if skipped {
+			return nil, 0, "exceeds the size limit", nil
+		}
+		if src.LineNumbers {
+			data = numberLines(data, first)
+		}
+		if dropped > 0 {
+			data = appendTruncationMarker(data, dropped)
+		}
+		return data, long, "", nil
+	}
+
+	// flagLong reports the long lines kept by longLinePolicy: flag
+	flagLong := func(src cfg.Source, p string, long int) {
+		if long > 0 && strings.EqualFold(src.LongLinePolicy, "flag") {
+			opts.warn(Warning{Document: doc.OutputPath, Path: p, Msg: fmt.Sprintf("%d line(s) longer than %d characters", long, src.MaxLineLength)})
+		}
+	}
+
+	split, err := newSplitter(doc)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	rootName := projectRoot
+	if abs, err := filepath.Abs(projectRoot); err == nil {
+		rootName = filepath.Base(abs)
+	}
+	encs := make([]*encoding, len(targets))
+	// openPart starts a part of encoding i with a fresh formatter
+	openPart := func(i int) error {
+		t := targets[i]
+		out, err := newFormatter(resolveFormat(t.Format, t.Path), doc.HeadingLevel)
+		if err != nil {
+			return err
+		}
+		if g, ok := out.(*gitingestFormat); ok {
+			g.root = rootName
+		}
+		e := encs[i]
+		e.out = out
+		_, md := out.(markdownFormat)
+		if md && fm != nil {
+			e.b.WriteString(frontMatterMarker)
+		}
+		d := doc
+		d.OutputPath, d.OutputFormat = t.Path, t.Format
+		out.header(&e.b, d, opts.RunID)
+		if split != nil {
+			e.b.WriteString(partMarker)
+		}
+		if md && doc.TOC {
+			e.b.WriteString(tocMarker)
+			e.toc = true
+		}
+		return nil
+	}
+	for i := range targets {
+		encs[i] = &encoding{captured: make(map[string]string)}
+		if err := openPart(i); err != nil {
+			return nil, nil, false, err
+		}
+	}
+	if split != nil {
+		// the header of a part, its "part N of M" note included
+		var note strings.Builder
+		encs[0].out.part(&note, 10, 10)
+		header := encs[0].b.Len() - len(partMarker) + note.Len()
+		if encs[0].toc {
+			// the heading of the table of contents; its entries count
+			// toward the units they link to
+			header += len(renderTOC(encs[0].out.(markdownFormat).hashes(-1), []tocEntry{{}})) - len(tocEntry{}.line()) - len(tocMarker)
+		}
+		split.reserve(header)
+	}
+	// closePart ends the current part of every encoding; partStats are the
+	// files embedded in it
+	started, partStart := time.Now(), 0
+	var partFiles [][]FileStat
+	// sections lists the sections of the document when toc is set; the
+	// current part lists sections.entries[tocStart:tocEnd], entries past
+	// tocEnd belong to the unit about to be emitted
+	var sections toc
+	tocStart, tocEnd := 0, 0
+	// anchor registers a section in the table of contents and returns its id
+	anchor := func(title, kind, path string) string {
+		if !doc.TOC {
+			return ""
+		}
+		return sections.add(title, kind, path)
+	}
+	closePart := func(last bool) error {
+		for i, e := range encs {
+			if last && appendix != "" {
+				e.out.snapshot(&e.b, appendix)
+			}
+			if doc.Footer {
+				took := time.Since(started)
+				if doc.Deterministic {
+					took = 0
+				}
+				e.out.footer(&e.b, footerText(stats[partStart:], excluded, duplicates, e.flushed+e.b.Len(), took))
+			}
+			if err := e.out.finish(&e.b); err != nil {
+				return err
+			}
+			part := e.b.String()
+			if e.toc {
+				part = strings.Replace(part, tocMarker, renderTOC(e.out.(markdownFormat).hashes(-1), sections.entries[tocStart:tocEnd]), 1)
+			}
+			if rest, ok := strings.CutPrefix(part, frontMatterMarker); ok {
+				part = fm.render(opts.RunID, len(stats)-partStart, rest) + rest
+			}
+			if sinks != nil {
+				n, err := io.WriteString(sinks[i], part)
+				if err != nil {
+					return err
+				}
+				e.flushed += n
+				part = ""
+			}
+			e.parts = append(e.parts, part)
+			e.pending += e.b.String()[e.captureStart:]
+			e.b.Reset()
+			e.captureStart = 0
+		}
+		partFiles = append(partFiles, stats[partStart:])
+		partStart, tocStart = len(stats), tocEnd
+		return nil
+	}
+	// emit writes one unit (size bytes of content embedding files files) to
+	// every encoding in turn, starting a new part first when the unit does
+	// not fit; cur is the encoding being written, so templates see the
+	// sources captured in their own format
+	cur := encs[0]
+	emit := func(size, files int, write func(out formatter, b *strings.Builder) error) error {
+		if split != nil {
+			// a part is sized by the unit as rendered in the first format,
+			// headings and markup included; formats that only render when
+			// finished count the content
+			t := targets[0]
+			out, err := newFormatter(resolveFormat(t.Format, t.Path), doc.HeadingLevel)
+			if err != nil {
+				return err
+			}
+			var b strings.Builder
+			cur = encs[0]
+			if err := write(out, &b); err != nil {
+				return err
+			}
+			size = max(size, b.Len())
+			if encs[0].toc {
+				for _, e := range sections.entries[tocEnd:] {
+					size += len(e.line())
+				}
+			}
+		}
+		if split.next(size, files) {
+			if err := closePart(false); err != nil {
+				return err
+			}
+			for i := range encs {
+				if err := openPart(i); err != nil {
+					return err
+				}
+			}
+		}
+		for i, e := range encs {
+			cur = e
+			if err := write(e.out, &e.b); err != nil {
+				return err
+			}
+			if sinks != nil {
+				n, err := io.WriteString(sinks[i], e.b.String())
+				if err != nil {
+					return err
+				}
+				e.flushed += n
+				e.b.Reset()
+				e.captureStart = 0
+			}
+		}
+		tocEnd = len(sections.entries)
+		return nil
+	}
+
+	sourceFunc := template.FuncMap{"source": func(id string) (string, error) {
+		text, ok := cur.captured[id]
+		if !ok {
+			return "", fmt.Errorf("no source with id %q rendered before this point", id)
+		}
+		return text, nil
+	}}
+	captureID := ""
+	capture := func() {
+		for _, e := range encs {
+			if captureID != "" {
+				e.captured[captureID] = stripAnchors(e.pending + e.b.String()[e.captureStart:])
+			}
+			e.pending, e.captureStart = "", e.b.Len()
+		}
+	}
+
+	var changed map[string]bool
+	if doc.ChangedSince != "" {
+		if opts.FS != nil {
+			return nil, nil, false, errors.New("changedSince needs the project on disk")
+		}
+		if changed, err = changedFiles(opts.ctx(), projectRoot, doc.ChangedSince); err != nil {
+			return nil, nil, false, err
+		}
+	}
+
+	// sources walk the directories, or only the listed files
+	walkFS := opts.files
+	var listed map[string]bool
+	if opts.FileList != nil || doc.FilesFrom != "" {
+		rootAbs, err := filepath.Abs(projectRoot)
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("resolve root: %w", err)
+		}
+		list, err := documentFileList(opts, rootAbs, doc.FilesFrom)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		walkFS = listedFS{sourceFS: opts.files, rootAbs: rootAbs, files: list}
+		listed = make(map[string]bool, len(list))
+		for _, rel := range list {
+			listed[unorm.NFC(rel)] = true
+		}
+	}
+
+	for _, srcIndex := range prioritized(doc) {
+		src := doc.Sources[srcIndex]
+		root = sourceRoot{dir: projectRoot}
+		if err := opts.ctx().Err(); err != nil {
+			return nil, nil, false, err
+		}
+		capture()
+		captureID = strings.TrimSpace(src.ID)
+
+		kind := strings.ToLower(src.Type)
+		if kind == "template" {
+			tmpl, err := sectionTemplate(src.Text)
+			if err != nil {
+				return nil, nil, false, err
+			}
+			tmpl.Funcs(sourceFunc)
+			err = emit(0, 0, func(_ formatter, b *strings.Builder) error {
+				return tmpl.Execute(b, sectionView{Description: doc.Description, RunID: opts.RunID, Vars: doc.Vars})
+			})
+			if err != nil {
+				return nil, nil, false, fmt.Errorf("template source: %w", err)
+			}
+			continue
+		}
+		if kind == "command" {
+			title, output, ok, err := runCommandSource(opts.ctx(), projectRoot, src, opts.Refresh)
+			if err != nil {
+				if err := opts.degrade.handle(err, "its output is left out"); err != nil {
+					return nil, nil, false, err
+				}
+			}
+			if ok {
+				err = emit(len(output), 0, func(out formatter, b *strings.Builder) error {
+					out.command(b, title, output)
+					return nil
+				})
+				if err != nil {
+					return nil, nil, false, err
+				}
+			}
+			continue
+		}
+		if provider, ok := opts.providers[kind]; ok {
+			rootAbs, err := filepath.Abs(projectRoot)
+			if err != nil {
+				return nil, nil, false, fmt.Errorf("resolve root: %w", err)
+			}
+			req := SourceRequest{
+				Protocol:    PluginProtocol,
+				Type:        kind,
+				Params:      src.Params,
+				ProjectRoot: rootAbs,
+				Document:    doc.OutputPath,
+				RunID:       opts.RunID,
+				Vars:        doc.Vars,
+			}
+			resp, err := collectSource(opts.ctx(), provider, req, src, opts.Refresh)
+			if err != nil {
+				if err := opts.degrade.handle(err, "its items are left out"); err != nil {
+					return nil, nil, false, err
+				}
+				continue
+			}
+			for _, msg := range resp.Warnings {
+				opts.warn(Warning{Document: doc.OutputPath, Msg: fmt.Sprintf("%s source: %s", kind, msg)})
+			}
+			tmpl, err := fileTemplate(src.Template, doc.Template)
+			if err != nil {
+				return nil, nil, false, err
+			}
+			tmpl.Funcs(sourceFunc)
+			for _, item := range resp.Items {
+				data, long, skip, err := process(src, item.Path, []byte(item.Content), 1)
+				if err != nil {
+					return nil, nil, false, err
+				}
+				if skip != "" {
+					opts.warn(Warning{Document: doc.OutputPath, Path: item.Path, Msg: skippedPrefix + skip})
+					excluded++
+					continue
+				}
+				flagLong(src, item.Path, long)
+				view := newFileView(item.Path, "", data, int64(len(item.Content)), item.Modified)
+				view.Lang, view.Vars = cmp.Or(item.Lang, opts.langs.detect(item.Path, data)), doc.Vars
+				id := anchor(item.Path, "file", item.Path)
+				err = emit(len(data), 1, func(out formatter, b *strings.Builder) error {
+					writeAnchor(out, b, id)
+					return out.file(b, tmpl, view)
+				})
+				if err != nil {
+					return nil, nil, false, fmt.Errorf("template for %s: %w", item.Path, err)
+				}
+				stats = append(stats, newFileStat(item.Path, data))
+				opts.progress(Event{Event: EventFileEmbedded, Document: name, Path: item.Path, Bytes: len(data)})
+			}
+			continue
+		}
+		if kind == "url" {
+			if len(src.URLs) == 0 {
+				return nil, nil, false, errors.New("url source: urls is required")
+			}
+			tmpl, err := fileTemplate(src.Template, doc.Template)
+			if err != nil {
+				return nil, nil, false, err
+			}
+			tmpl.Funcs(sourceFunc)
+			for _, u := range src.URLs {
+				fetched, err := fetchURL(opts.ctx(), u, src, opts.Refresh)
+				if err != nil {
+					return nil, nil, false, err
+				}
+				label := redactURL(u) // never show credentials
+				data, lang := fetched.data, urlLang(u, fetched.contentType)
+				if src.HTMLToMarkdown && lang == "html" {
+					data, lang = htmlToMarkdown(data), "md"
+				}
+				data, long, skip, err := process(src, label, data, 1)
+				if err != nil {
+					return nil, nil, false, err
+				}
+				if skip != "" {
+					opts.warn(Warning{Document: doc.OutputPath, Path: label, Msg: skippedPrefix + skip})
+					excluded++
+					continue
+				}
+				flagLong(src, label, long)
+				view := newFileView(label, "", data, int64(len(fetched.data)), fetched.fetched)
+				view.Lang, view.Vars = lang, doc.Vars
+				id := anchor(label, "file", label)
+				err = emit(len(data), 1, func(out formatter, b *strings.Builder) error {
+					writeAnchor(out, b, id)
+					return out.file(b, tmpl, view)
+				})
+				if err != nil {
+					return nil, nil, false, fmt.Errorf("template for %s: %w", label, err)
+				}
+				stats = append(stats, newFileStat(label, data))
+				opts.progress(Event{Event: EventFileEmbedded, Document: name, Path: label, Bytes: len(data)})
+			}
+			continue
+		}
+		if kind == "git-log" {
+			title, output, err := runGitLog(opts.ctx(), projectRoot, src)
+			if err != nil {
+				if err := opts.degrade.handle(err, "the log is left out"); err != nil {
+					return nil, nil, false, err
+				}
+				continue
+			}
+			err = emit(len(output), 0, func(out formatter, b *strings.Builder) error {
+				out.block(b, title, "", output)
+				return nil
+			})
+			if err != nil {
+				return nil, nil, false, err
+			}
+			continue
+		}
+		if kind == "deps" {
+			title, graph, lang, err := renderDeps(opts.ctx(), opts.files, projectRoot, src, opts.FS == nil, opts.degrade)
+			if err != nil {
+				return nil, nil, false, err
+			}
+			err = emit(len(graph), 0, func(out formatter, b *strings.Builder) error {
+				out.block(b, title, lang, graph)
+				return nil
+			})
+			if err != nil {
+				return nil, nil, false, err
+			}
+			continue
+		}
+		if kind == "dirdiff" {
+			d, err := runDirDiff(opts.files, projectRoot, src)
+			if err != nil {
+				return nil, nil, false, err
+			}
+			summary := d.summary()
+			size := len(summary)
+			for _, diff := range d.diffs {
+				size += len(diff)
+			}
+			err = emit(size, 0, func(out formatter, b *strings.Builder) error {
+				out.block(b, fmt.Sprintf("diff %s %s", src.Left, src.Right), "", summary)
+				for i, rel := range d.differing {
+					if i < len(d.diffs) {
+						out.block(b, rel, "diff", []byte(d.diffs[i]))
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, nil, false, err
+			}
+			continue
+		}
+
+		if kind == "db-schema" && src.DSNEnv != "" {
+			title, schema, err := dumpSchema(opts.ctx(), projectRoot, src)
+			if err != nil {
+				if err := opts.degrade.handle(err, "the schema is left out"); err != nil {
+					return nil, nil, false, err
+				}
+				continue
+			}
+			err = emit(len(schema), 0, func(out formatter, b *strings.Builder) error {
+				out.block(b, title, "sql", schema)
+				return nil
+			})
+			if err != nil {
+				return nil, nil, false, err
+			}
+			continue
+		}
+		switch kind {
+		case "db-schema":
+			if len(src.FilePattern) == 0 {
+				src.FilePattern = cfg.Patterns{"*.sql"}
+			}
+		case "infra":
+			if len(src.FilePattern) == 0 {
+				src.FilePattern = cfg.ParsePatterns(infraPattern)
+			}
+		}
+
+		if root, err = newSourceRoot(projectRoot, src); err != nil {
+			return nil, nil, false, err
+		}
+		paths, selectors, err := splitSelectors(root.dir, src.SourcePaths)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		if root.rel != "" && selectors != nil {
+			rebased := make(map[string][]*cfg.Selector, len(selectors))
+			for rel, sels := range selectors {
+				rebased[root.fromRoot(rel)] = sels
+			}
+			selectors = rebased
+		}
+		var files []string
+		var denied map[string]string // tree placeholders: unreadable directory -> why
+		unreadable := unreadableDirs(kind, src, func(rel string, err error) {
+			rel = root.fromRoot(rel)
+			if kind == "tree" && strings.EqualFold(src.OnError, "placeholder") {
+				if denied == nil {
+					denied = make(map[string]string)
+				}
+				denied[rel] = pathCause(err)
+				opts.warn(Warning{Document: doc.OutputPath, Source: srcIndex + 1, Path: rel, Msg: "unreadable, shown in the tree: " + err.Error()})
+				return
+			}
+			opts.warn(Warning{Document: doc.OutputPath, Source: srcIndex + 1, Path: rel, Msg: skippedPrefix + "unreadable: " + err.Error()})
+		})
+		if kind == "tree" && src.TreeShowAll {
+			// the real layout, whatever the file sources embed
+			files, err = collectAll(opts.files, root.dir, paths, slices.Concat(src.ExcludePaths, src.TreeExclude), unreadable)
+		} else {
+			files, err = sourceFiles(walkFS, root.dir, paths, src, unreadable)
+		}
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("collect files for %q: %w", src.Type, err)
+		}
+		for i, f := range files {
+			files[i] = root.fromRoot(f)
+		}
+		if changed != nil {
+			files = keepChanged(files, changed)
+		}
+		if listed != nil && !(kind == "tree" && src.TreeShowAll) {
+			// sourcePaths naming files are not walked
+			files = keepChanged(files, listed)
+		}
+		pathSources++
+		matched += len(files)
+		opts.progress(Event{Event: EventSourceCollected, Document: name, Path: strings.Join(src.SourcePaths, ","), Files: len(files)})
+		before := len(files)
+		files, err = filterOwners(opts.files, projectRoot, files, src.ExcludeOwners)
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("filter owners for %q: %w", src.Type, err)
+		}
+		excluded += before - len(files)
+		if src.ModifiedWithin != "" || src.ModifiedAfter != "" {
+			cutoff, err := modifiedCutoff(src, time.Now())
+			if err != nil {
+				return nil, nil, false, err
+			}
+			before := len(files)
+			if files, err = filterModified(opts.ctx(), opts.files, projectRoot, files, src, cutoff, opts.FS == nil, opts.jobs()); err != nil {
+				return nil, nil, false, err
+			}
+			excluded += before - len(files)
+		}
+		if len(src.Authors) > 0 {
+			before := len(files)
+			if files, err = filterAuthors(opts.ctx(), projectRoot, files, src.Authors, opts.FS == nil, opts.jobs()); err != nil {
+				return nil, nil, false, err
+			}
+			excluded += before - len(files)
+		}
+		if src.SkipGenerated {
+			var dropped int
+			if files, dropped, err = dropGenerated(opts.files, projectRoot, files, src, opts.jobs()); err != nil {
+				return nil, nil, false, err
+			}
+			excluded += dropped
+		}
+
+		var covered coverage
+		if src.CoverageProfile != "" && (kind == "file" || kind == "outline") {
+			if covered, err = loadCoverage(opts.files, projectRoot, src.CoverageProfile, modulePath); err != nil {
+				return nil, nil, false, err
+			}
+			if src.CoverageBelow > 0 {
+				before := len(files)
+				files = covered.below(files, src.CoverageBelow)
+				excluded += before - len(files)
+			}
+		}
+
+		contents, err := newContentFilter(src)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		if contents != nil && (kind == "tree" || kind == "stats" || kind == "symbols" || kind == "api-spec" || kind == "db-schema" || kind == "infra") {
+			before := len(files)
+			if files, err = filterContent(opts.files, projectRoot, files, contents, opts.jobs()); err != nil {
+				return nil, nil, false, err
+			}
+			excluded += before - len(files)
 		}
 
-		for _, src := range doc.Sources {
-			files, err := collectFiles(projectRoot, src.SourcePaths, src.FilePattern, src.ExcludePaths)
+		switch kind {
+		case "tree":
+			if len(files) == 0 && len(denied) == 0 {
+				err = emit(0, 0, func(out formatter, b *strings.Builder) error {
+					out.tree(b, src, "")
+					return nil
+				})
+				if err != nil {
+					return nil, nil, false, err
+				}
+				continue
+			}
+			view := treeView{fields: src.TreeDetails, maxDepth: src.MaxDepth, dirsOnly: src.DirsOnly, maxTokens: src.MaxTokens, sort: strings.ToLower(doc.Sort)}
+			if f := strings.ToLower(src.TreeFormat); f != "ascii" {
+				view.format = f
+			}
+			fields := src.TreeDetails
+			if view.sort == "size" || view.sort == "modtime" {
+				fields = append(slices.Clone(fields), view.sort)
+			}
+			if src.RecentWithin != "" {
+				within, err := cfg.ParseAge(src.RecentWithin)
+				if err != nil {
+					return nil, nil, false, fmt.Errorf("recentWithin: %w", err)
+				}
+				view.recentSince, view.recentWithin = time.Now().Add(-within), src.RecentWithin
+				fields = append(slices.Clone(fields), "modtime")
+			}
+			details, err := collectTreeDetails(opts.files, projectRoot, files, fields, opts.jobs())
+			if err != nil {
+				return nil, nil, false, err
+			}
+			labelTree := func(paths []string) []string {
+				if root.rel == "" {
+					return labelRoots(projectRoot, paths)
+				}
+				// every path is below the source's root
+				labeled := make([]string, len(paths))
+				for i, p := range paths {
+					labeled[i], _ = root.show(p)
+				}
+				return labeled
+			}
+			paths := labelTree(files)
+			if len(denied) > 0 {
+				// label the directories with the files, which may come from
+				// outside the root
+				dirs := make([]string, 0, len(denied))
+				for dir := range denied {
+					dirs = append(dirs, dir)
+				}
+				labeled := labelTree(append(slices.Clone(files), dirs...))
+				paths = labeled[:len(files)]
+				view.unreadable = make(map[string]string, len(dirs))
+				for i, dir := range dirs {
+					view.unreadable[labeled[len(files)+i]] = denied[dir]
+				}
+			}
+			tree := renderTree(paths, details, view)
+			id := anchor("Tree of "+strings.Join(src.SourcePaths, ", "), "tree", strings.Join(src.SourcePaths, " "))
+			err = emit(len(tree), 0, func(out formatter, b *strings.Builder) error {
+				writeAnchor(out, b, id)
+				out.tree(b, src, tree)
+				return nil
+			})
+			if err != nil {
+				return nil, nil, false, err
+			}
+
+		case "stats":
+			table, err := renderStats(opts.files, projectRoot, files, opts.langs, cmp.Or(src.Largest, defaultLargest), opts.jobs())
+			if err != nil {
+				return nil, nil, false, err
+			}
+			title := "Statistics of " + strings.Join(src.SourcePaths, ", ")
+			id := anchor(title, "stats", strings.Join(src.SourcePaths, " "))
+			err = emit(len(table), 0, func(out formatter, b *strings.Builder) error {
+				writeAnchor(out, b, id)
+				out.block(b, title, "", table)
+				return nil
+			})
+			if err != nil {
+				return nil, nil, false, err
+			}
+
+		case "symbols":
+			table, err := renderSymbols(opts.files, projectRoot, files, opts.jobs())
+			if err != nil {
+				return nil, nil, false, err
+			}
+			title := "Symbols in " + strings.Join(src.SourcePaths, ", ")
+			id := anchor(title, "symbols", strings.Join(src.SourcePaths, " "))
+			err = emit(len(table), 0, func(out formatter, b *strings.Builder) error {
+				writeAnchor(out, b, id)
+				out.block(b, title, "", table)
+				return nil
+			})
+			if err != nil {
+				return nil, nil, false, err
+			}
+
+		case "db-schema":
+			schema, n, err := renderMigrations(opts.files, projectRoot, files, opts.jobs())
+			if err != nil {
+				return nil, nil, false, err
+			}
+			if n == 0 {
+				schema = []byte("(no migrations)\n")
+			}
+			title := fmt.Sprintf("Schema from %d migration(s) in %s", n, strings.Join(src.SourcePaths, ", "))
+			id := anchor(title, "db-schema", strings.Join(src.SourcePaths, " "))
+			err = emit(len(schema), n, func(out formatter, b *strings.Builder) error {
+				writeAnchor(out, b, id)
+				out.block(b, title, "sql", schema)
+				return nil
+			})
+			if err != nil {
+				return nil, nil, false, err
+			}
+
+		case "infra":
+			found, err := collectInfra(opts.files, projectRoot, files, opts.jobs())
+			if err != nil {
+				return nil, nil, false, err
+			}
+			overview := renderInfra(found)
+			size := len(overview)
+			for _, f := range found {
+				size += len(f.data)
+			}
+			title := "Infrastructure in " + strings.Join(src.SourcePaths, ", ")
+			id := anchor(title, "infra", strings.Join(src.SourcePaths, " "))
+			err = emit(size, len(found), func(out formatter, b *strings.Builder) error {
+				writeAnchor(out, b, id)
+				out.block(b, title, "", overview)
+				for _, f := range found {
+					out.block(b, showPath(f.rel), opts.langs.detect(f.rel, f.data), f.data)
+				}
+				return nil
+			})
 			if err != nil {
-				return fmt.Errorf("collect files for %q: %w", src.Type, err)
+				return nil, nil, false, err
+			}
+			for _, f := range found {
+				stats = append(stats, newFileStat(f.rel, f.data))
 			}
 
-			switch strings.ToLower(src.Type) {
-			case "tree":
-				if len(files) == 0 {
-					fmt.Fprintf(&b, "```\n(no matches for %q in %v)\n```\n\n", src.FilePattern, src.SourcePaths)
+		case "api-spec":
+			results := readFiles(files, opts.jobs(), func(rel string) fileResult {
+				r := fileResult{rel: rel}
+				r.data, r.err = opts.files.ReadFile(filepath.Join(projectRoot, rel))
+				return r
+			})
+			for _, r := range results {
+				if r.err != nil {
+					return nil, nil, false, fmt.Errorf("api-spec %s: %w", r.rel, r.err)
+				}
+				summary, ok := renderAPISpec(r.rel, r.data)
+				if !ok {
+					opts.warn(Warning{Document: doc.OutputPath, Path: r.rel, Msg: skippedPrefix + "not an OpenAPI document or .proto file"})
+					excluded++
 					continue
 				}
-				tree := renderTree(files)
-				// Put tree into code block for readability
-				fmt.Fprintf(&b, "```\n%s\n```\n\n", tree)
+				title := "API of " + showPath(r.rel)
+				id := anchor(title, "api-spec", r.rel)
+				err = emit(len(summary), 1, func(out formatter, b *strings.Builder) error {
+					writeAnchor(out, b, id)
+					out.block(b, title, "", summary)
+					return nil
+				})
+				if err != nil {
+					return nil, nil, false, err
+				}
+			}
 
-			case "file":
-				if len(files) == 0 {
-					fmt.Fprintf(&b, "_No files matched %q under %v_\n\n", src.FilePattern, src.SourcePaths)
+		case "file", "outline":
+			if len(files) == 0 {
+				err = emit(0, 0, func(out formatter, b *strings.Builder) error {
+					out.noFiles(b, src)
+					return nil
+				})
+				if err != nil {
+					return nil, nil, false, err
+				}
+				continue
+			}
+			if files, err = orderFiles(opts.files, projectRoot, files, doc); err != nil {
+				return nil, nil, false, err
+			}
+			if src.SortByCoverage {
+				files = covered.sort(files)
+			}
+			if src.Core != "" {
+				classes, err := classifyFiles(opts.files, projectRoot, files, opts.FS == nil, opts.degrade)
+				if err != nil {
+					return nil, nil, false, err
+				}
+				before := len(files)
+				files = coreOrder(src, classes, files)
+				excluded += before - len(files)
+			}
+			if strings.EqualFold(src.Entrypoints, "first") {
+				files = entrypointsFirst(files)
+			}
+			if strings.EqualFold(src.Rank, "auto") {
+				ranked, err := rankFiles(opts.files, projectRoot, files, opts.FS == nil, opts.degrade, src.RankTop)
+				if err != nil {
+					return nil, nil, false, err
+				}
+				excluded += len(files) - len(ranked)
+				files = ranked
+			}
+			if strings.EqualFold(src.ContentMode, "reference") {
+				list, kept, dropped, err := referenceList(opts.files, projectRoot, files, contents, opts.jobs())
+				if err != nil {
+					return nil, nil, false, err
+				}
+				excluded += dropped
+				if kept == 0 {
 					continue
 				}
-				for _, rel := range files {
-					abs := filepath.Join(projectRoot, rel)
-					data, err := os.ReadFile(abs)
+				title := fileCount(kept) + " (reference only)"
+				err = emit(len(list), 0, func(out formatter, b *strings.Builder) error {
+					out.block(b, title, "", list)
+					return nil
+				})
+				if err != nil {
+					return nil, nil, false, err
+				}
+				continue
+			}
+			tmpl, err := fileTemplate(src.Template, doc.Template)
+			if err != nil {
+				return nil, nil, false, err
+			}
+			tmpl.Funcs(sourceFunc)
+			items, slices := sliceItems(files, selectors)
+			if doc.DedupeFiles {
+				kept := make([]string, 0, len(items))
+				for _, item := range items {
+					if embedded[item] {
+						duplicates++
+						continue
+					}
+					embedded[item] = true
+					kept = append(kept, item)
+				}
+				items = kept
+			}
+			results := readFiles(items, opts.jobs(), func(item string) fileResult {
+				rel := item
+				sl, sliced := slices[item]
+				if sliced {
+					rel = sl.rel
+				}
+				r := fileResult{rel: rel, label: unorm.NFC(item)}
+				abs := filepath.Join(projectRoot, rel)
+				info, err := opts.files.Stat(abs)
+				if err != nil {
+					return unreadableFile(src, r, "stat", err)
+				}
+				r.info = info
+				data, err := opts.files.ReadFile(abs)
+				if err != nil {
+					return unreadableFile(src, r, "read", err)
+				}
+				read := data
+				if flat, lang, ok, err := convertRich(src, rel, data); err != nil {
+					r.err = err
+					return r
+				} else if ok {
+					data, r.lang = flat, lang
+				}
+				if data, r.skip, err = decodeText(src, data); err != nil {
+					r.err = fmt.Errorf("decode %s: %w", rel, err)
+					return r
+				} else if r.skip != "" {
+					return r
+				}
+				if contents != nil {
+					keep, err := contents.keepData(rel, data)
+					if err != nil || !keep {
+						r.err, r.filtered = err, !keep
+						return r
+					}
+				}
+				// several slices of one file are license-checked once
+				if gate != nil && (!sliced || sl.sel == selectors[rel][0]) {
+					r.raw = data
+				}
+				r.note = annotate(src, rel, data)
+				if note := covered.note(rel); note != "" {
+					r.note = strings.TrimPrefix(r.note+"; "+note, "; ")
+				}
+				if len(src.FileHeader) > 0 {
+					header, err := fileHeader(opts.ctx(), projectRoot, rel, src.FileHeader, info, read, opts.FS == nil)
 					if err != nil {
-						return fmt.Errorf("read %s: %w", rel, err)
+						r.err = err
+						return r
 					}
-					// Show path and content as markdown code block
-					// Heading with the path for clarity
-					fmt.Fprintf(&b, "### %s\n\n", rel)
-					lang := detectLang(rel)
-					if lang != "" {
-						fmt.Fprintf(&b, "```%s\n", lang)
-					} else {
-						fmt.Fprintf(&b, "```\n")
+					r.note = strings.TrimSuffix(header+"; "+r.note, "; ")
+				}
+				first := 1
+				if sliced {
+					if data, first, err = sl.extract(data); err != nil {
+						r.err = err
+						return r
 					}
-					b.Write(data)
-					if len(data) > 0 && data[len(data)-1] != '\n' {
-						b.WriteByte('\n')
+				} else if kind == "outline" && strings.EqualFold(filepath.Ext(rel), ".go") {
+					data, err = outlineGo(rel, data)
+					if err != nil {
+						r.err = fmt.Errorf("outline %s: %w", rel, err)
+						return r
 					}
-					fmt.Fprintf(&b, "```\n\n")
 				}
-
-			default:
-				return fmt.Errorf("unknown source type: %q", src.Type)
+				if len(src.Regions) > 0 {
+					region, at, found := extractRegions(data, src.Regions)
+					if !found {
+						r.filtered = true
+						return r
+					}
+					data, first = region, first+at-1
+				}
+				r.data, r.long, r.skip, r.err = process(src, rel, data, first)
+				if src.Summarize && r.err == nil && r.skip == "" {
+					r.data, r.err = opts.llm.summarize(opts.ctx(), rel, r.data)
+					r.summarized = true
+				}
+				return r
+			})
+			if err := applyBudget(src, results); err != nil {
+				return nil, nil, false, err
+			}
+			// assemble in the original order to keep output deterministic
+			for _, r := range results {
+				if r.err != nil {
+					return nil, nil, false, r.err
+				}
+				if r.filtered {
+					excluded++
+					continue
+				}
+				if r.raw != nil {
+					if err := gate.check(r.rel, r.raw); err != nil {
+						return nil, nil, false, err
+					}
+				}
+				if r.skip != "" {
+					opts.warn(Warning{Document: doc.OutputPath, Path: r.label, Msg: skippedPrefix + r.skip})
+					excluded++
+					continue
+				}
+				if r.unreadable != nil {
+					opts.warn(Warning{Document: doc.OutputPath, Path: r.label, Msg: skippedPrefix + "unreadable, placeholder embedded: " + r.unreadable.Error()})
+					view := newFileView(r.label, "not embedded", r.data, 0, time.Time{})
+					view.Lang, view.Path, view.Vars = "", showPath(r.label), doc.Vars
+					if err := emit(len(r.data), 1, func(out formatter, b *strings.Builder) error {
+						return out.file(b, tmpl, view)
+					}); err != nil {
+						return nil, nil, false, fmt.Errorf("template for %s: %w", r.label, err)
+					}
+					continue
+				}
+				flagLong(src, r.label, r.long)
+				view := newFileView(r.label, r.note, r.data, r.info.Size(), r.info.ModTime())
+				view.Lang = cmp.Or(r.lang, opts.langs.detect(r.rel, r.data))
+				view.Path = showPath(r.label)
+				view.Vars = doc.Vars
+				if r.summarized {
+					view.Lang = "md"
+					view.Note = strings.TrimPrefix(view.Note+"; summary by "+opts.llm.llm.Model+", content not embedded", "; ")
+				}
+				id := anchor(view.Path, "file", r.label)
+				err = emit(len(r.data), 1, func(out formatter, b *strings.Builder) error {
+					writeAnchor(out, b, id)
+					return out.file(b, tmpl, view)
+				})
+				if err != nil {
+					return nil, nil, false, fmt.Errorf("template for %s: %w", r.label, err)
+				}
+				stats = append(stats, newFileStat(r.label, r.data))
+				opts.progress(Event{Event: EventFileEmbedded, Document: name, Path: r.label, Bytes: len(r.data)})
 			}
-		}
 
-		if err := ensureDir(filepath.Dir(doc.OutputPath)); err != nil {
-			return err
-		}
-		if err := os.WriteFile(doc.OutputPath, []byte(b.String()), 0o644); err != nil {
-			return fmt.Errorf("write output %s: %w", doc.OutputPath, err)
+		default:
+			return nil, nil, false, fmt.Errorf("unknown source type: %q", src.Type)
 		}
 	}
+	capture()
+
+	if err := gate.finish(doc.OutputPath, opts.warn); err != nil {
+		return nil, nil, false, err
+	}
+	if err := closePart(true); err != nil {
+		return nil, nil, false, err
+	}
+	contents := make([][]string, len(encs))
+	for i, e := range encs {
+		contents[i] = numberParts(e.out, e.parts)
+	}
+	return contents, partFiles, pathSources > 0 && matched == 0, nil
+}
+
+// contextIgnoreFiles hold gitignore-style exclusions for every source, read
+// in this order; .gpcmignore is named after the tool for projects whose
+// .contextignore belongs to another one.
+var contextIgnoreFiles = []string{".contextignore", ".gpcmignore"}
+
+// unreadableFile applies the onError of a file or outline source to a file
+// that op ("stat" or "read") failed on: "fail" (default) returns the error,
+// "skip" leaves the file out and "placeholder" embeds a line saying why it
+// is missing.
+func unreadableFile(src cfg.Source, r fileResult, op string, err error) fileResult {
+	cause := pathCause(err)
+	switch strings.ToLower(src.OnError) {
+	case "skip":
+		r.skip = fmt.Sprintf("unreadable: %s: %s", op, cause)
+	case "placeholder":
+		r.unreadable = fmt.Errorf("%s: %s", op, cause)
+		r.data = fmt.Appendf(nil, "(unreadable: %s: %s)\n", op, cause)
+	default:
+		r.err = fmt.Errorf("%s %s: %w", op, r.rel, err)
+	}
+	return r
+}
 
+// unreadableDirs returns warn when the onError of a file, outline or tree
+// source leaves out what cannot be read, so unreadable directories are
+// passed over too, and nil otherwise.
+func unreadableDirs(kind string, src cfg.Source, warn func(rel string, err error)) func(rel string, err error) {
+	if kind != "file" && kind != "outline" && kind != "tree" {
+		return nil
+	}
+	switch strings.ToLower(src.OnError) {
+	case "skip", "placeholder":
+		return warn
+	}
 	return nil
 }
 
-// collectFiles now supports glob patterns inside sourcePaths entries.
-// Examples:
-//   - "src", "migrations", "templates" (literal dirs)
-//   - "/abs/path/to/src"
-//   - "app/*/templates" (glob, non-recursive)
-//
-// Note: Go's filepath.Glob does not support ** (recursive glob) nor {a,b} brace expansion.
-func collectFiles(root string, dirs []string, patternCSV string, excludes []string) ([]string, error) {
+// pathCause is the reason a file or directory could not be read, without
+// the path: "permission denied".
+func pathCause(err error) string {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err.Error()
+	}
+	return err.Error()
+}
+
+// collectFiles returns the files under the sourcePaths entries dirs that
+// match patternCSV and are not excluded, as sorted slash-separated paths
+// relative to root. All patterns use the engine in internal/match; entries of
+// dirs may be globs, including "**" (e.g. "services/**/api"). Patterns from
+// root/.contextignore and root/.gpcmignore are applied before excludes, so a "!pattern" in
+// excludes can re-include a file. Paths are matched, deduplicated and sorted
+// in Unicode NFC, so a decomposed "café.go" (as macOS stores it) matches
+// "café.go" patterns and sorts the same on every machine; the returned path
+// is still the one on disk.
+func collectFiles(fsys sourceFS, root string, dirs []string, patternCSV string, excludes []string) ([]string, error) {
+	patterns, err := match.CompileCSV(patternCSV)
+	if err != nil {
+		return nil, fmt.Errorf("filePattern: %w", err)
+	}
+	return collectMatching(fsys, root, dirs, patterns, excludes, nil)
+}
+
+// collectAll is collectFiles for every file that is not excluded, passing
+// directories that cannot be read to unreadable like sourceFiles.
+func collectAll(fsys sourceFS, root string, dirs, excludes []string, unreadable func(rel string, err error)) ([]string, error) {
+	patterns, err := match.Compile(nil)
+	if err != nil {
+		return nil, err
+	}
+	return collectMatching(fsys, root, dirs, patterns, excludes, unreadable)
+}
+
+// sourceFiles is collectFiles for a source's filePattern, read in its
+// patternSyntax and caseInsensitive. Directories that cannot be read are
+// passed to unreadable and left out when it is not nil.
+func sourceFiles(fsys sourceFS, root string, dirs []string, src cfg.Source, unreadable func(rel string, err error)) ([]string, error) {
+	patterns, err := match.CompileFilePattern(src.FilePattern.String(), src.PatternSyntax, src.CaseInsensitive)
+	if err != nil {
+		return nil, fmt.Errorf("filePattern: %w", err)
+	}
+	return collectMatching(fsys, root, dirs, patterns, src.ExcludePaths, unreadable)
+}
+
+// collectMatching is collectFiles with compiled file patterns.
+func collectMatching(fsys sourceFS, root string, dirs []string, patterns *match.Set, excludes []string, unreadable func(rel string, err error)) ([]string, error) {
 	rootAbs, err := filepath.Abs(root)
 	if err != nil {
 		return nil, fmt.Errorf("resolve root: %w", err)
 	}
+	var ignored []string
+	for _, name := range contextIgnoreFiles {
+		ignore, err := fsys.ReadFile(filepath.Join(rootAbs, name))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("read %s: %w", name, err)
+		}
+		ignored = append(ignored, match.ParseIgnore(ignore)...)
+	}
+	exclude, err := match.Compile(append(ignored, anchorAbsolute(rootAbs, excludes)...))
+	if err != nil {
+		return nil, fmt.Errorf("excludePaths: %w", err)
+	}
+	// NFC path -> path on disk
+	seen := make(map[string]string)
+	add := func(relSlash, norm string) {
+		if _, dup := seen[norm]; !dup {
+			seen[norm] = relSlash
+		}
+	}
 
-	patterns := splitPatterns(patternCSV)
-	exclude := normPatterns(excludes)
-	seen := make(map[string]struct{})
-
-	starts, err := expandSourceStarts(rootAbs, dirs)
+	starts, err := expandSourceStarts(fsys, rootAbs, dirs)
 	if err != nil {
 		return nil, err
 	}
 
 	for _, start := range starts {
-		info, err := os.Stat(start)
+		info, err := fsys.Stat(start)
 		if err != nil {
 			if errors.Is(err, os.ErrNotExist) {
 				// silently skip non-existent source path
@@ -115,43 +1680,54 @@ func collectFiles(root string, dirs []string, patternCSV string, excludes []stri
 			// if it's a file, include if matches and not excluded
 			rel, err := filepath.Rel(rootAbs, start)
 			if err != nil {
-				return nil, err
+				return nil, fmt.Errorf("source path %s: not on the volume of the project root %s", start, rootAbs)
 			}
 			relSlash := filepath.ToSlash(rel)
-			if matchPathAny(exclude, relSlash) {
+			norm := unorm.NFC(relSlash)
+			if exclude.Match(norm) {
 				continue
 			}
-			name := filepath.Base(start)
-			if len(patterns) == 0 || matchAny(patterns, name) {
-				seen[relSlash] = struct{}{}
+			if patterns.Select(norm) {
+				add(relSlash, norm)
 			}
 			continue
 		}
 
-		err = filepath.WalkDir(start, func(path string, de fs.DirEntry, walkErr error) error {
+		// filePattern entries with a slash also match from the source path
+		startRel, err := filepath.Rel(rootAbs, start)
+		if err != nil {
+			return nil, fmt.Errorf("source path %s: not on the volume of the project root %s", start, rootAbs)
+		}
+		startNorm := unorm.NFC(filepath.ToSlash(startRel))
+		err = fsys.WalkDir(start, func(path string, de fs.DirEntry, walkErr error) error {
 			if walkErr != nil {
-				return walkErr
+				if unreadable == nil || path == start || de == nil || !de.IsDir() {
+					return walkErr
+				}
+				rel, _ := filepath.Rel(rootAbs, path)
+				unreadable(filepath.ToSlash(rel)+"/", walkErr)
+				return fs.SkipDir
 			}
 			rel, err := filepath.Rel(rootAbs, path)
 			if err != nil {
 				return err
 			}
 			relSlash := filepath.ToSlash(rel)
+			norm := unorm.NFC(relSlash)
 			if de.IsDir() {
 				// skip excluded directories
-				if relSlash != "." && matchPathAny(exclude, relSlash) {
+				if relSlash != "." && exclude.MatchDir(norm) {
 					return fs.SkipDir
 				}
 				return nil
 			}
 			// skip excluded files
-			if matchPathAny(exclude, relSlash) {
+			if exclude.Match(norm) {
 				return nil
 			}
-			name := de.Name()
-			if len(patterns) == 0 || matchAny(patterns, name) {
+			if patterns.SelectIn(norm, startNorm) {
 				// normalize to slashes to keep tree stable across OSes
-				seen[relSlash] = struct{}{}
+				add(relSlash, norm)
 			}
 			return nil
 		})
@@ -160,55 +1736,82 @@ func collectFiles(root string, dirs []string, patternCSV string, excludes []stri
 		}
 	}
 
-	out := make([]string, 0, len(seen))
+	keys := make([]string, 0, len(seen))
 	for k := range seen {
-		out = append(out, k)
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]string, len(keys))
+	for i, k := range keys {
+		out[i] = seen[k]
 	}
-	sort.Strings(out)
 	return out, nil
 }
 
-func splitPatterns(csv string) []string {
-	parts := strings.Split(csv, ",")
-	out := make([]string, 0, len(parts))
-	for _, p := range parts {
-		p = strings.TrimSpace(p)
-		if p != "" {
-			out = append(out, p)
+// anchorAbsolute rewrites excludePaths written as absolute Windows paths,
+// such as `C:\repo\vendor` or `\\server\share\repo\vendor`, into patterns
+// anchored at the project root ("/vendor"), so they match the same files as
+// on other systems. Entries outside the root cannot match and are dropped;
+// a leading "!" and a trailing separator are kept. Elsewhere a leading "/"
+// already anchors a pattern, so nothing changes. Paths are parsed the same
+// way on every system.
+func anchorAbsolute(rootAbs string, excludes []string) []string {
+	rootVol, root := splitWindowsPath(rootAbs)
+	out := make([]string, 0, len(excludes))
+	for _, ex := range excludes {
+		neg, p := "", strings.TrimSpace(ex)
+		if strings.HasPrefix(p, "!") {
+			neg, p = "!", p[1:]
 		}
-	}
-	return out
-}
-
-func matchAny(patterns []string, name string) bool {
-	for _, p := range patterns {
-		if ok, _ := filepath.Match(p, name); ok {
-			return true
+		vol, abs := splitWindowsPath(p)
+		if vol == "" {
+			out = append(out, ex)
+			continue
 		}
-	}
-	return false
-}
-
-// normPatterns trims and normalizes exclude patterns to use forward slashes.
-func normPatterns(ps []string) []string {
-	out := make([]string, 0, len(ps))
-	for _, p := range ps {
-		p = strings.TrimSpace(p)
-		if p != "" {
-			out = append(out, filepath.ToSlash(p))
+		dir := ""
+		if strings.HasSuffix(p, "/") || strings.HasSuffix(p, `\`) {
+			dir = "/"
+		}
+		if !strings.EqualFold(vol, rootVol) {
+			continue
+		}
+		var rel string
+		switch {
+		case strings.EqualFold(abs, root):
+			rel = "**"
+		case root == "/":
+			rel = abs[1:]
+		case len(abs) > len(root) && abs[len(root)] == '/' && strings.EqualFold(abs[:len(root)], root):
+			rel = abs[len(root)+1:]
+		default:
+			continue
 		}
+		out = append(out, neg+"/"+rel+dir)
 	}
 	return out
 }
 
-// matchPathAny checks rel path (with forward slashes) against patterns using POSIX-style matching.
-func matchPathAny(patterns []string, relSlash string) bool {
-	for _, p := range patterns {
-		if ok, _ := path.Match(p, relSlash); ok {
-			return true
+// splitWindowsPath splits an absolute Windows path into its volume, a drive
+// ("C:") or UNC share (`\\server\share`), and the cleaned slash-separated
+// rest ("/repo/vendor"). vol is "" for other paths.
+func splitWindowsPath(p string) (vol, rest string) {
+	switch {
+	case len(p) >= 3 && p[1] == ':' && (p[2] == '\\' || p[2] == '/') &&
+		('a' <= p[0] && p[0] <= 'z' || 'A' <= p[0] && p[0] <= 'Z'):
+		vol, rest = p[:2], p[2:]
+	case strings.HasPrefix(p, `\\`):
+		parts := strings.SplitN(strings.ReplaceAll(p[2:], `\`, "/"), "/", 3)
+		if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+			return "", ""
+		}
+		vol = `\\` + parts[0] + `\` + parts[1]
+		if len(parts) == 3 {
+			rest = parts[2]
 		}
+	default:
+		return "", ""
 	}
-	return false
+	return vol, path.Clean("/" + strings.ReplaceAll(rest, `\`, "/"))
 }
 
 func hasGlob(p string) bool {
@@ -216,7 +1819,7 @@ func hasGlob(p string) bool {
 	return strings.ContainsAny(p, "*?[")
 }
 
-func expandSourceStarts(rootAbs string, dirs []string) ([]string, error) {
+func expandSourceStarts(fsys sourceFS, rootAbs string, dirs []string) ([]string, error) {
 	var out []string
 	for _, d := range dirs {
 		if strings.TrimSpace(d) == "*" {
@@ -229,14 +1832,11 @@ func expandSourceStarts(rootAbs string, dirs []string) ([]string, error) {
 			pat = filepath.Join(rootAbs, d)
 		}
 		if hasGlob(pat) {
-			matches, err := filepath.Glob(pat)
+			matches, err := globPaths(fsys, pat)
 			if err != nil {
 				return nil, fmt.Errorf("glob %s: %w", pat, err)
 			}
-			if len(matches) == 0 {
-				// no matches for this pattern; skip silently
-				continue
-			}
+			// no matches for this pattern: skip silently
 			for _, m := range matches {
 				out = append(out, filepath.Clean(m))
 			}
@@ -247,10 +1847,56 @@ func expandSourceStarts(rootAbs string, dirs []string) ([]string, error) {
 	return out, nil
 }
 
+// globPaths expands an absolute glob. Patterns without "**" go through
+// fsys.Glob; otherwise the directory before the first meta character is
+// walked and every entry is matched with the pattern engine.
+func globPaths(fsys sourceFS, pat string) ([]string, error) {
+	if !strings.Contains(pat, "**") {
+		return fsys.Glob(pat)
+	}
+	slashed := filepath.ToSlash(pat)
+	base := slashed[:strings.LastIndexByte(slashed[:strings.IndexAny(slashed, "*?[")], '/')+1]
+	set, err := match.Compile([]string{"/" + slashed[len(base):]})
+	if err != nil {
+		return nil, err
+	}
+	baseDir := filepath.FromSlash(base)
+	if _, err := fsys.Stat(baseDir); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	var out []string
+	err = fsys.WalkDir(baseDir, func(p string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(baseDir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if de.IsDir() {
+			if set.MatchDir(rel) {
+				out = append(out, p)
+				// the walk of this start covers everything below
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if set.Match(rel) {
+			out = append(out, p)
+		}
+		return nil
+	})
+	return out, err
+}
+
 type tnode struct {
 	name     string
 	children map[string]*tnode
 	isFile   bool
+	detail   treeDetail // file details, or totals below a directory
+
+	unreadable string // why the directory could not be read, shown instead of its entries
 }
 
 func newNode(name string) *tnode {
@@ -260,7 +1906,22 @@ func newNode(name string) *tnode {
 	}
 }
 
-func insertPath(root *tnode, rel string) {
+// insertDir adds the directory rel, which could not be read, to the tree
+// with the reason.
+func insertDir(root *tnode, rel, cause string) {
+	cur := root
+	for _, part := range splitPath(rel) {
+		n, ok := cur.children[part]
+		if !ok {
+			n = newNode(part)
+			cur.children[part] = n
+		}
+		cur = n
+	}
+	cur.unreadable = cause
+}
+
+func insertPath(root *tnode, rel string, detail treeDetail) {
 	parts := splitPath(rel)
 	cur := root
 	for i, part := range parts {
@@ -271,6 +1932,7 @@ func insertPath(root *tnode, rel string) {
 		}
 		if i == len(parts)-1 {
 			n.isFile = true
+			n.detail = detail
 		}
 		cur = n
 	}
@@ -282,24 +1944,158 @@ func splitPath(p string) []string {
 	return strings.Split(p, string(filepath.Separator))
 }
 
-func renderTree(paths []string) string {
-	root := newNode("")
+// labelRoots groups paths by the root they come from when some of them lie
+// outside the project root (e.g. "../shared-lib/x.go" from a sourcePath like
+// "../shared-lib"). Each root then becomes a labeled top-level node such as
+// "service-a/" and "shared-lib/" instead of a chain of ".." entries.
+// Paths are returned unchanged when they all live under the project root.
+func labelRoots(projectRoot string, paths []string) []string {
+	outside := false
+	for _, p := range paths {
+		if _, _, ok := splitOutsideRoot(p); ok {
+			outside = true
+			break
+		}
+	}
+	if !outside {
+		return paths
+	}
+
+	rootAbs, err := filepath.Abs(projectRoot)
+	if err != nil {
+		rootAbs = projectRoot
+	}
+	projectLabel := filepath.Base(rootAbs)
+	labels := map[string]string{projectLabel: ""}
+	out := make([]string, 0, len(paths))
 	for _, p := range paths {
-		insertPath(root, p)
+		label, rest, ok := splitOutsideRoot(p)
+		if !ok {
+			out = append(out, projectLabel+"/"+p)
+			continue
+		}
+		// keep roots with the same base name apart
+		key := strings.TrimSuffix(p, rest)
+		if prev, seen := labels[label]; seen && prev != key {
+			label = strings.TrimSuffix(key, "/")
+		}
+		labels[label] = key
+		out = append(out, label+"/"+rest)
+	}
+	return out
+}
+
+// splitOutsideRoot splits a slash path that escapes the project root, such as
+// "../../libs/shared/a.go", into its root label ("libs") and the rest ("shared/a.go").
+func splitOutsideRoot(p string) (label, rest string, ok bool) {
+	if !strings.HasPrefix(p, "../") {
+		return "", "", false
+	}
+	for strings.HasPrefix(p, "../") {
+		p = p[3:]
+	}
+	label, rest, found := strings.Cut(p, "/")
+	if !found {
+		return "", "", false
+	}
+	return label, rest, true
+}
+
+// treeView selects what renderTree shows: detail fields (see treeDetails),
+// how many levels (0 for all) and whether files are listed at all.
+type treeView struct {
+	fields   []string
+	maxDepth int
+	dirsOnly bool
+	format   string // "" for ASCII art, treeMermaid or treeMindmap
+	// unreadable directories, as tree paths, shown with why they could not
+	// be read
+	unreadable map[string]string
+	sort       string // the document's sort: "natural", "size" or "modtime"; lexical otherwise
+
+	// maxTokens is the tree's token budget; directories in collapsed, chosen
+	// by pruneTree to meet it, show their file count instead of entries
+	maxTokens int
+	collapsed map[*tnode]bool
+
+	// entries modified after recentSince are marked with recentMarker
+	recentSince  time.Time
+	recentWithin string
+}
+
+// recentMarker follows recently modified entries in a tree.
+const recentMarker = " *"
+
+// recent returns recentMarker when n, or a file below it, was modified
+// within the view's window.
+func (v treeView) recent(n *tnode) string {
+	if v.recentSince.IsZero() || !n.detail.modTime.After(v.recentSince) {
+		return ""
+	}
+	return recentMarker
+}
+
+// hides reports whether entries below n, a directory at depth (1 for
+// top-level entries), are left out of the tree.
+func (v treeView) hides(n *tnode, depth int) bool {
+	if v.collapsed[n] || v.maxDepth > 0 && depth >= v.maxDepth {
+		return true
+	}
+	if v.dirsOnly {
+		for _, c := range n.children {
+			if !isDir(c) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// renderTree draws paths as a tree. With view.fields, details[i] annotates
+// paths[i] and directories show their totals; directories whose entries are
+// hidden by maxDepth or dirsOnly, or collapsed to fit maxTokens, show their
+// file count.
+func renderTree(paths []string, details []treeDetail, view treeView) string {
+	root := newNode("")
+	for dir, cause := range view.unreadable {
+		insertDir(root, unorm.NFC(dir), cause)
+	}
+	for i, p := range paths {
+		var d treeDetail
+		if i < len(details) {
+			d = details[i]
+		}
+		insertPath(root, unorm.NFC(p), d)
 	}
+	if len(view.fields) > 0 || view.maxDepth > 0 || view.dirsOnly || view.recentWithin != "" || view.maxTokens > 0 || view.sort == "size" || view.sort == "modtime" {
+		sumDetails(root)
+	}
+	if view.maxTokens > 0 {
+		return pruneTree(root, view)
+	}
+	return drawTree(root, view)
+}
 
+// drawTree renders the tree below root.
+func drawTree(root *tnode, view treeView) string {
+	if view.format != "" {
+		return drawMermaidTree(root, view)
+	}
 	var b strings.Builder
 	// top-level entries
-	names := sortedKeys(root.children, true)
+	names := visibleKeys(root, view)
 	for i, name := range names {
 		child := root.children[name]
 		last := i == len(names)-1
-		renderNode(&b, child, "", last)
+		renderNode(&b, child, "", last, 1, view)
+	}
+	if view.recentWithin != "" {
+		fmt.Fprintf(&b, "\n* modified within %s\n", view.recentWithin)
 	}
 	return b.String()
 }
 
-func renderNode(b *strings.Builder, n *tnode, prefix string, isLast bool) {
+func renderNode(b *strings.Builder, n *tnode, prefix string, isLast bool, depth int, view treeView) {
 	branch := "├── "
 	nextPrefix := prefix + "│   "
 	if isLast {
@@ -307,22 +2103,73 @@ func renderNode(b *strings.Builder, n *tnode, prefix string, isLast bool) {
 		nextPrefix = prefix + "    "
 	}
 	if isDir(n) {
-		fmt.Fprintf(b, "%s%s%s/\n", prefix, branch, n.name)
+		hidden := view.hides(n, depth)
+		detail := n.detail.format(view.fields, true)
+		if detail == "" && hidden {
+			detail = "  (" + fileCount(n.detail.files) + ")"
+		}
+		if n.unreadable != "" {
+			detail += "  (" + n.unreadable + ")"
+		}
+		fmt.Fprintf(b, "%s%s%s/%s%s\n", prefix, branch, n.name, view.recent(n), detail)
+		if view.collapsed[n] || view.maxDepth > 0 && depth >= view.maxDepth {
+			return
+		}
 		// sort children: directories first, then files, each alphabetical
-		names := sortedKeys(n.children, true)
+		names := visibleKeys(n, view)
 		for i, name := range names {
 			child := n.children[name]
 			last := i == len(names)-1
-			renderNode(b, child, nextPrefix, last)
+			renderNode(b, child, nextPrefix, last, depth+1, view)
 		}
 	} else {
-		fmt.Fprintf(b, "%s%s%s\n", prefix, branch, n.name)
+		fmt.Fprintf(b, "%s%s%s%s%s\n", prefix, branch, n.name, view.recent(n), n.detail.format(view.fields, false))
+	}
+}
+
+// visibleKeys returns the sorted names of n's children shown in view:
+// directories first, each group in the view's sort order.
+func visibleKeys(n *tnode, view treeView) []string {
+	names := sortedKeys(n.children, true)
+	if view.sort != "" && view.sort != "lexical" {
+		byView := func(a, b string) int { return compareNodes(n.children[a], n.children[b], view.sort) }
+		dirs := 0
+		for dirs < len(names) && isDir(n.children[names[dirs]]) {
+			dirs++
+		}
+		slices.SortStableFunc(names[:dirs], byView)
+		slices.SortStableFunc(names[dirs:], byView)
 	}
+	if !view.dirsOnly {
+		return names
+	}
+	dirs := names[:0]
+	for _, name := range names {
+		if isDir(n.children[name]) {
+			dirs = append(dirs, name)
+		}
+	}
+	return dirs
 }
 
 func isDir(n *tnode) bool {
 	// a node is a directory if it has children; leaf nodes are files
-	return len(n.children) > 0 && !n.isFile
+	return (len(n.children) > 0 || n.unreadable != "") && !n.isFile
+}
+
+// compareNodes orders tree entries by sort: "natural" by name, "size"
+// smallest first and "modtime" newest first, directories by the totals
+// below them. Ties keep the lexical order.
+func compareNodes(a, b *tnode, sort string) int {
+	switch sort {
+	case "natural":
+		return compareNatural(a.name, b.name)
+	case "size":
+		return cmp.Compare(a.detail.size, b.detail.size)
+	case "modtime":
+		return b.detail.modTime.Compare(a.detail.modTime)
+	}
+	return 0
 }
 
 func sortedKeys(m map[string]*tnode, dirsFirst bool) []string {
@@ -347,39 +2194,10 @@ func sortedKeys(m map[string]*tnode, dirsFirst bool) []string {
 	return append(dirs, files...)
 }
 
-func detectLang(path string) string {
-	switch strings.ToLower(filepath.Ext(path)) {
-	case ".go":
-		return "go"
-	case ".php":
-		return "php"
-	case ".twig":
-		return "twig"
-	case ".js":
-		return "javascript"
-	case ".ts":
-		return "typescript"
-	case ".json":
-		return "json"
-	case ".yaml", ".yml":
-		return "yaml"
-	case ".md":
-		return "md"
-	default:
-		return ""
-	}
-}
-
-func ensureDir(dir string) error {
-	if dir == "" || dir == "." {
-		return nil
+// lfLineEndings converts CRLF and lone CR line endings to LF.
+func lfLineEndings(s string) string {
+	if !strings.Contains(s, "\r") {
+		return s
 	}
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		info, statErr := os.Stat(dir)
-		if statErr == nil && !info.IsDir() {
-			return errors.New("path exists and is not a directory: " + dir)
-		}
-		return err
-	}
-	return nil
+	return strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\r", "\n")
 }
@@ -0,0 +1,44 @@
+package generator
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAnchorAbsolute(t *testing.T) {
+	tests := []struct {
+		name     string
+		root     string
+		excludes []string
+		want     []string
+	}{
+		{"drive letter", `C:\repo`, []string{`C:\repo\vendor`}, []string{"/vendor"}},
+		{"drive letter dir", `C:\repo`, []string{`C:\repo\vendor\`}, []string{"/vendor/"}},
+		{"drive letter forward slashes", `C:\repo`, []string{`C:/repo/vendor/lib`}, []string{"/vendor/lib"}},
+		{"drive letter case", `C:\Repo`, []string{`c:\repo\Vendor`}, []string{"/Vendor"}},
+		{"drive letter negated", `C:\repo`, []string{`!C:\repo\vendor\keep`}, []string{"!/vendor/keep"}},
+		{"drive letter root itself", `C:\repo`, []string{`C:\repo`}, []string{"/**"}},
+		{"drive letter cleaned", `C:\repo`, []string{`C:\repo\a\..\b`}, []string{"/b"}},
+		{"drive letter volume root", `C:\`, []string{`C:\vendor`}, []string{"/vendor"}},
+		{"other drive", `C:\repo`, []string{`D:\repo\vendor`}, nil},
+		{"outside root", `C:\repo`, []string{`C:\other\vendor`}, nil},
+		{"sibling prefix", `C:\repo`, []string{`C:\repository\x`}, nil},
+		{"escaping root", `C:\repo`, []string{`C:\repo\..\x`}, nil},
+		{"unc", `\\server\share\repo`, []string{`\\server\share\repo\x`}, []string{"/x"}},
+		{"unc dir", `\\server\share\repo`, []string{`\\server\share\repo\x\`}, []string{"/x/"}},
+		{"unc other share", `\\server\share\repo`, []string{`\\server\other\repo\x`}, nil},
+		{"unc outside root", `\\server\share\repo`, []string{`\\server\share\x`}, nil},
+		{"unc against drive root", `C:\repo`, []string{`\\server\share\repo\x`}, nil},
+		{"drive against unix root", "/home/u/repo", []string{`C:\repo\vendor`}, nil},
+		{"relative kept", `C:\repo`, []string{"vendor/", `build\out`, "!keep"}, []string{"vendor/", `build\out`, "!keep"}},
+		{"unix absolute kept", "/home/u/repo", []string{"/vendor"}, []string{"/vendor"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := anchorAbsolute(tt.root, tt.excludes)
+			if !slices.Equal(got, tt.want) && len(got)+len(tt.want) > 0 {
+				t.Errorf("anchorAbsolute(%q, %q) = %q, want %q", tt.root, tt.excludes, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package generator
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// defaultLogCommits is how many commits a git-log source shows by default.
+const defaultLogCommits = 20
+
+// gitLogFormats are the --format strings of the logFormat values.
+var gitLogFormats = map[string]string{
+	"oneline": "%h %ad %an: %s",
+	"full":    "commit %h%nAuthor: %an <%ae>%nDate:   %ad%n%n%w(0,4,4)%B",
+}
+
+// runGitLog returns the title and output of a git-log source: the newest
+// commits of its revision range, limited to its sourcePaths when set.
+func runGitLog(ctx context.Context, projectRoot string, src cfg.Source) (title string, output []byte, err error) {
+	format := strings.ToLower(cmp.Or(src.LogFormat, "oneline"))
+	layout, ok := gitLogFormats[format]
+	if !ok {
+		return "", nil, fmt.Errorf("git-log source: unknown logFormat %q", src.LogFormat)
+	}
+	if strings.HasPrefix(src.Revisions, "-") {
+		return "", nil, fmt.Errorf("git-log source: invalid revisions %q", src.Revisions)
+	}
+	n := src.Commits
+	if n <= 0 {
+		n = defaultLogCommits
+	}
+	rev := cmp.Or(src.Revisions, "HEAD")
+	args := []string{"log", "-n", strconv.Itoa(n), "--date=short", "--format=" + layout}
+	if format == "full" {
+		args = append(args, "--name-status")
+	}
+	args = append(args, rev, "--")
+	args = append(args, src.SourcePaths...)
+
+	title = fmt.Sprintf("Recent commits (%s, at most %d)", rev, n)
+	if len(src.SourcePaths) > 0 {
+		title += " touching " + strings.Join(src.SourcePaths, ", ")
+	}
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = projectRoot
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err := ctx.Err(); err != nil {
+		return title, nil, err
+	}
+	if err != nil {
+		if toolMissing(err) {
+			return title, nil, &unavailableError{feature: "git-log source", detail: "git: " + err.Error()}
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			err = fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return title, nil, fmt.Errorf("git-log source: git log: %w", err)
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return title, []byte("(no commits)\n"), nil
+	}
+	var b bytes.Buffer
+	writeWithNewline(&b, bytes.TrimRight(out, "\n"))
+	return title, b.Bytes(), nil
+}
@@ -0,0 +1,140 @@
+package generator
+
+import (
+	"bytes"
+	"html"
+	"path/filepath"
+	"strings"
+)
+
+// keywordSets lists the keywords highlighted in HTML output, by fence
+// language.
+var keywordSets = map[string]map[string]bool{
+	"go": words("break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var " +
+		"nil true false iota"),
+	"javascript": words(jsKeywords),
+	"jsx":        words(jsKeywords),
+	"typescript": words(jsKeywords + tsKeywords),
+	"tsx":        words(jsKeywords + tsKeywords),
+	"python": words("and as assert async await break class continue def del elif else except finally for from global if import in is lambda nonlocal not or pass raise return try while with yield " +
+		"None True False self"),
+	"php": words("abstract and array as break case catch class clone const continue declare default do echo else elseif empty enum extends final finally fn for foreach function global if implements " +
+		"include include_once instanceof interface isset list match namespace new null or print private protected public readonly require require_once return static switch throw trait try unset use var while yield true false"),
+	"bash": words(shKeywords),
+	"zsh":  words(shKeywords),
+	"c": words("auto break case char const continue default do double else enum extern float for goto if inline int long register return short signed sizeof static struct switch typedef union " +
+		"unsigned void volatile while NULL true false"),
+	"cpp": words("auto bool break case catch char class const constexpr continue default delete do double else enum explicit extern false float for friend if inline int long namespace new noexcept " +
+		"nullptr operator override private protected public return short signed sizeof static struct switch template this throw true try typedef typename union unsigned using virtual void while"),
+	"java": words("abstract boolean break byte case catch char class const continue default do double else enum extends final finally float for if implements import instanceof int interface long new " +
+		"null package private protected public record return short static super switch synchronized this throw throws true false try var void volatile while"),
+	"rust": words("as async await break const continue crate dyn else enum extern false fn for if impl in let loop match mod move mut pub ref return self Self static struct super trait true type " +
+		"unsafe use where while"),
+	"ruby": words("alias and begin break case class def do else elsif end ensure false for if in module next nil not or redo rescue retry return self super then true undef unless until when while yield"),
+	"sql":  words(sqlKeywords + " " + strings.ToLower(sqlKeywords)),
+}
+
+const (
+	jsKeywords  = "async await break case catch class const continue debugger default delete do else export extends false finally for function if import in instanceof let new null of return static super switch this throw true try typeof undefined var void while with yield"
+	tsKeywords  = " interface type enum implements declare namespace readonly keyof as any unknown never"
+	shKeywords  = "case do done elif else esac export fi for function if in local readonly return select then until while"
+	sqlKeywords = "ADD ALTER AND AS ASC BETWEEN BY CASE CREATE DELETE DESC DISTINCT DROP ELSE END EXISTS FROM GROUP HAVING IN INDEX INNER INSERT INTO IS JOIN KEY LEFT LIKE LIMIT NOT NULL ON OR ORDER " +
+		"OUTER PRIMARY REFERENCES RIGHT SELECT SET TABLE THEN UNION UNIQUE UPDATE VALUES VIEW WHEN WHERE WITH"
+)
+
+func words(list string) map[string]bool {
+	m := make(map[string]bool)
+	for _, w := range strings.Fields(list) {
+		m[w] = true
+	}
+	return m
+}
+
+// highlightHTML returns code as escaped HTML with comments, strings,
+// numbers and keywords wrapped in <span class="c|s|n|k">. Comments and
+// strings are found with the comment syntax of rel's extension, keywords by
+// lang; code in neither is only escaped.
+func highlightHTML(rel, lang, code string) string {
+	syn, hasSyntax := builtinSyntaxes[strings.ToLower(filepath.Ext(rel))]
+	keywords := keywordSets[lang]
+	if !hasSyntax && keywords == nil {
+		return html.EscapeString(code)
+	}
+	data := []byte(code)
+	var b strings.Builder
+	span := func(class string, text []byte) {
+		b.WriteString(`<span class="` + class + `">`)
+		b.WriteString(html.EscapeString(string(text)))
+		b.WriteString("</span>")
+	}
+	for i := 0; i < len(data); {
+		rest := data[i:]
+		c := data[i]
+		switch {
+		case hasSyntax && commentStart(data, i, syn):
+			end := i + bytes.IndexByte(rest, '\n')
+			if end < i {
+				end = len(data)
+			}
+			span("c", data[i:end])
+			i = end
+			continue
+		case hasSyntax && blockClose(rest, syn) != "":
+			close := blockClose(rest, syn)
+			end := len(data)
+			if j := bytes.Index(rest[2:], []byte(close)); j >= 0 {
+				end = i + 2 + j + len(close)
+			}
+			span("c", data[i:end])
+			i = end
+			continue
+		case hasSyntax && syn.triple && (c == '"' || c == '\'') && bytes.HasPrefix(rest, []byte{c, c, c}):
+			end := len(data)
+			if j := bytes.Index(rest[3:], rest[:3]); j >= 0 {
+				end = i + 3 + j + 3
+			}
+			span("s", data[i:end])
+			i = end
+			continue
+		case hasSyntax && strings.IndexByte(syn.raw, c) >= 0:
+			end := len(data)
+			if j := bytes.IndexByte(rest[1:], c); j >= 0 {
+				end = i + 1 + j + 1
+			}
+			span("s", data[i:end])
+			i = end
+			continue
+		case hasSyntax && strings.IndexByte(syn.quotes, c) >= 0:
+			end := quotedEnd(data, i, syn.multiline || c == '`')
+			span("s", data[i:end])
+			i = end
+			continue
+		case isWordByte(c):
+			end := i + 1
+			for end < len(data) && (isWordByte(data[end]) || data[end] == '.' && c >= '0' && c <= '9') {
+				end++
+			}
+			// a word glued to the previous one (x1, $var) is not a new token
+			glued := i > 0 && (isWordByte(data[i-1]) || data[i-1] == '$')
+			switch word := string(data[i:end]); {
+			case glued:
+				b.WriteString(html.EscapeString(word))
+			case c >= '0' && c <= '9':
+				span("n", data[i:end])
+			case keywords[word]:
+				span("k", data[i:end])
+			default:
+				b.WriteString(html.EscapeString(word))
+			}
+			i = end
+			continue
+		}
+		b.WriteString(html.EscapeString(string(data[i : i+1])))
+		i++
+	}
+	return b.String()
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
@@ -0,0 +1,75 @@
+package generator
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// runHooks runs the commands of one of doc's hook lists ("preGenerate" or
+// "postGenerate") in projectRoot, stopping at the first that fails. Their
+// output goes to opts.Log, keeping stdout free for documents.
+func runHooks(projectRoot, which string, cmds []string, doc cfg.Document, opts Options) error {
+	if opts.NoHooks {
+		return nil
+	}
+	var paths []string
+	for _, t := range doc.Targets() {
+		paths = append(paths, t.Path)
+	}
+	env := append(os.Environ(),
+		"GPCM_DOCUMENT="+cmp.Or(doc.Name, paths[0]),
+		"GPCM_OUTPUT="+paths[0],
+		"GPCM_OUTPUTS="+strings.Join(paths, "\n"),
+		"GPCM_RUN_ID="+opts.RunID,
+	)
+	log := opts.Log
+	if log == nil {
+		log = os.Stderr
+	}
+	for _, c := range cmds {
+		if err := opts.ctx().Err(); err != nil {
+			return err
+		}
+		var cmd *exec.Cmd
+		if runtime.GOOS == "windows" {
+			cmd = exec.CommandContext(opts.ctx(), "cmd", "/C", c)
+		} else {
+			cmd = exec.CommandContext(opts.ctx(), "sh", "-c", c)
+		}
+		cmd.Dir = projectRoot
+		cmd.Env = env
+		cmd.Stdout, cmd.Stderr = log, log
+		if err := cmd.Run(); err != nil {
+			if err := opts.ctx().Err(); err != nil {
+				return err
+			}
+			return fmt.Errorf("%s hook %q: %w", which, c, err)
+		}
+	}
+	return nil
+}
+
+// RunPostHooks runs the postGenerate hooks of the documents of c that have
+// outputs among outs, once they are written; documents that failed have
+// none and are passed over.
+func RunPostHooks(c cfg.Config, projectRoot string, outs []Output, opts Options) error {
+	rendered := make(map[string]bool, len(outs))
+	for _, o := range outs {
+		rendered[o.Document] = true
+	}
+	for _, doc := range c.Documents {
+		if doc.Hooks == nil || !rendered[cmp.Or(doc.Name, doc.Targets()[0].Path)] {
+			continue
+		}
+		if err := runHooks(projectRoot, "postGenerate", doc.Hooks.PostGenerate, doc, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package generator
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	htmlDropRe   = regexp.MustCompile(`(?is)<!--.*?-->|<(script|style|head|noscript|svg)\b.*?</(script|style|head|noscript|svg)\s*>`)
+	htmlTagRe    = regexp.MustCompile(`(?s)<(/?)([a-zA-Z][a-zA-Z0-9]*)([^>]*)>`)
+	htmlAttrRe   = regexp.MustCompile(`(?i)\b(href|src|alt)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+	spaceRunRe   = regexp.MustCompile(`[ \t\r\n]+`)
+	blankRunRe   = regexp.MustCompile(`\n{3,}`)
+	trailingWSRe = regexp.MustCompile(`[ \t]+\n`)
+)
+
+// htmlToMarkdown converts an HTML page to readable markdown: headings,
+// paragraphs, lists, links, emphasis, inline code and preformatted blocks.
+// It is deliberately small; unknown tags are dropped and their text kept.
+func htmlToMarkdown(src []byte) []byte {
+	doc := htmlDropRe.ReplaceAllString(string(src), "")
+
+	var b strings.Builder
+	var hrefs []string // open <a> targets
+	pre := 0
+	last := 0
+	for _, m := range htmlTagRe.FindAllStringSubmatchIndex(doc, -1) {
+		text := doc[last:m[0]]
+		last = m[1]
+		if pre > 0 {
+			b.WriteString(html.UnescapeString(text))
+		} else {
+			b.WriteString(spaceRunRe.ReplaceAllString(html.UnescapeString(text), " "))
+		}
+
+		closing := m[3] > m[2]
+		tag := strings.ToLower(doc[m[4]:m[5]])
+		attrs := htmlAttrs(doc[m[6]:m[7]])
+		if pre > 0 && tag != "pre" {
+			continue
+		}
+		switch tag {
+		case "h1", "h2", "h3", "h4", "h5", "h6":
+			if closing {
+				b.WriteString("\n\n")
+			} else {
+				b.WriteString("\n\n" + strings.Repeat("#", int(tag[1]-'0')) + " ")
+			}
+		case "p", "div", "section", "article", "header", "footer", "main", "nav", "table", "blockquote", "ul", "ol", "dl":
+			b.WriteString("\n\n")
+		case "tr", "dt", "dd":
+			b.WriteString("\n")
+		case "td", "th":
+			b.WriteString(" ")
+		case "br":
+			b.WriteString("\n")
+		case "hr":
+			b.WriteString("\n\n---\n\n")
+		case "li":
+			if !closing {
+				b.WriteString("\n- ")
+			}
+		case "strong", "b":
+			b.WriteString("**")
+		case "em", "i":
+			b.WriteString("_")
+		case "code":
+			b.WriteString("`")
+		case "pre":
+			if closing {
+				pre--
+				if pre == 0 {
+					b.WriteString("\n```\n\n")
+				}
+			} else {
+				if pre == 0 {
+					b.WriteString("\n\n```\n")
+				}
+				pre++
+			}
+		case "a":
+			if closing {
+				if n := len(hrefs); n > 0 {
+					if hrefs[n-1] != "" {
+						b.WriteString("](" + hrefs[n-1] + ")")
+					}
+					hrefs = hrefs[:n-1]
+				}
+			} else {
+				hrefs = append(hrefs, attrs["href"])
+				if attrs["href"] != "" {
+					b.WriteString("[")
+				}
+			}
+		case "img":
+			if attrs["src"] != "" {
+				b.WriteString("![" + attrs["alt"] + "](" + attrs["src"] + ")")
+			}
+		}
+	}
+	b.WriteString(spaceRunRe.ReplaceAllString(html.UnescapeString(doc[last:]), " "))
+
+	out := trailingWSRe.ReplaceAllString(b.String(), "\n")
+	out = blankRunRe.ReplaceAllString(out, "\n\n")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	inFence := false
+	for i, l := range lines {
+		if strings.HasPrefix(l, "```") {
+			inFence = !inFence
+			continue
+		}
+		if !inFence {
+			lines[i] = strings.TrimLeft(l, " ")
+		}
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// htmlAttrs extracts the attributes htmlToMarkdown needs from a tag's attribute text.
+func htmlAttrs(s string) map[string]string {
+	out := make(map[string]string)
+	for _, m := range htmlAttrRe.FindAllStringSubmatch(s, -1) {
+		out[strings.ToLower(m[1])] = html.UnescapeString(m[2] + m[3] + m[4])
+	}
+	return out
+}
@@ -0,0 +1,294 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// importCounts tallies the imports of one file by origin.
+type importCounts struct {
+	stdlib, internal, thirdParty int
+}
+
+func (c importCounts) total() int { return c.stdlib + c.internal + c.thirdParty }
+
+// String renders "imports: 14 stdlib, 6 internal, 3 third-party", leaving
+// out empty groups.
+func (c importCounts) String() string {
+	var parts []string
+	for _, g := range []struct {
+		n    int
+		name string
+	}{{c.stdlib, "stdlib"}, {c.internal, "internal"}, {c.thirdParty, "third-party"}} {
+		if g.n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", g.n, g.name))
+		}
+	}
+	return "imports: " + strings.Join(parts, ", ")
+}
+
+// collapseImports replaces the import block of a Go, JS/TS, Python or PHP
+// file with a single summary comment. modulePath (from go.mod) decides which
+// Go imports are internal. Other files and files without imports are
+// returned unchanged.
+func collapseImports(rel string, data []byte, modulePath string) []byte {
+	switch strings.ToLower(filepath.Ext(rel)) {
+	case ".go":
+		return collapseGoImports(rel, data, modulePath)
+	case ".js", ".jsx", ".mjs", ".cjs", ".ts", ".tsx", ".mts", ".cts":
+		return collapseLineImports(data, "//", jsImport)
+	case ".py", ".pyi":
+		return collapseLineImports(data, "#", pyImport)
+	case ".php":
+		return collapseLineImports(data, "//", phpImporter(data))
+	}
+	return data
+}
+
+func collapseGoImports(rel string, data []byte, modulePath string) []byte {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, rel, data, parser.ImportsOnly)
+	if err != nil || len(f.Imports) == 0 {
+		return data
+	}
+	var c importCounts
+	for _, spec := range f.Imports {
+		p, _ := strconv.Unquote(spec.Path.Value)
+		first, _, _ := strings.Cut(p, "/")
+		switch {
+		case modulePath != "" && (p == modulePath || strings.HasPrefix(p, modulePath+"/")):
+			c.internal++
+		case !strings.Contains(first, "."):
+			c.stdlib++
+		default:
+			c.thirdParty++
+		}
+	}
+	var from, to int = -1, -1
+	for _, d := range f.Decls {
+		start, end := fset.Position(d.Pos()).Offset, fset.Position(d.End()).Offset
+		if from < 0 {
+			from = start
+		}
+		to = end
+	}
+	from = bytes.LastIndexByte(data[:from], '\n') + 1
+	to = lineEnd(data, to)
+	return spliceSummary(data, from, to, "// "+c.String())
+}
+
+// importLine classifies one import statement, which may span several lines.
+// It reports ok=false when the statement is not an import; more asks for
+// the next line to complete the statement.
+type importLine func(stmt string) (c importCounts, ok, more bool)
+
+// collapseLineImports finds the first run of top-level import statements,
+// separated only by blank and comment lines, and replaces it with a summary.
+func collapseLineImports(data []byte, comment string, parse importLine) []byte {
+	var c importCounts
+	from, to := -1, -1
+	var stmt strings.Builder
+	stmtStart := 0
+	for off := 0; off < len(data); {
+		end := lineEnd(data, off)
+		line := string(data[off:end])
+		trimmed := strings.TrimSpace(line)
+
+		if stmt.Len() == 0 {
+			if from >= 0 && (trimmed == "" || strings.HasPrefix(trimmed, comment)) {
+				off = end
+				continue
+			}
+			// imports start at the beginning of a line
+			if trimmed == "" || line[0] == ' ' || line[0] == '\t' {
+				if from >= 0 {
+					break
+				}
+				off = end
+				continue
+			}
+			stmtStart = off
+		}
+		stmt.WriteString(line)
+		got, ok, more := parse(stmt.String())
+		switch {
+		case more && end < len(data):
+			off = end
+			continue
+		case ok:
+			if from < 0 {
+				from = stmtStart
+			}
+			to = end
+			c.stdlib += got.stdlib
+			c.internal += got.internal
+			c.thirdParty += got.thirdParty
+			stmt.Reset()
+			off = end
+			continue
+		}
+		if from >= 0 {
+			break
+		}
+		stmt.Reset()
+		off = end
+	}
+	if from < 0 || c.total() == 0 {
+		return data
+	}
+	return spliceSummary(data, from, to, comment+" "+c.String())
+}
+
+// spliceSummary replaces data[from:to] (whole lines) with one summary line.
+func spliceSummary(data []byte, from, to int, summary string) []byte {
+	out := make([]byte, 0, len(data)-(to-from)+len(summary)+1)
+	out = append(out, data[:from]...)
+	out = append(out, summary...)
+	out = append(out, '\n')
+	return append(out, data[to:]...)
+}
+
+var (
+	jsImportRe  = regexp.MustCompile(`^\s*import\b[\s\S]*?['"]([^'"]+)['"]\s*;?\s*(?://.*)?\s*$`)
+	jsRequireRe = regexp.MustCompile(`^\s*(?:const|let|var)\s+[\s\S]+?=\s*require\(\s*['"]([^'"]+)['"]\s*\)\s*;?\s*(?://.*)?\s*$`)
+	jsOpenRe    = regexp.MustCompile(`^\s*(?:import\b|(?:const|let|var)\s+[\s\S]*=\s*require\()`)
+)
+
+// nodeBuiltins are Node.js core modules, importable with or without "node:".
+var nodeBuiltins = setOf("assert", "async_hooks", "buffer", "child_process", "cluster", "console", "crypto",
+	"dgram", "dns", "events", "fs", "fs/promises", "http", "http2", "https", "module", "net", "os", "path",
+	"perf_hooks", "process", "querystring", "readline", "stream", "string_decoder", "timers", "tls", "tty",
+	"url", "util", "v8", "vm", "worker_threads", "zlib")
+
+func jsImport(stmt string) (importCounts, bool, bool) {
+	var c importCounts
+	m := jsImportRe.FindStringSubmatch(stmt)
+	if m == nil {
+		m = jsRequireRe.FindStringSubmatch(stmt)
+	}
+	if m == nil {
+		// "import {" waits for its "from '...'" line
+		more := jsOpenRe.MatchString(stmt) && !strings.ContainsAny(stmt, `'"`) && !strings.HasPrefix(strings.TrimSpace(stmt), "import(")
+		return c, false, more
+	}
+	spec := m[1]
+	switch {
+	case strings.HasPrefix(spec, "node:") || nodeBuiltins[spec]:
+		c.stdlib++
+	case strings.HasPrefix(spec, ".") || strings.HasPrefix(spec, "/") || strings.HasPrefix(spec, "@/") ||
+		strings.HasPrefix(spec, "~/") || strings.HasPrefix(spec, "#"):
+		c.internal++
+	default:
+		c.thirdParty++
+	}
+	return c, true, false
+}
+
+var (
+	pyImportRe = regexp.MustCompile(`^import\s+(.+?)\s*$`)
+	pyFromRe   = regexp.MustCompile(`^from\s+(\S+)\s+import\s+([\s\S]+?)\s*$`)
+)
+
+// pythonStdlib lists the commonly imported standard library modules.
+var pythonStdlib = setOf("__future__", "abc", "argparse", "array", "ast", "asyncio", "base64", "binascii",
+	"bisect", "builtins", "bz2", "calendar", "cmath", "codecs", "collections", "concurrent", "configparser",
+	"contextlib", "contextvars", "copy", "csv", "ctypes", "dataclasses", "datetime", "decimal", "difflib",
+	"dis", "email", "enum", "errno", "fnmatch", "fractions", "ftplib", "functools", "gc", "getpass",
+	"gettext", "glob", "gzip", "hashlib", "heapq", "hmac", "html", "http", "imaplib", "importlib",
+	"inspect", "io", "ipaddress", "itertools", "json", "keyword", "linecache", "locale", "logging",
+	"lzma", "math", "mimetypes", "multiprocessing", "numbers", "operator", "os", "pathlib", "pickle",
+	"pkgutil", "platform", "pprint", "queue", "random", "re", "secrets", "select", "selectors", "shlex",
+	"shutil", "signal", "smtplib", "socket", "sqlite3", "ssl", "stat", "statistics", "string", "struct",
+	"subprocess", "sys", "tarfile", "tempfile", "textwrap", "threading", "time", "timeit", "tkinter",
+	"token", "tokenize", "traceback", "types", "typing", "unicodedata", "unittest", "urllib", "uuid",
+	"venv", "warnings", "weakref", "xml", "zipfile", "zlib", "zoneinfo")
+
+func pyImport(stmt string) (importCounts, bool, bool) {
+	var c importCounts
+	classify := func(mod string, n int) {
+		top, _, _ := strings.Cut(mod, ".")
+		switch {
+		case strings.HasPrefix(mod, "."):
+			c.internal += n
+		case pythonStdlib[top]:
+			c.stdlib += n
+		default:
+			c.thirdParty += n
+		}
+	}
+	stmt = strings.TrimRight(stmt, "\r\n")
+	if m := pyFromRe.FindStringSubmatch(stmt); m != nil {
+		names := m[2]
+		if strings.HasPrefix(names, "(") && !strings.Contains(names, ")") {
+			return c, false, true
+		}
+		classify(m[1], 1)
+		return c, true, false
+	}
+	if strings.HasPrefix(stmt, "from ") && !strings.Contains(stmt, " import") {
+		return c, false, false
+	}
+	if m := pyImportRe.FindStringSubmatch(stmt); m != nil {
+		for _, part := range strings.Split(m[1], ",") {
+			mod, _, _ := strings.Cut(strings.TrimSpace(part), " ")
+			classify(mod, 1)
+		}
+		return c, true, false
+	}
+	return c, false, false
+}
+
+var (
+	phpUseRe       = regexp.MustCompile(`^use\s+(?:function\s+|const\s+)?([^;{]+?)\s*(\{[^}]*\})?\s*;\s*$`)
+	phpNamespaceRe = regexp.MustCompile(`(?m)^namespace\s+([A-Za-z0-9_\\]+)\s*;`)
+)
+
+// phpImporter classifies "use" statements: names from the file's own
+// top-level namespace are internal, unqualified names (DateTime, Exception)
+// are built in, the rest come from dependencies.
+func phpImporter(data []byte) importLine {
+	own := ""
+	if m := phpNamespaceRe.FindSubmatch(data); m != nil {
+		own, _, _ = strings.Cut(string(m[1]), `\`)
+	}
+	return func(stmt string) (importCounts, bool, bool) {
+		var c importCounts
+		trimmed := strings.TrimSpace(stmt)
+		if !strings.HasPrefix(trimmed, "use ") {
+			return c, false, false
+		}
+		m := phpUseRe.FindStringSubmatch(trimmed)
+		if m == nil {
+			return c, false, !strings.Contains(trimmed, ";")
+		}
+		name := strings.TrimPrefix(strings.TrimSpace(m[1]), `\`)
+		n := 1
+		if m[2] != "" {
+			n = len(strings.Split(strings.Trim(m[2], "{} "), ","))
+		}
+		top, _, qualified := strings.Cut(name, `\`)
+		switch {
+		case !qualified && m[2] == "":
+			c.stdlib += n
+		case own != "" && top == own:
+			c.internal += n
+		default:
+			c.thirdParty += n
+		}
+		return c, true, false
+	}
+}
+
+func setOf(names ...string) map[string]bool {
+	m := make(map[string]bool, len(names))
+	for _, n := range names {
+		m[n] = true
+	}
+	return m
+}
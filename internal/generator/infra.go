@@ -0,0 +1,378 @@
+package generator
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// infraPattern is the filePattern of infra sources that set none: every
+// file the collectors might recognize.
+const infraPattern = "*.yml,*.yaml,Dockerfile*,*.Dockerfile,*.dockerfile,Containerfile*"
+
+// infraEntry is one row of the infrastructure overview.
+type infraEntry struct {
+	name    string
+	kind    string   // "compose service", "Dockerfile", "Helm chart" or a Kubernetes kind
+	image   string   // images, build contexts or the chart version
+	exposes []string // ports, ingress hosts
+	uses    []string // services, config maps, secrets and charts it depends on
+	rel     string
+}
+
+// infraFile is a matched file the collectors recognized.
+type infraFile struct {
+	rel     string
+	data    []byte
+	entries []infraEntry
+}
+
+// collectInfra reads files (relative to projectRoot) and keeps those that
+// describe how the project is deployed: Compose files, Dockerfiles, Helm
+// charts (Chart.yaml and everything below it) and Kubernetes manifests,
+// with the services, workloads and charts they declare.
+func collectInfra(fsys sourceFS, projectRoot string, files []string, jobs int) ([]infraFile, error) {
+	charts := make(map[string]bool)
+	for _, rel := range files {
+		if filepath.Base(rel) == "Chart.yaml" {
+			charts[filepath.ToSlash(filepath.Dir(rel))] = true
+		}
+	}
+	results := readFiles(files, jobs, func(rel string) fileResult {
+		r := fileResult{rel: rel}
+		r.data, r.err = fsys.ReadFile(filepath.Join(projectRoot, rel))
+		return r
+	})
+	var found []infraFile
+	for _, r := range results {
+		if r.err != nil {
+			return nil, fmt.Errorf("infra %s: %w", r.rel, r.err)
+		}
+		rel := filepath.ToSlash(r.rel)
+		base := strings.ToLower(path.Base(rel))
+		f := infraFile{rel: rel, data: r.data}
+		switch {
+		case strings.HasPrefix(base, "dockerfile") || strings.HasPrefix(base, "containerfile") || strings.HasSuffix(base, ".dockerfile"):
+			f.entries = dockerfileEntries(rel, r.data)
+		case base == "chart.yaml":
+			f.entries = chartEntries(rel, r.data)
+		case inChart(rel, charts):
+			// values and templates, which are not plain YAML
+		case strings.HasPrefix(base, "docker-compose") || strings.HasPrefix(base, "compose."):
+			if f.entries = composeEntries(rel, r.data); f.entries == nil {
+				continue
+			}
+		default:
+			if f.entries = manifestEntries(rel, r.data); f.entries == nil {
+				continue
+			}
+		}
+		found = append(found, f)
+	}
+	return found, nil
+}
+
+// inChart reports whether rel lies below a directory holding a Chart.yaml.
+func inChart(rel string, charts map[string]bool) bool {
+	for dir := path.Dir(rel); ; dir = path.Dir(dir) {
+		if charts[dir] {
+			return true
+		}
+		if dir == "." || dir == "/" {
+			return false
+		}
+	}
+}
+
+// renderInfra renders the entries of files as an aligned table.
+func renderInfra(files []infraFile) []byte {
+	rows := [][]string{{"Name", "Kind", "Image", "Exposes", "Uses", "Defined in"}}
+	for _, f := range files {
+		for _, e := range f.entries {
+			rows = append(rows, []string{e.name, e.kind, cell(e.image), cell(strings.Join(e.exposes, ", ")), cell(strings.Join(e.uses, ", ")), e.rel})
+		}
+	}
+	if len(rows) == 1 {
+		return []byte("(no services, workloads or charts found)\n")
+	}
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, c := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(c))
+		}
+	}
+	var b bytes.Buffer
+	for _, row := range rows {
+		for i, c := range row {
+			if i == len(row)-1 {
+				b.WriteString(c + "\n")
+				break
+			}
+			fmt.Fprintf(&b, "%-*s  ", widths[i], c)
+		}
+	}
+	return b.Bytes()
+}
+
+func cell(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// composeEntries lists the services of a Compose file, or nil if it has
+// none.
+func composeEntries(rel string, data []byte) []infraEntry {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil || len(doc.Content) == 0 {
+		return nil
+	}
+	services := field(doc.Content[0], "services")
+	if services == nil || services.Kind != yaml.MappingNode {
+		return nil
+	}
+	var entries []infraEntry
+	for i := 0; i+1 < len(services.Content); i += 2 {
+		svc := services.Content[i+1]
+		e := infraEntry{name: services.Content[i].Value, kind: "compose service", rel: rel, image: fieldValue(svc, "image")}
+		if build := field(svc, "build"); build != nil && e.image == "" {
+			ctx := build.Value
+			if build.Kind == yaml.MappingNode {
+				ctx = fieldValue(build, "context")
+			}
+			e.image = "build " + ctx
+		}
+		if ports := field(svc, "ports"); ports != nil {
+			for _, p := range ports.Content {
+				if p.Kind == yaml.MappingNode {
+					// long syntax
+					e.exposes = append(e.exposes, strings.TrimPrefix(fieldValue(p, "published")+":"+fieldValue(p, "target"), ":"))
+					continue
+				}
+				e.exposes = append(e.exposes, p.Value)
+			}
+		}
+		if deps := field(svc, "depends_on"); deps != nil {
+			for j, d := range deps.Content {
+				if deps.Kind == yaml.MappingNode && j%2 == 1 {
+					continue
+				}
+				e.uses = append(e.uses, d.Value)
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// dockerfileEntries describes a Dockerfile by its directory: its base
+// images, leaving out earlier stages, and the ports it exposes.
+func dockerfileEntries(rel string, data []byte) []infraEntry {
+	e := infraEntry{name: path.Base(path.Dir(rel)), kind: "Dockerfile", rel: rel}
+	if path.Dir(rel) == "." {
+		e.name = path.Base(rel)
+	}
+	stages := make(map[string]bool)
+	var bases []string
+	for _, line := range strings.Split(string(data), "\n") {
+		f := strings.Fields(line)
+		if len(f) < 2 {
+			continue
+		}
+		switch strings.ToUpper(f[0]) {
+		case "FROM":
+			args := f[1:]
+			for len(args) > 1 && strings.HasPrefix(args[0], "--") {
+				args = args[1:]
+			}
+			if !stages[strings.ToLower(args[0])] {
+				bases = append(bases, args[0])
+			}
+			if len(args) == 3 && strings.EqualFold(args[1], "as") {
+				stages[strings.ToLower(args[2])] = true
+			}
+		case "EXPOSE":
+			e.exposes = append(e.exposes, f[1:]...)
+		}
+	}
+	e.image = strings.Join(bases, ", ")
+	return []infraEntry{e}
+}
+
+// chartEntries describes a Helm Chart.yaml: the chart, its version and the
+// charts it depends on.
+func chartEntries(rel string, data []byte) []infraEntry {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil || len(doc.Content) == 0 {
+		return []infraEntry{{name: path.Base(path.Dir(rel)), kind: "Helm chart", rel: rel}}
+	}
+	chart := doc.Content[0]
+	e := infraEntry{name: fieldValue(chart, "name"), kind: "Helm chart", rel: rel}
+	if v := fieldValue(chart, "version"); v != "" {
+		e.image = "version " + v
+	}
+	if deps := field(chart, "dependencies"); deps != nil {
+		for _, d := range deps.Content {
+			e.uses = append(e.uses, fieldValue(d, "name"))
+		}
+	}
+	return []infraEntry{e}
+}
+
+// manifestEntries lists the objects of a (multi-document) Kubernetes
+// manifest, or nil if it is not one.
+func manifestEntries(rel string, data []byte) []infraEntry {
+	var entries []infraEntry
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+		obj := doc.Content[0]
+		kind := fieldValue(obj, "kind")
+		if fieldValue(obj, "apiVersion") == "" || kind == "" {
+			continue
+		}
+		if kind == "List" {
+			if items := field(obj, "items"); items != nil {
+				for _, item := range items.Content {
+					entries = append(entries, manifestEntry(rel, item))
+				}
+			}
+			continue
+		}
+		entries = append(entries, manifestEntry(rel, obj))
+	}
+	return entries
+}
+
+func manifestEntry(rel string, obj *yaml.Node) infraEntry {
+	kind := fieldValue(obj, "kind")
+	e := infraEntry{name: fieldValue(field(obj, "metadata"), "name"), kind: kind, rel: rel}
+	spec := field(obj, "spec")
+	switch kind {
+	case "Pod":
+		podEntry(&e, spec)
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "Job":
+		podEntry(&e, field(field(spec, "template"), "spec"))
+	case "CronJob":
+		podEntry(&e, field(field(field(field(spec, "jobTemplate"), "spec"), "template"), "spec"))
+	case "Service":
+		if ports := field(spec, "ports"); ports != nil {
+			for _, p := range ports.Content {
+				port := fieldValue(p, "port")
+				if target := fieldValue(p, "targetPort"); target != "" && target != port {
+					port += "→" + target
+				}
+				e.exposes = append(e.exposes, port)
+			}
+		}
+		if sel := field(spec, "selector"); sel != nil {
+			for i := 0; i+1 < len(sel.Content); i += 2 {
+				e.uses = append(e.uses, sel.Content[i].Value+"="+sel.Content[i+1].Value)
+			}
+		}
+	case "Ingress":
+		if rules := field(spec, "rules"); rules != nil {
+			for _, rule := range rules.Content {
+				host := cmp.Or(fieldValue(rule, "host"), "*")
+				paths := field(field(rule, "http"), "paths")
+				if paths == nil {
+					continue
+				}
+				for _, p := range paths.Content {
+					e.exposes = append(e.exposes, host+fieldValue(p, "path"))
+					backend := field(p, "backend")
+					// networking.k8s.io/v1, then the older v1beta1
+					svc := cmp.Or(fieldValue(field(backend, "service"), "name"), fieldValue(backend, "serviceName"))
+					if svc != "" && !slices.Contains(e.uses, "service/"+svc) {
+						e.uses = append(e.uses, "service/"+svc)
+					}
+				}
+			}
+		}
+	}
+	return e
+}
+
+// podEntry fills e from a pod spec: the images and ports of its containers,
+// and the config maps, secrets and volume claims it mounts or reads.
+func podEntry(e *infraEntry, spec *yaml.Node) {
+	use := func(ref string) {
+		if !slices.Contains(e.uses, ref) {
+			e.uses = append(e.uses, ref)
+		}
+	}
+	var images []string
+	for _, key := range []string{"initContainers", "containers"} {
+		containers := field(spec, key)
+		if containers == nil {
+			continue
+		}
+		for _, c := range containers.Content {
+			if img := fieldValue(c, "image"); img != "" && !slices.Contains(images, img) {
+				images = append(images, img)
+			}
+			if key == "containers" {
+				if ports := field(c, "ports"); ports != nil {
+					for _, p := range ports.Content {
+						e.exposes = append(e.exposes, fieldValue(p, "containerPort"))
+					}
+				}
+			}
+			if envFrom := field(c, "envFrom"); envFrom != nil {
+				for _, from := range envFrom.Content {
+					if name := fieldValue(field(from, "configMapRef"), "name"); name != "" {
+						use("configmap/" + name)
+					}
+					if name := fieldValue(field(from, "secretRef"), "name"); name != "" {
+						use("secret/" + name)
+					}
+				}
+			}
+			if env := field(c, "env"); env != nil {
+				for _, v := range env.Content {
+					from := field(v, "valueFrom")
+					if name := fieldValue(field(from, "configMapKeyRef"), "name"); name != "" {
+						use("configmap/" + name)
+					}
+					if name := fieldValue(field(from, "secretKeyRef"), "name"); name != "" {
+						use("secret/" + name)
+					}
+				}
+			}
+		}
+	}
+	e.image = strings.Join(images, ", ")
+	if volumes := field(spec, "volumes"); volumes != nil {
+		for _, v := range volumes.Content {
+			if name := fieldValue(field(v, "configMap"), "name"); name != "" {
+				use("configmap/" + name)
+			}
+			if name := fieldValue(field(v, "secret"), "secretName"); name != "" {
+				use("secret/" + name)
+			}
+			if name := fieldValue(field(v, "persistentVolumeClaim"), "claimName"); name != "" {
+				use("pvc/" + name)
+			}
+		}
+	}
+}
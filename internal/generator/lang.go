@@ -0,0 +1,139 @@
+package generator
+
+import (
+	"bytes"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// builtinLanguages maps lower-case file extensions to fence languages;
+// languageMap in the config adds to and overrides it.
+var builtinLanguages = map[string]string{
+	".go": "go", ".mod": "go-mod", ".sum": "text",
+	".php": "php", ".twig": "twig", ".blade": "blade",
+	".js": "javascript", ".mjs": "javascript", ".cjs": "javascript", ".jsx": "jsx",
+	".ts": "typescript", ".mts": "typescript", ".cts": "typescript", ".tsx": "tsx",
+	".vue": "vue", ".svelte": "svelte", ".astro": "astro",
+	".json": "json", ".jsonc": "jsonc", ".json5": "json5",
+	".yaml": "yaml", ".yml": "yaml", ".toml": "toml", ".ini": "ini", ".cfg": "ini", ".conf": "ini",
+	".properties": "properties", ".env": "dotenv",
+	".xml": "xml", ".xsd": "xml", ".svg": "xml", ".plist": "xml",
+	".md": "md", ".markdown": "md", ".mdx": "mdx", ".rst": "rst", ".adoc": "asciidoc", ".tex": "latex",
+	".html": "html", ".htm": "html", ".css": "css", ".scss": "scss", ".sass": "sass", ".less": "less",
+	".py": "python", ".pyi": "python", ".ipynb": "json",
+	".rb": "ruby", ".erb": "erb", ".rake": "ruby", ".gemspec": "ruby",
+	".rs": "rust", ".c": "c", ".h": "c", ".cc": "cpp", ".cpp": "cpp", ".cxx": "cpp", ".hpp": "cpp", ".hh": "cpp",
+	".m": "objectivec", ".mm": "objectivec", ".swift": "swift",
+	".java": "java", ".kt": "kotlin", ".kts": "kotlin", ".scala": "scala", ".groovy": "groovy", ".gradle": "groovy",
+	".clj": "clojure", ".cs": "csharp", ".fs": "fsharp", ".vb": "vbnet",
+	".dart": "dart", ".lua": "lua", ".pl": "perl", ".pm": "perl", ".r": "r", ".jl": "julia",
+	".ex": "elixir", ".exs": "elixir", ".erl": "erlang", ".hs": "haskell", ".ml": "ocaml", ".elm": "elm",
+	".zig": "zig", ".nim": "nim", ".v": "v", ".sol": "solidity",
+	".sh": "bash", ".bash": "bash", ".zsh": "zsh", ".fish": "fish", ".ps1": "powershell", ".psm1": "powershell",
+	".bat": "batch", ".cmd": "batch",
+	".sql": "sql", ".graphql": "graphql", ".gql": "graphql", ".proto": "protobuf", ".prisma": "prisma",
+	".tf": "hcl", ".tfvars": "hcl", ".hcl": "hcl", ".nix": "nix",
+	".dockerfile": "dockerfile", ".mk": "makefile", ".cmake": "cmake",
+	".diff": "diff", ".patch": "diff", ".csv": "csv", ".tsv": "tsv",
+}
+
+// builtinFileLanguages maps whole file names, for files whose name tells
+// the language rather than the extension.
+var builtinFileLanguages = map[string]string{
+	"Dockerfile": "dockerfile", "Containerfile": "dockerfile",
+	"Makefile": "makefile", "GNUmakefile": "makefile", "makefile": "makefile",
+	"CMakeLists.txt": "cmake", "Jenkinsfile": "groovy", "Vagrantfile": "ruby",
+	"Gemfile": "ruby", "Rakefile": "ruby", "Podfile": "ruby", "Brewfile": "ruby",
+	"Procfile": "yaml", "go.mod": "go-mod", "go.work": "go-mod",
+	".bashrc": "bash", ".zshrc": "zsh", ".profile": "bash", ".gitignore": "gitignore", ".dockerignore": "gitignore",
+	".editorconfig": "ini", ".gitconfig": "ini", ".env": "dotenv",
+}
+
+// shebangLanguages maps the interpreter of a "#!" line to a fence language.
+var shebangLanguages = map[string]string{
+	"sh": "bash", "bash": "bash", "dash": "bash", "ksh": "bash", "zsh": "zsh", "fish": "fish",
+	"python": "python", "python2": "python", "python3": "python",
+	"node": "javascript", "deno": "typescript", "bun": "javascript", "ts-node": "typescript",
+	"ruby": "ruby", "perl": "perl", "php": "php", "lua": "lua", "Rscript": "r",
+	"pwsh": "powershell", "awk": "awk", "gawk": "awk", "tclsh": "tcl",
+}
+
+// detectLang returns the built-in fence language of path, or "".
+func detectLang(path string) string {
+	return languageRegistry(nil).detect(path, nil)
+}
+
+// languageRegistry holds the languageMap of the config: keys starting with
+// "." are extensions (or dot files such as .envrc), other keys whole file
+// names.
+type languageRegistry map[string]string
+
+func newLanguageRegistry(custom map[string]string) languageRegistry {
+	r := make(languageRegistry, len(custom))
+	for k, lang := range custom {
+		if strings.HasPrefix(k, ".") {
+			k = strings.ToLower(k)
+		}
+		r[k] = lang
+	}
+	return r
+}
+
+// detect returns the fence language of the file rel: by its name, then its
+// extension (configured before built in), then, for files without an
+// extension, the interpreter of a "#!" line at the start of data.
+func (r languageRegistry) detect(rel string, data []byte) string {
+	base := path.Base(filepath.ToSlash(rel))
+	ext := strings.ToLower(path.Ext(base))
+	for _, m := range []map[string]string{r, builtinFileLanguages} {
+		if lang := m[base]; lang != "" {
+			return lang
+		}
+	}
+	if lang := r[ext]; lang != "" {
+		return lang
+	}
+	if lang := builtinLanguages[ext]; lang != "" {
+		return lang
+	}
+	// Dockerfile.dev, api.Dockerfile
+	if strings.HasPrefix(base, "Dockerfile") || strings.HasSuffix(base, ".Dockerfile") {
+		return "dockerfile"
+	}
+	if ext == "" {
+		return shebangLanguage(data)
+	}
+	return ""
+}
+
+// shebangLanguage reads "#!/usr/bin/env python3" or "#!/bin/sh -e" at the
+// start of data.
+func shebangLanguage(data []byte) string {
+	line, ok := bytes.CutPrefix(data, []byte("#!"))
+	if !ok {
+		return ""
+	}
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		return ""
+	}
+	interp := path.Base(fields[0])
+	if interp == "env" {
+		// skip env's options, such as -S
+		for _, f := range fields[1:] {
+			if !strings.HasPrefix(f, "-") {
+				interp = f
+				break
+			}
+		}
+	}
+	if lang := shebangLanguages[interp]; lang != "" {
+		return lang
+	}
+	// python3.12
+	return shebangLanguages[strings.TrimRight(interp, "0123456789.")]
+}
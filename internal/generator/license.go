@@ -0,0 +1,221 @@
+package generator
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// licenseFileNames are checked in every directory from a file up to the project root.
+var licenseFileNames = []string{
+	"LICENSE", "LICENSE.md", "LICENSE.txt",
+	"LICENCE", "LICENCE.md", "LICENCE.txt",
+	"COPYING", "COPYING.md", "COPYING.txt",
+}
+
+var spdxRe = regexp.MustCompile(`SPDX-License-Identifier:\s*([^\r\n*]+)`)
+
+// licenseTextHints map distinctive license text to SPDX identifiers, most specific first.
+var licenseTextHints = []struct {
+	needle string
+	id     string
+}{
+	{"GNU AFFERO GENERAL PUBLIC LICENSE", "AGPL"},
+	{"GNU LESSER GENERAL PUBLIC LICENSE", "LGPL"},
+	{"GNU LIBRARY GENERAL PUBLIC LICENSE", "LGPL"},
+	{"GNU GENERAL PUBLIC LICENSE", "GPL"},
+	{"Mozilla Public License", "MPL-2.0"},
+	{"Eclipse Public License", "EPL"},
+	{"Apache License", "Apache-2.0"},
+	{"Permission is hereby granted, free of charge", "MIT"},
+	{"Redistribution and use in source and binary forms", "BSD"},
+	{"This is free and unencumbered software released into the public domain", "Unlicense"},
+}
+
+var gnuVersionRe = regexp.MustCompile(`(?i)version\s+([0-9])(?:\.[0-9])?,`)
+
+// licenseScanner detects licenses of included files and caches per-directory results.
+type licenseScanner struct {
+	files   sourceFS
+	rootAbs string
+	dirs    map[string]licenseInfo
+}
+
+type licenseInfo struct {
+	id     string // SPDX identifier or expression, empty when unknown
+	source string // where the license was found (file path relative to root)
+}
+
+func newLicenseScanner(files sourceFS, projectRoot string) (*licenseScanner, error) {
+	rootAbs, err := filepath.Abs(projectRoot)
+	if err != nil {
+		return nil, fmt.Errorf("resolve root: %w", err)
+	}
+	return &licenseScanner{files: files, rootAbs: rootAbs, dirs: make(map[string]licenseInfo)}, nil
+}
+
+// detect returns the license of rel: an SPDX header in the file wins,
+// otherwise the nearest license file in an enclosing directory.
+func (s *licenseScanner) detect(rel string, data []byte) (licenseInfo, error) {
+	if id := spdxHeader(data); id != "" {
+		return licenseInfo{id: id, source: rel}, nil
+	}
+	return s.dirLicense(path.Dir(rel))
+}
+
+func (s *licenseScanner) dirLicense(dir string) (licenseInfo, error) {
+	if li, ok := s.dirs[dir]; ok {
+		return li, nil
+	}
+	var li licenseInfo
+	for _, name := range licenseFileNames {
+		rel := path.Join(dir, name)
+		data, err := s.files.ReadFile(filepath.Join(s.rootAbs, filepath.FromSlash(rel)))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return li, fmt.Errorf("read %s: %w", rel, err)
+		}
+		li = licenseInfo{id: identifyLicenseText(data), source: rel}
+		break
+	}
+	if li.source == "" && dir != "." && dir != "/" && !strings.HasPrefix(dir, "..") {
+		var err error
+		li, err = s.dirLicense(path.Dir(dir))
+		if err != nil {
+			return li, err
+		}
+	}
+	s.dirs[dir] = li
+	return li, nil
+}
+
+// spdxHeader returns the SPDX-License-Identifier found in the first lines of data.
+func spdxHeader(data []byte) string {
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for i := 0; i < 30 && sc.Scan(); i++ {
+		if m := spdxRe.FindSubmatch(sc.Bytes()); m != nil {
+			return strings.TrimSpace(string(m[1]))
+		}
+	}
+	return ""
+}
+
+// identifyLicenseText guesses the SPDX identifier of a license file's text.
+func identifyLicenseText(data []byte) string {
+	if id := spdxHeader(data); id != "" {
+		return id
+	}
+	text := string(data)
+	for _, h := range licenseTextHints {
+		if !strings.Contains(text, h.needle) {
+			continue
+		}
+		id := h.id
+		if strings.HasSuffix(id, "GPL") {
+			if m := gnuVersionRe.FindStringSubmatch(text); m != nil {
+				id += "-" + m[1] + ".0"
+			}
+		}
+		return id
+	}
+	return ""
+}
+
+// licenseIDs splits an SPDX expression such as "(MIT OR GPL-2.0+)" into identifiers.
+func licenseIDs(expr string) []string {
+	fields := strings.FieldsFunc(expr, func(r rune) bool {
+		return r == ' ' || r == '(' || r == ')' || r == '\t'
+	})
+	var out []string
+	for _, f := range fields {
+		switch strings.ToUpper(f) {
+		case "AND", "OR", "WITH":
+			continue
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// deniedLicense returns the first identifier in expr matching a deny glob.
+func deniedLicense(deny []string, expr string) (string, bool) {
+	for _, id := range licenseIDs(expr) {
+		for _, d := range deny {
+			if ok, _ := path.Match(strings.ToUpper(d), strings.ToUpper(id)); ok {
+				return id, true
+			}
+		}
+	}
+	return "", false
+}
+
+// licenseGate collects policy violations while a document is rendered.
+type licenseGate struct {
+	policy     cfg.LicensePolicy
+	scanner    *licenseScanner
+	violations []licenseViolation
+}
+
+type licenseViolation struct {
+	rel string
+	msg string
+}
+
+func newLicenseGate(files sourceFS, projectRoot string, policy *cfg.LicensePolicy) (*licenseGate, error) {
+	if policy == nil || len(policy.Deny) == 0 {
+		return nil, nil
+	}
+	switch strings.ToLower(policy.Action) {
+	case "", "warn", "fail":
+	default:
+		return nil, fmt.Errorf("licensePolicy: unknown action %q", policy.Action)
+	}
+	s, err := newLicenseScanner(files, projectRoot)
+	if err != nil {
+		return nil, err
+	}
+	return &licenseGate{policy: *policy, scanner: s}, nil
+}
+
+// check records a violation if rel is under a denied license. A nil gate is a no-op.
+func (g *licenseGate) check(rel string, data []byte) error {
+	if g == nil {
+		return nil
+	}
+	li, err := g.scanner.detect(rel, data)
+	if err != nil {
+		return err
+	}
+	if id, bad := deniedLicense(g.policy.Deny, li.id); bad {
+		g.violations = append(g.violations, licenseViolation{rel, fmt.Sprintf("licensed %s (from %s)", id, li.source)})
+	}
+	return nil
+}
+
+// finish reports violations as warnings or as an error depending on the policy action.
+func (g *licenseGate) finish(docPath string, warn func(Warning)) error {
+	if g == nil || len(g.violations) == 0 {
+		return nil
+	}
+	if strings.EqualFold(g.policy.Action, "fail") {
+		lines := make([]string, len(g.violations))
+		for i, v := range g.violations {
+			lines[i] = v.rel + " is " + v.msg
+		}
+		return fmt.Errorf("license policy violated in %s:\n  %s", docPath, strings.Join(lines, "\n  "))
+	}
+	for _, v := range g.violations {
+		warn(Warning{Document: docPath, Path: v.rel, Msg: "license policy: " + v.msg})
+	}
+	return nil
+}
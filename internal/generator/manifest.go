@@ -0,0 +1,270 @@
+package generator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SnapshotDir is where snapshot manifests are kept, relative to the
+// project root.
+const SnapshotDir = ".gpcm/snapshots"
+
+// LatestSnapshot names the most recent snapshot in a reference.
+const LatestSnapshot = "latest"
+
+// Manifest records what every document embedded at one point in time, so
+// later runs can report how a bundle drifted.
+type Manifest struct {
+	Name      string             `json:"name"`
+	Taken     time.Time          `json:"taken"`
+	RunID     string             `json:"runId,omitempty"`
+	Documents []DocumentManifest `json:"documents"`
+}
+
+// DocumentManifest lists the files one document embedded.
+type DocumentManifest struct {
+	Name   string         `json:"name"`
+	Tokens int            `json:"tokens"` // estimated for the whole first output
+	Files  []ManifestFile `json:"files"`
+}
+
+// ManifestFile is one embedded file.
+type ManifestFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Bytes  int    `json:"bytes"`
+	Tokens int    `json:"tokens"`
+}
+
+// NewManifest builds the manifest of rendered outputs, from the first
+// output of each document (further outputs repeat its files).
+func NewManifest(name, runID string, taken time.Time, outs []Output) Manifest {
+	m := Manifest{Name: name, Taken: taken.UTC(), RunID: runID, Documents: []DocumentManifest{}}
+	for i := 0; i < len(outs); {
+		d := DocumentManifest{Name: outs[i].Document, Files: []ManifestFile{}}
+		for doc := outs[i].Document; i < len(outs) && outs[i].Document == doc; i++ {
+			if outs[i].target != 0 {
+				continue
+			}
+			d.Tokens += EstimateTokens(outs[i].Len())
+			for _, f := range outs[i].Files {
+				d.Files = append(d.Files, ManifestFile{Path: f.Path, SHA256: f.SHA256, Bytes: f.Bytes, Tokens: EstimateTokens(f.Bytes)})
+			}
+		}
+		m.Documents = append(m.Documents, d)
+	}
+	return m
+}
+
+// SaveManifest writes m to dir as <name>.json and returns its path. An
+// existing snapshot of the same name is never overwritten: the error then
+// wraps fs.ErrExist.
+func SaveManifest(dir string, m Manifest) (string, error) {
+	if m.Name == "" || m.Name == LatestSnapshot || strings.ContainsAny(m.Name, `/\`) || strings.HasPrefix(m.Name, ".") {
+		return "", fmt.Errorf("invalid snapshot name %q", m.Name)
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("snapshot: %w", err)
+	}
+	path := filepath.Join(dir, m.Name+".json")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		return "", fmt.Errorf("snapshot %q in %s: %w", m.Name, dir, fs.ErrExist)
+	}
+	if err != nil {
+		return "", fmt.Errorf("snapshot: %w", err)
+	}
+	_, err = f.Write(append(data, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("snapshot: %w", err)
+	}
+	return path, nil
+}
+
+// LoadManifest reads the snapshot ref from dir: a snapshot name, "latest"
+// for the most recently taken one, or the path of a manifest file.
+func LoadManifest(dir, ref string) (Manifest, error) {
+	var m Manifest
+	path := filepath.Join(dir, ref+".json")
+	switch {
+	case ref == LatestSnapshot:
+		all, err := listManifests(dir)
+		if err != nil {
+			return m, err
+		}
+		if len(all) == 0 {
+			return m, fmt.Errorf("no snapshots in %s", dir)
+		}
+		return all[len(all)-1], nil
+	case strings.HasSuffix(ref, ".json"):
+		path = ref
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, fmt.Errorf("no snapshot %q in %s", ref, dir)
+	}
+	if err != nil {
+		return m, fmt.Errorf("read snapshot: %w", err)
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("read snapshot %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// listManifests returns the snapshots in dir, oldest first.
+func listManifests(dir string) ([]Manifest, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("read snapshots: %w", err)
+	}
+	var all []Manifest
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || e.IsDir() {
+			continue
+		}
+		m, err := LoadManifest(dir, name)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, m)
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Taken.Before(all[j].Taken) })
+	return all, nil
+}
+
+// DocumentDrift is how a document changed between two manifests.
+type DocumentDrift struct {
+	Document   string      `json:"document"`
+	Status     string      `json:"status"` // "added", "removed" or "changed"
+	Tokens     int         `json:"tokens"` // in the newer manifest
+	TokenDelta int         `json:"tokenDelta"`
+	Files      []FileDrift `json:"files,omitempty"`
+}
+
+// FileDrift is an embedded file that was added, removed or changed.
+type FileDrift struct {
+	Path       string `json:"path"`
+	Status     string `json:"status"` // "added", "removed", "grown", "shrunk" or "changed"
+	TokenDelta int    `json:"tokenDelta"`
+}
+
+// CompareManifests reports the documents whose embedded files differ
+// between old and cur. Files within a document are listed added first,
+// then removed, then changed by the size of the change.
+func CompareManifests(old, cur Manifest) []DocumentDrift {
+	before := make(map[string]DocumentManifest, len(old.Documents))
+	for _, d := range old.Documents {
+		before[d.Name] = d
+	}
+	var drifts []DocumentDrift
+	seen := make(map[string]bool)
+	for _, d := range cur.Documents {
+		seen[d.Name] = true
+		prev, ok := before[d.Name]
+		if !ok {
+			drift := DocumentDrift{Document: d.Name, Status: "added", Tokens: d.Tokens, TokenDelta: d.Tokens}
+			for _, f := range d.Files {
+				drift.Files = append(drift.Files, FileDrift{Path: f.Path, Status: "added", TokenDelta: f.Tokens})
+			}
+			drifts = append(drifts, drift)
+			continue
+		}
+		files := compareFiles(prev.Files, d.Files)
+		if len(files) == 0 && prev.Tokens == d.Tokens {
+			continue
+		}
+		drifts = append(drifts, DocumentDrift{Document: d.Name, Status: "changed", Tokens: d.Tokens, TokenDelta: d.Tokens - prev.Tokens, Files: files})
+	}
+	for _, d := range old.Documents {
+		if !seen[d.Name] {
+			drifts = append(drifts, DocumentDrift{Document: d.Name, Status: "removed", TokenDelta: -d.Tokens})
+		}
+	}
+	return drifts
+}
+
+func compareFiles(old, cur []ManifestFile) []FileDrift {
+	before := make(map[string]ManifestFile, len(old))
+	for _, f := range old {
+		before[f.Path] = f
+	}
+	var added, removed, changed []FileDrift
+	seen := make(map[string]bool)
+	for _, f := range cur {
+		seen[f.Path] = true
+		prev, ok := before[f.Path]
+		switch {
+		case !ok:
+			added = append(added, FileDrift{Path: f.Path, Status: "added", TokenDelta: f.Tokens})
+		case prev.SHA256 == f.SHA256:
+		case f.Tokens > prev.Tokens:
+			changed = append(changed, FileDrift{Path: f.Path, Status: "grown", TokenDelta: f.Tokens - prev.Tokens})
+		case f.Tokens < prev.Tokens:
+			changed = append(changed, FileDrift{Path: f.Path, Status: "shrunk", TokenDelta: f.Tokens - prev.Tokens})
+		default:
+			changed = append(changed, FileDrift{Path: f.Path, Status: "changed"})
+		}
+	}
+	for _, f := range old {
+		if !seen[f.Path] {
+			removed = append(removed, FileDrift{Path: f.Path, Status: "removed", TokenDelta: -f.Tokens})
+		}
+	}
+	sort.SliceStable(changed, func(i, j int) bool {
+		return absInt(changed[i].TokenDelta) > absInt(changed[j].TokenDelta)
+	})
+	return append(append(added, removed...), changed...)
+}
+
+func absInt(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// WriteDrift prints drifts as a summary, one line per document with its
+// token change and one per file added (+), removed (-) or changed (~).
+func WriteDrift(w io.Writer, since string, drifts []DocumentDrift) {
+	if len(drifts) == 0 {
+		fmt.Fprintf(w, "No drift since %s\n", since)
+		return
+	}
+	marks := map[string]string{"added": "+", "removed": "-"}
+	for _, d := range drifts {
+		switch d.Status {
+		case "added":
+			fmt.Fprintf(w, "%s: new, ~%d tokens\n", d.Document, d.Tokens)
+		case "removed":
+			fmt.Fprintf(w, "%s: removed (%+d tokens)\n", d.Document, d.TokenDelta)
+			continue
+		default:
+			fmt.Fprintf(w, "%s: ~%d tokens (%+d since %s)\n", d.Document, d.Tokens, d.TokenDelta, since)
+		}
+		for _, f := range d.Files {
+			mark, ok := marks[f.Status]
+			if !ok {
+				mark = "~"
+			}
+			fmt.Fprintf(w, "  %s %s (%+d tokens)\n", mark, f.Path, f.TokenDelta)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	cfg "go_project_context_maker/internal/config"
+	"go_project_context_maker/internal/unorm"
+)
+
+// modifiedCutoff returns the start of src's modification window, or the
+// zero time when it has none.
+func modifiedCutoff(src cfg.Source, now time.Time) (time.Time, error) {
+	var cutoff time.Time
+	if src.ModifiedWithin != "" {
+		within, err := cfg.ParseAge(src.ModifiedWithin)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("modifiedWithin: %w", err)
+		}
+		cutoff = now.Add(-within)
+	}
+	if src.ModifiedAfter != "" {
+		after, err := cfg.ParseDate(src.ModifiedAfter)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("modifiedAfter: %w", err)
+		}
+		if after.After(cutoff) {
+			cutoff = after
+		}
+	}
+	return cutoff, nil
+}
+
+// filterModified keeps the files (relative to projectRoot) changed after
+// cutoff: by modification time, or with modifiedBy "git" by the commits
+// touching them, counting uncommitted and untracked files as changed now.
+func filterModified(ctx context.Context, fsys sourceFS, projectRoot string, files []string, src cfg.Source, cutoff time.Time, onDisk bool, jobs int) ([]string, error) {
+	switch strings.ToLower(src.ModifiedBy) {
+	case "", "mtime":
+		results := readFiles(files, jobs, func(rel string) fileResult {
+			r := fileResult{rel: rel}
+			r.info, r.err = fsys.Stat(filepath.Join(projectRoot, rel))
+			return r
+		})
+		out := files[:0]
+		for _, r := range results {
+			if r.err != nil {
+				return nil, fmt.Errorf("stat %s: %w", r.rel, r.err)
+			}
+			if r.info.ModTime().After(cutoff) {
+				out = append(out, r.rel)
+			}
+		}
+		return out, nil
+	case "git":
+		if !onDisk {
+			return nil, errors.New("modifiedBy git needs the project on disk")
+		}
+		changed, err := gitModifiedSince(ctx, projectRoot, cutoff)
+		if err != nil {
+			return nil, err
+		}
+		return keepChanged(files, changed), nil
+	}
+	return nil, fmt.Errorf("unknown modifiedBy %q", src.ModifiedBy)
+}
+
+// gitModifiedSince returns the files below projectRoot (slash paths
+// relative to it, NFC) touched by a commit after cutoff, or changed in the
+// work tree and not committed yet.
+func gitModifiedSince(ctx context.Context, projectRoot string, cutoff time.Time) (map[string]bool, error) {
+	var names [][]byte
+	for _, args := range [][]string{
+		{"log", "--since=" + cutoff.Format(time.RFC3339), "--format=", "--name-only", "--relative", "-z", "--", "."},
+		{"diff", "HEAD", "--name-only", "--relative", "-z", "--"},
+		{"ls-files", "--others", "--exclude-standard", "-z"},
+	} {
+		out, err := git(ctx, projectRoot, args...)
+		if err != nil {
+			return nil, fmt.Errorf("modifiedBy git: %w", err)
+		}
+		names = append(names, bytes.Split(out, []byte{0})...)
+	}
+	changed := make(map[string]bool)
+	for _, name := range names {
+		// commits are separated by newlines in -z output of git log
+		if name := strings.TrimSpace(string(name)); name != "" {
+			changed[unorm.NFC(name)] = true
+		}
+	}
+	return changed, nil
+}
@@ -0,0 +1,125 @@
+package generator
+
+import (
+	"cmp"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// prioritized returns the indexes of the sources of doc in render order:
+// with order "priority" highest priority first, equal priorities as
+// configured; otherwise as configured.
+func prioritized(doc cfg.Document) []int {
+	order := make([]int, len(doc.Sources))
+	for i := range order {
+		order[i] = i
+	}
+	if strings.EqualFold(doc.Order, "priority") {
+		slices.SortStableFunc(order, func(a, b int) int { return doc.Sources[b].Priority - doc.Sources[a].Priority })
+	}
+	return order
+}
+
+// orderFiles sorts the files of one source, slash-separated paths relative
+// to projectRoot, by the document's order, or else its sort: "size"
+// smallest first, so more files fit a budget, "modtime" newest first and
+// "natural" by path with numbers compared by value. Otherwise files keep
+// the path order they are collected in.
+func orderFiles(fsys sourceFS, projectRoot string, files []string, doc cfg.Document) ([]string, error) {
+	order := strings.ToLower(doc.Order)
+	if order != "size" && order != "modtime" {
+		order = strings.ToLower(doc.Sort)
+	}
+	switch order {
+	case "natural":
+		files = slices.Clone(files)
+		slices.SortStableFunc(files, compareNaturalPaths)
+		return files, nil
+	case "size", "modtime":
+	default:
+		return files, nil
+	}
+	keys := make(map[string]int64, len(files))
+	for _, f := range files {
+		info, err := fsys.Stat(filepath.Join(projectRoot, filepath.FromSlash(f)))
+		if err != nil {
+			return nil, fmt.Errorf("stat %s: %w", f, err)
+		}
+		if order == "size" {
+			keys[f] = info.Size()
+		} else {
+			keys[f] = -info.ModTime().UnixNano()
+		}
+	}
+	files = slices.Clone(files)
+	slices.SortStableFunc(files, func(a, b string) int { return cmp.Compare(keys[a], keys[b]) })
+	return files, nil
+}
+
+// compareNaturalPaths compares slash-separated paths directory by
+// directory with compareNatural, so the files of "a" stay together
+// before those of "a-b".
+func compareNaturalPaths(a, b string) int {
+	for {
+		ha, ra, moreA := strings.Cut(a, "/")
+		hb, rb, moreB := strings.Cut(b, "/")
+		if c := compareNatural(ha, hb); c != 0 {
+			return c
+		}
+		if !moreA || !moreB {
+			return cmp.Compare(len(ra), len(rb))
+		}
+		a, b = ra, rb
+	}
+}
+
+// compareNatural orders names the way people read them: runs of digits by
+// their value, so "file2" comes before "file10" and "002_init.sql" before
+// "010_users.sql", and letters regardless of case. Names equal that way
+// fall back to byte order.
+func compareNatural(a, b string) int {
+	x, y := a, b
+	for x != "" && y != "" {
+		if isDigit(x[0]) && isDigit(y[0]) {
+			nx, ny := digitRun(x), digitRun(y)
+			// compare values without parsing: drop leading zeros, then the
+			// longer run is larger, equal lengths compare digit by digit
+			vx, vy := strings.TrimLeft(x[:nx], "0"), strings.TrimLeft(y[:ny], "0")
+			if c := cmp.Compare(len(vx), len(vy)); c != 0 {
+				return c
+			}
+			if c := strings.Compare(vx, vy); c != 0 {
+				return c
+			}
+			x, y = x[nx:], y[ny:]
+			continue
+		}
+		rx, sx := utf8.DecodeRuneInString(x)
+		ry, sy := utf8.DecodeRuneInString(y)
+		if c := cmp.Compare(unicode.ToLower(rx), unicode.ToLower(ry)); c != 0 {
+			return c
+		}
+		x, y = x[sx:], y[sy:]
+	}
+	if c := cmp.Compare(len(x), len(y)); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+func isDigit(c byte) bool { return '0' <= c && c <= '9' }
+
+// digitRun returns the length of the run of ASCII digits s starts with.
+func digitRun(s string) int {
+	n := 0
+	for n < len(s) && isDigit(s[n]) {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,223 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"path/filepath"
+	"strings"
+)
+
+// outlineGo reduces a Go source file to its API shape: the package clause,
+// exported type declarations and exported function/method signatures, each
+// preceded by its doc comment. Function bodies and unexported identifiers are dropped.
+func outlineGo(filename string, src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	writeDoc(&out, f.Doc)
+	out.WriteString("package " + f.Name.Name + "\n")
+
+	pcfg := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if !d.Name.IsExported() || (d.Recv != nil && !receiverExported(d.Recv)) {
+				continue
+			}
+			d.Body = nil
+			out.WriteString("\n")
+			writeDoc(&out, d.Doc)
+			d.Doc = nil
+			if err := pcfg.Fprint(&out, fset, d); err != nil {
+				return nil, err
+			}
+			out.WriteString("\n")
+
+		case *ast.GenDecl:
+			if d.Tok != token.TYPE {
+				continue
+			}
+			var specs []ast.Spec
+			for _, s := range d.Specs {
+				ts := s.(*ast.TypeSpec)
+				if !ts.Name.IsExported() {
+					continue
+				}
+				stripUnexported(ts.Type)
+				specs = append(specs, ts)
+			}
+			if len(specs) == 0 {
+				continue
+			}
+			for _, s := range specs {
+				out.WriteString("\n")
+				ts := s.(*ast.TypeSpec)
+				doc := ts.Doc
+				if doc == nil && len(d.Specs) == 1 {
+					doc = d.Doc
+				}
+				writeDoc(&out, doc)
+				ts.Doc, ts.Comment = nil, nil
+				single := &ast.GenDecl{Tok: token.TYPE, Specs: []ast.Spec{ts}}
+				if err := pcfg.Fprint(&out, fset, single); err != nil {
+					return nil, err
+				}
+				out.WriteString("\n")
+			}
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// writeDoc writes a comment group as "// " prefixed lines.
+func writeDoc(out *bytes.Buffer, cg *ast.CommentGroup) {
+	if cg == nil {
+		return
+	}
+	text := strings.TrimRight(cg.Text(), "\n")
+	if text == "" {
+		return
+	}
+	for _, line := range strings.Split(text, "\n") {
+		if line == "" {
+			out.WriteString("//\n")
+			continue
+		}
+		out.WriteString("// " + line + "\n")
+	}
+}
+
+// receiverExported reports whether the method receiver's base type is exported.
+func receiverExported(recv *ast.FieldList) bool {
+	if recv == nil || len(recv.List) == 0 {
+		return true
+	}
+	t := recv.List[0].Type
+	for {
+		switch x := t.(type) {
+		case *ast.StarExpr:
+			t = x.X
+		case *ast.IndexExpr:
+			t = x.X
+		case *ast.IndexListExpr:
+			t = x.X
+		case *ast.ParenExpr:
+			t = x.X
+		case *ast.Ident:
+			return x.IsExported()
+		default:
+			return true
+		}
+	}
+}
+
+// stripUnexported removes unexported struct fields and interface methods,
+// and drops field comments so that printing does not misplace them.
+func stripUnexported(expr ast.Expr) {
+	switch t := expr.(type) {
+	case *ast.StructType:
+		t.Fields.List = filterFields(t.Fields.List)
+	case *ast.InterfaceType:
+		t.Methods.List = filterFields(t.Methods.List)
+	}
+}
+
+func filterFields(fields []*ast.Field) []*ast.Field {
+	out := fields[:0]
+	for _, fld := range fields {
+		fld.Doc, fld.Comment = nil, nil
+		if len(fld.Names) == 0 {
+			// embedded field or interface element: keep as part of the API shape
+			out = append(out, fld)
+			continue
+		}
+		var names []*ast.Ident
+		for _, n := range fld.Names {
+			if n.IsExported() {
+				names = append(names, n)
+			}
+		}
+		if len(names) == 0 {
+			continue
+		}
+		fld.Names = names
+		stripUnexported(fld.Type)
+		out = append(out, fld)
+	}
+	return out
+}
+
+// goAnnotation summarizes a Go file in one line: package name, number of
+// exported top-level symbols and the imports that belong to modulePath.
+// It returns "" if the file does not parse.
+func goAnnotation(filename string, src []byte, modulePath string) string {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.SkipObjectResolution)
+	if err != nil {
+		return ""
+	}
+
+	exported := 0
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Name.IsExported() && (d.Recv == nil || receiverExported(d.Recv)) {
+				exported++
+			}
+		case *ast.GenDecl:
+			for _, s := range d.Specs {
+				switch sp := s.(type) {
+				case *ast.TypeSpec:
+					if sp.Name.IsExported() {
+						exported++
+					}
+				case *ast.ValueSpec:
+					for _, n := range sp.Names {
+						if n.IsExported() {
+							exported++
+						}
+					}
+				}
+			}
+		}
+	}
+
+	var internal []string
+	if modulePath != "" {
+		for _, imp := range f.Imports {
+			p := strings.Trim(imp.Path.Value, "\"`")
+			if p == modulePath || strings.HasPrefix(p, modulePath+"/") {
+				internal = append(internal, strings.TrimPrefix(strings.TrimPrefix(p, modulePath), "/"))
+			}
+		}
+	}
+
+	note := fmt.Sprintf("package %s · %d exported", f.Name.Name, exported)
+	if len(internal) > 0 {
+		note += " · imports: " + strings.Join(internal, ", ")
+	}
+	return note
+}
+
+// goModulePath returns the module path declared in projectRoot/go.mod, or "".
+func goModulePath(files sourceFS, projectRoot string) string {
+	data, err := files.ReadFile(filepath.Join(projectRoot, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if rest, ok := strings.CutPrefix(line, "module"); ok && rest != "" && (rest[0] == ' ' || rest[0] == '\t') {
+			return strings.Trim(strings.TrimSpace(rest), "\"")
+		}
+	}
+	return ""
+}
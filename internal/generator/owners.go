@@ -0,0 +1,115 @@
+package generator
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go_project_context_maker/internal/match"
+)
+
+// codeownersLocations are checked in order, matching GitHub's lookup rules.
+var codeownersLocations = []string{
+	".github/CODEOWNERS",
+	"CODEOWNERS",
+	"docs/CODEOWNERS",
+}
+
+type ownerRule struct {
+	pattern *match.Set
+	owners  []string
+}
+
+// loadCodeowners finds and parses the CODEOWNERS file under projectRoot.
+func loadCodeowners(files sourceFS, projectRoot string) ([]ownerRule, error) {
+	for _, loc := range codeownersLocations {
+		p := filepath.Join(projectRoot, filepath.FromSlash(loc))
+		f, err := files.Open(p)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("open %s: %w", loc, err)
+		}
+		defer f.Close()
+
+		var rules []ownerRule
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			line := strings.TrimSpace(sc.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			fields := strings.Fields(line)
+			set, err := match.Compile(fields[:1])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", loc, err)
+			}
+			rules = append(rules, ownerRule{pattern: set, owners: fields[1:]})
+		}
+		if err := sc.Err(); err != nil {
+			return nil, fmt.Errorf("read %s: %w", loc, err)
+		}
+		return rules, nil
+	}
+	return nil, errors.New("excludeOwners is set but no CODEOWNERS file was found")
+}
+
+// ownersOf returns the owners of relSlash; the last matching rule wins.
+func ownersOf(rules []ownerRule, relSlash string) []string {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if rules[i].pattern.Match(relSlash) {
+			return rules[i].owners
+		}
+	}
+	return nil
+}
+
+// ownerMatches reports whether a CODEOWNERS owner such as "@org/team-data"
+// refers to name, which may be given with or without the "@" and org prefix.
+func ownerMatches(owner, name string) bool {
+	owner = strings.TrimPrefix(owner, "@")
+	name = strings.TrimPrefix(strings.TrimSpace(name), "@")
+	if name == "" {
+		return false
+	}
+	if strings.EqualFold(owner, name) {
+		return true
+	}
+	if i := strings.LastIndex(owner, "/"); i >= 0 && !strings.Contains(name, "/") {
+		return strings.EqualFold(owner[i+1:], name)
+	}
+	return false
+}
+
+// filterOwners drops files owned by any of the excluded owners.
+func filterOwners(fsys sourceFS, projectRoot string, files []string, exclude []string) ([]string, error) {
+	if len(exclude) == 0 {
+		return files, nil
+	}
+	rules, err := loadCodeowners(fsys, projectRoot)
+	if err != nil {
+		return nil, err
+	}
+	out := files[:0]
+	for _, rel := range files {
+		if !ownedByAny(ownersOf(rules, rel), exclude) {
+			out = append(out, rel)
+		}
+	}
+	return out, nil
+}
+
+func ownedByAny(owners, names []string) bool {
+	for _, o := range owners {
+		for _, n := range names {
+			if ownerMatches(o, n) {
+				return true
+			}
+		}
+	}
+	return false
+}
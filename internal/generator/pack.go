@@ -0,0 +1,193 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	cfg "go_project_context_maker/internal/config"
+	"go_project_context_maker/internal/unorm"
+)
+
+// packFile is a file collected by the repomix and gitingest formats, which
+// write the directory structure of all files before their contents.
+type packFile struct {
+	path    string
+	content string
+}
+
+// packTree builds the tree of the collected files.
+func packTree(files []packFile) *tnode {
+	root := newNode("")
+	for _, f := range files {
+		insertPath(root, unorm.NFC(f.path), treeDetail{})
+	}
+	return root
+}
+
+// repomixFormat follows the default (XML) output style of Repomix: a file
+// summary, the directory structure and every file in <file path="...">
+// tags, contents verbatim. Like json it leaves out trees, command output
+// and other blocks; the directory structure lists the embedded files.
+type repomixFormat struct {
+	description string
+	runID       string
+	files       []packFile
+}
+
+func (f *repomixFormat) header(_ *strings.Builder, doc cfg.Document, runID string) {
+	f.description, f.runID = doc.Description, runID
+}
+
+func (*repomixFormat) tree(*strings.Builder, cfg.Source, string) {}
+
+func (*repomixFormat) noFiles(*strings.Builder, cfg.Source) {}
+
+func (f *repomixFormat) file(_ *strings.Builder, _ *template.Template, v FileView) error {
+	f.files = append(f.files, packFile{path: v.Path, content: v.Content})
+	return nil
+}
+
+func (*repomixFormat) command(*strings.Builder, string, []byte) {}
+
+func (*repomixFormat) block(*strings.Builder, string, string, []byte) {}
+
+func (*repomixFormat) snapshot(*strings.Builder, string) {}
+
+func (*repomixFormat) footer(*strings.Builder, string) {}
+
+func (*repomixFormat) part(*strings.Builder, int, int) {}
+
+// repomixSummary is the file summary Repomix writes at the top of a pack.
+const repomixSummary = `This file is a merged representation of a subset of the codebase, combined into a single document by go_project_context_maker in the Repomix format.
+
+<file_summary>
+This section contains a summary of this file.
+
+<purpose>
+This file contains a packed representation of the entire repository's contents.
+It is designed to be easily consumable by AI systems for analysis, code review,
+or other automated processes.
+</purpose>
+
+<file_format>
+The content is organized as follows:
+1. This summary section
+2. Directory structure
+3. Repository files, each consisting of:
+  - File path as an attribute
+  - Full contents of the file
+</file_format>
+
+<usage_guidelines>
+- This file should be treated as read-only. Any changes should be made to the
+  original repository files, not this packed version.
+- When processing this file, use the file path to distinguish
+  between different files in the repository.
+- Be aware that this file may contain sensitive information. Handle it with
+  the same level of security as you would the original repository.
+</usage_guidelines>
+
+<notes>
+- Some files may have been excluded based on the configuration's file patterns and excludePaths
+- Binary files are not included in this packed representation
+</notes>
+`
+
+func (f *repomixFormat) finish(b *strings.Builder) error {
+	b.WriteString(repomixSummary)
+	if f.description != "" {
+		fmt.Fprintf(b, "\n<user_provided_header>\n%s\n</user_provided_header>\n", f.description)
+	}
+	if f.runID != "" {
+		fmt.Fprintf(b, "\n<additional_info>\nrun-id: %s\n</additional_info>\n", f.runID)
+	}
+	b.WriteString("\n</file_summary>\n\n<directory_structure>\n")
+	drawIndentedTree(b, packTree(f.files), "")
+	b.WriteString("</directory_structure>\n\n<files>\nThis section contains the contents of the repository's files.\n")
+	for _, file := range f.files {
+		fmt.Fprintf(b, "\n<file path=\"%s\">\n%s</file>\n", file.path, file.content)
+	}
+	b.WriteString("\n</files>\n")
+	return nil
+}
+
+// drawIndentedTree writes the entries below n as Repomix does: two spaces
+// per level, directories first with a trailing slash.
+func drawIndentedTree(b *strings.Builder, n *tnode, indent string) {
+	for _, name := range sortedKeys(n.children, true) {
+		child := n.children[name]
+		if isDir(child) {
+			fmt.Fprintf(b, "%s%s/\n", indent, child.name)
+			drawIndentedTree(b, child, indent+"  ")
+			continue
+		}
+		fmt.Fprintf(b, "%s%s\n", indent, child.name)
+	}
+}
+
+// gitingestSeparator delimits the files of a gitingest digest.
+var gitingestSeparator = strings.Repeat("=", 48)
+
+// gitingestFormat follows the digest of gitingest: a summary, the
+// directory structure under the project's name and every file between
+// "FILE: path" separators. Like json it leaves out trees, command output
+// and other blocks.
+type gitingestFormat struct {
+	root  string // name of the project directory
+	files []packFile
+}
+
+func (*gitingestFormat) header(*strings.Builder, cfg.Document, string) {}
+
+func (*gitingestFormat) tree(*strings.Builder, cfg.Source, string) {}
+
+func (*gitingestFormat) noFiles(*strings.Builder, cfg.Source) {}
+
+func (f *gitingestFormat) file(_ *strings.Builder, _ *template.Template, v FileView) error {
+	f.files = append(f.files, packFile{path: v.Path, content: v.Content})
+	return nil
+}
+
+func (*gitingestFormat) command(*strings.Builder, string, []byte) {}
+
+func (*gitingestFormat) block(*strings.Builder, string, string, []byte) {}
+
+func (*gitingestFormat) snapshot(*strings.Builder, string) {}
+
+func (*gitingestFormat) footer(*strings.Builder, string) {}
+
+func (*gitingestFormat) part(*strings.Builder, int, int) {}
+
+func (f *gitingestFormat) finish(b *strings.Builder) error {
+	size := 0
+	for _, file := range f.files {
+		size += len(file.content)
+	}
+	fmt.Fprintf(b, "Repository: %s\nFiles analyzed: %d\n\nEstimated tokens: %s\n\n", f.root, len(f.files), gitingestTokens(EstimateTokens(size)))
+
+	b.WriteString("Directory structure:\n")
+	fmt.Fprintf(b, "└── %s/\n", f.root)
+	tree := drawTree(packTree(f.files), treeView{})
+	for _, line := range strings.SplitAfter(tree, "\n") {
+		if line != "" {
+			b.WriteString("    " + line)
+		}
+	}
+	b.WriteString("\n")
+	for _, file := range f.files {
+		fmt.Fprintf(b, "%s\nFILE: %s\n%s\n%s\n\n", gitingestSeparator, file.path, gitingestSeparator, file.content)
+	}
+	return nil
+}
+
+// gitingestTokens formats a token count as gitingest does: 950, 12.3k, 1.2M.
+func gitingestTokens(n int) string {
+	switch {
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1fM", float64(n)/1_000_000)
+	case n >= 1_000:
+		return fmt.Sprintf("%.1fk", float64(n)/1_000)
+	}
+	return fmt.Sprint(n)
+}
@@ -0,0 +1,165 @@
+package generator
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// fileResult is the outcome of reading and processing one file.
+type fileResult struct {
+	rel   string
+	label string // heading of the embedded item: rel, or rel with a selector such as ":120-240"
+	raw   []byte // original content, kept only when the license gate needs it
+	data  []byte // processed content to embed
+	note  string
+	info  fs.FileInfo
+	skip  string // why the file is left out; empty when it is embedded
+	long  int    // lines over maxLineLength
+	lang  string // code fence language of a converted rich file (convert)
+	// summarized is set when data is a summary written by the llm endpoint
+	summarized bool
+	// filtered is set when contentMatch/contentExclude drop the file, which
+	// is counted as excluded but not reported
+	filtered bool
+	// unreadable is the error of a file embedded as a placeholder under
+	// onError: placeholder
+	unreadable error
+	err        error
+}
+
+// readFiles runs fn for every file on a pool of jobs workers and returns the
+// results indexed like files, so callers can assemble output deterministically.
+func readFiles(files []string, jobs int, fn func(rel string) fileResult) []fileResult {
+	results := make([]fileResult, len(files))
+	if jobs > len(files) {
+		jobs = len(files)
+	}
+	if jobs <= 1 {
+		for i, rel := range files {
+			results[i] = fn(rel)
+		}
+		return results
+	}
+
+	idx := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range idx {
+				results[i] = fn(files[i])
+			}
+		}()
+	}
+	for i := range files {
+		idx <- i
+	}
+	close(idx)
+	wg.Wait()
+	return results
+}
+
+// documentResult is the outcome of rendering one document.
+type documentResult struct {
+	outs []Output
+	err  error
+	// interrupted is set when the document failed after another one
+	// aborted the run, so its error may only be a consequence
+	interrupted bool
+}
+
+// renderAll runs the preGenerate hooks of every document of c and renders
+// it, up to opts.jobs() documents at once, and returns the results in
+// config order. A document failing under failurePolicy abortAll calls
+// cancel, which cancels opts.Context and so the others, which are then
+// marked interrupted. The callbacks and log of opts are serialized, so
+// they never run concurrently.
+func renderAll(c cfg.Config, projectRoot string, opts Options, cancel context.CancelFunc) []documentResult {
+	results := make([]documentResult, len(c.Documents))
+	ctx := opts.ctx()
+	jobs := min(opts.jobs(), len(c.Documents))
+	if jobs > 1 {
+		opts = opts.serialized()
+	}
+	render := func(i int) {
+		doc := c.Documents[i]
+		if err := ctx.Err(); err != nil {
+			results[i] = documentResult{err: err, interrupted: true}
+			return
+		}
+		var err error
+		if doc.Hooks != nil {
+			err = runHooks(projectRoot, "preGenerate", doc.Hooks.PreGenerate, doc, opts)
+		}
+		if err == nil {
+			results[i].outs, err = renderIsolated(c, doc, projectRoot, opts)
+		}
+		results[i].err, results[i].interrupted = err, err != nil && ctx.Err() != nil
+		if policy := strings.ToLower(doc.FailurePolicy); err != nil && policy != "continue" && policy != "retry" {
+			cancel()
+		}
+	}
+
+	idx := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range idx {
+				render(i)
+			}
+		}()
+	}
+	for i := range c.Documents {
+		idx <- i
+	}
+	close(idx)
+	wg.Wait()
+	return results
+}
+
+// serialized returns o with Warn, Progress and Log behind one lock, for
+// documents rendered concurrently.
+func (o Options) serialized() Options {
+	mu := new(sync.Mutex)
+	if warn := o.Warn; warn != nil {
+		o.Warn = func(w Warning) {
+			mu.Lock()
+			defer mu.Unlock()
+			warn(w)
+		}
+	}
+	if progress := o.Progress; progress != nil {
+		o.Progress = func(e Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			progress(e)
+		}
+	}
+	log := o.Log
+	if log == nil {
+		log = os.Stderr
+	}
+	o.Log = &lockedWriter{mu: mu, w: log}
+	return o
+}
+
+// lockedWriter serializes writes to w.
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
@@ -0,0 +1,76 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// slowFS reads .go files slowly and closes reading on the first one.
+type slowFS struct {
+	fstest.MapFS
+	reads   atomic.Int32
+	once    sync.Once
+	reading chan struct{}
+}
+
+func (s *slowFS) read(name string) {
+	if strings.HasSuffix(name, ".go") {
+		s.once.Do(func() { close(s.reading) })
+		s.reads.Add(1)
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+func (s *slowFS) Open(name string) (fs.File, error) {
+	s.read(name)
+	return s.MapFS.Open(name)
+}
+
+func (s *slowFS) ReadFile(name string) ([]byte, error) {
+	s.read(name)
+	return s.MapFS.ReadFile(name)
+}
+
+// failingProvider fails once the other document is reading its files.
+type failingProvider struct {
+	reading chan struct{}
+}
+
+func (p failingProvider) Collect(context.Context, SourceRequest) (SourceResponse, error) {
+	<-p.reading
+	return SourceResponse{}, errors.New("boom")
+}
+
+func TestAbortAllStopsSiblings(t *testing.T) {
+	const files = 200
+	fsys := &slowFS{MapFS: fstest.MapFS{}, reading: make(chan struct{})}
+	for i := range files {
+		fsys.MapFS[fmt.Sprintf("src/f%03d.go", i)] = &fstest.MapFile{Data: []byte("package src\n")}
+	}
+	c := cfg.Config{Documents: []cfg.Document{
+		{OutputPath: "slow.md", Sources: []cfg.Source{{Type: "file", SourcePaths: []string{"src"}, FilePattern: cfg.Patterns{"*.go"}}}},
+		{OutputPath: "failing.md", FailurePolicy: "abortAll", Sources: []cfg.Source{{Type: "failing"}}},
+	}}
+	opts := Options{
+		Jobs:      2,
+		FS:        fsys,
+		Providers: map[string]SourceProvider{"failing": failingProvider{reading: fsys.reading}},
+	}
+	_, err := Render(c, t.TempDir(), opts)
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("Render = %v, want the failing document's error", err)
+	}
+	if n := fsys.reads.Load(); n >= files {
+		t.Errorf("the other document read all %d files after the failure", n)
+	}
+}
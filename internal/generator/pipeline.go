@@ -0,0 +1,112 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// defaultPipeline runs when a document lists no pipeline; its redact and
+// anonymize stages do nothing unless the document sets redact or anonymize.
+var defaultPipeline = []cfg.Stage{{Stage: "redact"}, {Stage: "assert"}, {Stage: "anonymize"}}
+
+// postProcessStage is the command stage a document's postProcess adds
+// after its pipeline.
+const postProcessStage = "postprocess"
+
+// runPipeline runs the stages of doc.Pipeline on every part of every
+// encoding in contents, in place, and returns the anonymization mapping,
+// if a stage made one. files are the embedded files, for assertions, and
+// sidecar is the config snapshot, which anonymization also covers.
+func runPipeline(doc cfg.Document, projectRoot string, targets []cfg.Output, contents [][]string, files []FileStat, sidecar *string, opts Options) (string, error) {
+	stages := doc.Pipeline
+	if len(stages) == 0 {
+		stages = defaultPipeline
+	} else {
+		// an anonymize stage listed explicitly always runs
+		doc.Anonymize = true
+	}
+	if doc.PostProcess != "" {
+		stages = append(slices.Clone(stages), cfg.Stage{Stage: postProcessStage, Cmd: doc.PostProcess, Timeout: doc.PostProcessTimeout})
+	}
+	mapping := ""
+	for _, st := range stages {
+		// each applies to the parts of one encoding
+		var apply func(d cfg.Document, parts []string) error
+		switch strings.ToLower(strings.TrimSpace(st.Stage)) {
+		case "redact":
+			apply = func(d cfg.Document, parts []string) error {
+				if len(st.Rules) > 0 {
+					d.Redact = st.Rules
+				}
+				for j := range parts {
+					var err error
+					if parts[j], err = redactDocument(d, parts[j], opts); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+		case "assert":
+			// assertions hold for the document as a whole
+			apply = func(d cfg.Document, parts []string) error {
+				return checkAssertions(d, strings.Join(parts, ""), files)
+			}
+		case "anonymize":
+			m, err := anonymizeDocument(opts.files, projectRoot, doc, contents, sidecar, opts)
+			if err != nil {
+				return "", err
+			}
+			mapping = m
+			continue
+		case "command", postProcessStage:
+			filter := cfg.Source{FilterCommand: st.Cmd, FilterTimeout: st.Timeout}
+			feature := "pipeline command stage"
+			if st.Stage == postProcessStage {
+				feature = "postProcess"
+			}
+			apply = func(d cfg.Document, parts []string) error {
+				for j := range parts {
+					out, _, err := runFilter(opts.ctx(), projectRoot, d.OutputPath, []byte(parts[j]), filter)
+					if err != nil {
+						var ue *unavailableError
+						if errors.As(err, &ue) {
+							ue.feature = feature
+						}
+						if err := opts.degrade.handle(err, "stage skipped"); err != nil {
+							return fmt.Errorf("%s: %w", feature, err)
+						}
+						return nil
+					}
+					parts[j] = string(out)
+				}
+				return nil
+			}
+		case "replace":
+			re, err := regexp.Compile(st.Pattern)
+			if err != nil {
+				return "", fmt.Errorf("pipeline replace stage: invalid pattern %q: %w", st.Pattern, err)
+			}
+			apply = func(_ cfg.Document, parts []string) error {
+				for j := range parts {
+					parts[j] = re.ReplaceAllString(parts[j], st.Replacement)
+				}
+				return nil
+			}
+		default:
+			return "", fmt.Errorf("unknown pipeline stage %q (expected one of %s)", st.Stage, strings.Join(cfg.StageTypes, ", "))
+		}
+		for i, parts := range contents {
+			d := doc
+			d.OutputPath = targets[i].Path
+			if err := apply(d, parts); err != nil {
+				return "", err
+			}
+		}
+	}
+	return mapping, nil
+}
@@ -0,0 +1,180 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// PluginProtocol is the version of the request plugins receive; it changes
+// only when a plugin written for an older one would misread a request.
+const PluginProtocol = 1
+
+// SourceProvider implements a source type outside the generator, such as a
+// ticket tracker or an internal wiki. Collect returns what one source of
+// its type embeds; the generator renders the items like files, through the
+// source's template and file processing settings. Providers come from the
+// config's plugins (see cfg.Plugin) or from Options.Providers.
+type SourceProvider interface {
+	Collect(ctx context.Context, req SourceRequest) (SourceResponse, error)
+}
+
+// SourceRequest asks a SourceProvider for one source. Plugins receive it as
+// JSON on stdin.
+type SourceRequest struct {
+	Protocol    int               `json:"protocol"`         // PluginProtocol
+	Type        string            `json:"type"`             // the source's type
+	Params      map[string]any    `json:"params,omitempty"` // the source's params
+	ProjectRoot string            `json:"projectRoot"`      // absolute
+	Document    string            `json:"document"`         // output path of the document
+	RunID       string            `json:"runId,omitempty"`
+	Vars        map[string]string `json:"vars,omitempty"` // the document's variables
+}
+
+// SourceResponse is what a SourceProvider returns. Plugins write it as JSON
+// on stdout.
+type SourceResponse struct {
+	Items    []SourceItem `json:"items"`
+	Warnings []string     `json:"warnings,omitempty"` // reported like skipped files
+	Error    string       `json:"error,omitempty"`    // fails the source, as a non-zero exit does
+}
+
+// SourceItem is one piece of content a SourceProvider returns.
+type SourceItem struct {
+	Path     string    `json:"path"`               // label the item is shown under, e.g. "PAY-123" or a URL
+	Lang     string    `json:"lang,omitempty"`     // code fence language; empty detects it from path
+	Content  string    `json:"content"`            // the text to embed
+	Modified time.Time `json:"modified,omitempty"` // RFC 3339; shown where templates use .ModTime
+}
+
+// pluginProvider runs a configured plugin program, once per source.
+type pluginProvider struct {
+	name   string
+	plugin cfg.Plugin
+}
+
+// providers returns the source types the run knows besides the built-in
+// ones: the config's plugins, with extra (Options.Providers) winning.
+func providers(plugins map[string]cfg.Plugin, extra map[string]SourceProvider) map[string]SourceProvider {
+	ps := make(map[string]SourceProvider, len(plugins)+len(extra))
+	for name, p := range plugins {
+		ps[strings.ToLower(name)] = pluginProvider{name: name, plugin: p}
+	}
+	for name, p := range extra {
+		ps[strings.ToLower(name)] = p
+	}
+	return ps
+}
+
+func (p pluginProvider) Collect(parent context.Context, req SourceRequest) (SourceResponse, error) {
+	var resp SourceResponse
+	if strings.TrimSpace(p.plugin.Cmd) == "" {
+		return resp, errors.New("cmd is required")
+	}
+	in, err := json.Marshal(req)
+	if err != nil {
+		return resp, fmt.Errorf("encode request: %w", err)
+	}
+
+	ctx := parent
+	if p.plugin.Timeout != "" {
+		d, err := time.ParseDuration(p.plugin.Timeout)
+		if err != nil {
+			return resp, fmt.Errorf("invalid timeout %q: %w", p.plugin.Timeout, err)
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, p.plugin.Cmd, p.plugin.Args...)
+	cmd.Dir = req.ProjectRoot
+	cmd.Stdin = bytes.NewReader(in)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	runErr := cmd.Run()
+	if err := parent.Err(); err != nil {
+		return resp, err
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		runErr = fmt.Errorf("timed out after %s", p.plugin.Timeout)
+	}
+	if runErr != nil && toolMissing(runErr) {
+		return resp, &unavailableError{feature: "plugin " + p.name, detail: fmt.Sprintf("%s: %v", p.plugin.Cmd, runErr)}
+	}
+	if runErr != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return resp, fmt.Errorf("%s: %w: %s", p.plugin.Cmd, runErr, msg)
+		}
+		return resp, fmt.Errorf("%s: %w", p.plugin.Cmd, runErr)
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return resp, fmt.Errorf("%s: decode response: %w", p.plugin.Cmd, err)
+	}
+	return resp, nil
+}
+
+// collectSource asks provider for src. With src.CacheTTL, a successful
+// response is kept in the user cache dir like command output (see
+// runCommandSource); src.Timeout bounds the call.
+func collectSource(parent context.Context, provider SourceProvider, req SourceRequest, src cfg.Source, refresh bool) (SourceResponse, error) {
+	var resp SourceResponse
+	file := ""
+	if src.CacheTTL != "" {
+		ttl, err := time.ParseDuration(src.CacheTTL)
+		if err != nil {
+			return resp, fmt.Errorf("%s source: invalid cacheTTL %q: %w", src.Type, src.CacheTTL, err)
+		}
+		file = cacheFile("plugin", sourceKey(req.ProjectRoot, src))
+		if data, _, ok := readCache(file, ttl); ok && !refresh && json.Unmarshal(data, &resp) == nil {
+			return resp, nil
+		}
+	}
+
+	ctx := parent
+	if src.Timeout != "" {
+		d, err := time.ParseDuration(src.Timeout)
+		if err != nil {
+			return resp, fmt.Errorf("%s source: invalid timeout %q: %w", src.Type, src.Timeout, err)
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+	resp, err := provider.Collect(ctx, req)
+	if err == nil && resp.Error != "" {
+		err = errors.New(resp.Error)
+	}
+	if err != nil {
+		if perr := parent.Err(); perr != nil {
+			return resp, perr
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			return resp, fmt.Errorf("%s source: timed out after %s", src.Type, src.Timeout)
+		}
+		var unavailable *unavailableError
+		if errors.As(err, &unavailable) {
+			return resp, err
+		}
+		return resp, fmt.Errorf("%s source: %w", src.Type, err)
+	}
+	for i, item := range resp.Items {
+		if strings.TrimSpace(item.Path) == "" {
+			return resp, fmt.Errorf("%s source: item %d has no path", src.Type, i+1)
+		}
+	}
+	if data, err := json.Marshal(resp); err == nil {
+		// caching is best effort
+		_ = writeCache(file, data)
+	}
+	return resp, nil
+}
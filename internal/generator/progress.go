@@ -0,0 +1,157 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Progress event kinds, in the order a document emits them.
+const (
+	EventDocumentStarted  = "document_started"
+	EventSourceCollected  = "source_collected"
+	EventFileEmbedded     = "file_embedded"
+	EventWarning          = "warning"
+	EventDocumentFinished = "document_finished"
+	EventDocumentFailed   = "document_failed" // instead of document_finished, with failurePolicy continue or retry
+)
+
+// Event reports progress of a run as it happens, for GUIs and editor
+// plugins that show live progress (see Options.Progress).
+type Event struct {
+	Event    string          `json:"event"`
+	Time     time.Time       `json:"time"`
+	RunID    string          `json:"runId,omitempty"`
+	Document string          `json:"document"`
+	Path     string          `json:"path,omitempty"`  // file_embedded and warning; source_collected: the source paths
+	Files    int             `json:"files,omitempty"` // source_collected: files matched
+	Bytes    int             `json:"bytes,omitempty"` // file_embedded: size of the embedded content
+	Msg      string          `json:"msg,omitempty"`   // warning and document_failed
+	Stats    *DocumentResult `json:"stats,omitempty"` // document_finished
+}
+
+func (o Options) progress(e Event) {
+	if o.Progress == nil {
+		return
+	}
+	e.Time = time.Now()
+	e.RunID = o.RunID
+	o.Progress(e)
+}
+
+// NDJSONProgress returns an Options.Progress func that writes every event
+// to w as one line of JSON. Write errors are ignored, so a reader that goes
+// away does not fail the run.
+func NDJSONProgress(w io.Writer) func(Event) {
+	var mu sync.Mutex
+	return func(e Event) {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		w.Write(append(line, '\n'))
+	}
+}
+
+// LogProgress returns an Options.Progress func that logs every event to l:
+// documents at info level, sources and files at debug level, warnings and
+// failed documents at warn and error level.
+func LogProgress(l *slog.Logger) func(Event) {
+	return func(e Event) {
+		switch e.Event {
+		case EventDocumentStarted:
+			l.Info("document started", "document", e.Document)
+		case EventSourceCollected:
+			l.Debug("source collected", "document", e.Document, "paths", e.Path, "files", e.Files)
+		case EventFileEmbedded:
+			l.Debug("file embedded", "document", e.Document, "path", e.Path, "bytes", e.Bytes)
+		case EventWarning:
+			l.Warn(e.Msg, "document", e.Document, "path", e.Path)
+		case EventDocumentFinished:
+			attrs := []any{"document", e.Document}
+			if s := e.Stats; s != nil {
+				attrs = append(attrs, "files", len(s.Files), "skipped", len(s.Skipped), "bytes", s.Bytes, "tokens", s.Tokens, "took", time.Duration(s.DurationMS)*time.Millisecond)
+			}
+			l.Info("document finished", attrs...)
+		case EventDocumentFailed:
+			l.Error("document failed", "document", e.Document, "error", e.Msg)
+		}
+	}
+}
+
+// StatusLine shows the progress of a run on one line of a terminal, which
+// it rewrites as files are scanned and embedded; each finished document
+// leaves a summary line. Warnings are printed above the status line.
+type StatusLine struct {
+	w  io.Writer
+	mu sync.Mutex
+
+	doc              string
+	scanned, written int // files
+	bytes            int
+	shown            time.Time
+}
+
+// NewStatusLine returns a StatusLine writing to w, usually a terminal's
+// stderr.
+func NewStatusLine(w io.Writer) *StatusLine {
+	return &StatusLine{w: w}
+}
+
+// Progress is an Options.Progress func.
+func (s *StatusLine) Progress(e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch e.Event {
+	case EventDocumentStarted:
+		s.doc, s.scanned, s.written, s.bytes = e.Document, 0, 0, 0
+	case EventSourceCollected:
+		s.scanned += e.Files
+	case EventFileEmbedded:
+		s.written++
+		s.bytes += e.Bytes
+	case EventDocumentFinished:
+		s.clear()
+		if st := e.Stats; st != nil {
+			fmt.Fprintf(s.w, "%s: %d files embedded, %s written\n", e.Document, len(st.Files), humanBytes(st.Bytes))
+		}
+		return
+	case EventDocumentFailed:
+		s.clear()
+		return
+	default:
+		return
+	}
+	// redraw at most ten times a second
+	if now := time.Now(); now.Sub(s.shown) >= 100*time.Millisecond {
+		s.shown = now
+		fmt.Fprintf(s.w, "\r\x1b[K%s: %d files scanned, %d embedded, %s", s.doc, s.scanned, s.written, humanBytes(s.bytes))
+	}
+}
+
+// Warn is an Options.Warn func printing w above the status line.
+func (s *StatusLine) Warn(w Warning) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clear()
+	fmt.Fprintf(s.w, "warning: %s\n", w)
+}
+
+// Done clears the status line, e.g. before an error is printed.
+func (s *StatusLine) Done() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clear()
+}
+
+func (s *StatusLine) clear() {
+	if !s.shown.IsZero() {
+		fmt.Fprint(s.w, "\r\x1b[K")
+		s.shown = time.Time{}
+	}
+}
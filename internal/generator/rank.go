@@ -0,0 +1,56 @@
+package generator
+
+import (
+	"cmp"
+	"path"
+	"slices"
+	"strings"
+)
+
+// keyFileNames are base names that describe a project rather than
+// implement it: manifests, build files and configuration.
+var keyFileNames = setOf("go.mod", "package.json", "pyproject.toml", "setup.py", "Cargo.toml",
+	"composer.json", "Gemfile", "pom.xml", "build.gradle", "Makefile", "Dockerfile",
+	"docker-compose.yml", "docker-compose.yaml", "tsconfig.json", "config.yaml", "config.yml")
+
+// isKeyFile reports whether the slash-separated path rel is a README
+// anywhere or a manifest, build or config file at the root.
+func isKeyFile(rel string) bool {
+	dir, base := path.Split(rel)
+	if strings.HasPrefix(strings.ToUpper(base), "README") {
+		return true
+	}
+	return dir == "" && keyFileNames[base]
+}
+
+// rankFiles orders files for rank: auto, most important first: each
+// scores 1 for being an entry point, 1 for being a README or a root
+// manifest or config file, and its fan-in and git changes relative to the
+// highest of the set, as classifyFiles counts them. Ties keep the order
+// files came in. With top above 0 only that many are kept.
+func rankFiles(fsys sourceFS, projectRoot string, files []string, history bool, degrade *degrader, top int) ([]string, error) {
+	classes, err := classifyFiles(fsys, projectRoot, files, history, degrade)
+	if err != nil {
+		return nil, err
+	}
+	score := make(map[string]float64, len(classes))
+	for _, c := range classes {
+		score[c.Path] = c.Score
+	}
+	for _, f := range files {
+		if isEntrypoint(f) {
+			score[f]++
+		}
+		if isKeyFile(f) {
+			score[f]++
+		}
+	}
+	out := slices.Clone(files)
+	slices.SortStableFunc(out, func(a, b string) int {
+		return cmp.Compare(score[b], score[a])
+	})
+	if top > 0 && len(out) > top {
+		out = out[:top]
+	}
+	return out, nil
+}
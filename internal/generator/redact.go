@@ -0,0 +1,31 @@
+package generator
+
+import (
+	cfg "go_project_context_maker/internal/config"
+	"go_project_context_maker/internal/redact"
+)
+
+// redactDocument applies the document's redaction rules to the rendered
+// content and reports how many matches each rule replaced.
+func redactDocument(doc cfg.Document, content string, opts Options) (string, error) {
+	if len(doc.Redact) == 0 {
+		return content, nil
+	}
+	rules := make([]redact.Rule, len(doc.Redact))
+	for i, r := range doc.Redact {
+		rules[i] = redact.Rule{Name: r.Name, Pattern: r.Pattern}
+	}
+	rd, err := redact.New(rules)
+	if err != nil {
+		return "", err
+	}
+	content, counts := rd.Apply(content)
+	if len(counts) > 0 {
+		total := 0
+		for _, n := range counts {
+			total += n
+		}
+		opts.logf("%s: redacted %d secret(s): %s\n", doc.OutputPath, total, redact.Summary(counts))
+	}
+	return content, nil
+}
@@ -0,0 +1,74 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+// excerptLength is the longest head excerpt shown in reference mode, in characters.
+const excerptLength = 80
+
+// referenceList renders files (relative to projectRoot) for contentMode:
+// reference, one line each with the size and the first non-blank line:
+//
+//	internal/api/handler.go   4.2 KiB  // Package api serves the public HTTP API.
+//
+// Files dropped by contents (which may be nil) are counted in dropped.
+func referenceList(fsys sourceFS, projectRoot string, files []string, contents *contentFilter, jobs int) (list []byte, kept, dropped int, err error) {
+	results := readFiles(files, jobs, func(rel string) fileResult {
+		r := fileResult{rel: rel}
+		abs := filepath.Join(projectRoot, rel)
+		if r.info, r.err = fsys.Stat(abs); r.err != nil {
+			return r
+		}
+		if r.data, r.err = fsys.ReadFile(abs); r.err != nil {
+			return r
+		}
+		if contents != nil {
+			keep, err := contents.keepData(rel, r.data)
+			r.err, r.filtered = err, err == nil && !keep
+		}
+		return r
+	})
+
+	width := 0
+	for _, r := range results {
+		width = max(width, utf8.RuneCountInString(r.rel))
+	}
+	var b bytes.Buffer
+	for _, r := range results {
+		if r.err != nil {
+			return nil, 0, 0, fmt.Errorf("reference %s: %w", r.rel, r.err)
+		}
+		if r.filtered {
+			dropped++
+			continue
+		}
+		fmt.Fprintf(&b, "%-*s  %9s  %s\n", width, r.rel, humanBytes(int(r.info.Size())), headExcerpt(r.data))
+		kept++
+	}
+	return b.Bytes(), kept, dropped, nil
+}
+
+// headExcerpt returns the first non-blank line of data, trimmed and cut to
+// excerptLength characters.
+func headExcerpt(data []byte) string {
+	if isBinary(data) {
+		return "(binary)"
+	}
+	for off := 0; off < len(data); {
+		end := lineEnd(data, off)
+		line := bytes.TrimSpace(data[off:end])
+		off = end
+		if len(line) == 0 {
+			continue
+		}
+		if utf8.RuneCount(line) > excerptLength {
+			return string(line[:runeOffset(line, excerptLength)]) + "…"
+		}
+		return string(line)
+	}
+	return "(empty)"
+}
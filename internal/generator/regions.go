@@ -0,0 +1,62 @@
+package generator
+
+import (
+	"bytes"
+	"regexp"
+	"slices"
+)
+
+// regionMarkerRe matches the "gpcm:begin <label>" and "gpcm:end [label]"
+// markers, written in whatever comment syntax the file uses.
+var regionMarkerRe = regexp.MustCompile(`\bgpcm:(begin|end)\b[ \t]*([\w.-]*)`)
+
+// extractRegions returns the lines of data inside regions marked with one
+// of labels ("*" selects every region), without the marker lines, and the
+// 1-based line the first of them starts on. Regions nest; "gpcm:end" closes
+// the innermost open one, or the one it names, and a region left open runs
+// to the end of the file. Separate regions are joined with a "..." line.
+// found is false when no selected region has any line.
+func extractRegions(data []byte, labels []string) (out []byte, first int, found bool) {
+	var b bytes.Buffer
+	var open []string // labels of the enclosing regions, innermost last
+	selected := func() bool {
+		return slices.ContainsFunc(open, func(l string) bool {
+			return slices.Contains(labels, "*") || slices.Contains(labels, l)
+		})
+	}
+	gap := false
+	line := 0
+	for len(data) > 0 {
+		end := lineEnd(data, 0)
+		text := data[:end]
+		data = data[end:]
+		line++
+
+		if m := regionMarkerRe.FindSubmatch(text); m != nil {
+			if string(m[1]) == "begin" {
+				open = append(open, string(m[2]))
+			} else if i := slices.Index(open, string(m[2])); len(m[2]) > 0 && i >= 0 {
+				open = open[:i]
+			} else if len(open) > 0 {
+				open = open[:len(open)-1]
+			}
+			gap = gap || !selected()
+			continue
+		}
+		if !selected() {
+			gap = true
+			continue
+		}
+		if !found {
+			first, found = line, true
+		} else if gap {
+			b.WriteString("...\n")
+		}
+		gap = false
+		b.Write(text)
+	}
+	if found && !bytes.HasSuffix(b.Bytes(), []byte{'\n'}) {
+		b.WriteByte('\n')
+	}
+	return b.Bytes(), first, found
+}
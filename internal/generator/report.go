@@ -0,0 +1,142 @@
+package generator
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go_project_context_maker/internal/models"
+)
+
+func newFileStat(rel string, data []byte) FileStat {
+	lines := bytes.Count(data, []byte{'\n'})
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		lines++
+	}
+	sum := sha256.Sum256(data)
+	return FileStat{Path: rel, Bytes: len(data), Lines: lines, SHA256: hex.EncodeToString(sum[:])}
+}
+
+// EstimateTokens approximates the token count of text for common LLM
+// tokenizers (roughly four bytes per token for code and English prose).
+func EstimateTokens(n int) int {
+	return (n + 3) / 4
+}
+
+// WriteDryRunReport prints, per document, the embedded files with their sizes
+// and the total output size, without writing any document.
+func WriteDryRunReport(w io.Writer, outs []Output) {
+	var total int
+	for _, o := range outs {
+		size := len(o.Content)
+		total += size
+		fmt.Fprintf(w, "%s: %d files, %s, ~%d tokens\n", o.Path, len(o.Files), humanBytes(size), EstimateTokens(size))
+		for _, f := range o.Files {
+			fmt.Fprintf(w, "  %10s %7d lines %8d tok  %s\n", humanBytes(f.Bytes), f.Lines, EstimateTokens(f.Bytes), f.Path)
+		}
+	}
+	fmt.Fprintf(w, "total: %d documents, %s, ~%d tokens\n", len(outs), humanBytes(total), EstimateTokens(total))
+}
+
+// WriteCosts prints, per document, the estimated tokens and what sending
+// them as input costs with each of ms, at the models' input prices.
+func WriteCosts(w io.Writer, outs []Output, ms []models.Model) {
+	size := 0
+	line := func(name string, tokens int) {
+		fmt.Fprintf(w, "%s: ~%d tokens", name, tokens)
+		for _, m := range ms {
+			fmt.Fprintf(w, ", %s $%.4f", m.Name, m.InputCost(tokens))
+		}
+		fmt.Fprintln(w)
+	}
+	for _, o := range outs {
+		size += len(o.Content)
+		line(o.Path, EstimateTokens(len(o.Content)))
+	}
+	if len(outs) > 1 {
+		line("total", EstimateTokens(size))
+	}
+}
+
+// WriteMarkdownReport writes the generation report as a markdown table, for
+// CI job summaries.
+func WriteMarkdownReport(w io.Writer, outs []Output, runID string) {
+	fmt.Fprintf(w, "### Context documents\n\n")
+	if runID != "" {
+		fmt.Fprintf(w, "Run ID: `%s`\n\n", runID)
+	}
+	fmt.Fprintf(w, "| Document | Files | Size | Tokens |\n|---|---:|---:|---:|\n")
+	var total int
+	for _, o := range outs {
+		size := len(o.Content)
+		total += size
+		fmt.Fprintf(w, "| `%s` | %d | %s | ~%d |\n", o.Path, len(o.Files), humanBytes(size), EstimateTokens(size))
+	}
+	fmt.Fprintf(w, "| **Total** | | %s | ~%d |\n\n", humanBytes(total), EstimateTokens(total))
+}
+
+func humanBytes(n int) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := unit, 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// footerText summarizes the document compactly so the reader (and the LLM)
+// knows the bundle's scope: files per language, estimated tokens (docSize is
+// the document size so far), how many matched files were left out or
+// suppressed as duplicates (dedupeFiles), and how long generation took
+// (left out when took is 0, for deterministic documents).
+func footerText(files []FileStat, excluded, duplicates, docSize int, took time.Duration) string {
+	langs := make(map[string]int)
+	for _, f := range files {
+		lang := detectLang(f.Path)
+		if lang == "" {
+			lang = strings.TrimPrefix(strings.ToLower(filepath.Ext(f.Path)), ".")
+		}
+		if lang == "" {
+			lang = "other"
+		}
+		langs[lang]++
+	}
+	names := make([]string, 0, len(langs))
+	for l := range langs {
+		names = append(names, l)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if langs[names[i]] != langs[names[j]] {
+			return langs[names[i]] > langs[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	parts := make([]string, len(names))
+	for i, l := range names {
+		parts[i] = fmt.Sprintf("%s %d", l, langs[l])
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Bundle stats: %d files", len(files))
+	if len(parts) > 0 {
+		fmt.Fprintf(&b, " (%s)", strings.Join(parts, ", "))
+	}
+	fmt.Fprintf(&b, " · ~%d tokens · %d excluded", EstimateTokens(docSize), excluded)
+	if duplicates > 0 {
+		fmt.Fprintf(&b, " · %d duplicates suppressed", duplicates)
+	}
+	if took > 0 {
+		fmt.Fprintf(&b, " · generated in %s", took.Round(time.Millisecond))
+	}
+	return b.String()
+}
@@ -0,0 +1,106 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// skippedPrefix starts the message of warnings about files left out.
+const skippedPrefix = "skipped: "
+
+// Result summarizes a run per document, for `generate -report json` and CI
+// gates.
+type Result struct {
+	RunID     string           `json:"runId"`
+	Documents []DocumentResult `json:"documents"`
+}
+
+// DocumentResult describes one document of a run.
+type DocumentResult struct {
+	Name           string        `json:"name"`
+	Outputs        []string      `json:"outputs"`
+	Files          []string      `json:"files"`             // embedded files, in output order
+	Skipped        []SkippedFile `json:"skipped,omitempty"` // files left out, with the reason
+	Warnings       []Warning     `json:"warnings,omitempty"`
+	Unavailable    []Warning     `json:"unavailable,omitempty"` // configured features left out on this machine
+	NothingMatched bool          `json:"nothingMatched,omitempty"`
+	Bytes          int           `json:"bytes"`  // written to all outputs
+	Tokens         int           `json:"tokens"` // estimated for the first output
+	DurationMS     int64         `json:"durationMs"`
+}
+
+// SkippedFile is a file a document left out.
+type SkippedFile struct {
+	Source int    `json:"source,omitempty"` // 1-based index of the source that left it out, when known
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// NewResult groups rendered outputs by document.
+func NewResult(runID string, outs []Output) Result {
+	res := Result{RunID: runID, Documents: []DocumentResult{}}
+	for i := 0; i < len(outs); {
+		first := outs[i]
+		d := DocumentResult{
+			Name:           first.Document,
+			Files:          []string{},
+			NothingMatched: first.NothingMatched,
+			DurationMS:     first.Took.Milliseconds(),
+		}
+		for _, w := range first.Warnings {
+			if reason, ok := strings.CutPrefix(w.Msg, skippedPrefix); ok {
+				d.Skipped = append(d.Skipped, SkippedFile{Source: w.Source, Path: w.Path, Reason: reason})
+			} else if strings.HasPrefix(w.Msg, unavailablePrefix) {
+				d.Unavailable = append(d.Unavailable, w)
+			} else {
+				d.Warnings = append(d.Warnings, w)
+			}
+		}
+		for ; i < len(outs) && outs[i].Document == first.Document; i++ {
+			o := outs[i]
+			d.Outputs = append(d.Outputs, o.Path)
+			d.Bytes += o.Len()
+			// further outputs repeat the files of the first one
+			if o.target == 0 {
+				d.Tokens += EstimateTokens(o.Len())
+				for _, f := range o.Files {
+					d.Files = append(d.Files, f.Path)
+				}
+			}
+		}
+		res.Documents = append(res.Documents, d)
+	}
+	return res
+}
+
+// Skipped returns the number of files left out across all documents.
+func (r Result) Skipped() int {
+	n := 0
+	for _, d := range r.Documents {
+		n += len(d.Skipped)
+	}
+	return n
+}
+
+// NothingMatched returns the documents whose sources matched no files.
+func (r Result) NothingMatched() []string {
+	var names []string
+	for _, d := range r.Documents {
+		if d.NothingMatched {
+			names = append(names, d.Name)
+		}
+	}
+	return names
+}
+
+// WriteJSON writes r as indented JSON.
+func (r Result) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return fmt.Errorf("write report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package generator
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// sourceRoot is the directory a source's sourcePaths, excludePaths and
+// ignore files are relative to: the project root, or the source's root,
+// such as a sibling repository. Files below it keep paths relative to the
+// project root ("../shared-lib/x.go") while rendering, and are shown with
+// the root's name instead ("shared-lib/x.go").
+type sourceRoot struct {
+	dir   string // the directory, as given or joined to the project root
+	rel   string // dir relative to the project root, slash-separated; "" for the project root
+	label string // the base name of dir
+}
+
+// newSourceRoot resolves the root of src.
+func newSourceRoot(projectRoot string, src cfg.Source) (sourceRoot, error) {
+	if src.Root == "" {
+		return sourceRoot{dir: projectRoot}, nil
+	}
+	dir := src.RootDir(projectRoot)
+	rootAbs, err := filepath.Abs(projectRoot)
+	if err != nil {
+		return sourceRoot{}, fmt.Errorf("resolve root: %w", err)
+	}
+	dirAbs, err := filepath.Abs(dir)
+	if err != nil {
+		return sourceRoot{}, fmt.Errorf("resolve root %s: %w", src.Root, err)
+	}
+	rel, err := filepath.Rel(rootAbs, dirAbs)
+	if err != nil {
+		return sourceRoot{}, fmt.Errorf("root %s: not on the volume of the project root %s", src.Root, rootAbs)
+	}
+	if rel == "." {
+		return sourceRoot{dir: projectRoot}, nil
+	}
+	return sourceRoot{dir: dir, rel: filepath.ToSlash(rel), label: filepath.Base(dirAbs)}, nil
+}
+
+// fromRoot turns p, relative to the source root, into a path relative to
+// the project root, keeping a trailing slash.
+func (r sourceRoot) fromRoot(p string) string {
+	if r.rel == "" {
+		return p
+	}
+	joined := path.Join(r.rel, p)
+	if strings.HasSuffix(p, "/") {
+		joined += "/"
+	}
+	return joined
+}
+
+// show returns rel, relative to the project root, as it is shown: below
+// the root's name when it lies in the source root.
+func (r sourceRoot) show(rel string) (string, bool) {
+	if r.rel == "" {
+		return rel, false
+	}
+	rest, ok := strings.CutPrefix(rel, r.rel+"/")
+	if !ok {
+		return rel, false
+	}
+	return r.label + "/" + rest, true
+}
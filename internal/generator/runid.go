@@ -0,0 +1,17 @@
+package generator
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// NewRunID returns a random RFC 4122 version 4 UUID.
+func NewRunID() (string, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		return "", fmt.Errorf("generate run id: %w", err)
+	}
+	u[6] = (u[6] & 0x0f) | 0x40
+	u[8] = (u[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16]), nil
+}
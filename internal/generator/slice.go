@@ -0,0 +1,180 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// fileSlice is the part of a collected file addressed by a sourcePaths
+// entry such as "server.go:120-240" or "server.go#Handler".
+type fileSlice struct {
+	rel string
+	sel *cfg.Selector
+}
+
+// splitSelectors strips selectors from sourcePaths entries. It returns the
+// plain paths to collect and, keyed by the slash-separated path relative to
+// projectRoot, the selectors given for each file in order.
+func splitSelectors(projectRoot string, entries []string) ([]string, map[string][]*cfg.Selector, error) {
+	rootAbs, err := filepath.Abs(projectRoot)
+	if err != nil {
+		return nil, nil, fmt.Errorf("resolve root: %w", err)
+	}
+	paths := make([]string, 0, len(entries))
+	var selectors map[string][]*cfg.Selector
+	for _, e := range entries {
+		p, sel, err := cfg.SplitSelector(e)
+		if err != nil {
+			return nil, nil, err
+		}
+		paths = append(paths, p)
+		if sel == nil {
+			continue
+		}
+		if hasGlob(p) {
+			return nil, nil, fmt.Errorf("%q: line ranges and symbols need a file path, not a glob", e)
+		}
+		rel, err := filepath.Rel(rootAbs, resolveUnder(rootAbs, p))
+		if err != nil {
+			return nil, nil, err
+		}
+		if selectors == nil {
+			selectors = make(map[string][]*cfg.Selector)
+		}
+		key := filepath.ToSlash(rel)
+		selectors[key] = append(selectors[key], sel)
+	}
+	return paths, selectors, nil
+}
+
+// sliceItems expands files into the items to embed: a file with selectors
+// becomes one item per selector, labeled "path:120-240" or "path#Name".
+func sliceItems(files []string, selectors map[string][]*cfg.Selector) ([]string, map[string]fileSlice) {
+	if len(selectors) == 0 {
+		return files, nil
+	}
+	items := make([]string, 0, len(files))
+	slices := make(map[string]fileSlice)
+	for _, rel := range files {
+		sels := selectors[rel]
+		if len(sels) == 0 {
+			items = append(items, rel)
+			continue
+		}
+		for _, sel := range sels {
+			label := rel + sel.Raw
+			if _, dup := slices[label]; dup {
+				continue
+			}
+			items = append(items, label)
+			slices[label] = fileSlice{rel: rel, sel: sel}
+		}
+	}
+	return items, slices
+}
+
+// extract returns the addressed lines of data and the number of the first one.
+func (s fileSlice) extract(data []byte) ([]byte, int, error) {
+	if s.sel.Symbol != "" {
+		if !strings.EqualFold(filepath.Ext(s.rel), ".go") {
+			return nil, 0, fmt.Errorf("%s%s: symbols can only be looked up in Go files", s.rel, s.sel.Raw)
+		}
+		return goSymbol(s.rel, data, s.sel.Symbol)
+	}
+	start := nthLineEnd(data, s.sel.Start-1)
+	if start >= len(data) {
+		return nil, 0, fmt.Errorf("%s%s: file has only %d lines", s.rel, s.sel.Raw, bytes.Count(data, []byte{'\n'}))
+	}
+	return data[start:nthLineEnd(data, s.sel.End)], s.sel.Start, nil
+}
+
+// goSymbol returns the full lines declaring name in a Go file, including its
+// doc comment. name is a function, type, variable or constant, or
+// "Type.Method".
+func goSymbol(rel string, data []byte, name string) ([]byte, int, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, rel, data, parser.ParseComments)
+	if err != nil {
+		return nil, 0, fmt.Errorf("parse %s: %w", rel, err)
+	}
+
+	var node ast.Node
+	var doc *ast.CommentGroup
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			full := d.Name.Name
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				full = receiverName(d.Recv.List[0].Type) + "." + full
+			}
+			if full == name {
+				node, doc = d, d.Doc
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				var names []*ast.Ident
+				var specDoc *ast.CommentGroup
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					names, specDoc = []*ast.Ident{s.Name}, s.Doc
+				case *ast.ValueSpec:
+					names, specDoc = s.Names, s.Doc
+				}
+				for _, id := range names {
+					if id.Name != name {
+						continue
+					}
+					// a declaration of its own is shown with its keyword
+					if d.Lparen.IsValid() {
+						node, doc = spec, specDoc
+					} else {
+						node, doc = d, d.Doc
+					}
+				}
+			}
+		}
+		if node != nil {
+			break
+		}
+	}
+	if node == nil {
+		return nil, 0, fmt.Errorf("%s: symbol %q not found", rel, name)
+	}
+
+	startPos := node.Pos()
+	if doc != nil {
+		startPos = doc.Pos()
+	}
+	start := fset.Position(startPos)
+	end := fset.Position(node.End()).Offset
+	from := bytes.LastIndexByte(data[:start.Offset], '\n') + 1
+	return data[from:lineEnd(data, end)], start.Line, nil
+}
+
+// receiverName returns the type name of a method receiver, without pointer
+// or type parameters.
+func receiverName(expr ast.Expr) string {
+	for {
+		switch t := expr.(type) {
+		case *ast.StarExpr:
+			expr = t.X
+		case *ast.IndexExpr:
+			expr = t.X
+		case *ast.IndexListExpr:
+			expr = t.X
+		case *ast.ParenExpr:
+			expr = t.X
+		case *ast.Ident:
+			return t.Name
+		default:
+			return ""
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package generator
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// SidecarSuffix is appended to a document's output path to name its
+// configuration sidecar (configSnapshot: sidecar).
+const SidecarSuffix = ".config.yaml"
+
+// snapshotMode returns the document's configSnapshot setting, falling back
+// to the top-level one.
+func snapshotMode(c cfg.Config, doc cfg.Document) (string, error) {
+	mode := strings.ToLower(strings.TrimSpace(doc.ConfigSnapshot))
+	if mode == "" {
+		mode = strings.ToLower(strings.TrimSpace(c.ConfigSnapshot))
+	}
+	switch mode {
+	case "", "none", "appendix", "sidecar":
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown configSnapshot %q (expected appendix, sidecar or none)", mode)
+}
+
+// Effective returns c with every document's inherited settings and the
+// defaults the generator applies filled in, and projectPath replaced by the
+// resolved projectRoot. Top-level settings that documents inherit are moved
+// into the documents.
+func Effective(c cfg.Config, projectRoot string) (cfg.Config, error) {
+	eff := cfg.Config{
+		ProjectPath: filepath.ToSlash(projectRoot),
+		WalkBackend: c.WalkBackend,
+		Documents:   make([]cfg.Document, len(c.Documents)),
+	}
+	if eff.WalkBackend == "" {
+		eff.WalkBackend = "std"
+	}
+	for i, doc := range c.Documents {
+		d, err := effectiveDocument(c, doc)
+		if err != nil {
+			return cfg.Config{}, err
+		}
+		eff.Documents[i] = d
+	}
+	return eff, nil
+}
+
+func effectiveDocument(c cfg.Config, doc cfg.Document) (cfg.Document, error) {
+	if len(doc.Outputs) > 0 {
+		doc.Outputs = append([]cfg.Output(nil), doc.Outputs...)
+		for i, o := range doc.Outputs {
+			doc.Outputs[i].Format = resolveFormat(o.Format, o.Path)
+		}
+	} else {
+		doc.OutputFormat = resolveFormat(doc.OutputFormat, doc.OutputPath)
+	}
+	if doc.Template == "" {
+		doc.Template = "default"
+	}
+	if doc.LicensePolicy == nil {
+		doc.LicensePolicy = c.LicensePolicy
+	}
+	if doc.Redact == nil {
+		doc.Redact = c.Redact
+	}
+	doc.Deterministic = doc.Deterministic || c.Deterministic
+	mode, err := snapshotMode(c, doc)
+	if err != nil {
+		return doc, err
+	}
+	if mode == "" {
+		mode = "none"
+	}
+	doc.ConfigSnapshot = mode
+	return doc, nil
+}
+
+// configSnapshot renders the effective configuration that produced doc:
+// the document alone, with inherited settings and defaults filled in.
+func configSnapshot(c cfg.Config, doc cfg.Document, projectRoot, runID string) (string, error) {
+	c.Documents = []cfg.Document{doc}
+	eff, err := Effective(c, projectRoot)
+	if err != nil {
+		return "", err
+	}
+	if doc.Deterministic {
+		eff.ProjectPath = "" // differs between checkouts
+	}
+	data, err := yaml.Marshal(eff)
+	if err != nil {
+		return "", fmt.Errorf("encode config snapshot: %w", err)
+	}
+	header := "# Effective configuration for " + doc.Targets()[0].Path + "\n"
+	if runID != "" {
+		header += "# run-id: " + runID + "\n"
+	}
+	return header + string(data), nil
+}
@@ -0,0 +1,94 @@
+package generator
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// partMarker holds the place of the "part N of M" note in the header of
+// every part until the number of parts is known.
+const partMarker = "\x00part\x00"
+
+// splitter decides where a document with splitBy starts a new part. Units
+// (a file, a tree, a command's output, ...) are never cut; a unit larger
+// than the limit gets a part of its own.
+type splitter struct {
+	by     string
+	limit  int64
+	header int64 // tokens or bytes of the header every part starts with
+	used   int64 // tokens, bytes or files in the current part
+	units  int   // units in the current part
+}
+
+// newSplitter returns nil when doc is not split.
+func newSplitter(doc cfg.Document) (*splitter, error) {
+	limit, err := cfg.SplitLimit(doc.SplitBy, doc.SplitSize)
+	if err != nil || limit == 0 {
+		return nil, err
+	}
+	return &splitter{by: strings.ToLower(strings.TrimSpace(doc.SplitBy)), limit: limit}, nil
+}
+
+// reserve counts the size bytes of the part header against every part.
+func (s *splitter) reserve(size int) {
+	if s == nil {
+		return
+	}
+	s.header = s.measure(size, 0)
+	if s.units == 0 {
+		s.used = s.header
+	}
+}
+
+// next accounts for a unit rendered as size bytes and embedding files
+// files, and reports whether it has to start a new part.
+func (s *splitter) next(size, files int) bool {
+	if s == nil {
+		return false
+	}
+	n := s.measure(size, files)
+	split := s.units > 0 && n > 0 && s.used+n > s.limit
+	if split {
+		s.used, s.units = s.header, 0
+	}
+	s.used += n
+	s.units++
+	return split
+}
+
+func (s *splitter) measure(size, files int) int64 {
+	switch s.by {
+	case "tokens":
+		return int64(EstimateTokens(size))
+	case "files":
+		return int64(files)
+	}
+	return int64(size)
+}
+
+// partPath names part n of a document: "ctx.md" becomes "ctx.part2.md".
+func partPath(p string, n int) string {
+	if p == StdoutPath {
+		return p
+	}
+	ext := filepath.Ext(p)
+	return fmt.Sprintf("%s.part%d%s", strings.TrimSuffix(p, ext), n, ext)
+}
+
+// numberParts replaces partMarker in every part with its "part N of M"
+// note; a document that fit in one part gets none.
+func numberParts(out formatter, parts []string) []string {
+	for i, p := range parts {
+		note := ""
+		if len(parts) > 1 {
+			var b strings.Builder
+			out.part(&b, i+1, len(parts))
+			note = b.String()
+		}
+		parts[i] = strings.Replace(p, partMarker, note, 1)
+	}
+	return parts
+}
@@ -0,0 +1,61 @@
+package generator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+func TestSplitTOC(t *testing.T) {
+	root := t.TempDir()
+	for i := range 12 {
+		body := fmt.Sprintf("package p\n\n// F%d %s\nfunc F%d() {}\n", i, strings.Repeat("x", 40*i), i)
+		if err := os.WriteFile(filepath.Join(root, fmt.Sprintf("f%02d.go", i)), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const limit = 1200
+	c := cfg.Config{Documents: []cfg.Document{{
+		OutputPath: "ctx.md",
+		TOC:        true,
+		SplitBy:    "bytes",
+		SplitSize:  fmt.Sprint(limit),
+		Sources:    []cfg.Source{{Type: "file", SourcePaths: []string{"."}, FilePattern: cfg.Patterns{"*.go"}}},
+	}}}
+	outs, err := Render(c, root, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outs) < 3 {
+		t.Fatalf("got %d parts, want at least 3", len(outs))
+	}
+
+	linkRe := regexp.MustCompile(`(?m)^- \[[^\]]*\]\(#([^)]*)\)$`)
+	anchorIDRe := regexp.MustCompile(`<a id="([^"]*)"></a>`)
+	files := 0
+	for _, o := range outs {
+		var links, anchors []string
+		for _, m := range linkRe.FindAllStringSubmatch(o.Content, -1) {
+			links = append(links, m[1])
+		}
+		for _, m := range anchorIDRe.FindAllStringSubmatch(o.Content, -1) {
+			anchors = append(anchors, m[1])
+		}
+		if len(anchors) == 0 || !slices.Equal(links, anchors) {
+			t.Errorf("%s: contents link %q, sections are %q", o.Path, links, anchors)
+		}
+		if len(o.Content) > limit && len(o.Files) > 1 {
+			t.Errorf("%s: %d bytes with %d files, limit %d", o.Path, len(o.Content), len(o.Files), limit)
+		}
+		files += len(o.Files)
+	}
+	if files != 12 {
+		t.Errorf("parts embed %d files, want 12", files)
+	}
+}
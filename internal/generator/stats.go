@@ -0,0 +1,115 @@
+package generator
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultLargest is how many of the largest files a stats source lists when
+// largest is not set.
+const defaultLargest = 10
+
+// statsGroup is the totals of the files of one language or directory.
+type statsGroup struct {
+	name  string
+	files int
+	lines int
+	size  int64
+}
+
+func (g *statsGroup) add(lines int, size int64) {
+	g.files++
+	g.lines += lines
+	g.size += size
+}
+
+// renderStats reads files (relative to projectRoot) and renders their
+// totals, files and lines per language, the largest files and the size of
+// each top-level directory, as aligned text.
+func renderStats(fsys sourceFS, projectRoot string, files []string, langs languageRegistry, largest, jobs int) ([]byte, error) {
+	results := readFiles(files, jobs, func(rel string) fileResult {
+		r := fileResult{rel: rel}
+		abs := filepath.Join(projectRoot, rel)
+		if r.info, r.err = fsys.Stat(abs); r.err != nil {
+			return r
+		}
+		r.data, r.err = fsys.ReadFile(abs)
+		return r
+	})
+
+	var total statsGroup
+	byLang := make(map[string]*statsGroup)
+	byDir := make(map[string]*statsGroup)
+	group := func(m map[string]*statsGroup, name string) *statsGroup {
+		if m[name] == nil {
+			m[name] = &statsGroup{name: name}
+		}
+		return m[name]
+	}
+	var sized []statsGroup
+	for _, r := range results {
+		if r.err != nil {
+			return nil, fmt.Errorf("stats for %s: %w", r.rel, r.err)
+		}
+		lines := 0
+		lang := "binary"
+		if !isBinary(r.data) {
+			lines = countLines(r.data)
+			lang = langs.detect(r.rel, r.data)
+			if lang == "" {
+				lang = cmp.Or(strings.ToLower(path.Ext(filepath.ToSlash(r.rel))), "other")
+			}
+		}
+		size := r.info.Size()
+		total.add(lines, size)
+		group(byLang, lang).add(lines, size)
+		dir, _, nested := strings.Cut(filepath.ToSlash(r.rel), "/")
+		if !nested {
+			dir = "."
+		} else {
+			dir += "/"
+		}
+		group(byDir, dir).add(lines, size)
+		sized = append(sized, statsGroup{name: filepath.ToSlash(r.rel), files: 1, lines: lines, size: size})
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s, %d lines, %s, ~%d tokens\n", fileCount(total.files), total.lines, humanBytes(int(total.size)), EstimateTokens(int(total.size)))
+
+	b.WriteString("\nBy language:\n")
+	writeStatsGroups(&b, byLang)
+	b.WriteString("\nBy directory:\n")
+	writeStatsGroups(&b, byDir)
+
+	slices.SortStableFunc(sized, func(x, y statsGroup) int { return cmp.Compare(y.size, x.size) })
+	if len(sized) > largest {
+		sized = sized[:largest]
+	}
+	b.WriteString("\nLargest files:\n")
+	for _, f := range sized {
+		fmt.Fprintf(&b, "  %10s  %7d lines  %s\n", humanBytes(int(f.size)), f.lines, f.name)
+	}
+	return b.Bytes(), nil
+}
+
+// writeStatsGroups writes one row per group, largest first.
+func writeStatsGroups(b *bytes.Buffer, groups map[string]*statsGroup) {
+	sorted := make([]*statsGroup, 0, len(groups))
+	width := 0
+	for _, g := range groups {
+		sorted = append(sorted, g)
+		width = max(width, utf8.RuneCountInString(g.name))
+	}
+	slices.SortFunc(sorted, func(x, y *statsGroup) int {
+		return cmp.Or(cmp.Compare(y.size, x.size), strings.Compare(x.name, y.name))
+	})
+	for _, g := range sorted {
+		fmt.Fprintf(b, "  %-*s  %10s  %7d lines  %10s\n", width, g.name, fileCount(g.files), g.lines, humanBytes(int(g.size)))
+	}
+}
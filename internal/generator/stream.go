@@ -0,0 +1,96 @@
+package generator
+
+import (
+	"cmp"
+	"io"
+	"io/fs"
+	"slices"
+
+	cfg "go_project_context_maker/internal/config"
+	"go_project_context_maker/internal/storage"
+)
+
+// streamable reports whether doc can be written to its outputs while it is
+// rendered (see Options.Stream): every output is a local file and nothing
+// has to revisit the whole text, such as a table of contents, front matter,
+// parts, captured sources, pipeline stages or postProcess.
+func streamable(doc cfg.Document, targets []cfg.Output) bool {
+	if doc.TOC || doc.FrontMatter || doc.Deterministic || doc.Anonymize || doc.Assertions != nil ||
+		len(doc.Redact) > 0 || len(doc.Pipeline) > 0 || doc.PostProcess != "" {
+		return false
+	}
+	if limit, err := cfg.SplitLimit(doc.SplitBy, doc.SplitSize); err != nil || limit != 0 {
+		return false
+	}
+	if slices.ContainsFunc(doc.Sources, func(s cfg.Source) bool { return s.ID != "" }) {
+		return false
+	}
+	for _, t := range targets {
+		if t.Path == StdoutPath || !storage.IsLocal(t.Path) {
+			return false
+		}
+	}
+	return true
+}
+
+// streamSink is the temporary file a streamed output is written to.
+type streamSink struct {
+	f    *storage.AtomicFile
+	n    int // bytes written
+	done bool
+}
+
+func (s *streamSink) Write(p []byte) (int, error) {
+	n, err := s.f.Write(p)
+	s.n += n
+	return n, err
+}
+
+// openStreams starts the file of every target, with permissions mode (0
+// means 0644).
+func openStreams(targets []cfg.Output, mode fs.FileMode) ([]*streamSink, error) {
+	sinks := make([]*streamSink, 0, len(targets))
+	for _, t := range targets {
+		f, err := storage.Disk{}.Create(t.Path, cmp.Or(mode, 0o644))
+		if err != nil {
+			abortStreams(sinks)
+			return nil, err
+		}
+		sinks = append(sinks, &streamSink{f: f})
+	}
+	return sinks, nil
+}
+
+// writers returns the sinks as the writers renderDocument streams to.
+func writers(sinks []*streamSink) []io.Writer {
+	if sinks == nil {
+		return nil
+	}
+	ws := make([]io.Writer, len(sinks))
+	for i, s := range sinks {
+		ws[i] = s
+	}
+	return ws
+}
+
+// commitStreams moves the finished files into place.
+func commitStreams(sinks []*streamSink) error {
+	for _, s := range sinks {
+		s.done = true
+		if err := s.f.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// abortStreams discards the files not committed yet, leaving the previous
+// outputs as they were.
+func abortStreams(sinks []*streamSink) {
+	for _, s := range sinks {
+		if !s.done {
+			s.done = true
+			s.f.Abort()
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package generator
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// commentSyntax describes just enough of a language's lexical structure to
+// find comments without being fooled by comment markers inside strings.
+type commentSyntax struct {
+	line      []string    // line comment openers
+	block     [][2]string // block comment delimiters
+	quotes    string      // string delimiters with backslash escapes
+	raw       string      // string delimiters without escapes (Go raw strings, shell single quotes)
+	triple    bool        // Python triple-quoted strings
+	multiline bool        // quoted strings may span lines
+	wordHash  bool        // "#" only opens a comment at the start of a word (shell)
+	attrHash  bool        // "#[" opens a PHP attribute, not a comment
+	goDirs    bool        // keep //go: and //line directives
+}
+
+var (
+	goSyntax  = commentSyntax{line: []string{"//"}, block: [][2]string{{"/*", "*/"}}, quotes: `"'`, raw: "`", goDirs: true}
+	jsSyntax  = commentSyntax{line: []string{"//"}, block: [][2]string{{"/*", "*/"}}, quotes: "\"'`"}
+	phpSyntax = commentSyntax{line: []string{"//", "#"}, block: [][2]string{{"/*", "*/"}}, quotes: `"'`, multiline: true, attrHash: true}
+	pySyntax  = commentSyntax{line: []string{"#"}, quotes: `"'`, triple: true}
+	shSyntax  = commentSyntax{line: []string{"#"}, quotes: `"`, raw: "'", multiline: true, wordHash: true}
+)
+
+// applyTransforms runs the source's content transforms on one file. Files
+// in languages without a known comment syntax only get blank lines collapsed.
+// modulePath classifies Go imports for collapseImports.
+func applyTransforms(src cfg.Source, rel string, data []byte, modulePath string, comments commentRegistry) []byte {
+	syn, ok := comments.lookup(rel)
+	if ok && src.StripLicenseHeader {
+		data = stripLicenseHeader(data, syn)
+	}
+	if ok && src.StripComments {
+		data = stripComments(data, syn)
+	}
+	if src.CollapseImports {
+		data = collapseImports(rel, data, modulePath)
+	}
+	if src.CollapseBlankLines {
+		data = collapseBlankLines(data)
+	}
+	return data
+}
+
+// licenseHeaderRe recognizes license boilerplate; a plain mention of the
+// word "license" (e.g. in a package doc) is not enough.
+var licenseHeaderRe = regexp.MustCompile(`(?i)copyright|spdx-license-identifier|licensed under|all rights reserved|permission is hereby granted|license,? version|gnu (?:affero |lesser )?general public license`)
+
+// stripLicenseHeader removes the first comment block of data, together with
+// the blank lines after it, when it looks like license boilerplate. A
+// shebang or "<?php" opening line is kept.
+func stripLicenseHeader(data []byte, syn commentSyntax) []byte {
+	start := 0
+	if bytes.HasPrefix(data, []byte("#!")) || bytes.HasPrefix(data, []byte("<?php")) {
+		start = lineEnd(data, 0)
+	}
+	i := skipBlankLines(data, start)
+	end := -1
+	for _, bl := range syn.block {
+		if bytes.HasPrefix(data[i:], []byte(bl[0])) {
+			if j := bytes.Index(data[i+len(bl[0]):], []byte(bl[1])); j >= 0 {
+				end = lineEnd(data, i+len(bl[0])+j+len(bl[1]))
+			}
+			break
+		}
+	}
+	if end < 0 {
+		for j := i; j < len(data) && isLineComment(data[j:lineEnd(data, j)], syn); j = lineEnd(data, j) {
+			end = lineEnd(data, j)
+		}
+	}
+	if end < 0 || !licenseHeaderRe.Match(data[i:end]) {
+		return data
+	}
+	// a comment directly above the package clause is the package doc
+	if syn.goDirs && bytes.HasPrefix(data[end:], []byte("package ")) {
+		return data
+	}
+	end = skipBlankLines(data, end)
+	return append(data[:start:start], data[end:]...)
+}
+
+func isLineComment(line []byte, syn commentSyntax) bool {
+	line = bytes.TrimLeft(line, " \t")
+	for _, open := range syn.line {
+		if bytes.HasPrefix(line, []byte(open)) {
+			return true
+		}
+	}
+	return false
+}
+
+// lineEnd returns the offset just past the newline ending the line at i.
+func lineEnd(data []byte, i int) int {
+	if j := bytes.IndexByte(data[i:], '\n'); j >= 0 {
+		return i + j + 1
+	}
+	return len(data)
+}
+
+func skipBlankLines(data []byte, i int) int {
+	for i < len(data) {
+		next := lineEnd(data, i)
+		if len(bytes.TrimSpace(data[i:next])) > 0 {
+			break
+		}
+		i = next
+	}
+	return i
+}
+
+// stripComments removes comments outside of strings. Lines left empty by
+// the removal are dropped; blank lines that were already there are kept.
+func stripComments(data []byte, syn commentSyntax) []byte {
+	out := make([]byte, 0, len(data))
+	touched := make(map[int]bool) // output lines that lost a comment
+	line := 0
+	emit := func(b []byte) {
+		out = append(out, b...)
+		line += bytes.Count(b, []byte{'\n'})
+	}
+
+	for i := 0; i < len(data); {
+		rest := data[i:]
+		c := data[i]
+
+		if commentStart(data, i, syn) {
+			end := i + bytes.IndexByte(rest, '\n')
+			if end < i {
+				end = len(data)
+			}
+			if syn.goDirs && (bytes.HasPrefix(rest, []byte("//go:")) || bytes.HasPrefix(rest, []byte("//line "))) {
+				emit(data[i:end])
+			} else {
+				touched[line] = true
+			}
+			i = end
+			continue
+		}
+		if close := blockClose(rest, syn); close != "" {
+			end := len(data)
+			if j := bytes.Index(rest[2:], []byte(close)); j >= 0 {
+				end = i + 2 + j + len(close)
+			}
+			touched[line] = true
+			for k := bytes.Count(data[i:end], []byte{'\n'}); k > 0; k-- {
+				emit([]byte{'\n'})
+				touched[line] = true
+			}
+			i = end
+			continue
+		}
+
+		if syn.triple && (c == '"' || c == '\'') && bytes.HasPrefix(rest, []byte{c, c, c}) {
+			end := len(data)
+			if j := bytes.Index(rest[3:], rest[:3]); j >= 0 {
+				end = i + 3 + j + 3
+			}
+			emit(data[i:end])
+			i = end
+			continue
+		}
+		if strings.IndexByte(syn.raw, c) >= 0 {
+			end := len(data)
+			if j := bytes.IndexByte(rest[1:], c); j >= 0 {
+				end = i + 1 + j + 1
+			}
+			emit(data[i:end])
+			i = end
+			continue
+		}
+		if strings.IndexByte(syn.quotes, c) >= 0 {
+			end := quotedEnd(data, i, syn.multiline || c == '`')
+			emit(data[i:end])
+			i = end
+			continue
+		}
+		emit(data[i : i+1])
+		i++
+	}
+
+	if len(touched) == 0 {
+		return out
+	}
+	kept := make([]byte, 0, len(out))
+	for n, l := range bytes.SplitAfter(out, []byte{'\n'}) {
+		if touched[n] {
+			body, nl := bytes.CutSuffix(l, []byte{'\n'})
+			body = bytes.TrimRight(body, " \t\r")
+			if len(bytes.TrimSpace(body)) == 0 {
+				continue
+			}
+			kept = append(kept, body...)
+			if nl {
+				kept = append(kept, '\n')
+			}
+			continue
+		}
+		kept = append(kept, l...)
+	}
+	return kept
+}
+
+// commentStart reports whether a line comment starts at data[i].
+func commentStart(data []byte, i int, syn commentSyntax) bool {
+	rest := data[i:]
+	for _, open := range syn.line {
+		if !bytes.HasPrefix(rest, []byte(open)) {
+			continue
+		}
+		if open == "#" {
+			if syn.attrHash && bytes.HasPrefix(rest, []byte("#[")) {
+				continue
+			}
+			if i == 0 && bytes.HasPrefix(rest, []byte("#!")) {
+				continue
+			}
+			if syn.wordHash && i > 0 && !strings.ContainsRune(" \t\n;(", rune(data[i-1])) {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// blockClose returns the closing delimiter when a block comment opens at
+// the start of rest.
+func blockClose(rest []byte, syn commentSyntax) string {
+	for _, bl := range syn.block {
+		if bytes.HasPrefix(rest, []byte(bl[0])) {
+			return bl[1]
+		}
+	}
+	return ""
+}
+
+// quotedEnd returns the offset just past the string opened at data[i].
+// Unless multiline, an unescaped newline ends the string, so a stray quote
+// cannot swallow the rest of the file.
+func quotedEnd(data []byte, i int, multiline bool) int {
+	q := data[i]
+	for j := i + 1; j < len(data); j++ {
+		switch data[j] {
+		case '\\':
+			j++
+		case q:
+			return j + 1
+		case '\n':
+			if !multiline {
+				return j
+			}
+		}
+	}
+	return len(data)
+}
+
+// collapseBlankLines squeezes runs of blank lines into a single one.
+func collapseBlankLines(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	blank := false
+	for i := 0; i < len(data); {
+		next := lineEnd(data, i)
+		isBlank := len(bytes.TrimSpace(data[i:next])) == 0
+		if !(isBlank && blank) {
+			out = append(out, data[i:next]...)
+		}
+		blank = isBlank
+		i = next
+	}
+	return out
+}
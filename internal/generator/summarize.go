@@ -0,0 +1,163 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// defaultSummaryPrompt asks for a summary that lets a reader decide whether
+// to request the full file.
+const defaultSummaryPrompt = "Summarize the following source file for a developer who has not seen it. " +
+	"Describe its purpose, its main types and functions with their responsibilities, " +
+	"and how it relates to the rest of the project. Be concise; answer in markdown without a heading."
+
+// summarizer writes file summaries through an OpenAI-compatible chat
+// completions endpoint. Summaries are cached in the user cache directory by
+// model, prompt and content, so unchanged files are not sent again.
+type summarizer struct {
+	llm    cfg.LLM
+	client *http.Client
+}
+
+func newSummarizer(l *cfg.LLM) (*summarizer, error) {
+	if l == nil {
+		return nil, nil
+	}
+	timeout := 2 * time.Minute
+	if l.Timeout != "" {
+		d, err := time.ParseDuration(l.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("llm: invalid timeout %q: %w", l.Timeout, err)
+		}
+		timeout = d
+	}
+	return &summarizer{llm: *l, client: &http.Client{Timeout: timeout}}, nil
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model       string        `json:"model"`
+	Messages    []chatMessage `json:"messages"`
+	MaxTokens   int           `json:"max_tokens,omitempty"`
+	Temperature float64       `json:"temperature"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+}
+
+// summarize returns the summary of the file rel with content data, ending
+// in a newline.
+func (s *summarizer) summarize(ctx context.Context, rel string, data []byte) ([]byte, error) {
+	if s == nil {
+		return nil, errors.New("summarize needs an llm endpoint in the config")
+	}
+	prompt := s.llm.Prompt
+	if strings.TrimSpace(prompt) == "" {
+		prompt = defaultSummaryPrompt
+	}
+	user := fmt.Sprintf("File: %s\n\n%s", rel, data)
+
+	sum := sha256.Sum256([]byte(s.llm.Model + "\x00" + prompt + "\x00" + user))
+	cacheFile := ""
+	if dir, err := os.UserCacheDir(); err == nil {
+		cacheFile = filepath.Join(dir, "gpcm", "summary", hex.EncodeToString(sum[:]))
+		if cached, err := os.ReadFile(cacheFile); err == nil {
+			return cached, nil
+		}
+	}
+
+	key := ""
+	if s.llm.APIKeyEnv != "" {
+		if key = os.Getenv(s.llm.APIKeyEnv); key == "" {
+			return nil, fmt.Errorf("llm: %s is not set", s.llm.APIKeyEnv)
+		}
+	}
+	body, err := json.Marshal(chatRequest{
+		Model:     s.llm.Model,
+		Messages:  []chatMessage{{Role: "system", Content: prompt}, {Role: "user", Content: user}},
+		MaxTokens: s.llm.MaxTokens,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var text string
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		text, retry, err = s.complete(ctx, body, key)
+		if err == nil || !retry || attempt == len(retryDelays) {
+			break
+		}
+		if err = sleep(ctx, retryDelays[attempt]); err != nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("summarize %s: %w", rel, err)
+	}
+	summary := []byte(strings.TrimSpace(text) + "\n")
+	if cacheFile != "" {
+		// caching is best effort
+		if os.MkdirAll(filepath.Dir(cacheFile), 0o755) == nil {
+			_ = os.WriteFile(cacheFile, summary, 0o644)
+		}
+	}
+	return summary, nil
+}
+
+// complete sends one chat completion request; retry reports whether the
+// failure is transient.
+func (s *summarizer) complete(ctx context.Context, body []byte, key string) (text string, retry bool, err error) {
+	endpoint := strings.TrimSuffix(s.llm.BaseURL, "/") + "/chat/completions"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	resp, err := s.client.Do(req)
+	if ctx.Err() != nil {
+		return "", false, ctx.Err()
+	}
+	if err != nil {
+		return "", true, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxURLBytes))
+	if err != nil {
+		return "", true, err
+	}
+	if resp.StatusCode/100 != 2 {
+		transient := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return "", transient, fmt.Errorf("%s: %s: %s", endpoint, resp.Status, strings.TrimSpace(string(data)))
+	}
+	var out chatResponse
+	if err := json.Unmarshal(data, &out); err != nil {
+		return "", false, fmt.Errorf("%s: decode response: %w", endpoint, err)
+	}
+	if len(out.Choices) == 0 || strings.TrimSpace(out.Choices[0].Message.Content) == "" {
+		return "", false, fmt.Errorf("%s: empty response", endpoint)
+	}
+	return out.Choices[0].Message.Content, false, nil
+}
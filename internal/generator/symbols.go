@@ -0,0 +1,252 @@
+package generator
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// symbol is one entry of a symbol index.
+type symbol struct {
+	name string // "Server.Start" for methods of known types
+	kind string // "function", "method", "type", "interface", "class", ...
+	rel  string
+	line int
+}
+
+// symbolParsers extract symbols by file extension; files of other
+// extensions are passed over.
+var symbolParsers = map[string]func(data []byte) []symbol{
+	".go":  goSymbols,
+	".php": phpSymbols,
+	".py":  pythonSymbols,
+	".js":  jsSymbols,
+	".jsx": jsSymbols,
+	".mjs": jsSymbols,
+	".cjs": jsSymbols,
+	".ts":  jsSymbols,
+	".tsx": jsSymbols,
+	".mts": jsSymbols,
+}
+
+// renderSymbols reads files (relative to projectRoot) and renders a flat
+// index of the functions, types, classes and methods they define with their
+// file:line locations, sorted by name, as aligned text.
+func renderSymbols(fsys sourceFS, projectRoot string, files []string, jobs int) ([]byte, error) {
+	results := readFiles(files, jobs, func(rel string) fileResult {
+		r := fileResult{rel: rel}
+		if symbolParsers[strings.ToLower(filepath.Ext(rel))] != nil {
+			r.data, r.err = fsys.ReadFile(filepath.Join(projectRoot, rel))
+		}
+		return r
+	})
+	var syms []symbol
+	for _, r := range results {
+		if r.err != nil {
+			return nil, fmt.Errorf("symbols for %s: %w", r.rel, r.err)
+		}
+		if r.data == nil {
+			continue
+		}
+		for _, s := range symbolParsers[strings.ToLower(filepath.Ext(r.rel))](r.data) {
+			s.rel = filepath.ToSlash(r.rel)
+			syms = append(syms, s)
+		}
+	}
+	if len(syms) == 0 {
+		return []byte("(no symbols found)\n"), nil
+	}
+	slices.SortFunc(syms, func(x, y symbol) int {
+		return cmp.Or(cmp.Compare(strings.ToLower(x.name), strings.ToLower(y.name)),
+			strings.Compare(x.rel, y.rel), cmp.Compare(x.line, y.line))
+	})
+	nameWidth, kindWidth := utf8.RuneCountInString("Symbol"), utf8.RuneCountInString("Kind")
+	for _, s := range syms {
+		nameWidth = max(nameWidth, utf8.RuneCountInString(s.name))
+		kindWidth = max(kindWidth, len(s.kind))
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%-*s  %-*s  %s\n", nameWidth, "Symbol", kindWidth, "Kind", "Location")
+	for _, s := range syms {
+		fmt.Fprintf(&b, "%-*s  %-*s  %s:%d\n", nameWidth, s.name, kindWidth, s.kind, s.rel, s.line)
+	}
+	return b.Bytes(), nil
+}
+
+// goSymbols lists the top-level functions, methods and types of a Go file;
+// a file that does not parse has none.
+func goSymbols(data []byte) []symbol {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", data, parser.SkipObjectResolution)
+	if err != nil {
+		return nil
+	}
+	var syms []symbol
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			s := symbol{name: d.Name.Name, kind: "function", line: fset.Position(d.Pos()).Line}
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				s.kind = "method"
+				if recv := receiverName(d.Recv.List[0].Type); recv != "" {
+					s.name = recv + "." + s.name
+				}
+			}
+			syms = append(syms, s)
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				ts, ok := spec.(*ast.TypeSpec)
+				if !ok {
+					continue
+				}
+				kind := "type"
+				switch ts.Type.(type) {
+				case *ast.StructType:
+					kind = "struct"
+				case *ast.InterfaceType:
+					kind = "interface"
+				}
+				syms = append(syms, symbol{name: ts.Name.Name, kind: kind, line: fset.Position(ts.Pos()).Line})
+			}
+		}
+	}
+	return syms
+}
+
+// symbolRule finds one kind of symbol in a line; the first submatch is the
+// name.
+type symbolRule struct {
+	kind string
+	re   *regexp.Regexp
+}
+
+var (
+	phpRules = []symbolRule{
+		{"class", regexp.MustCompile(`^\s*(?:(?:abstract|final|readonly)\s+)*class\s+(\w+)`)},
+		{"interface", regexp.MustCompile(`^\s*interface\s+(\w+)`)},
+		{"trait", regexp.MustCompile(`^\s*trait\s+(\w+)`)},
+		{"enum", regexp.MustCompile(`^\s*enum\s+(\w+)`)},
+		{"function", regexp.MustCompile(`^\s*(?:(?:public|protected|private|static|abstract|final)\s+)*function\s+&?(\w+)`)},
+	}
+	pythonRules = []symbolRule{
+		{"class", regexp.MustCompile(`^\s*class\s+(\w+)`)},
+		{"function", regexp.MustCompile(`^\s*(?:async\s+)?def\s+(\w+)`)},
+	}
+	jsRules = []symbolRule{
+		{"class", regexp.MustCompile(`^\s*(?:export\s+)?(?:default\s+)?(?:abstract\s+)?class\s+(\w+)`)},
+		{"interface", regexp.MustCompile(`^\s*(?:export\s+)?(?:declare\s+)?interface\s+(\w+)`)},
+		{"type", regexp.MustCompile(`^\s*(?:export\s+)?(?:declare\s+)?type\s+(\w+)\s*(?:<[^=]*>)?\s*=`)},
+		{"enum", regexp.MustCompile(`^\s*(?:export\s+)?(?:declare\s+)?(?:const\s+)?enum\s+(\w+)`)},
+		{"function", regexp.MustCompile(`^\s*(?:export\s+)?(?:default\s+)?(?:async\s+)?function\s*\*?\s*(\w+)`)},
+		{"function", regexp.MustCompile(`^\s*(?:export\s+)?(?:const|let|var)\s+(\w+)\s*(?::[^=]+)?=\s*(?:async\s+)?(?:function\b|(?:\([^)]*\)|\w+)\s*(?::[^=]+)?=>)`)},
+	}
+	// jsMethod is a method definition in a class body
+	jsMethod = regexp.MustCompile(`^\s+(?:(?:public|protected|private|static|readonly|override|abstract|async|get|set)\s+)*\*?(\w+)\s*(?:<[^>]*>)?\([^)]*\)?\s*(?::[^{]*)?\{?\s*$`)
+	// jsNotMethods are keywords jsMethod would otherwise take for names
+	jsNotMethods = words("if for while switch catch with function return constructor")
+)
+
+// phpSymbols lists the classes, interfaces, traits, enums and functions of
+// a PHP file; functions declared inside a class are methods.
+func phpSymbols(data []byte) []symbol {
+	return scopedSymbols(data, phpRules, nil, "::")
+}
+
+// pythonSymbols lists the top-level classes and functions of a Python file
+// and the methods of its classes; functions nested in functions are left
+// out.
+func pythonSymbols(data []byte) []symbol {
+	var syms []symbol
+	var class string
+	bodyIndent := -1 // of the current class body, once known
+	for i, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(line) - len(trimmed)
+		if indent == 0 {
+			class, bodyIndent = "", -1
+		} else if class != "" && bodyIndent < 0 {
+			bodyIndent = indent
+		}
+		for _, r := range pythonRules {
+			m := r.re.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			s := symbol{name: m[1], kind: r.kind, line: i + 1}
+			switch {
+			case indent == 0:
+				if r.kind == "class" {
+					class = m[1]
+				}
+				syms = append(syms, s)
+			case class != "" && indent == bodyIndent && r.kind == "function":
+				s.kind, s.name = "method", class+"."+m[1]
+				syms = append(syms, s)
+			}
+			break
+		}
+	}
+	return syms
+}
+
+// jsSymbols lists the classes, functions and, for TypeScript, interfaces,
+// types and enums of a JavaScript or TypeScript file, and the methods of
+// its classes.
+func jsSymbols(data []byte) []symbol {
+	return scopedSymbols(data, jsRules, jsMethod, ".")
+}
+
+// scopedSymbols applies rules to every line of a brace-delimited language,
+// tracking the class whose body a line is in: functions declared there are
+// methods, named "Class" + sep + "name", and so are the lines of the class
+// body matching method, when not nil.
+func scopedSymbols(data []byte, rules []symbolRule, method *regexp.Regexp, sep string) []symbol {
+	var syms []symbol
+	var class string
+	depth, classDepth := 0, -1
+	for i, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "//") || strings.HasPrefix(trimmed, "*") || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		found := false
+		for _, r := range rules {
+			m := r.re.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			s := symbol{name: m[1], kind: r.kind, line: i + 1}
+			if r.kind == "class" || r.kind == "interface" || r.kind == "trait" || r.kind == "enum" {
+				if class == "" {
+					class, classDepth = m[1], depth
+				}
+			} else if s.kind == "function" && class != "" {
+				s.kind, s.name = "method", class+sep+s.name
+			}
+			syms = append(syms, s)
+			found = true
+			break
+		}
+		if !found && method != nil && class != "" && depth == classDepth+1 {
+			if m := method.FindStringSubmatch(line); m != nil && !jsNotMethods[m[1]] {
+				syms = append(syms, symbol{name: class + sep + m[1], kind: "method", line: i + 1})
+			}
+		}
+		depth += strings.Count(line, "{") - strings.Count(line, "}")
+		if class != "" && depth <= classDepth && strings.Contains(line, "}") {
+			class, classDepth = "", -1
+		}
+	}
+	return syms
+}
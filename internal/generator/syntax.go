@@ -0,0 +1,76 @@
+package generator
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+var (
+	cSyntax    = commentSyntax{line: []string{"//"}, block: [][2]string{{"/*", "*/"}}, quotes: `"'`}
+	rustSyntax = commentSyntax{line: []string{"//"}, block: [][2]string{{"/*", "*/"}}, quotes: `"`} // 'a is a lifetime
+	hashSyntax = commentSyntax{line: []string{"#"}, quotes: `"'`}
+	sqlSyntax  = commentSyntax{line: []string{"--"}, block: [][2]string{{"/*", "*/"}}, quotes: `'`, multiline: true}
+	cssSyntax  = commentSyntax{block: [][2]string{{"/*", "*/"}}, quotes: `"'`}
+	htmlSyntax = commentSyntax{block: [][2]string{{"<!--", "-->"}}}
+)
+
+// builtinSyntaxes maps file extensions to the comment syntax of their
+// language; commentSyntaxes in the config add to and override it.
+var builtinSyntaxes = map[string]commentSyntax{
+	".go": goSyntax,
+	".js": jsSyntax, ".jsx": jsSyntax, ".mjs": jsSyntax, ".cjs": jsSyntax,
+	".ts": jsSyntax, ".tsx": jsSyntax, ".mts": jsSyntax, ".cts": jsSyntax,
+	".php": phpSyntax,
+	".py":  pySyntax, ".pyi": pySyntax,
+	".sh": shSyntax, ".bash": shSyntax, ".zsh": shSyntax,
+	".c": cSyntax, ".h": cSyntax, ".cc": cSyntax, ".cpp": cSyntax, ".hpp": cSyntax,
+	".java": cSyntax, ".kt": cSyntax, ".kts": cSyntax, ".scala": cSyntax, ".swift": cSyntax,
+	".cs": cSyntax, ".rs": rustSyntax, ".dart": cSyntax,
+	".rb": hashSyntax, ".pl": hashSyntax, ".r": hashSyntax,
+	".yaml": hashSyntax, ".yml": hashSyntax, ".toml": hashSyntax,
+	".sql": sqlSyntax,
+	".css": cssSyntax, ".scss": cSyntax, ".less": cSyntax,
+	".html": htmlSyntax, ".htm": htmlSyntax, ".xml": htmlSyntax,
+}
+
+// commentRegistry maps lower-case file extensions to comment syntaxes. It
+// backs every feature that needs to find comments: stripComments and
+// stripLicenseHeader.
+type commentRegistry map[string]commentSyntax
+
+// newCommentRegistry returns the built-in syntaxes with the config's
+// commentSyntaxes registered over them.
+func newCommentRegistry(custom []cfg.CommentSyntax) (commentRegistry, error) {
+	r := make(commentRegistry, len(builtinSyntaxes))
+	for ext, syn := range builtinSyntaxes {
+		r[ext] = syn
+	}
+	for _, c := range custom {
+		syn := commentSyntax{line: c.Line, quotes: c.Quotes}
+		for _, b := range c.Block {
+			open, close, ok := strings.Cut(strings.TrimSpace(b), " ")
+			if !ok {
+				return nil, fmt.Errorf("commentSyntaxes: block %q is not \"<open> <close>\"", b)
+			}
+			syn.block = append(syn.block, [2]string{open, strings.TrimSpace(close)})
+		}
+		for _, ext := range c.Extensions {
+			r[normalizeExt(ext)] = syn
+		}
+	}
+	return r, nil
+}
+
+// lookup picks the comment syntax by file extension.
+func (r commentRegistry) lookup(rel string) (commentSyntax, bool) {
+	syn, ok := r[strings.ToLower(filepath.Ext(rel))]
+	return syn, ok
+}
+
+// normalizeExt turns "zig", ".zig" and ".ZIG" into ".zig".
+func normalizeExt(ext string) string {
+	return "." + strings.TrimPrefix(strings.ToLower(strings.TrimSpace(ext)), ".")
+}
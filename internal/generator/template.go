@@ -0,0 +1,161 @@
+package generator
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"go_project_context_maker/internal/match"
+)
+
+// FileView is the data passed to file templates.
+type FileView struct {
+	Path    string    // path relative to the project root, with forward slashes
+	Lang    string    // fence language derived from the extension, may be empty
+	Content string    // processed content, always newline-terminated unless empty
+	Fence   string    // backtick fence longer than any backtick run in Content
+	Note    string    // optional one-line annotation (see annotateGo)
+	Size    int64     // size of the file on disk in bytes
+	ModTime time.Time // modification time of the file on disk
+	Heading string    // markdown heading marker of the document's headingLevel, "###" by default
+
+	Vars map[string]string // the document's variables (see config.Document.Vars)
+}
+
+// builtinTemplates can be selected by name in a document's or source's "template" field.
+var builtinTemplates = map[string]string{
+	"default": "{{.Heading}} {{.Path}}\n\n" +
+		"{{if .Note}}_{{.Note}}_\n\n{{end}}" +
+		"{{.Fence}}{{.Lang}}\n{{.Content}}{{.Fence}}\n\n",
+	"compact": "`{{.Path}}`\n" +
+		"{{.Fence}}{{.Lang}}\n{{.Content}}{{.Fence}}\n",
+	"xml-tags": "<file path=\"{{html .Path}}\"{{if .Lang}} lang=\"{{.Lang}}\"{{end}}>\n" +
+		"{{.Content}}</file>\n\n",
+}
+
+// templateFuncs are available in every file template, in addition to the
+// text/template builtins. Argument order follows sprig, so the piped value
+// comes last: {{ .Content | replace "\t" "  " }}.
+var templateFuncs = template.FuncMap{
+	"trim":          strings.TrimSpace,
+	"trimPrefix":    func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix":    func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":       func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"lower":         strings.ToLower,
+	"upper":         strings.ToUpper,
+	"indent":        indentLines,
+	"now":           time.Now,
+	"humanizeBytes": func(n int64) string { return humanBytes(int(n)) },
+	"tokenCount":    func(s string) int { return EstimateTokens(len(s)) },
+	"glob":          globMatch,
+	// source is replaced per document with a lookup of captured source output
+	"source": func(id string) (string, error) { return "", fmt.Errorf("source %q is not available here", id) },
+}
+
+// indentLines prefixes every non-empty line of s with n spaces.
+func indentLines(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	lines := strings.SplitAfter(s, "\n")
+	for i, l := range lines {
+		if l != "" && l != "\n" {
+			lines[i] = pad + l
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+// globMatch reports whether rel matches the comma-separated patterns;
+// invalid patterns never match.
+func globMatch(patterns, rel string) bool {
+	set, err := match.CompileCSV(patterns)
+	if err != nil {
+		return false
+	}
+	return set.Match(rel)
+}
+
+// fileTemplate resolves the template for a source: the source's own setting
+// wins over the document's, and both fall back to "default". A value is either
+// the name of a built-in template or inline text/template source.
+func fileTemplate(sourceSpec, docSpec string) (*template.Template, error) {
+	raw := sourceSpec
+	if strings.TrimSpace(raw) == "" {
+		raw = docSpec
+	}
+	spec := strings.TrimSpace(raw)
+	if spec == "" {
+		spec = "default"
+	}
+	// inline text is kept untrimmed so block scalars keep their final newline
+	name, text := "inline", raw
+	if builtin, ok := builtinTemplates[spec]; ok {
+		name, text = spec, builtin
+	} else if !strings.Contains(spec, "{{") {
+		return nil, fmt.Errorf("unknown template %q (built-in: default, compact, xml-tags)", spec)
+	}
+	t, err := template.New(name).Option("missingkey=error").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse template: %w", err)
+	}
+	return t, nil
+}
+
+// sectionView is the data passed to "template" sources.
+type sectionView struct {
+	Description string // the document's description
+	RunID       string // the run id, may be empty
+
+	Vars map[string]string // the document's variables (see config.Document.Vars)
+}
+
+// sectionTemplate parses the text of a "template" source.
+func sectionTemplate(text string) (*template.Template, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, fmt.Errorf("template source: text is required")
+	}
+	t, err := template.New("section").Option("missingkey=error").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse template source: %w", err)
+	}
+	return t, nil
+}
+
+// displayPath renders the path of an embedded file (relative to root, with
+// forward slashes) in a document's pathStyle: as it is, absolute, or its base
+// name; repoPrefix puts the name of root before relative paths.
+func displayPath(style string, repoPrefix bool, root, rel string) string {
+	switch strings.ToLower(style) {
+	case "absolute":
+		if abs, err := filepath.Abs(filepath.Join(root, filepath.FromSlash(rel))); err == nil {
+			return filepath.ToSlash(abs)
+		}
+	case "basename":
+		return path.Base(rel)
+	}
+	if repoPrefix {
+		if abs, err := filepath.Abs(root); err == nil {
+			return filepath.Base(abs) + "/" + rel
+		}
+	}
+	return rel
+}
+
+func newFileView(rel, note string, data []byte, size int64, modTime time.Time) FileView {
+	content := string(data)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return FileView{
+		Path:    rel,
+		Lang:    detectLang(rel),
+		Content: content,
+		Fence:   codeFence(content),
+		Note:    note,
+		Size:    size,
+		ModTime: modTime,
+		Heading: strings.Repeat("#", defaultHeadingLevel),
+	}
+}
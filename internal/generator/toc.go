@@ -0,0 +1,95 @@
+package generator
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// tocMarker holds the place of the table of contents in the header of a
+// markdown document with toc until its entries are known.
+const tocMarker = "\x00toc\x00"
+
+// tocEntry is a section listed in the table of contents.
+type tocEntry struct {
+	title, id string
+}
+
+// toc collects the sections of a document and hands out their anchors.
+// Anchors derive from the path alone ("file-internal-api-go"), so links
+// into a document survive regeneration; a repeated id gets "-2", "-3".
+type toc struct {
+	entries []tocEntry
+	used    map[string]int
+}
+
+func (t *toc) add(title, kind, path string) string {
+	id := kind + "-" + slug(path)
+	if t.used == nil {
+		t.used = make(map[string]int)
+	}
+	t.used[id]++
+	if n := t.used[id]; n > 1 {
+		id = fmt.Sprintf("%s-%d", id, n)
+	}
+	t.entries = append(t.entries, tocEntry{title: title, id: id})
+	return id
+}
+
+// slug lower-cases s and turns every run of other characters than letters
+// and digits into a single "-".
+func slug(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r > 127 {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// writeAnchor puts the anchor for id before a section of a markdown document.
+func writeAnchor(out formatter, b *strings.Builder, id string) {
+	if _, ok := out.(markdownFormat); ok && id != "" {
+		fmt.Fprintf(b, "<a id=\"%s\"></a>\n\n", id)
+	}
+}
+
+// anchorRe matches an anchor written by writeAnchor.
+var anchorRe = regexp.MustCompile(`(?m)^<a id="[^"\n]*"></a>\n\n`)
+
+// stripAnchors removes the anchors from captured sections, so a template
+// repeating one with {{ source "id" }} does not repeat their ids.
+func stripAnchors(s string) string {
+	if !strings.Contains(s, "<a id=") {
+		return s
+	}
+	return anchorRe.ReplaceAllString(s, "")
+}
+
+// renderTOC lists entries as links to their anchors under a heading
+// marked with hashes.
+func renderTOC(hashes string, entries []tocEntry) string {
+	if len(entries) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(hashes + " Contents\n\n")
+	for _, e := range entries {
+		b.WriteString(e.line())
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// line is the link to e in the table of contents.
+func (e tocEntry) line() string {
+	return fmt.Sprintf("- [%s](#%s)\n", strings.NewReplacer("[", `\[`, "]", `\]`).Replace(e.title), e.id)
+}
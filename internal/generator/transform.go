@@ -0,0 +1,108 @@
+package generator
+
+import (
+	"fmt"
+
+	cfg "go_project_context_maker/internal/config"
+	"go_project_context_maker/internal/redact"
+)
+
+// transformFile is the file a transform step works on.
+type transformFile struct {
+	rel        string
+	data       []byte
+	first      int // number of the first line, for lineNumbers
+	modulePath string
+	comments   commentRegistry
+}
+
+// transformStep applies one step of a source's transforms with the step's
+// options, which validation has checked (see cfg.TransformNames).
+type transformStep func(f transformFile, options map[string]any) ([]byte, error)
+
+// transformSteps implements the transforms a source may list. A new step
+// is added here and its name, and options if it takes any, in the config's
+// TransformNames and transformOptions.
+var transformSteps = map[string]transformStep{
+	"stripLicenseHeader": func(f transformFile, _ map[string]any) ([]byte, error) {
+		if syn, ok := f.comments.lookup(f.rel); ok {
+			return stripLicenseHeader(f.data, syn), nil
+		}
+		return f.data, nil
+	},
+	"stripComments": func(f transformFile, _ map[string]any) ([]byte, error) {
+		if syn, ok := f.comments.lookup(f.rel); ok {
+			return stripComments(f.data, syn), nil
+		}
+		return f.data, nil
+	},
+	"collapseImports": func(f transformFile, _ map[string]any) ([]byte, error) {
+		return collapseImports(f.rel, f.data, f.modulePath), nil
+	},
+	"collapseBlankLines": func(f transformFile, _ map[string]any) ([]byte, error) {
+		return collapseBlankLines(f.data), nil
+	},
+	"redactSecrets": redactSecrets,
+	"truncate":      truncateStep,
+	"lineNumbers": func(f transformFile, _ map[string]any) ([]byte, error) {
+		return numberLines(f.data, f.first), nil
+	},
+}
+
+// runTransforms applies the steps in order.
+func runTransforms(steps []cfg.Transform, f transformFile) ([]byte, error) {
+	for _, t := range steps {
+		step, ok := transformSteps[t.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown transform %q", t.Name)
+		}
+		data, err := step(f, t.Options)
+		if err != nil {
+			return nil, fmt.Errorf("transform %s on %s: %w", t.Name, f.rel, err)
+		}
+		f.data = data
+	}
+	return f.data, nil
+}
+
+// redactSecrets replaces credentials with "[REDACTED:<rule>]" markers,
+// using the built-in rules listed in the "rules" option, or all of them.
+func redactSecrets(f transformFile, options map[string]any) ([]byte, error) {
+	rules := []redact.Rule{{Name: "builtin"}}
+	if names, ok := options["rules"].([]any); ok {
+		rules = rules[:0]
+		for _, name := range names {
+			rules = append(rules, redact.Rule{Name: fmt.Sprint(name)})
+		}
+	}
+	r, err := redact.New(rules)
+	if err != nil {
+		return nil, err
+	}
+	out, _ := r.Apply(string(f.data))
+	return []byte(out), nil
+}
+
+// truncateStep keeps at most the "lines" and "bytes" options' worth of
+// whole lines, followed by a truncation marker when anything is dropped.
+func truncateStep(f transformFile, options map[string]any) ([]byte, error) {
+	limits := cfg.Source{}
+	if lines, ok := options["lines"]; ok {
+		n, ok := lines.(int)
+		if !ok {
+			return nil, fmt.Errorf("invalid lines %v", lines)
+		}
+		limits.MaxFileLines = n
+	}
+	if size, ok := options["bytes"]; ok {
+		limits.MaxFileSize = fmt.Sprint(size)
+	}
+	kept, dropped, _, err := applySizeLimits(limits, f.rel, f.data)
+	if err != nil {
+		return nil, err
+	}
+	if dropped > 0 {
+		kept = appendTruncationMarker(kept, dropped)
+	}
+	return kept, nil
+}
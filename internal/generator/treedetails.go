@@ -0,0 +1,125 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// treeDetail is shown next to a tree entry: a file's own size, line count
+// and modification time, or the totals of the files below a directory.
+type treeDetail struct {
+	size    int64
+	lines   int
+	modTime time.Time
+	files   int
+}
+
+func (d *treeDetail) add(o treeDetail) {
+	d.size += o.size
+	d.lines += o.lines
+	d.files += o.files
+	if o.modTime.After(d.modTime) {
+		d.modTime = o.modTime
+	}
+}
+
+// format renders "  (4.2 KiB, 180 lines)"; directories lead with their file
+// count and show the newest modification time. It is empty without fields.
+func (d treeDetail) format(fields []string, dir bool) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	var parts []string
+	if dir {
+		parts = append(parts, fileCount(d.files))
+	}
+	for _, f := range fields {
+		switch strings.ToLower(f) {
+		case "size":
+			parts = append(parts, humanBytes(int(d.size)))
+		case "lines":
+			parts = append(parts, fmt.Sprintf("%d lines", d.lines))
+		case "modtime":
+			if !d.modTime.IsZero() {
+				parts = append(parts, d.modTime.Format("2006-01-02"))
+			}
+		}
+	}
+	return "  (" + strings.Join(parts, ", ") + ")"
+}
+
+// fileCount renders "1 file" or "12 files".
+func fileCount(n int) string {
+	if n == 1 {
+		return "1 file"
+	}
+	return fmt.Sprintf("%d files", n)
+}
+
+// sumDetails fills every directory node with the totals below it.
+func sumDetails(n *tnode) treeDetail {
+	if !isDir(n) {
+		n.detail.files = 1
+		return n.detail
+	}
+	var total treeDetail
+	for _, c := range n.children {
+		total.add(sumDetails(c))
+	}
+	n.detail = total
+	return total
+}
+
+// collectTreeDetails stats files (relative to projectRoot) for the requested
+// fields; files are only read when line counts are asked for.
+func collectTreeDetails(fsys sourceFS, projectRoot string, files, fields []string, jobs int) ([]treeDetail, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	wantLines := false
+	for _, f := range fields {
+		switch strings.ToLower(f) {
+		case "lines":
+			wantLines = true
+		case "size", "modtime":
+		default:
+			return nil, fmt.Errorf("unknown treeDetails field %q (expected %s)", f, strings.Join(cfg.TreeDetailFields, ", "))
+		}
+	}
+
+	details := make([]treeDetail, len(files))
+	results := readFiles(files, jobs, func(rel string) fileResult {
+		r := fileResult{rel: rel}
+		abs := filepath.Join(projectRoot, rel)
+		if r.info, r.err = fsys.Stat(abs); r.err != nil {
+			return r
+		}
+		if wantLines {
+			r.data, r.err = fsys.ReadFile(abs)
+		}
+		return r
+	})
+	for i, r := range results {
+		if r.err != nil {
+			return nil, fmt.Errorf("tree details for %s: %w", r.rel, r.err)
+		}
+		details[i] = treeDetail{size: r.info.Size(), modTime: r.info.ModTime()}
+		if wantLines {
+			details[i].lines = countLines(r.data)
+		}
+	}
+	return details, nil
+}
+
+func countLines(data []byte) int {
+	n := bytes.Count(data, []byte{'\n'})
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,67 @@
+package generator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Tree formats besides the default ASCII art; both render in GitHub and
+// other Mermaid-aware markdown viewers.
+const (
+	treeMermaid = "mermaid" // left-to-right flowchart
+	treeMindmap = "mindmap" // Mermaid mindmap around the project root
+)
+
+// drawMermaidTree draws the tree below root as Mermaid, showing the same
+// entries and details as drawTree.
+func drawMermaidTree(root *tnode, view treeView) string {
+	var b strings.Builder
+	ids := 0
+	label := func(n *tnode, depth int) string {
+		text := n.name
+		if isDir(n) {
+			detail := n.detail.format(view.fields, true)
+			if detail == "" && view.hides(n, depth) {
+				detail = "  (" + fileCount(n.detail.files) + ")"
+			}
+			text += "/" + view.recent(n) + detail
+		} else {
+			text += view.recent(n) + n.detail.format(view.fields, false)
+		}
+		return strings.ReplaceAll(strings.TrimSpace(text), `"`, "#quot;")
+	}
+
+	var walk func(n *tnode, parent string, depth int)
+	walk = func(n *tnode, parent string, depth int) {
+		id := "n" + strconv.Itoa(ids)
+		ids++
+		if view.format == treeMindmap {
+			fmt.Fprintf(&b, "%s%s[\"%s\"]\n", strings.Repeat("  ", depth+1), id, label(n, depth))
+		} else {
+			fmt.Fprintf(&b, "  %s[\"%s\"]\n", id, label(n, depth))
+			if parent != "" {
+				fmt.Fprintf(&b, "  %s --> %s\n", parent, id)
+			}
+		}
+		if !isDir(n) || view.collapsed[n] || view.maxDepth > 0 && depth >= view.maxDepth {
+			return
+		}
+		for _, name := range visibleKeys(n, view) {
+			walk(n.children[name], id, depth+1)
+		}
+	}
+
+	if view.format == treeMindmap {
+		b.WriteString("mindmap\n  root((.))\n")
+	} else {
+		b.WriteString("flowchart LR\n")
+	}
+	for _, name := range visibleKeys(root, view) {
+		walk(root.children[name], "", 1)
+	}
+	if view.recentWithin != "" {
+		fmt.Fprintf(&b, "%%%% * modified within %s\n", view.recentWithin)
+	}
+	return b.String()
+}
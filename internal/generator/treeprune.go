@@ -0,0 +1,72 @@
+package generator
+
+import (
+	"sort"
+	"strings"
+)
+
+// pruneTree draws the tree below root within view.maxTokens: while it is too
+// large, directories at the deepest level still expanded are collapsed to
+// "dir/  (N files)", largest subtrees first, then the next level up. With
+// every directory collapsed the tree is drawn even if still over budget.
+func pruneTree(root *tnode, view treeView) string {
+	view.collapsed = make(map[*tnode]bool)
+	limit := view.maxTokens * 4 // bytes, the inverse of EstimateTokens
+	for {
+		out := drawTree(root, view)
+		if EstimateTokens(len(out)) <= view.maxTokens {
+			return out
+		}
+		deepest := expandedDirs(root, view)
+		if len(deepest) == 0 {
+			return out
+		}
+		// collapse until the estimated savings cover the excess; the next
+		// round measures again
+		excess := len(out) - limit
+		for _, c := range deepest {
+			if excess <= 0 {
+				break
+			}
+			view.collapsed[c.node] = true
+			excess -= c.size
+		}
+	}
+}
+
+// subtree is an expanded directory and the bytes its entries take in the
+// drawn tree.
+type subtree struct {
+	node *tnode
+	size int
+}
+
+// expandedDirs returns the directories at the deepest level that show their
+// entries, largest first.
+func expandedDirs(root *tnode, view treeView) []subtree {
+	var deepest []subtree
+	maxDepth := 0
+	var walk func(n *tnode, depth int)
+	walk = func(n *tnode, depth int) {
+		for _, name := range visibleKeys(n, view) {
+			c := n.children[name]
+			if !isDir(c) || view.collapsed[c] || view.maxDepth > 0 && depth >= view.maxDepth || len(c.children) == 0 {
+				continue
+			}
+			if depth > maxDepth {
+				maxDepth, deepest = depth, deepest[:0]
+			}
+			if depth == maxDepth {
+				var b strings.Builder
+				for _, k := range visibleKeys(c, view) {
+					renderNode(&b, c.children[k], "", false, depth+1, view)
+				}
+				deepest = append(deepest, subtree{c, b.Len()})
+			}
+			walk(c, depth+1)
+		}
+	}
+	walk(root, 1)
+	sort.SliceStable(deepest, func(i, j int) bool { return deepest[i].size > deepest[j].size })
+	return deepest
+}
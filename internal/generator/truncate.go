@@ -0,0 +1,170 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// applySizeLimits enforces src.MaxFileSize and src.MaxFileLines according to
+// src.OversizePolicy. It returns the kept content and the number of dropped
+// lines (see truncationMarker). skip is true when the file should be left out.
+func applySizeLimits(src cfg.Source, rel string, data []byte) (kept []byte, dropped int, skip bool, err error) {
+	maxBytes, err := cfg.ParseSize(src.MaxFileSize)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	maxLines := src.MaxFileLines
+	if maxBytes <= 0 && maxLines <= 0 {
+		return data, 0, false, nil
+	}
+
+	lines := bytes.Count(data, []byte{'\n'})
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		lines++
+	}
+	over := (maxBytes > 0 && int64(len(data)) > maxBytes) || (maxLines > 0 && lines > maxLines)
+	if !over {
+		return data, 0, false, nil
+	}
+
+	switch strings.ToLower(src.OversizePolicy) {
+	case "skip":
+		return nil, 0, true, nil
+	case "fail":
+		return nil, 0, false, fmt.Errorf("%s exceeds size limit (%d bytes, %d lines)", rel, len(data), lines)
+	case "", "truncate":
+	default:
+		return nil, 0, false, fmt.Errorf("unknown oversizePolicy %q", src.OversizePolicy)
+	}
+
+	cut := len(data)
+	if maxLines > 0 && lines > maxLines {
+		cut = nthLineEnd(data, maxLines)
+	}
+	if maxBytes > 0 && int64(cut) > maxBytes {
+		cut = int(maxBytes)
+		// keep whole lines when possible, and never cut a character in half
+		if i := bytes.LastIndexByte(data[:cut], '\n'); i >= 0 {
+			cut = i + 1
+		}
+		for cut > 0 && !utf8.RuneStart(data[cut]) {
+			cut--
+		}
+	}
+	kept = data[:cut]
+	return kept, lines - bytes.Count(kept, []byte{'\n'}), false, nil
+}
+
+// appendTruncationMarker terminates data with a marker telling how many lines were dropped.
+// When data ends inside a line, the first of them was cut rather than
+// dropped, and the marker says so.
+func appendTruncationMarker(data []byte, dropped int) []byte {
+	var b bytes.Buffer
+	b.Write(data)
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		b.WriteByte('\n')
+		fmt.Fprintf(&b, "... truncated (rest of the line and %d more lines) ...\n", dropped-1)
+		return b.Bytes()
+	}
+	fmt.Fprintf(&b, "... truncated (%d more lines) ...\n", dropped)
+	return b.Bytes()
+}
+
+// numberLines prefixes every line with its 1-based number, right-aligned and
+// followed by " | ".
+func numberLines(data []byte, first int) []byte {
+	if len(data) == 0 {
+		return data
+	}
+	lines := bytes.SplitAfter(data, []byte{'\n'})
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	width := len(fmt.Sprint(first + len(lines) - 1))
+	var b bytes.Buffer
+	b.Grow(len(data) + len(lines)*(width+3))
+	for i, line := range lines {
+		fmt.Fprintf(&b, "%*d | ", width, first+i)
+		b.Write(line)
+	}
+	return b.Bytes()
+}
+
+// nthLineEnd returns the offset just past the n-th newline in data.
+func nthLineEnd(data []byte, n int) int {
+	off := 0
+	for i := 0; i < n; i++ {
+		j := bytes.IndexByte(data[off:], '\n')
+		if j < 0 {
+			return len(data)
+		}
+		off += j + 1
+	}
+	return off
+}
+
+// limitLineLength enforces src.MaxLineLength (in characters) according to
+// src.LongLinePolicy: "wrap" (default) breaks long lines into pieces,
+// "truncate" cuts them with a "... (+N chars)" marker and "flag" keeps them.
+// It also returns how many lines were too long.
+func limitLineLength(src cfg.Source, data []byte) ([]byte, int, error) {
+	max := src.MaxLineLength
+	if max <= 0 {
+		return data, 0, nil
+	}
+	policy := strings.ToLower(src.LongLinePolicy)
+	switch policy {
+	case "", "wrap", "truncate", "flag":
+	default:
+		return nil, 0, fmt.Errorf("unknown longLinePolicy %q", src.LongLinePolicy)
+	}
+
+	var b bytes.Buffer
+	long := 0
+	for off := 0; off < len(data); {
+		end := lineEnd(data, off)
+		line := data[off:end]
+		off = end
+		body, nl := bytes.CutSuffix(line, []byte{'\n'})
+		n := utf8.RuneCount(body)
+		if n <= max {
+			b.Write(line)
+			continue
+		}
+		long++
+		switch policy {
+		case "flag":
+			b.Write(line)
+			continue
+		case "truncate":
+			b.Write(body[:runeOffset(body, max)])
+			fmt.Fprintf(&b, " ... (+%d chars)", n-max)
+		default:
+			for utf8.RuneCount(body) > max {
+				cut := runeOffset(body, max)
+				b.Write(body[:cut])
+				b.WriteByte('\n')
+				body = body[cut:]
+			}
+			b.Write(body)
+		}
+		if nl {
+			b.WriteByte('\n')
+		}
+	}
+	return b.Bytes(), long, nil
+}
+
+// runeOffset returns the byte offset of the n-th rune in s.
+func runeOffset(s []byte, n int) int {
+	off := 0
+	for i := 0; i < n && off < len(s); i++ {
+		_, size := utf8.DecodeRune(s[off:])
+		off += size
+	}
+	return off
+}
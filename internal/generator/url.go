@@ -0,0 +1,200 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	cfg "go_project_context_maker/internal/config"
+)
+
+// maxURLBytes caps a fetched body; larger documents are an error rather
+// than a silent truncation.
+const maxURLBytes = 32 << 20
+
+// urlDoc is a fetched remote document.
+type urlDoc struct {
+	data        []byte
+	contentType string // media type without parameters
+	fetched     time.Time
+}
+
+// fetchURL downloads u according to the source's timeout, retries, cache
+// and auth settings; ctx aborts the request and the pauses between retries.
+// refresh ignores a cached response but still caches the new one.
+func fetchURL(ctx context.Context, u string, src cfg.Source, refresh bool) (urlDoc, error) {
+	var ttl time.Duration
+	if src.CacheTTL != "" {
+		d, err := time.ParseDuration(src.CacheTTL)
+		if err != nil {
+			return urlDoc{}, fmt.Errorf("url source: invalid cacheTTL %q: %w", src.CacheTTL, err)
+		}
+		ttl = d
+	}
+	timeout := 30 * time.Second
+	if src.Timeout != "" {
+		d, err := time.ParseDuration(src.Timeout)
+		if err != nil {
+			return urlDoc{}, fmt.Errorf("url source: invalid timeout %q: %w", src.Timeout, err)
+		}
+		timeout = d
+	}
+
+	file := ""
+	if ttl > 0 {
+		file = cacheFile("url", u)
+		if data, at, ok := readCache(file, ttl); ok && !refresh {
+			if ct, body, ok := bytes.Cut(data, []byte{'\n'}); ok {
+				return urlDoc{data: body, contentType: string(ct), fetched: at}, nil
+			}
+		}
+	}
+
+	authorize, err := urlAuth(src.Auth)
+	if err != nil {
+		return urlDoc{}, err
+	}
+	client := &http.Client{Timeout: timeout}
+	if src.Auth != nil && src.Auth.Header != "" {
+		// net/http drops Authorization on redirects to other hosts, but not
+		// custom headers
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			if req.URL.Host != via[0].URL.Host {
+				req.Header.Del(src.Auth.Header)
+			}
+			return nil
+		}
+	}
+	var doc urlDoc
+	for attempt := 0; attempt <= max(src.Retries, 0); attempt++ {
+		if attempt > 0 {
+			if err := sleep(ctx, time.Duration(attempt)*time.Second); err != nil {
+				return urlDoc{}, err
+			}
+		}
+		var retry bool
+		doc, retry, err = getURL(ctx, client, u, authorize)
+		if err == nil || !retry {
+			break
+		}
+	}
+	if err != nil {
+		return urlDoc{}, err
+	}
+	// The cache file holds the content type on the first line, then the body.
+	_ = writeCache(file, append([]byte(doc.contentType+"\n"), doc.data...))
+	return doc, nil
+}
+
+// getURL performs one request, with the credentials authorize adds; retry
+// reports whether the failure is transient.
+func getURL(ctx context.Context, client *http.Client, u string, authorize func(*http.Request)) (doc urlDoc, retry bool, err error) {
+	shown := redactURL(u)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return urlDoc{}, false, fmt.Errorf("fetch %s: invalid url", shown)
+	}
+	authorize(req)
+	resp, err := client.Do(req)
+	if ctx.Err() != nil {
+		return urlDoc{}, false, ctx.Err()
+	}
+	if err != nil {
+		return urlDoc{}, true, fmt.Errorf("fetch %s: %w", shown, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		transient := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return urlDoc{}, transient, fmt.Errorf("fetch %s: %s", shown, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxURLBytes+1))
+	if err != nil {
+		return urlDoc{}, true, fmt.Errorf("fetch %s: %w", shown, err)
+	}
+	if len(data) > maxURLBytes {
+		return urlDoc{}, false, fmt.Errorf("fetch %s: body larger than %s", shown, humanBytes(maxURLBytes))
+	}
+	ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return urlDoc{data: data, contentType: ct, fetched: time.Now()}, false, nil
+}
+
+// urlLang picks the fence language from the URL path, then the content type.
+func urlLang(u, contentType string) string {
+	p := u
+	if i := strings.IndexAny(p, "?#"); i >= 0 {
+		p = p[:i]
+	}
+	if lang := detectLang(path.Base(p)); lang != "" {
+		return lang
+	}
+	switch {
+	case strings.HasSuffix(contentType, "json"):
+		return "json"
+	case strings.HasSuffix(contentType, "yaml"):
+		return "yaml"
+	case contentType == "text/markdown":
+		return "md"
+	case contentType == "text/html":
+		return "html"
+	}
+	return ""
+}
+
+// urlAuth returns what adds the credentials of a to a request, reading
+// the secrets from the environment; without a it adds nothing. Errors name
+// the variables, never their values.
+func urlAuth(a *cfg.Auth) (func(*http.Request), error) {
+	if a == nil {
+		return func(*http.Request) {}, nil
+	}
+	secret := func(key, env string) (string, error) {
+		v := os.Getenv(env)
+		if v == "" {
+			return "", fmt.Errorf("url source: auth %s: %s is not set", key, env)
+		}
+		return v, nil
+	}
+	if a.TokenEnv != "" {
+		token, err := secret("tokenEnv", a.TokenEnv)
+		if err != nil {
+			return nil, err
+		}
+		if a.Header != "" {
+			return func(r *http.Request) { r.Header.Set(a.Header, token) }, nil
+		}
+		return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }, nil
+	}
+	if a.Username == "" {
+		return nil, errors.New("url source: auth needs tokenEnv or username")
+	}
+	password := ""
+	if a.PasswordEnv != "" {
+		var err error
+		if password, err = secret("passwordEnv", a.PasswordEnv); err != nil {
+			return nil, err
+		}
+	}
+	return func(r *http.Request) { r.SetBasicAuth(a.Username, password) }, nil
+}
+
+// redactURL returns u with the password of its user info, if any, replaced
+// by "xxxxx", for labels, warnings and errors.
+func redactURL(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+	return parsed.Redacted()
+}
@@ -0,0 +1,114 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// walkFunc traverses the tree rooted at root with the same contract as filepath.WalkDir.
+type walkFunc func(root string, fn fs.WalkDirFunc) error
+
+// walkBatchSize is the number of directory entries read per ReadDir call.
+const walkBatchSize = 512
+
+// walkerFor returns the traversal backend selected by the config's walkBackend.
+func walkerFor(name string) (walkFunc, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "std":
+		return filepath.WalkDir, nil
+	case "batched":
+		return batchedWalkDir, nil
+	default:
+		return nil, fmt.Errorf("unknown walkBackend %q (expected std or batched)", name)
+	}
+}
+
+// batchedWalkDir walks the tree iteratively, reading directory entries in
+// fixed-size batches straight from the dirent stream. Unlike filepath.WalkDir
+// it neither loads whole directories into memory nor sorts them, and it never
+// lstats entries whose type is reported by readdir. Visit order is therefore
+// unspecified; callers sort results themselves.
+func batchedWalkDir(root string, fn fs.WalkDirFunc) error {
+	info, err := os.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkBatched(root, fs.FileInfoToDirEntry(info), fn)
+	}
+	if errors.Is(err, fs.SkipDir) || errors.Is(err, fs.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+type walkItem struct {
+	path string
+	de   fs.DirEntry
+}
+
+func walkBatched(root string, rootDE fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(root, rootDE, nil); err != nil || !rootDE.IsDir() {
+		return err
+	}
+
+	stack := []walkItem{{root, rootDE}}
+	for len(stack) > 0 {
+		dir := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		subdirs, err := readDirBatched(dir, fn)
+		if err != nil {
+			return err
+		}
+		stack = append(stack, subdirs...)
+	}
+	return nil
+}
+
+// readDirBatched calls fn for every entry of dir and returns the
+// subdirectories that still need to be visited.
+func readDirBatched(dir walkItem, fn fs.WalkDirFunc) ([]walkItem, error) {
+	f, err := os.Open(dir.path)
+	if err != nil {
+		if err := fn(dir.path, dir.de, err); err != nil && !errors.Is(err, fs.SkipDir) {
+			return nil, err
+		}
+		return nil, nil
+	}
+	defer f.Close()
+
+	var subdirs []walkItem
+	for {
+		entries, readErr := f.ReadDir(walkBatchSize)
+		for _, e := range entries {
+			p := filepath.Join(dir.path, e.Name())
+			if err := fn(p, e, nil); err != nil {
+				if errors.Is(err, fs.SkipDir) {
+					if e.IsDir() {
+						continue
+					}
+					// SkipDir on a file skips the rest of its directory
+					return subdirs, nil
+				}
+				return nil, err
+			}
+			if e.IsDir() {
+				subdirs = append(subdirs, walkItem{p, e})
+			}
+		}
+		if readErr == io.EOF {
+			return subdirs, nil
+		}
+		if readErr != nil {
+			if err := fn(dir.path, dir.de, readErr); err != nil && !errors.Is(err, fs.SkipDir) {
+				return nil, err
+			}
+			return subdirs, nil
+		}
+	}
+}
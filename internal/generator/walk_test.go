@@ -0,0 +1,55 @@
+package generator
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// BenchmarkWalk compares the walkBackend options on a generated tree of
+// 20 directories with 50 subdirectories of 20 files each (20,000 files).
+func BenchmarkWalk(b *testing.B) {
+	root := b.TempDir()
+	for i := range 20 {
+		for j := range 50 {
+			dir := filepath.Join(root, fmt.Sprintf("d%02d", i), fmt.Sprintf("s%02d", j))
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				b.Fatal(err)
+			}
+			for k := range 20 {
+				if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%02d.go", k)), nil, 0o644); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	}
+
+	for _, backend := range []string{"std", "batched"} {
+		walk, err := walkerFor(backend)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(backend, func(b *testing.B) {
+			for range b.N {
+				files := 0
+				err := walk(root, func(_ string, d fs.DirEntry, err error) error {
+					if err != nil {
+						return err
+					}
+					if !d.IsDir() {
+						files++
+					}
+					return nil
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+				if files != 20*50*20 {
+					b.Fatalf("walked %d files, want %d", files, 20*50*20)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+// Package ghactions writes GitHub Actions workflow commands, step outputs
+// and the job summary.
+package ghactions
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Detected reports whether the process runs inside GitHub Actions.
+func Detected() bool {
+	return os.Getenv("GITHUB_ACTIONS") == "true"
+}
+
+// Warning writes a ::warning command, attached to file when it is not empty.
+func Warning(w io.Writer, file, title, msg string) {
+	var props []string
+	if file != "" {
+		props = append(props, "file="+escapeProperty(file))
+	}
+	if title != "" {
+		props = append(props, "title="+escapeProperty(title))
+	}
+	cmd := "::warning"
+	if len(props) > 0 {
+		cmd += " " + strings.Join(props, ",")
+	}
+	fmt.Fprintf(w, "%s::%s\n", cmd, escapeData(msg))
+}
+
+// SetOutput appends a step output to the file named by GITHUB_OUTPUT.
+// Values may span several lines.
+func SetOutput(name, value string) error {
+	delim, err := delimiter()
+	if err != nil {
+		return err
+	}
+	return appendEnvFile("GITHUB_OUTPUT", fmt.Sprintf("%s<<%s\n%s\n%s\n", name, delim, value, delim))
+}
+
+// AppendSummary appends markdown to the job summary (GITHUB_STEP_SUMMARY).
+func AppendSummary(markdown string) error {
+	return appendEnvFile("GITHUB_STEP_SUMMARY", markdown)
+}
+
+func appendEnvFile(env, text string) error {
+	path := os.Getenv(env)
+	if path == "" {
+		return fmt.Errorf("%s is not set", env)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", env, err)
+	}
+	if _, err := io.WriteString(f, text); err != nil {
+		f.Close()
+		return fmt.Errorf("write %s: %w", env, err)
+	}
+	return f.Close()
+}
+
+// delimiter returns a random heredoc delimiter that cannot collide with a value.
+func delimiter() (string, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return "ghadelimiter_" + hex.EncodeToString(b[:]), nil
+}
+
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
@@ -0,0 +1,136 @@
+// Package gitstore keeps generated context documents in git instead of the
+// work tree: as commits under refs/context/<name> or as notes on the
+// current commit.
+package gitstore
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Bundle is the output of one document.
+type Bundle struct {
+	Name  string // document name; becomes part of the ref
+	Files []File
+}
+
+// File is one output file of a bundle.
+type File struct {
+	Name    string // base name of the output path
+	Content string
+}
+
+// Modes lists the values Store accepts.
+var Modes = []string{"refs", "notes"}
+
+// Store records the bundles in the repository containing dir and returns
+// the refs it updated.
+//
+// In "refs" mode every bundle becomes a commit of its files on
+// refs/context/<name>, whose parent is the previous bundle, so the ref's log
+// is the history of what was generated; the message names the commit the
+// bundle was generated from. In "notes" mode every file becomes a note on
+// HEAD under refs/notes/context/<name>/<file>, replacing an earlier note.
+func Store(dir, mode, runID string, bundles []Bundle) ([]string, error) {
+	head, err := git(dir, nil, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	var refs []string
+	for _, b := range bundles {
+		var written []string
+		switch mode {
+		case "refs":
+			written, err = storeRef(dir, head, runID, b)
+		case "notes":
+			written, err = storeNotes(dir, head, b)
+		default:
+			return refs, fmt.Errorf("unknown git store mode %q (expected %s)", mode, strings.Join(Modes, " or "))
+		}
+		if err != nil {
+			return refs, fmt.Errorf("store %s: %w", b.Name, err)
+		}
+		refs = append(refs, written...)
+	}
+	return refs, nil
+}
+
+func storeRef(dir, head, runID string, b Bundle) ([]string, error) {
+	var tree strings.Builder
+	for _, f := range b.Files {
+		blob, err := git(dir, strings.NewReader(f.Content), "hash-object", "-w", "--stdin")
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&tree, "100644 blob %s\t%s\n", blob, f.Name)
+	}
+	treeID, err := git(dir, strings.NewReader(tree.String()), "mktree")
+	if err != nil {
+		return nil, err
+	}
+	ref := "refs/context/" + refName(b.Name)
+	msg := fmt.Sprintf("Context %s for %s\n\nSource-Commit: %s\n", b.Name, head[:min(12, len(head))], head)
+	if runID != "" {
+		msg += "Run-Id: " + runID + "\n"
+	}
+	args := []string{"commit-tree", treeID, "-F", "-"}
+	if prev, err := git(dir, nil, "rev-parse", "--verify", "--quiet", ref); err == nil && prev != "" {
+		args = append(args, "-p", prev)
+	}
+	commit, err := git(dir, strings.NewReader(msg), args...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := git(dir, nil, "update-ref", "-m", "gpcm generate", ref, commit); err != nil {
+		return nil, err
+	}
+	return []string{ref}, nil
+}
+
+func storeNotes(dir, head string, b Bundle) ([]string, error) {
+	var refs []string
+	for _, f := range b.Files {
+		ref := "refs/notes/context/" + refName(b.Name) + "/" + refName(f.Name)
+		if _, err := git(dir, strings.NewReader(f.Content), "notes", "--ref", ref, "add", "-f", "-F", "-", head); err != nil {
+			return refs, err
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// refName makes s usable as one component of a ref name.
+func refName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '-'
+	}, s)
+	s = strings.Trim(strings.ReplaceAll(s, "..", "."), ".")
+	if s == "" {
+		return "context"
+	}
+	return strings.TrimSuffix(s, ".lock")
+}
+
+func git(dir string, stdin *strings.Reader, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, msg)
+		}
+		return "", fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,127 @@
+// Package hooks installs git hooks that keep committed context documents
+// in sync with the sources they are generated from.
+package hooks
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// marker identifies hooks written by Install so they can be replaced safely.
+const marker = "# installed by gpcm hooks install"
+
+// Options describes the hook to install.
+type Options struct {
+	Hook    string   // "pre-commit" or "pre-push"
+	Mode    string   // "check" (fail on stale documents) or "generate" (regenerate and stage)
+	Bin     string   // command used to run the tool, e.g. "gpcm" or "go run ."
+	Config  string   // config path relative to the repository root
+	Outputs []string // document output paths staged in "generate" mode
+	Force   bool     // overwrite a hook that was not written by Install
+}
+
+// Install writes the hook script into the repository's hooks directory
+// (honoring core.hooksPath) and returns its path.
+func Install(dir string, o Options) (string, error) {
+	switch o.Hook {
+	case "pre-commit", "pre-push":
+	default:
+		return "", fmt.Errorf("unknown hook %q (expected pre-commit or pre-push)", o.Hook)
+	}
+	script, err := Script(o)
+	if err != nil {
+		return "", err
+	}
+
+	hooksDir, err := gitOutput(dir, "rev-parse", "--git-path", "hooks")
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(hooksDir) {
+		hooksDir = filepath.Join(dir, hooksDir)
+	}
+	if err := os.MkdirAll(hooksDir, 0o755); err != nil {
+		return "", fmt.Errorf("create hooks dir: %w", err)
+	}
+
+	path := filepath.Join(hooksDir, o.Hook)
+	if old, err := os.ReadFile(path); err == nil && !o.Force && !bytes.Contains(old, []byte(marker)) {
+		return "", fmt.Errorf("%s already exists and was not installed by gpcm (use -force to replace it)", path)
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("read %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		return "", fmt.Errorf("write %s: %w", path, err)
+	}
+	return path, nil
+}
+
+// Script returns the shell script for o. Hooks run from the repository root.
+func Script(o Options) (string, error) {
+	bin := strings.TrimSpace(o.Bin)
+	if bin == "" {
+		bin = "gpcm"
+	}
+	config := shellQuote(filepath.ToSlash(o.Config))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "#!/bin/sh\n%s\n", marker)
+	switch o.Mode {
+	case "", "check":
+		fmt.Fprintf(&b, "%s -config %s check || {\n", bin, config)
+		fmt.Fprintf(&b, "\techo \"context documents are out of date: run '%s -config %s generate'\" >&2\n", bin, config)
+		b.WriteString("\texit 1\n}\n")
+	case "generate":
+		fmt.Fprintf(&b, "%s -config %s generate || exit 1\n", bin, config)
+		if len(o.Outputs) > 0 {
+			quoted := make([]string, len(o.Outputs))
+			for i, p := range o.Outputs {
+				quoted[i] = shellQuote(filepath.ToSlash(p))
+			}
+			if o.Hook == "pre-push" {
+				// a push cannot include new changes: fail if regeneration changed anything
+				fmt.Fprintf(&b, "git diff --quiet -- %s || {\n", strings.Join(quoted, " "))
+				b.WriteString("\techo \"context documents were regenerated: commit them and push again\" >&2\n")
+				b.WriteString("\texit 1\n}\n")
+			} else {
+				fmt.Fprintf(&b, "git add -- %s\n", strings.Join(quoted, " "))
+			}
+		}
+	default:
+		return "", fmt.Errorf("unknown mode %q (expected check or generate)", o.Mode)
+	}
+	return b.String(), nil
+}
+
+// TopLevel returns the root of the git work tree containing dir.
+func TopLevel(dir string) (string, error) {
+	return gitOutput(dir, "rev-parse", "--show-toplevel")
+}
+
+func gitOutput(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, msg)
+		}
+		return "", fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// shellQuote quotes s for sh when it contains anything beyond safe characters.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
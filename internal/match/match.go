@@ -0,0 +1,456 @@
+// Package match is the pattern engine behind filePattern, excludePaths,
+// sourcePaths globs, .contextignore/.gpcmignore and CODEOWNERS. Patterns follow
+// gitignore semantics:
+//
+//   - "*" and "?" match within one path segment, "[...]" is a character class
+//     ("[!...]" or "[^...]" negated, a leading "]" literal) that never
+//     matches "/", and "\" escapes the next character
+//   - a "\" before any other character than *?[]\!# and space separates
+//     path segments like "/", on every system: `vendor\lib` is "vendor/lib"
+//     while `\*.go` matches a file named "*.go"
+//   - "**" matches any number of directories: "**/x", "a/**/b", "a/**"
+//   - a pattern without a slash matches the base name at any depth; a
+//     leading or inner slash anchors it at the root ("/build", "docs/*.md"),
+//     or for filePattern (Set.SelectIn) at the source path as well
+//   - a trailing "/" matches directories only
+//   - a leading "!" negates; the last matching pattern decides
+//   - a path whose parent directory matches is matched as well
+//
+// filePattern lists are applied with Set.Select, where a negation also
+// drops files a positive pattern matched and a list of negations only
+// starts from every file.
+package match
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+type kind int
+
+const (
+	kindLiteral kind = iota // no meta characters: plain comparison
+	kindSuffix              // "*.ext": suffix comparison
+	kindPrefix              // "name*": prefix comparison
+	kindRegexp              // anything else
+)
+
+type pattern struct {
+	raw      string // as written, including "!" and trailing "/"
+	kind     kind
+	lit      string // literal, suffix or prefix for the fast paths
+	re       *regexp.Regexp
+	negate   bool
+	dirOnly  bool
+	anchored bool // matched against the whole path instead of the base name
+	either   bool // a regular expression matching the base name or the whole path
+}
+
+// Set is a compiled list of patterns. The zero value matches nothing and
+// reports Empty.
+type Set struct {
+	patterns []pattern
+	negates  bool // any pattern starts with "!"
+	fold     bool // paths are lowercased before matching
+}
+
+// Compile builds a Set from patterns. Patterns are trimmed and separating
+// backslashes converted to forward slashes; empty entries are ignored.
+func Compile(globs []string) (*Set, error) {
+	return compile(globs, false)
+}
+
+// compile is Compile, case-insensitive with fold.
+func compile(globs []string, fold bool) (*Set, error) {
+	s := &Set{fold: fold}
+	for _, g := range globs {
+		g = toSlash(strings.TrimSpace(g))
+		if g == "" || g == "!" {
+			continue
+		}
+		if fold {
+			g = strings.ToLower(g)
+		}
+		p, err := compileOne(g)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", g, err)
+		}
+		s.patterns = append(s.patterns, p)
+		s.negates = s.negates || p.negate
+	}
+	return s, nil
+}
+
+// CompileCSV builds a Set from a comma-separated list such as "*.php,*.twig".
+func CompileCSV(csv string) (*Set, error) {
+	return Compile(strings.Split(csv, ","))
+}
+
+// CompileFilePattern builds the Set of a filePattern in syntax "glob" (the
+// default, a comma-separated list) or "regex", one regular expression
+// matched against the base name and the whole path of files, such as
+// `^(handler|service)_.*\.go$`. With fold, case is ignored: "*.md" matches
+// README.MD.
+func CompileFilePattern(expr, syntax string, fold bool) (*Set, error) {
+	switch strings.ToLower(syntax) {
+	case "", "glob":
+		return compile(strings.Split(expr, ","), fold)
+	case "regex":
+		if strings.TrimSpace(expr) == "" {
+			return &Set{}, nil
+		}
+		if fold {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %w", expr, err)
+		}
+		return &Set{patterns: []pattern{{raw: expr, kind: kindRegexp, re: re, either: true}}}, nil
+	}
+	return nil, fmt.Errorf("unknown pattern syntax %q (expected glob or regex)", syntax)
+}
+
+// ParseIgnore returns the patterns of a .gitignore-style file: one per
+// line, blank lines and lines starting with "#" skipped ("\#" escapes a
+// leading hash).
+func ParseIgnore(data []byte) []string {
+	var out []string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+// escapable lists the characters a backslash escapes; before any other
+// character it is a path separator.
+const escapable = `*?[]\!# `
+
+// toSlash converts the backslashes of g that separate path segments into
+// "/", keeping escapes. The rule does not depend on the system, so a config
+// matches the same files on Windows as elsewhere.
+func toSlash(g string) string {
+	if !strings.Contains(g, `\`) {
+		return g
+	}
+	var b strings.Builder
+	for i := 0; i < len(g); i++ {
+		switch {
+		case g[i] != '\\':
+			b.WriteByte(g[i])
+		case i+1 < len(g) && strings.IndexByte(escapable, g[i+1]) >= 0:
+			b.WriteString(g[i : i+2])
+			i++
+		default:
+			b.WriteByte('/')
+		}
+	}
+	return b.String()
+}
+
+func compileOne(g string) (pattern, error) {
+	p := pattern{raw: g}
+	if strings.HasPrefix(g, "!") {
+		p.negate = true
+		g = g[1:]
+	}
+	if strings.HasSuffix(g, "/") && g != "/" {
+		p.dirOnly = true
+		g = strings.TrimRight(g, "/")
+	}
+	g = strings.TrimPrefix(g, "./")
+	if strings.Contains(g, "/") {
+		p.anchored = true
+		g = strings.TrimPrefix(g, "/")
+	}
+	meta := strings.IndexAny(g, `*?[\`)
+	switch {
+	case meta < 0:
+		p.kind, p.lit = kindLiteral, g
+		return p, nil
+	case !p.anchored && meta == 0 && g[0] == '*' && !strings.ContainsAny(g[1:], `*?[\`):
+		p.kind, p.lit = kindSuffix, g[1:]
+		return p, nil
+	case !p.anchored && meta == len(g)-1 && g[meta] == '*':
+		p.kind, p.lit = kindPrefix, g[:meta]
+		return p, nil
+	}
+	expr, err := toRegexp(g)
+	if err != nil {
+		return p, err
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return p, err
+	}
+	p.kind, p.re = kindRegexp, re
+	return p, nil
+}
+
+// toRegexp translates a glob (without "!", trailing "/" or leading "/")
+// into an anchored regular expression. A trailing "\" or an unclosed class
+// is an error.
+func toRegexp(g string) (string, error) {
+	var re strings.Builder
+	re.WriteString("^")
+	for i := 0; i < len(g); i++ {
+		c := g[i]
+		switch {
+		case strings.HasPrefix(g[i:], "**/") && (i == 0 || g[i-1] == '/'):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case g[i:] == "**" && (i == 0 || g[i-1] == '/'):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		case c == '\\':
+			if i+1 == len(g) {
+				return "", path.ErrBadPattern
+			}
+			_, n := utf8.DecodeRuneInString(g[i+1:])
+			re.WriteString(regexp.QuoteMeta(g[i+1 : i+1+n]))
+			i += n
+		case c == '[':
+			class, end, err := classRegexp(g, i)
+			if err != nil {
+				return "", err
+			}
+			re.WriteString(class)
+			i = end
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	return re.String(), nil
+}
+
+// classRegexp translates the character class opening at g[i] into a
+// regular expression and returns the index of its closing "]". As in
+// gitignore, "!" or "^" negates, a "]" right after the opening (and the
+// negation) is literal, "\" escapes, "a-z" is a range and no class
+// matches "/".
+func classRegexp(g string, i int) (string, int, error) {
+	j := i + 1
+	negate := j < len(g) && (g[j] == '!' || g[j] == '^')
+	if negate {
+		j++
+	}
+	type span struct{ lo, hi rune }
+	var spans []span
+	next := func() (rune, error) {
+		if g[j] == '\\' {
+			if j++; j == len(g) {
+				return 0, path.ErrBadPattern
+			}
+		}
+		r, n := utf8.DecodeRuneInString(g[j:])
+		j += n
+		return r, nil
+	}
+	for first := true; j >= len(g) || g[j] != ']' || first; first = false {
+		if j >= len(g) {
+			return "", 0, path.ErrBadPattern
+		}
+		lo, err := next()
+		if err != nil {
+			return "", 0, err
+		}
+		hi := lo
+		if j+1 < len(g) && g[j] == '-' && g[j+1] != ']' {
+			j++
+			if hi, err = next(); err != nil {
+				return "", 0, err
+			}
+			if hi < lo {
+				return "", 0, path.ErrBadPattern
+			}
+		}
+		spans = append(spans, span{lo, hi})
+	}
+
+	var b strings.Builder
+	write := func(lo, hi rune) {
+		fmt.Fprintf(&b, `\x{%x}`, lo)
+		if hi != lo {
+			fmt.Fprintf(&b, `-\x{%x}`, hi)
+		}
+	}
+	b.WriteString("[")
+	if negate {
+		b.WriteString("^/")
+	}
+	for _, s := range spans {
+		if negate || s.hi < '/' || s.lo > '/' {
+			write(s.lo, s.hi)
+			continue
+		}
+		// leave out "/"
+		if s.lo < '/' {
+			write(s.lo, '/'-1)
+		}
+		if s.hi > '/' {
+			write('/'+1, s.hi)
+		}
+	}
+	if b.Len() == 1 {
+		// only "/": nothing matches
+		return `[^\x00-\x{10ffff}]`, j, nil
+	}
+	b.WriteString("]")
+	return b.String(), j, nil
+}
+
+// Empty reports whether the set has no patterns.
+func (s *Set) Empty() bool {
+	return s == nil || len(s.patterns) == 0
+}
+
+// Patterns returns the normalized source patterns.
+func (s *Set) Patterns() []string {
+	if s == nil {
+		return nil
+	}
+	out := make([]string, len(s.patterns))
+	for i, p := range s.patterns {
+		out[i] = p.raw
+	}
+	return out
+}
+
+// Match reports whether the file at rel (a slash-separated path relative to
+// the pattern root, or a bare base name) is matched.
+func (s *Set) Match(rel string) bool {
+	return s.matchPath(rel, false)
+}
+
+// MatchDir is Match for a directory, so directory-only patterns apply.
+func (s *Set) MatchDir(rel string) bool {
+	return s.matchPath(rel, true)
+}
+
+func (s *Set) matchPath(rel string, isDir bool) bool {
+	if s.Empty() {
+		return false
+	}
+	rel = strings.TrimPrefix(rel, "./")
+	if s.fold {
+		rel = strings.ToLower(rel)
+	}
+	// a matched directory covers everything below it
+	for i := 0; i < len(rel); i++ {
+		if rel[i] == '/' && s.decide(rel[:i], true) {
+			return true
+		}
+	}
+	return s.decide(rel, isDir)
+}
+
+// Select reports whether a file is selected by a filePattern list. Unlike
+// Match, patterns are applied in order to the file and each of its parent
+// directories, the last that matches deciding, so "!*_test.go" or
+// "!mocks/" after "*.go" drops files a positive pattern selected; a list of
+// negations only starts from every file.
+func (s *Set) Select(rel string) bool {
+	return s.SelectIn(rel, "")
+}
+
+// SelectIn is Select for a file found below dir, a source path relative to
+// the same root as rel: patterns containing a slash also match the path
+// relative to dir, so "*/handler.go" works for sourcePaths "internal" as
+// "internal/*/handler.go" does from the root.
+func (s *Set) SelectIn(rel, dir string) bool {
+	if s.Empty() {
+		return true
+	}
+	rel, dir = strings.TrimPrefix(rel, "./"), strings.TrimPrefix(dir, "./")
+	if s.fold {
+		rel, dir = strings.ToLower(rel), strings.ToLower(dir)
+	}
+	var sub string
+	if dir = strings.Trim(dir, "/"); dir != "" && dir != "." {
+		sub, _ = strings.CutPrefix(rel, dir+"/")
+		if sub == rel {
+			sub = ""
+		}
+	}
+	selected := true
+	for _, p := range s.patterns {
+		if !p.negate {
+			selected = false
+			break
+		}
+	}
+	for _, p := range s.patterns {
+		if p.matchPath(rel) || p.anchored && sub != "" && p.matchPath(sub) {
+			selected = !p.negate
+		}
+	}
+	return selected
+}
+
+// matchPath reports whether p matches the file rel or, unless p is a
+// regular expression, one of its parent directories.
+func (p pattern) matchPath(rel string) bool {
+	for i := 0; i < len(rel) && !p.either; i++ {
+		if rel[i] == '/' && p.match(rel[:i], rel[strings.LastIndexByte(rel[:i], '/')+1:i], true) {
+			return true
+		}
+	}
+	return p.match(rel, rel[strings.LastIndexByte(rel, '/')+1:], false)
+}
+
+// decide applies the patterns to one path, ignoring its parents.
+func (s *Set) decide(rel string, isDir bool) bool {
+	base := rel[strings.LastIndexByte(rel, '/')+1:]
+	if !s.negates {
+		for _, p := range s.patterns {
+			if p.match(rel, base, isDir) {
+				return true
+			}
+		}
+		return false
+	}
+	for i := len(s.patterns) - 1; i >= 0; i-- {
+		if p := s.patterns[i]; p.match(rel, base, isDir) {
+			return !p.negate
+		}
+	}
+	return false
+}
+
+func (p pattern) match(rel, base string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if p.either {
+		return p.re.MatchString(base) || p.re.MatchString(rel)
+	}
+	v := base
+	if p.anchored {
+		v = rel
+	}
+	switch p.kind {
+	case kindLiteral:
+		return v == p.lit
+	case kindSuffix:
+		return strings.HasSuffix(v, p.lit)
+	case kindPrefix:
+		return strings.HasPrefix(v, p.lit)
+	default:
+		return p.re.MatchString(v)
+	}
+}
@@ -0,0 +1,268 @@
+package match
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		path     string
+		dir      bool
+		want     bool
+	}{
+		// base names at any depth
+		{"literal base", []string{"vendor"}, "a/vendor", true, true},
+		{"literal file", []string{"go.sum"}, "x/go.sum", false, true},
+		{"suffix", []string{"*.go"}, "a/b/c.go", false, true},
+		{"suffix other ext", []string{"*.go"}, "a/b/c.gox", false, false},
+		{"prefix", []string{"tmp*"}, "a/tmpfile", false, true},
+		{"question", []string{"?.go"}, "a/x.go", false, true},
+		{"question two chars", []string{"?.go"}, "a/xy.go", false, false},
+		{"star within segment", []string{"a*b"}, "a/b", false, false},
+
+		// anchoring
+		{"leading slash root", []string{"/build"}, "build", true, true},
+		{"leading slash nested", []string{"/build"}, "x/build", true, false},
+		{"inner slash anchors", []string{"docs/*.md"}, "docs/a.md", false, true},
+		{"inner slash nested", []string{"docs/*.md"}, "x/docs/a.md", false, false},
+		{"inner slash star stays in segment", []string{"docs/*.md"}, "docs/x/a.md", false, false},
+		{"dot slash prefix", []string{"./build"}, "build", false, true},
+
+		// **
+		{"leading ** at root", []string{"**/testdata"}, "testdata", true, true},
+		{"leading ** nested", []string{"**/testdata"}, "a/b/testdata", true, true},
+		{"inner ** none", []string{"a/**/b"}, "a/b", false, true},
+		{"inner ** one", []string{"a/**/b"}, "a/x/b", false, true},
+		{"inner ** many", []string{"a/**/b"}, "a/x/y/b", false, true},
+		{"inner ** other root", []string{"a/**/b"}, "c/x/b", false, false},
+		{"trailing **", []string{"docs/**"}, "docs/a/b.md", false, true},
+		{"trailing ** not sibling", []string{"docs/**"}, "docsx/a.md", false, false},
+		{"double star in segment is star", []string{"a**b"}, "x/a/b", false, false},
+
+		// directories
+		{"dir only on dir", []string{"build/"}, "x/build", true, true},
+		{"dir only on file", []string{"build/"}, "x/build", false, false},
+		{"dir only covers files below", []string{"build/"}, "x/build/out.o", false, true},
+		{"parent dir covers file", []string{"vendor"}, "vendor/a/b.go", false, true},
+
+		// negation: last match wins
+		{"negation after", []string{"*.go", "!main.go"}, "main.go", false, false},
+		{"negation keeps others", []string{"*.go", "!main.go"}, "x.go", false, true},
+		{"negation before", []string{"!main.go", "*.go"}, "main.go", false, true},
+		{"negation only", []string{"!main.go"}, "x.go", false, false},
+		{"negation of parent does not cover child", []string{"a/", "!a/b"}, "a/b/c", false, true},
+
+		// escapes
+		{"escaped star literal", []string{`\*.go`}, "*.go", false, true},
+		{"escaped star no glob", []string{`\*.go`}, "x.go", false, false},
+		{"escaped question", []string{`a\?`}, "a?", false, true},
+		{"escaped bang", []string{`\!x`}, "!x", false, true},
+		{"escaped hash", []string{`\#x`}, "#x", false, true},
+		{"escaped bracket", []string{`\[x]`}, "[x]", false, true},
+		{"backslash separates", []string{`vendor\lib`}, "vendor/lib", true, true},
+		{"backslash separates anchored", []string{`vendor\lib`}, "x/vendor/lib", true, false},
+
+		// classes
+		{"class", []string{"[ab].go"}, "a.go", false, true},
+		{"class miss", []string{"[ab].go"}, "c.go", false, false},
+		{"class range", []string{"v[0-9]"}, "v7", false, true},
+		{"class negated bang", []string{"[!a]x"}, "bx", false, true},
+		{"class negated bang miss", []string{"[!a]x"}, "ax", false, false},
+		{"class negated caret", []string{"[^a]x"}, "bx", false, true},
+		{"class leading bracket", []string{"[]]"}, "]", false, true},
+		{"class leading bracket miss", []string{"[]]"}, "x", false, false},
+		{"class negated leading bracket", []string{"[!]]"}, "x", false, true},
+		{"class negated leading bracket miss", []string{"[!]]"}, "]", false, false},
+		{"class escaped bracket", []string{`[\]a]`}, "]", false, true},
+		{"class never matches slash", []string{"a[/]b"}, "a/b", false, false},
+		{"class range never matches slash", []string{"a[.-0]b"}, "a/b", false, false},
+		{"class range keeps ends", []string{"a[.-0]b"}, "a0b", false, true},
+		{"negated class never matches slash", []string{"a[!x]b"}, "a/b", false, false},
+		{"class multibyte", []string{"caf[é]"}, "café", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Compile(tt.patterns)
+			if err != nil {
+				t.Fatalf("Compile(%q): %v", tt.patterns, err)
+			}
+			match := s.Match
+			if tt.dir {
+				match = s.MatchDir
+			}
+			if got := match(tt.path); got != tt.want {
+				t.Errorf("%q matching %q (dir %v) = %v, want %v", tt.patterns, tt.path, tt.dir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, g := range []string{"[", "a[b", "[]", "[!]", "[z-a]", `[a\`} {
+		if _, err := Compile([]string{g}); err == nil {
+			t.Errorf("Compile(%q): want error", g)
+		}
+	}
+}
+
+func TestMatchVersusMatchDir(t *testing.T) {
+	s, err := Compile([]string{"build/", "*.log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path            string
+		match, matchDir bool
+	}{
+		{"build", false, true},
+		{"a/build", false, true},
+		{"build/x.go", true, true},
+		{"x.log", true, true},
+		{"x.go", false, false},
+	}
+	for _, tt := range tests {
+		if got := s.Match(tt.path); got != tt.match {
+			t.Errorf("Match(%q) = %v, want %v", tt.path, got, tt.match)
+		}
+		if got := s.MatchDir(tt.path); got != tt.matchDir {
+			t.Errorf("MatchDir(%q) = %v, want %v", tt.path, got, tt.matchDir)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns string
+		path     string
+		want     bool
+	}{
+		{"empty selects all", "", "a/b.txt", true},
+		{"positive", "*.go", "a/b.go", true},
+		{"positive miss", "*.go", "a/b.txt", false},
+		{"negation drops", "*.go,!*_test.go", "a/b_test.go", false},
+		{"negation keeps", "*.go,!*_test.go", "a/b.go", true},
+		{"negated dir drops", "*.go,!mocks/", "a/mocks/m.go", false},
+		{"later positive restores", "*.go,!*_test.go,integration_test.go", "a/integration_test.go", true},
+		{"negations only start from all", "!*_test.go", "a/b.txt", true},
+		{"negations only drop", "!*_test.go", "a/b_test.go", false},
+		{"order matters", "!*_test.go,*.go", "a/b_test.go", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := CompileCSV(tt.patterns)
+			if err != nil {
+				t.Fatalf("CompileCSV(%q): %v", tt.patterns, err)
+			}
+			if got := s.Select(tt.path); got != tt.want {
+				t.Errorf("%q selecting %q = %v, want %v", tt.patterns, tt.path, got, tt.want)
+			}
+		})
+	}
+
+	// Match does not let a negation drop what an earlier pattern matched
+	// through a parent directory, Select does
+	s, err := CompileCSV("src/,!src/gen/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Match("src/gen/x.go") {
+		t.Error(`Match("src/gen/x.go") = false, want true`)
+	}
+	if s.Select("src/gen/x.go") {
+		t.Error(`Select("src/gen/x.go") = true, want false`)
+	}
+}
+
+func TestSelectIn(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		dir     string
+		path    string
+		want    bool
+	}{
+		{"from root", "internal/*/handler.go", "", "internal/user/handler.go", true},
+		{"from root with source path", "internal/*/handler.go", "internal", "internal/user/handler.go", true},
+		{"from source path", "*/handler.go", "internal", "internal/user/handler.go", true},
+		{"from source path dot slash", "*/handler.go", "./internal/", "internal/user/handler.go", true},
+		{"from root too deep", "internal/*/handler.go", "", "internal/user/v1/handler.go", false},
+		{"from source path too deep", "*/handler.go", "internal", "internal/user/v1/handler.go", false},
+		{"from source path other name", "*/handler.go", "internal", "internal/user/service.go", false},
+		{"from source path outside", "*/handler.go", "internal", "cmd/user/handler.go", false},
+		{"relative pattern without source path", "*/handler.go", "", "internal/user/handler.go", false},
+		{"source path root", "*/handler.go", ".", "user/handler.go", true},
+		{"base name pattern ignores source path", "handler.go", "internal", "internal/user/handler.go", true},
+		{"negation from source path", "*.go,!*/gen.go", "internal", "internal/user/gen.go", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := CompileCSV(tt.pattern)
+			if err != nil {
+				t.Fatalf("CompileCSV(%q): %v", tt.pattern, err)
+			}
+			if got := s.SelectIn(tt.path, tt.dir); got != tt.want {
+				t.Errorf("%q in %q selecting %q = %v, want %v", tt.pattern, tt.dir, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileFilePattern(t *testing.T) {
+	tests := []struct {
+		expr, syntax string
+		fold         bool
+		path         string
+		want         bool
+	}{
+		{"*.md", "glob", false, "README.MD", false},
+		{"*.md", "glob", true, "README.MD", true},
+		{`^(handler|service)_.*\.go$`, "regex", false, "a/handler_x.go", true},
+		{`^(handler|service)_.*\.go$`, "regex", false, "a/repo_x.go", false},
+		{`^a/.*\.go$`, "regex", false, "a/b/c.go", true},
+		{`^HANDLER`, "regex", true, "handler.go", true},
+	}
+	for _, tt := range tests {
+		s, err := CompileFilePattern(tt.expr, tt.syntax, tt.fold)
+		if err != nil {
+			t.Fatalf("CompileFilePattern(%q, %q): %v", tt.expr, tt.syntax, err)
+		}
+		if got := s.Select(tt.path); got != tt.want {
+			t.Errorf("%s %q (fold %v) selecting %q = %v, want %v", tt.syntax, tt.expr, tt.fold, tt.path, got, tt.want)
+		}
+	}
+	if _, err := CompileFilePattern("*.go", "shell", false); err == nil {
+		t.Error("unknown syntax: want error")
+	}
+}
+
+func TestToSlash(t *testing.T) {
+	tests := map[string]string{
+		`vendor\lib`:    "vendor/lib",
+		`vendor\`:       "vendor/",
+		`\*.go`:         `\*.go`,
+		`a\\b`:          `a\\b`,
+		`a\ b`:          `a\ b`,
+		`docs\[x]\*`:    `docs\[x]\*`,
+		`docs\sub\*.md`: `docs/sub\*.md`,
+		"plain/path":    "plain/path",
+	}
+	for in, want := range tests {
+		if got := toSlash(in); got != want {
+			t.Errorf("toSlash(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestParseIgnore(t *testing.T) {
+	got := ParseIgnore([]byte("# comment\n\n*.log\n  build/  \n\\#hash\n"))
+	want := []string{"*.log", "build/", `\#hash`}
+	if len(got) != len(want) {
+		t.Fatalf("ParseIgnore = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("ParseIgnore[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
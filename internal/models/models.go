@@ -0,0 +1,93 @@
+// Package models lists the context limits and input prices of common LLMs,
+// to check a document against the model it is meant for and estimate what
+// sending it costs.
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Model describes one LLM.
+type Model struct {
+	Name          string
+	Provider      string
+	ContextWindow int     // tokens of input and output together
+	MaxOutput     int     // tokens the model writes at most per response
+	InputPrice    float64 // list price in USD per million input tokens; 0 when unknown
+}
+
+// Known lists the models Lookup finds, by provider.
+var Known = []Model{
+	{Name: "gpt-4o", Provider: "openai", ContextWindow: 128_000, MaxOutput: 16_384, InputPrice: 2.5},
+	{Name: "gpt-4o-mini", Provider: "openai", ContextWindow: 128_000, MaxOutput: 16_384, InputPrice: 0.15},
+	{Name: "gpt-4.1", Provider: "openai", ContextWindow: 1_047_576, MaxOutput: 32_768, InputPrice: 2},
+	{Name: "gpt-4.1-mini", Provider: "openai", ContextWindow: 1_047_576, MaxOutput: 32_768, InputPrice: 0.4},
+	{Name: "o3", Provider: "openai", ContextWindow: 200_000, MaxOutput: 100_000, InputPrice: 2},
+	{Name: "o4-mini", Provider: "openai", ContextWindow: 200_000, MaxOutput: 100_000, InputPrice: 1.1},
+	{Name: "claude-3-5-haiku", Provider: "anthropic", ContextWindow: 200_000, MaxOutput: 8_192, InputPrice: 0.8},
+	{Name: "claude-3-5-sonnet", Provider: "anthropic", ContextWindow: 200_000, MaxOutput: 8_192, InputPrice: 3},
+	{Name: "claude-3-7-sonnet", Provider: "anthropic", ContextWindow: 200_000, MaxOutput: 64_000, InputPrice: 3},
+	{Name: "claude-sonnet-4", Provider: "anthropic", ContextWindow: 200_000, MaxOutput: 64_000, InputPrice: 3},
+	{Name: "claude-opus-4", Provider: "anthropic", ContextWindow: 200_000, MaxOutput: 32_000, InputPrice: 15},
+	{Name: "gemini-1.5-pro", Provider: "google", ContextWindow: 2_097_152, MaxOutput: 8_192, InputPrice: 1.25},
+	{Name: "gemini-2.0-flash", Provider: "google", ContextWindow: 1_048_576, MaxOutput: 8_192, InputPrice: 0.1},
+	{Name: "gemini-2.5-flash", Provider: "google", ContextWindow: 1_048_576, MaxOutput: 65_536, InputPrice: 0.3},
+	{Name: "gemini-2.5-pro", Provider: "google", ContextWindow: 1_048_576, MaxOutput: 65_536, InputPrice: 1.25},
+	{Name: "llama-3.1-70b", Provider: "meta", ContextWindow: 131_072, MaxOutput: 4_096},
+	{Name: "llama-3.1-405b", Provider: "meta", ContextWindow: 131_072, MaxOutput: 4_096},
+	{Name: "deepseek-chat", Provider: "deepseek", ContextWindow: 65_536, MaxOutput: 8_192, InputPrice: 0.27},
+	{Name: "mistral-large", Provider: "mistral", ContextWindow: 131_072, MaxOutput: 4_096, InputPrice: 2},
+}
+
+// Lookup returns the model called name, ignoring case. A name with a date
+// or version suffix, such as claude-3-5-sonnet-20241022, finds its model.
+func Lookup(name string) (Model, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	var best Model
+	for _, m := range Known {
+		if name == m.Name {
+			return m, nil
+		}
+		if strings.HasPrefix(name, m.Name+"-") && len(m.Name) > len(best.Name) {
+			best = m
+		}
+	}
+	if best.Name != "" {
+		return best, nil
+	}
+	names := make([]string, len(Known))
+	for i, m := range Known {
+		names[i] = m.Name
+	}
+	sort.Strings(names)
+	return Model{}, fmt.Errorf("unknown model %q (known: %s)", name, strings.Join(names, ", "))
+}
+
+// InputCost returns the price in USD of sending tokens input tokens to m.
+func (m Model) InputCost(tokens int) float64 {
+	return float64(tokens) * m.InputPrice / 1_000_000
+}
+
+// Priced looks up the model called name with its input price, taking the
+// price from pricing (USD per million tokens by model name, ignoring case)
+// over the built-in one. A model only in pricing is known by its price.
+func Priced(name string, pricing map[string]float64) (Model, error) {
+	m, err := Lookup(name)
+	for n, price := range pricing {
+		if strings.EqualFold(n, strings.TrimSpace(name)) {
+			if err != nil {
+				m, err = Model{Name: strings.ToLower(n)}, nil
+			}
+			m.InputPrice = price
+		}
+	}
+	if err != nil {
+		return m, err
+	}
+	if m.InputPrice == 0 {
+		return m, fmt.Errorf("no input price for model %q: set it under pricing", m.Name)
+	}
+	return m, nil
+}
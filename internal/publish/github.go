@@ -0,0 +1,175 @@
+// Package publish posts generated documents to code review systems.
+package publish
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go_project_context_maker/internal/export"
+)
+
+// maxCommentBytes keeps each comment under GitHub's 65536 character limit
+// with room for the marker and part heading.
+const maxCommentBytes = 65000
+
+// markerRe finds the hidden marker that identifies comments written by
+// Publish, so reruns update them instead of adding new ones.
+var markerRe = regexp.MustCompile(`^<!-- gpcm-publish: (.+) part (\d+) -->`)
+
+// GitHubPR publishes documents as comments on one pull request.
+type GitHubPR struct {
+	API    string // REST API base URL, e.g. "https://api.github.com"
+	Token  string
+	Repo   string // "owner/name"
+	Number int
+	Client *http.Client
+}
+
+// NewGitHubPR configures a pull request target from the environment:
+// GITHUB_TOKEN, GITHUB_API_URL and, when repo is empty, GITHUB_REPOSITORY.
+func NewGitHubPR(repo string, number int) (*GitHubPR, error) {
+	token := os.Getenv("GITHUB_TOKEN")
+	if token == "" {
+		return nil, errors.New("GITHUB_TOKEN is not set")
+	}
+	if repo == "" {
+		repo = os.Getenv("GITHUB_REPOSITORY")
+	}
+	if !strings.Contains(repo, "/") {
+		return nil, fmt.Errorf("repository %q is not owner/name (set -repo or GITHUB_REPOSITORY)", repo)
+	}
+	if number <= 0 {
+		return nil, fmt.Errorf("invalid pull request number %d", number)
+	}
+	api := os.Getenv("GITHUB_API_URL")
+	if api == "" {
+		api = "https://api.github.com"
+	}
+	return &GitHubPR{
+		API:    strings.TrimRight(api, "/"),
+		Token:  token,
+		Repo:   repo,
+		Number: number,
+		Client: &http.Client{Timeout: time.Minute},
+	}, nil
+}
+
+type comment struct {
+	ID      int64  `json:"id"`
+	Body    string `json:"body"`
+	HTMLURL string `json:"html_url"`
+}
+
+// Publish posts content as one or more comments (split at file boundaries
+// when it exceeds the comment size limit). Comments from an earlier run for
+// the same document are edited in place and surplus parts are deleted.
+// It returns the URLs of the comments.
+func (g *GitHubPR) Publish(docPath, content string) ([]string, error) {
+	existing, err := g.ownComments(docPath)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := export.Split(content, maxCommentBytes)
+	urls := make([]string, 0, len(parts))
+	for i, part := range parts {
+		var body strings.Builder
+		fmt.Fprintf(&body, "<!-- gpcm-publish: %s part %d -->\n", docPath, i+1)
+		if len(parts) > 1 {
+			fmt.Fprintf(&body, "_%s, part %d of %d_\n\n", docPath, i+1, len(parts))
+		}
+		body.WriteString(part)
+
+		var c comment
+		if old, ok := existing[i+1]; ok {
+			err = g.do(http.MethodPatch, fmt.Sprintf("/repos/%s/issues/comments/%d", g.Repo, old.ID), body.String(), &c)
+			delete(existing, i+1)
+		} else {
+			err = g.do(http.MethodPost, fmt.Sprintf("/repos/%s/issues/%d/comments", g.Repo, g.Number), body.String(), &c)
+		}
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, c.HTMLURL)
+	}
+	for _, old := range existing {
+		if err := g.do(http.MethodDelete, fmt.Sprintf("/repos/%s/issues/comments/%d", g.Repo, old.ID), "", nil); err != nil {
+			return nil, err
+		}
+	}
+	return urls, nil
+}
+
+// ownComments returns the comments previously published for docPath, by part number.
+func (g *GitHubPR) ownComments(docPath string) (map[int]comment, error) {
+	out := make(map[int]comment)
+	for page := 1; ; page++ {
+		var batch []comment
+		path := fmt.Sprintf("/repos/%s/issues/%d/comments?per_page=100&page=%d", g.Repo, g.Number, page)
+		if err := g.do(http.MethodGet, path, "", &batch); err != nil {
+			return nil, err
+		}
+		for _, c := range batch {
+			m := markerRe.FindStringSubmatch(c.Body)
+			if m == nil || m[1] != docPath {
+				continue
+			}
+			n, _ := strconv.Atoi(m[2])
+			out[n] = c
+		}
+		if len(batch) < 100 {
+			return out, nil
+		}
+	}
+}
+
+// do sends a REST request; body, when not empty, is sent as {"body": body}
+// and the JSON response is decoded into out when out is not nil.
+func (g *GitHubPR) do(method, path, body string, out any) error {
+	var reqBody io.Reader
+	if body != "" {
+		data, err := json.Marshal(map[string]string{"body": body})
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, g.API+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+g.Token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if reqBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, bytes.TrimSpace(data))
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("decode response: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+// Package redact replaces credentials in generated documents with
+// "[REDACTED:<rule>]" markers before they are written.
+package redact
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// rule is a compiled redaction rule. When the expression has a capture
+// group, only the first group is replaced, so surrounding context such as
+// "password = " stays readable.
+type rule struct {
+	name       string
+	re         *regexp.Regexp
+	minEntropy float64 // bits per character the match must reach; 0 disables the check
+}
+
+// builtins are enabled by the "builtin" entry or individually by name.
+var builtins = []rule{
+	{name: "private-key", re: regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----[\s\S]*?-----END [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`)},
+	{name: "aws-access-key", re: regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[0-9A-Z]{16}\b`)},
+	{name: "aws-secret-key", re: regexp.MustCompile(`(?i)aws.{0,20}?(?:secret|private).{0,20}?["'=:\s]+([A-Za-z0-9/+]{40})\b`)},
+	{name: "github-token", re: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{60,})\b`)},
+	{name: "jwt", re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`)},
+	{name: "high-entropy", minEntropy: 3.5, re: regexp.MustCompile(`(?i)(?:api[_-]?key|token|secret|passw(?:or)?d|pwd|credential|auth)[a-z_-]*["']?\s*[:=]\s*["']?([A-Za-z0-9+/=_\-.~]{16,})`)},
+}
+
+// BuiltinNames lists the built-in rule names.
+func BuiltinNames() []string {
+	names := make([]string, len(builtins))
+	for i, r := range builtins {
+		names[i] = r.name
+	}
+	return names
+}
+
+// Rule is a configured redaction rule. A rule without a pattern names a
+// built-in rule, or every built-in rule when the name is "builtin".
+type Rule struct {
+	Name    string
+	Pattern string
+}
+
+// Redactor applies a set of rules.
+type Redactor struct {
+	rules []rule
+}
+
+// New compiles rules in order; duplicates by name are ignored.
+func New(rules []Rule) (*Redactor, error) {
+	r := &Redactor{}
+	seen := make(map[string]bool)
+	add := func(ru rule) {
+		if !seen[ru.name] {
+			seen[ru.name] = true
+			r.rules = append(r.rules, ru)
+		}
+	}
+	for _, rr := range rules {
+		name := strings.TrimSpace(rr.Name)
+		if rr.Pattern == "" {
+			if name == "builtin" {
+				for _, b := range builtins {
+					add(b)
+				}
+				continue
+			}
+			b, ok := lookupBuiltin(name)
+			if !ok {
+				return nil, fmt.Errorf("unknown built-in redaction rule %q (expected builtin or one of %s)", name, strings.Join(BuiltinNames(), ", "))
+			}
+			add(b)
+			continue
+		}
+		if name == "" {
+			return nil, fmt.Errorf("redaction pattern %q needs a name", rr.Pattern)
+		}
+		re, err := regexp.Compile(rr.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redaction rule %s: %w", name, err)
+		}
+		add(rule{name: name, re: re})
+	}
+	return r, nil
+}
+
+func lookupBuiltin(name string) (rule, bool) {
+	for _, b := range builtins {
+		if b.name == name {
+			return b, true
+		}
+	}
+	return rule{}, false
+}
+
+// Apply returns s with every match replaced and the number of replacements per rule.
+func (r *Redactor) Apply(s string) (string, map[string]int) {
+	counts := make(map[string]int)
+	if r == nil {
+		return s, counts
+	}
+	for _, ru := range r.rules {
+		s = ru.apply(s, counts)
+	}
+	return s, counts
+}
+
+func (ru rule) apply(s string, counts map[string]int) string {
+	matches := ru.re.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+	marker := "[REDACTED:" + ru.name + "]"
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if len(m) >= 4 && m[2] >= 0 {
+			start, end = m[2], m[3]
+		}
+		if ru.minEntropy > 0 && entropy(s[start:end]) < ru.minEntropy {
+			continue
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(marker)
+		last = end
+		counts[ru.name]++
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// entropy returns the Shannon entropy of s in bits per byte.
+func entropy(s string) float64 {
+	var freq [256]int
+	for i := 0; i < len(s); i++ {
+		freq[s[i]]++
+	}
+	var h float64
+	n := float64(len(s))
+	for _, c := range freq {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / n
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// Summary formats per-rule counts as "jwt 2, private-key 1", or "" when empty.
+func Summary(counts map[string]int) string {
+	names := make([]string, 0, len(counts))
+	for n := range counts {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, n := range names {
+		parts[i] = fmt.Sprintf("%s %d", n, counts[n])
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,315 @@
+// Package selfupdate reports the build of the running binary and replaces
+// it with a release published on GitHub.
+package selfupdate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Repo is the GitHub repository releases are published in.
+const Repo = "hightemp/go_project_context_maker"
+
+// ChecksumsAsset is the release asset listing the SHA-256 of the others, as
+// sha256sum writes it; downloads are checked against it.
+const ChecksumsAsset = "checksums.txt"
+
+// maxBinary bounds a downloaded binary.
+const maxBinary = 256 << 20
+
+// Info describes the build of the running binary.
+type Info struct {
+	Version   string `json:"version"` // release tag, e.g. "v1.4.0", or "(devel)"
+	Commit    string `json:"commit,omitempty"`
+	Date      string `json:"date,omitempty"`     // commit or build time, RFC 3339
+	Modified  bool   `json:"modified,omitempty"` // built from a tree with uncommitted changes
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"` // GOOS/GOARCH
+}
+
+// Current returns the build info: version, commit and date as set with
+// -ldflags "-X main.version=..." when given, else what the Go toolchain
+// recorded (the module version with go install, the VCS revision with go
+// build in a checkout).
+func Current(version, commit, date string) Info {
+	info := Info{
+		Version:   version,
+		Commit:    commit,
+		Date:      date,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.Date == "" {
+					info.Date = s.Value
+				}
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "(devel)"
+	}
+	return info
+}
+
+func (i Info) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "gpcm %s", i.Version)
+	if i.Commit != "" {
+		commit := i.Commit
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		fmt.Fprintf(&b, " (%s", commit)
+		if i.Modified {
+			b.WriteString(", modified")
+		}
+		if i.Date != "" {
+			fmt.Fprintf(&b, ", %s", i.Date)
+		}
+		b.WriteString(")")
+	}
+	fmt.Fprintf(&b, " %s %s", i.GoVersion, i.Platform)
+	return b.String()
+}
+
+// AssetName is the name of the release asset for a platform:
+// gpcm_<goos>_<goarch>, with .exe on Windows.
+func AssetName(goos, goarch string) string {
+	name := "gpcm_" + goos + "_" + goarch
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// Release is a published GitHub release.
+type Release struct {
+	Tag    string  `json:"tag_name"`
+	URL    string  `json:"html_url"`
+	Assets []Asset `json:"assets"`
+}
+
+// Asset is a file attached to a release.
+type Asset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+	Size int64  `json:"size"`
+}
+
+// Client talks to the GitHub API. GITHUB_TOKEN, when set, raises the rate
+// limit; GITHUB_API_URL points at GitHub Enterprise.
+type Client struct {
+	API   string // REST API base URL
+	Token string
+	HTTP  *http.Client
+}
+
+// NewClient configures a client from the environment.
+func NewClient() *Client {
+	api := os.Getenv("GITHUB_API_URL")
+	if api == "" {
+		api = "https://api.github.com"
+	}
+	return &Client{
+		API:   strings.TrimRight(api, "/"),
+		Token: os.Getenv("GITHUB_TOKEN"),
+		HTTP:  &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// Release returns the release tagged tag, or the latest one when tag is
+// empty.
+func (c *Client) Release(ctx context.Context, tag string) (Release, error) {
+	var rel Release
+	path := "/repos/" + Repo + "/releases/latest"
+	if tag != "" {
+		path = "/repos/" + Repo + "/releases/tags/" + tag
+	}
+	data, err := c.get(ctx, c.API+path, 1<<20)
+	if err != nil {
+		return rel, err
+	}
+	if err := json.Unmarshal(data, &rel); err != nil {
+		return rel, fmt.Errorf("decode release: %w", err)
+	}
+	return rel, nil
+}
+
+// ErrUnverified is returned by Download for a release without checksums.
+var ErrUnverified = errors.New("release has no " + ChecksumsAsset + " to verify the download")
+
+// Download fetches the asset for the running platform from rel, checked
+// against the release's checksums. A release without them fails with
+// ErrUnverified unless unverified is set.
+func (c *Client) Download(ctx context.Context, rel Release, unverified bool) ([]byte, error) {
+	name := AssetName(runtime.GOOS, runtime.GOARCH)
+	var asset, sums *Asset
+	for i, a := range rel.Assets {
+		switch a.Name {
+		case name:
+			asset = &rel.Assets[i]
+		case ChecksumsAsset:
+			sums = &rel.Assets[i]
+		}
+	}
+	if asset == nil {
+		return nil, fmt.Errorf("release %s has no %s", rel.Tag, name)
+	}
+	if sums == nil && !unverified {
+		return nil, fmt.Errorf("%s: %w", rel.Tag, ErrUnverified)
+	}
+	data, err := c.get(ctx, asset.URL, maxBinary)
+	if err != nil {
+		return nil, err
+	}
+	if sums != nil {
+		list, err := c.get(ctx, sums.URL, 1<<20)
+		if err != nil {
+			return nil, err
+		}
+		if err := verify(list, name, data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// verify checks data against the line for name in a sha256sum listing.
+func verify(list []byte, name string, data []byte) error {
+	sum := sha256.Sum256(data)
+	sc := bufio.NewScanner(bytes.NewReader(list))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			if !strings.EqualFold(fields[0], hex.EncodeToString(sum[:])) {
+				return fmt.Errorf("%s: checksum mismatch", name)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: not listed in %s", name, ChecksumsAsset)
+}
+
+func (c *Client) get(ctx context.Context, url string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(url, c.API) {
+		req.Header.Set("Accept", "application/vnd.github+json")
+		if c.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.Token)
+		}
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("GET %s: %w", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("GET %s: larger than %d bytes", url, limit)
+	}
+	return data, nil
+}
+
+// Replace writes data over the executable at exe, through a temporary file
+// in the same directory so the swap is a rename. On Windows, where a
+// running program cannot be overwritten, the old binary is moved aside to
+// exe+".old" first.
+func Replace(exe string, data []byte) error {
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	info, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".gpcm-update-*")
+	if err != nil {
+		return fmt.Errorf("write new binary: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write new binary: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write new binary: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()|0o111); err != nil {
+		return err
+	}
+	old := ""
+	if runtime.GOOS == "windows" {
+		old = exe + ".old"
+		_ = os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return fmt.Errorf("move old binary aside: %w", err)
+		}
+	}
+	if err := os.Rename(tmp.Name(), exe); err != nil {
+		if old != "" {
+			// put the old binary back rather than leave none
+			if rerr := os.Rename(old, exe); rerr != nil {
+				return fmt.Errorf("replace %s: %w (the old binary is left at %s: %v)", exe, err, old, rerr)
+			}
+		}
+		return fmt.Errorf("replace %s: %w", exe, err)
+	}
+	return nil
+}
+
+// ErrDevel is returned by NeedsUpdate for builds without a release version.
+var ErrDevel = errors.New("not a release build")
+
+var (
+	// releaseRe matches release versions such as v1.4.0 or v1.5.0-rc.1
+	releaseRe = regexp.MustCompile(`^v?\d+\.\d+\.\d+(?:-[0-9A-Za-z.]+)?$`)
+	// pseudoRe matches the pseudo-versions go build records in a checkout
+	pseudoRe = regexp.MustCompile(`\d{14}-[0-9a-f]{12}$`)
+)
+
+// NeedsUpdate reports whether tag is a different release than the running
+// version. Development builds (a commit, a pseudo-version or uncommitted
+// changes) return true with ErrDevel, as there is nothing to compare.
+func NeedsUpdate(current Info, tag string) (bool, error) {
+	if !releaseRe.MatchString(current.Version) || pseudoRe.MatchString(current.Version) {
+		return true, ErrDevel
+	}
+	return strings.TrimPrefix(current.Version, "v") != strings.TrimPrefix(tag, "v"), nil
+}
@@ -0,0 +1,143 @@
+// Package server serves context documents over HTTP, generating them on
+// demand so bots and internal tools always get fresh context.
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	cfg "go_project_context_maker/internal/config"
+	"go_project_context_maker/internal/generator"
+)
+
+// contentTypes maps output formats to response content types.
+var contentTypes = map[string]string{
+	"markdown":     "text/markdown; charset=utf-8",
+	"md":           "text/markdown; charset=utf-8",
+	"xml":          "application/xml; charset=utf-8",
+	"html":         "text/html; charset=utf-8",
+	"text":         "text/plain; charset=utf-8",
+	"txt":          "text/plain; charset=utf-8",
+	"json":         "application/json",
+	"jsonl-chunks": "application/x-ndjson",
+	"repomix":      "text/plain; charset=utf-8", // XML-like, but contents are not escaped
+	"gitingest":    "text/plain; charset=utf-8",
+}
+
+// Server answers:
+//
+//	GET /healthz                 "ok"
+//	GET /documents               the configured documents as JSON
+//	GET /documents/{name}        the document, rendered now; ?format= picks
+//	                             markdown, json, xml, html or text
+type Server struct {
+	// Load returns the config and project root; it runs for every request,
+	// so edits to the config apply without a restart.
+	Load func() (cfg.Config, string, error)
+	// Options returns the generator options for one request (run id, jobs).
+	Options func() (generator.Options, error)
+}
+
+// DocumentInfo describes one document in the GET /documents listing.
+type DocumentInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Format      string `json:"format"`
+	URL         string `json:"url"`
+}
+
+// Handler returns the HTTP handler serving s.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("GET /documents", s.list)
+	mux.HandleFunc("GET /documents/{name...}", s.document)
+	return mux
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	conf, _, err := s.Load()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	docs := make([]DocumentInfo, 0, len(conf.Documents))
+	for _, d := range conf.Documents {
+		name := docName(d)
+		t := d.Targets()[0]
+		docs = append(docs, DocumentInfo{
+			Name:        name,
+			Description: d.Description,
+			Format:      generator.ResolveFormat(t.Format, t.Path),
+			URL:         "/documents/" + name,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(docs)
+}
+
+func (s *Server) document(w http.ResponseWriter, r *http.Request) {
+	conf, root, err := s.Load()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	name := r.PathValue("name")
+	var doc *cfg.Document
+	for i := range conf.Documents {
+		if docName(conf.Documents[i]) == name {
+			doc = &conf.Documents[i]
+			break
+		}
+	}
+	if doc == nil {
+		http.Error(w, fmt.Sprintf("document not found: %s", name), http.StatusNotFound)
+		return
+	}
+
+	t := doc.Targets()[0]
+	format := generator.ResolveFormat(t.Format, t.Path)
+	if f := strings.ToLower(r.URL.Query().Get("format")); f != "" {
+		if _, ok := contentTypes[f]; !ok {
+			http.Error(w, fmt.Sprintf("unknown format %q", f), http.StatusBadRequest)
+			return
+		}
+		format = f
+	}
+	// one response: render to stdout in one piece
+	one := *doc
+	one.OutputPath, one.OutputFormat, one.Outputs = generator.StdoutPath, format, nil
+	one.SplitBy, one.SplitSize = "", ""
+	conf.Documents = []cfg.Document{one}
+
+	opts, err := s.Options()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	outs, err := generator.Render(conf, root, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentTypes[format])
+	if opts.RunID != "" {
+		w.Header().Set("X-Run-Id", opts.RunID)
+	}
+	fmt.Fprint(w, outs[0].Content)
+}
+
+// docName is the name a document is served under: its name, or its output
+// path when it has none.
+func docName(d cfg.Document) string {
+	if d.Name != "" {
+		return d.Name
+	}
+	return d.Targets()[0].Path
+}
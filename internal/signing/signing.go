@@ -0,0 +1,82 @@
+// Package signing makes and checks detached signatures of generated
+// documents with ssh-keygen -Y, so consumers can tell a bundle came from a
+// trusted key and was not modified since.
+package signing
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Namespace is the ssh-keygen signature namespace of documents; a
+// signature made for another purpose (e.g. git commits) does not verify.
+const Namespace = "gpcm"
+
+// Suffix is appended to an output path for its signature.
+const Suffix = ".sig"
+
+// Sign returns an SSH signature of data made with the private key in
+// keyFile (ssh-keygen -Y sign).
+func Sign(keyFile string, data []byte) ([]byte, error) {
+	sig, err := sshKeygen(data, "-Y", "sign", "-f", keyFile, "-n", Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("sign: %w", err)
+	}
+	return sig, nil
+}
+
+// Verify checks sig over data against an allowed signers file (see
+// ssh-keygen(1), ALLOWED SIGNERS) and returns the principal that signed.
+// With an empty identity any principal whose key made the signature is
+// accepted; otherwise it must be identity.
+func Verify(allowedSigners, identity string, data, sig []byte) (string, error) {
+	// ssh-keygen reads the signature from a file
+	f, err := os.CreateTemp("", "gpcm-*"+Suffix)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(sig); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	if identity == "" {
+		out, err := sshKeygen(nil, "-Y", "find-principals", "-f", allowedSigners, "-s", f.Name())
+		if err != nil {
+			return "", fmt.Errorf("no allowed signer made this signature: %w", err)
+		}
+		identity, _, _ = strings.Cut(strings.TrimSpace(string(out)), "\n")
+	}
+	if _, err := sshKeygen(data, "-Y", "verify", "-f", allowedSigners, "-I", identity, "-n", Namespace, "-s", f.Name()); err != nil {
+		return "", fmt.Errorf("bad signature: %w", err)
+	}
+	return identity, nil
+}
+
+// sshKeygen runs ssh-keygen with stdin and returns its stdout; the error
+// carries what it printed to stderr.
+func sshKeygen(stdin []byte, args ...string) ([]byte, error) {
+	cmd := exec.Command("ssh-keygen", args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, errors.New("ssh-keygen not found (install OpenSSH 8.1 or later)")
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+	return out, nil
+}
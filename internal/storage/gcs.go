@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// GCS stores objects in Google Cloud Storage through its JSON API, with the
+// OAuth access token in GOOGLE_OAUTH_ACCESS_TOKEN (e.g. from
+// `gcloud auth print-access-token`).
+type GCS struct {
+	Client *http.Client // nil means http.DefaultClient
+}
+
+const gcsAPI = "https://storage.googleapis.com"
+
+func (g *GCS) Put(key string, data []byte, _ bool) error {
+	bucket, object, err := splitBucket(key)
+	if err != nil {
+		return fmt.Errorf("gs: %w", err)
+	}
+	u := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=media&name=%s", gcsAPI, url.PathEscape(bucket), url.QueryEscape(object))
+	req, err := g.request(http.MethodPost, u, data)
+	if err != nil {
+		return err
+	}
+	_, err = send(g.Client, req, "gs://"+key)
+	return err
+}
+
+func (g *GCS) Get(key string) ([]byte, error) {
+	bucket, object, err := splitBucket(key)
+	if err != nil {
+		return nil, fmt.Errorf("gs: %w", err)
+	}
+	u := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media", gcsAPI, url.PathEscape(bucket), url.PathEscape(object))
+	req, err := g.request(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	return send(g.Client, req, "gs://"+key)
+}
+
+func (g *GCS) request(method, u string, body []byte) (*http.Request, error) {
+	token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")
+	if token == "" {
+		return nil, errors.New("gs: GOOGLE_OAUTH_ACCESS_TOKEN must be set")
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("gs: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	return req, nil
+}
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// S3 stores objects in Amazon S3 or an S3-compatible service, signing
+// requests with AWS Signature Version 4. Credentials come from
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN, the
+// region from AWS_REGION (default us-east-1); AWS_ENDPOINT_URL selects
+// another service (MinIO, R2, ...), addressed path-style.
+type S3 struct {
+	Client *http.Client // nil means http.DefaultClient
+}
+
+func (s *S3) Put(key string, data []byte, _ bool) error {
+	_, err := s.do(http.MethodPut, key, data)
+	return err
+}
+
+func (s *S3) Get(key string) ([]byte, error) {
+	return s.do(http.MethodGet, key, nil)
+}
+
+func (s *S3) do(method, key string, body []byte) ([]byte, error) {
+	bucket, object, err := splitBucket(key)
+	if err != nil {
+		return nil, fmt.Errorf("s3: %w", err)
+	}
+	accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return nil, errors.New("s3: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	var url, host, path string
+	if endpoint := strings.TrimSuffix(os.Getenv("AWS_ENDPOINT_URL"), "/"); endpoint != "" {
+		path = "/" + bucket + "/" + uriEncode(object)
+		url = endpoint + path
+		host = strings.TrimPrefix(strings.TrimPrefix(endpoint, "https://"), "http://")
+	} else {
+		host = fmt.Sprintf("%s.s3.%s.amazonaws.com", bucket, region)
+		path = "/" + uriEncode(object)
+		url = "https://" + host + path
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("s3: %w", err)
+	}
+
+	now := time.Now().UTC()
+	amzDate, day := now.Format("20060102T150405Z"), now.Format("20060102")
+	payload := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(payload[:])
+	headers := map[string]string{"host": host, "x-amz-content-sha256": payloadHash, "x-amz-date": amzDate}
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		headers["x-amz-security-token"] = token
+	}
+	names := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if _, ok := headers["x-amz-security-token"]; ok {
+		names = append(names, "x-amz-security-token")
+	}
+	var canonHeaders strings.Builder
+	for _, n := range names {
+		canonHeaders.WriteString(n + ":" + headers[n] + "\n")
+		if n != "host" {
+			req.Header.Set(n, headers[n])
+		}
+	}
+	signed := strings.Join(names, ";")
+	canonical := strings.Join([]string{method, path, "", canonHeaders.String(), signed, payloadHash}, "\n")
+	scope := day + "/" + region + "/s3/aws4_request"
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+	k := hmacSHA256([]byte("AWS4"+secretKey), day)
+	for _, part := range []string{region, "s3", "aws4_request"} {
+		k = hmacSHA256(k, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%x",
+		accessKey, scope, signed, hmacSHA256(k, toSign)))
+
+	return send(s.Client, req, "s3://"+key)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// uriEncode escapes an object key the way SigV4 expects: everything but
+// unreserved characters and "/".
+func uriEncode(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.IndexByte("-._~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// send performs req and returns the response body; 404 wraps
+// fs.ErrNotExist and other non-2xx statuses are errors naming url.
+func send(client *http.Client, req *http.Request, url string) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", req.Method, url, err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("%s: %w", url, fs.ErrNotExist)
+	case resp.StatusCode/100 != 2:
+		return nil, fmt.Errorf("%s %s: %s: %s", req.Method, url, resp.Status, strings.TrimSpace(string(data[:min(len(data), 512)])))
+	}
+	return data, nil
+}
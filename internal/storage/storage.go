@@ -0,0 +1,210 @@
+// Package storage writes generated documents to where their output path
+// points: the local disk, memory, or object stores addressed by URL
+// scheme ("s3://bucket/key.md", "gs://bucket/key.md").
+package storage
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Storage stores documents by key: a file path for the disk, "bucket/key"
+// for object stores.
+type Storage interface {
+	// Put stores data under key. private asks for owner-only access where
+	// the backend has such a notion (file mode 0600 on disk).
+	Put(key string, data []byte, private bool) error
+	// Get returns the data under key; a missing key is an error wrapping
+	// fs.ErrNotExist.
+	Get(key string) ([]byte, error)
+}
+
+// ModeStorage is a Storage with file permissions, such as the disk.
+type ModeStorage interface {
+	Storage
+	// PutMode stores data under key with permissions mode.
+	PutMode(key string, data []byte, mode fs.FileMode) error
+}
+
+// Backends selects a Storage by the scheme of an output path; paths without
+// a scheme go to the disk.
+type Backends map[string]Storage
+
+// Default returns the backends available without configuration: the disk,
+// and s3 and gs with credentials from the environment.
+func Default() Backends {
+	return Backends{"s3": &S3{}, "gs": &GCS{}}
+}
+
+// For returns the storage for path and the key within it.
+func (b Backends) For(path string) (Storage, string, error) {
+	scheme, rest, ok := strings.Cut(path, "://")
+	if !ok || strings.ContainsAny(scheme, `/\.`) || len(scheme) < 2 {
+		// no scheme, or a Windows drive letter such as C:\
+		return Disk{}, path, nil
+	}
+	s, ok := b[scheme]
+	if !ok {
+		names := make([]string, 0, len(b))
+		for n := range b {
+			names = append(names, n+"://")
+		}
+		sort.Strings(names)
+		return nil, "", fmt.Errorf("no storage for %s (available: %s)", path, strings.Join(names, ", "))
+	}
+	return s, rest, nil
+}
+
+// IsLocal reports whether path is a file on disk rather than a URL.
+func IsLocal(path string) bool {
+	s, _, err := Backends(nil).For(path)
+	_, disk := s.(Disk)
+	return err == nil && disk
+}
+
+// Disk stores files on the local filesystem, creating parent directories.
+// Files are replaced atomically: data goes to a temporary file in the same
+// directory, which is then renamed over the target, so a crash never
+// leaves a truncated document behind.
+type Disk struct{}
+
+func (d Disk) Put(key string, data []byte, private bool) error {
+	perm := os.FileMode(0o644)
+	if private {
+		perm = 0o600
+	}
+	return d.PutMode(key, data, perm)
+}
+
+func (d Disk) PutMode(key string, data []byte, mode fs.FileMode) error {
+	f, err := d.Create(key, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Abort()
+		return err
+	}
+	return f.Commit()
+}
+
+// Create starts writing key in pieces, for documents too large to hold in
+// memory. Nothing replaces key until Commit; Abort discards what was
+// written.
+func (Disk) Create(key string, mode fs.FileMode) (*AtomicFile, error) {
+	dir := filepath.Dir(key)
+	if dir != "" && dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			if info, statErr := os.Stat(dir); statErr == nil && !info.IsDir() {
+				return nil, errors.New("path exists and is not a directory: " + dir)
+			}
+			return nil, err
+		}
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(key)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &AtomicFile{tmp: tmp, w: bufio.NewWriterSize(tmp, 256<<10), key: key, mode: mode}, nil
+}
+
+// AtomicFile is a file being written through a buffered temporary file in
+// the same directory, renamed over its target by Commit.
+type AtomicFile struct {
+	tmp  *os.File
+	w    *bufio.Writer
+	key  string
+	mode fs.FileMode
+}
+
+func (f *AtomicFile) Write(p []byte) (int, error) {
+	return f.w.Write(p)
+}
+
+// Commit flushes the file and renames it over the target.
+func (f *AtomicFile) Commit() error {
+	// after a successful rename there is nothing to remove
+	defer os.Remove(f.tmp.Name())
+	if err := f.w.Flush(); err != nil {
+		f.tmp.Close()
+		return err
+	}
+	if err := f.tmp.Chmod(f.mode); err != nil {
+		f.tmp.Close()
+		return err
+	}
+	if err := f.tmp.Sync(); err != nil {
+		f.tmp.Close()
+		return err
+	}
+	if err := f.tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.tmp.Name(), f.key)
+}
+
+// Abort removes the temporary file, leaving the target as it was.
+func (f *AtomicFile) Abort() {
+	f.tmp.Close()
+	os.Remove(f.tmp.Name())
+}
+
+func (Disk) Get(key string) ([]byte, error) {
+	return os.ReadFile(key)
+}
+
+// Memory keeps documents in memory, for library use and tests of callers.
+type Memory struct {
+	mu    sync.Mutex
+	items map[string][]byte
+}
+
+// NewMemory returns an empty Memory storage.
+func NewMemory() *Memory {
+	return &Memory{items: make(map[string][]byte)}
+}
+
+func (m *Memory) Put(key string, data []byte, _ bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items[key] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *Memory) Get(key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.items[key]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", key, fs.ErrNotExist)
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// Keys returns the stored keys, sorted.
+func (m *Memory) Keys() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]string, 0, len(m.items))
+	for k := range m.items {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// splitBucket splits "bucket/key" for the object stores.
+func splitBucket(key string) (bucket, object string, err error) {
+	bucket, object, ok := strings.Cut(key, "/")
+	if !ok || bucket == "" || object == "" {
+		return "", "", errors.New("expected bucket/key, got " + key)
+	}
+	return bucket, object, nil
+}
@@ -0,0 +1,398 @@
+// Package tui implements the interactive "tui" command: browse the project
+// tree, tick files and directories, watch the estimated token count and
+// either persist the selection as a config source or generate right away.
+//
+// The interface is line based (one command per line) so that it works in any
+// terminal, over ssh and in CI logs without a terminal library.
+package tui
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	cfg "go_project_context_maker/internal/config"
+	"go_project_context_maker/internal/generator"
+	"go_project_context_maker/internal/match"
+)
+
+// skipDirs are never offered for selection.
+var skipDirs = map[string]bool{".git": true, "vendor": true, "node_modules": true}
+
+// Session is one interactive selection over the files under Root.
+type Session struct {
+	Root string
+
+	// Save persists src into the document named doc, creating the document
+	// with outputPath output when it does not exist yet.
+	Save func(doc, output string, src cfg.Source) error
+	// Generate renders doc immediately.
+	Generate func(doc cfg.Document) error
+
+	files    []string         // every file under Root, slash separated, sorted
+	sizes    map[string]int64 // file sizes in bytes
+	selected map[string]bool
+	cwd      string  // current directory relative to Root, "" for the root
+	entries  []entry // the last listing, addressed by number
+}
+
+type entry struct {
+	name  string
+	rel   string
+	isDir bool
+}
+
+const help = `Commands:
+  ls                  list the current directory
+  cd N|NAME|..        change directory
+  t N...              toggle entries (a directory toggles every file below it)
+  p GLOB              preview files matching GLOB (path or base name)
+  a GLOB / r GLOB     add / remove files matching GLOB
+  sel                 show the selection
+  save DOC [OUTPUT]   save the selection as a file source of document DOC
+  gen OUTPUT          generate a document from the selection now
+  q                   quit
+`
+
+// Run scans Root and processes commands from in until "q" or EOF.
+func (s *Session) Run(in io.Reader, out io.Writer) error {
+	if err := s.scan(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%d files under %s\n%s\n", len(s.files), s.Root, help)
+	s.list(out)
+
+	sc := bufio.NewScanner(in)
+	for {
+		fmt.Fprintf(out, "%s> ", "/"+s.cwd)
+		if !sc.Scan() {
+			fmt.Fprintln(out)
+			return sc.Err()
+		}
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		cmd, args := fields[0], fields[1:]
+		if cmd == "q" || cmd == "quit" {
+			return nil
+		}
+		if err := s.exec(out, cmd, args); err != nil {
+			fmt.Fprintf(out, "error: %v\n", err)
+		}
+	}
+}
+
+func (s *Session) exec(out io.Writer, cmd string, args []string) error {
+	switch cmd {
+	case "help", "?":
+		fmt.Fprint(out, help)
+	case "ls":
+		s.list(out)
+	case "cd":
+		if len(args) != 1 {
+			return errors.New("usage: cd N|NAME|..")
+		}
+		if err := s.cd(args[0]); err != nil {
+			return err
+		}
+		s.list(out)
+	case "t":
+		if len(args) == 0 {
+			return errors.New("usage: t N...")
+		}
+		for _, a := range args {
+			e, err := s.lookup(a)
+			if err != nil {
+				return err
+			}
+			files := s.under(e)
+			on := !s.allSelected(files)
+			for _, f := range files {
+				s.setSelected(f, on)
+			}
+		}
+		s.list(out)
+	case "p", "a", "r":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: %s GLOB", cmd)
+		}
+		files, err := s.glob(args[0])
+		if err != nil {
+			return err
+		}
+		if cmd == "p" {
+			for _, f := range files {
+				fmt.Fprintf(out, "  %s (~%d tokens)\n", f, generator.EstimateTokens(int(s.sizes[f])))
+			}
+			fmt.Fprintf(out, "%d files match, ~%d tokens\n", len(files), s.tokens(files))
+			return nil
+		}
+		for _, f := range files {
+			s.setSelected(f, cmd == "a")
+		}
+		s.status(out)
+	case "sel":
+		sel := s.selection()
+		for _, f := range sel {
+			fmt.Fprintf(out, "  %s\n", f)
+		}
+		s.status(out)
+	case "save":
+		if len(args) < 1 || len(args) > 2 {
+			return errors.New("usage: save DOC [OUTPUT]")
+		}
+		src, err := s.source()
+		if err != nil {
+			return err
+		}
+		output := args[0] + ".md"
+		if len(args) == 2 {
+			output = args[1]
+		}
+		if err := s.Save(args[0], output, src); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "saved %d paths to document %q\n", len(src.SourcePaths), args[0])
+	case "gen":
+		if len(args) != 1 {
+			return errors.New("usage: gen OUTPUT")
+		}
+		src, err := s.source()
+		if err != nil {
+			return err
+		}
+		return s.Generate(cfg.Document{OutputPath: args[0], Sources: []cfg.Source{src}})
+	default:
+		return fmt.Errorf("unknown command %q (type help)", cmd)
+	}
+	return nil
+}
+
+// scan collects every file under Root, skipping VCS and dependency directories.
+func (s *Session) scan() error {
+	s.sizes = make(map[string]int64)
+	if s.selected == nil {
+		s.selected = make(map[string]bool)
+	}
+	err := filepath.WalkDir(s.Root, func(p string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if de.IsDir() {
+			if p != s.Root && skipDirs[de.Name()] {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(s.Root, p)
+		if err != nil {
+			return err
+		}
+		info, err := de.Info()
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		s.files = append(s.files, rel)
+		s.sizes[rel] = info.Size()
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("scan %s: %w", s.Root, err)
+	}
+	// walk order puts "a/x" before "a.txt"; under relies on plain string order
+	sort.Strings(s.files)
+	return nil
+}
+
+// list prints the current directory with checkboxes: [x] selected,
+// [~] partly selected directory, [ ] nothing selected.
+func (s *Session) list(out io.Writer) {
+	prefix := ""
+	if s.cwd != "" {
+		prefix = s.cwd + "/"
+	}
+	seen := make(map[string]bool)
+	var dirs, files []entry
+	for _, f := range s.files {
+		rest, ok := strings.CutPrefix(f, prefix)
+		if !ok {
+			continue
+		}
+		name, _, isDir := strings.Cut(rest, "/")
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		e := entry{name: name, rel: prefix + name, isDir: isDir}
+		if isDir {
+			dirs = append(dirs, e)
+		} else {
+			files = append(files, e)
+		}
+	}
+	s.entries = append(dirs, files...)
+
+	for i, e := range s.entries {
+		under := s.under(e)
+		box := "[ ]"
+		switch n := s.countSelected(under); {
+		case n == len(under):
+			box = "[x]"
+		case n > 0:
+			box = "[~]"
+		}
+		name := e.name
+		if e.isDir {
+			name += "/"
+		}
+		fmt.Fprintf(out, "%3d %s %-40s ~%d tokens\n", i+1, box, name, s.tokens(under))
+	}
+	s.status(out)
+}
+
+func (s *Session) status(out io.Writer) {
+	sel := s.selection()
+	fmt.Fprintf(out, "selected: %d files, ~%d tokens\n", len(sel), s.tokens(sel))
+}
+
+func (s *Session) cd(arg string) error {
+	if arg == ".." {
+		s.cwd = path.Dir(s.cwd)
+		if s.cwd == "." {
+			s.cwd = ""
+		}
+		return nil
+	}
+	e, err := s.lookup(arg)
+	if err != nil {
+		return err
+	}
+	if !e.isDir {
+		return fmt.Errorf("%s is not a directory", e.name)
+	}
+	s.cwd = e.rel
+	return nil
+}
+
+// lookup resolves a listing number or a name in the last listing.
+func (s *Session) lookup(arg string) (entry, error) {
+	if n, err := strconv.Atoi(arg); err == nil {
+		if n < 1 || n > len(s.entries) {
+			return entry{}, fmt.Errorf("no entry %d", n)
+		}
+		return s.entries[n-1], nil
+	}
+	for _, e := range s.entries {
+		if e.name == strings.TrimSuffix(arg, "/") {
+			return e, nil
+		}
+	}
+	return entry{}, fmt.Errorf("no entry %q", arg)
+}
+
+// under returns the files an entry stands for.
+func (s *Session) under(e entry) []string {
+	if !e.isDir {
+		return []string{e.rel}
+	}
+	prefix := e.rel + "/"
+	i := sort.SearchStrings(s.files, prefix)
+	var out []string
+	for ; i < len(s.files) && strings.HasPrefix(s.files[i], prefix); i++ {
+		out = append(out, s.files[i])
+	}
+	return out
+}
+
+// glob returns the files matching pattern.
+func (s *Session) glob(pattern string) ([]string, error) {
+	set, err := match.Compile([]string{pattern})
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, f := range s.files {
+		if set.Match(f) {
+			out = append(out, f)
+		}
+	}
+	return out, nil
+}
+
+func (s *Session) setSelected(f string, on bool) {
+	if on {
+		s.selected[f] = true
+	} else {
+		delete(s.selected, f)
+	}
+}
+
+func (s *Session) countSelected(files []string) int {
+	n := 0
+	for _, f := range files {
+		if s.selected[f] {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *Session) allSelected(files []string) bool {
+	return s.countSelected(files) == len(files)
+}
+
+func (s *Session) selection() []string {
+	out := make([]string, 0, len(s.selected))
+	for f := range s.selected {
+		out = append(out, f)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (s *Session) tokens(files []string) int {
+	n := 0
+	for _, f := range files {
+		n += generator.EstimateTokens(int(s.sizes[f]))
+	}
+	return n
+}
+
+// source turns the selection into a file source. Directories whose files
+// are all selected are listed as the directory instead of file by file.
+func (s *Session) source() (cfg.Source, error) {
+	sel := s.selection()
+	if len(sel) == 0 {
+		return cfg.Source{}, errors.New("nothing selected")
+	}
+	var paths []string
+	covered := make(map[string]bool)
+	for _, f := range sel {
+		if covered[f] {
+			continue
+		}
+		// climb to the highest directory that is fully selected
+		best := f
+		for dir := path.Dir(f); dir != "."; dir = path.Dir(dir) {
+			files := s.under(entry{rel: dir, isDir: true})
+			if !s.allSelected(files) {
+				break
+			}
+			best = dir
+		}
+		for _, g := range s.under(entry{rel: best, isDir: best != f}) {
+			covered[g] = true
+		}
+		paths = append(paths, best)
+	}
+	return cfg.Source{Type: "file", SourcePaths: paths}, nil
+}
@@ -0,0 +1,94 @@
+// Package unorm brings file names to Unicode Normalization Form C, so that
+// "café.go" is the same path whether the file system stored it composed
+// (Linux, Windows) or decomposed (macOS). It covers the cases that occur in
+// practice without the full Unicode tables: Latin, Greek and Cyrillic
+// letters with combining diacritics and Hangul syllables.
+package unorm
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Hangul syllable composition constants (Unicode 3.12).
+const (
+	hangulBase  = 0xAC00
+	leadBase    = 0x1100
+	vowelBase   = 0x1161
+	trailBase   = 0x11A7
+	leadCount   = 19
+	vowelCount  = 21
+	trailCount  = 28
+	hangulCount = leadCount * vowelCount * trailCount
+)
+
+// NFC returns s in Normalization Form C. Strings without combining marks or
+// conjoining Hangul jamo, which is nearly all of them, are returned as is.
+func NFC(s string) string {
+	if !needsComposing(s) {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	// starter is the last character that marks may still combine with;
+	// pending holds the marks after it that did not.
+	starter, hasStarter := rune(0), false
+	var pending []rune
+	flush := func() {
+		if hasStarter {
+			b.WriteRune(starter)
+		}
+		for _, m := range pending {
+			b.WriteRune(m)
+		}
+		hasStarter, pending = false, pending[:0]
+	}
+	for _, r := range s {
+		if hasStarter {
+			if c, ok := compose(starter, r); ok && (len(pending) == 0 || isMark(r)) {
+				starter = c
+				continue
+			}
+			if isMark(r) {
+				pending = append(pending, r)
+				continue
+			}
+		}
+		flush()
+		starter, hasStarter = r, true
+	}
+	flush()
+	return b.String()
+}
+
+// compose returns the precomposed form of a followed by b.
+func compose(a, b rune) (rune, bool) {
+	switch {
+	case a >= leadBase && a < leadBase+leadCount && b >= vowelBase && b < vowelBase+vowelCount:
+		return hangulBase + ((a-leadBase)*vowelCount+(b-vowelBase))*trailCount, true
+	case a >= hangulBase && a < hangulBase+hangulCount && (a-hangulBase)%trailCount == 0 &&
+		b > trailBase && b < trailBase+trailCount:
+		return a + (b - trailBase), true
+	}
+	c, ok := compositions[[2]rune{a, b}]
+	return c, ok
+}
+
+// isMark reports whether r is a combining diacritical mark.
+func isMark(r rune) bool {
+	return r >= 0x0300 && r <= 0x036F
+}
+
+func needsComposing(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < utf8.RuneSelf {
+			continue
+		}
+		r, n := utf8.DecodeRuneInString(s[i:])
+		if isMark(r) || r >= vowelBase && r < trailBase+trailCount {
+			return true
+		}
+		i += n - 1
+	}
+	return false
+}
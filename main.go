@@ -1,31 +1,110 @@
 package main
 
 import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"gopkg.in/yaml.v3"
+
+	"go_project_context_maker/internal/anonymize"
 	cfg "go_project_context_maker/internal/config"
+	"go_project_context_maker/internal/export"
 	"go_project_context_maker/internal/generator"
+	"go_project_context_maker/internal/ghactions"
+	"go_project_context_maker/internal/gitstore"
+	"go_project_context_maker/internal/hooks"
+	"go_project_context_maker/internal/models"
+	"go_project_context_maker/internal/publish"
+	"go_project_context_maker/internal/server"
+	"go_project_context_maker/internal/signing"
+	"go_project_context_maker/internal/storage"
+	"go_project_context_maker/internal/tui"
 )
 
 const defaultConfigPath = "config.yaml"
 
-func main() {
-	var configPath string
-	flag.StringVar(&configPath, "config", defaultConfigPath, "path to config.yaml (used for both init and generate)")
-	flag.Usage = func() {
-		fmt.Fprintf(flag.CommandLine.Output(), "Usage:\n")
-		fmt.Fprintf(flag.CommandLine.Output(), "  %s [flags] <command>\n\n", filepath.Base(os.Args[0]))
-		fmt.Fprintf(flag.CommandLine.Output(), "Commands:\n")
-		fmt.Fprintf(flag.CommandLine.Output(), "  init       Create a default config.yaml (use -config to choose path)\n")
-		fmt.Fprintf(flag.CommandLine.Output(), "  generate   Run generation according to config.yaml\n\n")
-		fmt.Fprintf(flag.CommandLine.Output(), "Flags:\n")
-		flag.PrintDefaults()
+// Build metadata, set by release builds with
+// -ldflags "-X main.version=v1.4.0 -X main.commit=... -X main.date=...";
+// empty values fall back to what the Go toolchain recorded (see version).
+var version, commit, date string
+
+// findConfig returns the config used without -config: the first of
+// config.yaml, config.json and config.toml that exists.
+func findConfig() string {
+	for _, p := range []string{defaultConfigPath, "config.json", "config.toml"} {
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return defaultConfigPath
+}
+
+// flagSet reports whether the global flag name was given.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) { set = set || f.Name == name })
+	return set
+}
+
+// configVars holds the -set NAME=value variables for ${NAME} in the config.
+var configVars = varsFlag{}
+
+// verbosity holds the global -v, -vv and -quiet flags.
+var verbosity struct {
+	verbose, debug, quiet bool
+}
+
+// varsFlag collects repeated -set NAME=value flags.
+type varsFlag map[string]string
+
+func (v varsFlag) String() string { return "" }
+
+func (v varsFlag) Set(s string) error {
+	name, value, err := cfg.ParseVar(s)
+	if err != nil {
+		return err
 	}
+	v[name] = value
+	return nil
+}
+
+func main() {
+	var g globals
+	flag.StringVar(&g.config, "config", defaultConfigPath, "path to the config file, YAML, JSON or TOML, or a directory of them (used for both init and generate; default config.yaml, else config.json or config.toml)")
+	flag.StringVar(&cfg.DefaultFormat, "format", cfg.FormatYAML, "format of a config file whose extension names none: "+strings.Join(cfg.Formats, ", "))
+	flag.StringVar(&g.root, "root", "", "project root, overriding projectPath from the config (default: projectPath relative to the config file)")
+	flag.StringVar(&g.runID, "run-id", "", "correlation ID embedded in generated documents (default: random UUID)")
+	flag.Var(configVars, "set", "set a config variable, NAME=value, used as ${NAME} in paths and descriptions (repeatable; overrides the environment)")
+	flag.Var(configVars, "var", "same as -set")
+	flag.BoolVar(&verbosity.verbose, "v", false, "log the progress and statistics of every document to stderr")
+	flag.BoolVar(&verbosity.debug, "vv", false, "like -v, also logging every source and embedded file")
+	flag.BoolVar(&verbosity.quiet, "quiet", false, "print errors only")
+	flag.Usage = usage
 	flag.Parse()
+	if !slices.Contains(cfg.Formats, cfg.DefaultFormat) {
+		fmt.Fprintf(os.Stderr, "unknown -format %q (expected %s)\n\n", cfg.DefaultFormat, strings.Join(cfg.Formats, ", "))
+		flag.Usage()
+		os.Exit(2)
+	}
 
 	args := flag.Args()
 	if len(args) == 0 {
@@ -33,29 +112,54 @@ func main() {
 		os.Exit(2)
 	}
 
-	cmd := args[0]
-	switch cmd {
-	case "init":
-		if err := runInit(configPath); err != nil {
-			fmt.Fprintf(os.Stderr, "init error: %v\n", err)
-			os.Exit(1)
-		}
-	case "generate":
-		if err := runGenerate(configPath); err != nil {
-			fmt.Fprintf(os.Stderr, "generate error: %v\n", err)
-			os.Exit(1)
-		}
-	default:
-		fmt.Fprintf(os.Stderr, "unknown command: %q\n\n", cmd)
+	c, ok := findCommand(args[0])
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command: %q\n\n", args[0])
 		flag.Usage()
 		os.Exit(2)
 	}
+	if !flagSet("config") && c.name != "init" {
+		g.config = findConfig()
+	}
+	if err := c.run(g, args[1:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintf(os.Stderr, "%s error: %v\n", c.name, err)
+		var ec exitCodeError
+		if errors.As(err, &ec) {
+			os.Exit(ec.code)
+		}
+		os.Exit(1)
+	}
 }
 
-func runInit(path string) error {
+// runInit writes a starting config for the project next to it: from
+// -preset, from the answers of -interactive, or for the project type
+// detected in the config's directory.
+func runInit(path string, args []string) error {
+	fs := newFlagSet("init")
+	var names []string
+	for _, p := range cfg.PresetNames() {
+		names = append(names, p[0])
+	}
+	preset := fs.String("preset", "", "project type: "+strings.Join(names, ", ")+" (default: detected)")
+	interactive := fs.Bool("interactive", false, "ask for the project type and source paths")
+	format := fs.String("format", "", "format of the config written: "+strings.Join(cfg.Formats, ", ")+" (default: by the extension of -config)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
 	if path == "" {
 		path = defaultConfigPath
 	}
+	if *format != "" {
+		if !slices.Contains(cfg.Formats, *format) {
+			return fmt.Errorf("unknown -format %q (expected %s)", *format, strings.Join(cfg.Formats, ", "))
+		}
+		if path == defaultConfigPath {
+			path = "config." + *format
+		}
+		if cfg.DefaultFormat = *format; cfg.FormatOf(path) != *format {
+			return fmt.Errorf("%s is not a %s file", path, *format)
+		}
+	}
 	// Avoid overwriting existing config to be safe by default
 	if _, err := os.Stat(path); err == nil {
 		return fmt.Errorf("config already exists: %s", path)
@@ -63,32 +167,1437 @@ func runInit(path string) error {
 		return fmt.Errorf("cannot stat %s: %w", path, err)
 	}
 
-	def := cfg.Default()
+	name := *preset
+	if name == "" {
+		name = cfg.DetectPreset(filepath.Dir(path))
+	}
+	var def cfg.Config
+	var err error
+	switch {
+	case *interactive:
+		def, err = initWizard(bufio.NewReader(os.Stdin), os.Stdout, name)
+	case name != "":
+		def, err = cfg.Preset(name)
+	default:
+		def = cfg.Default()
+	}
+	if err != nil {
+		return err
+	}
 	if err := cfg.Save(path, def); err != nil {
 		return err
 	}
 
-	fmt.Printf("Default config created at %s\n", path)
+	if name == "" || *interactive {
+		fmt.Printf("Config created at %s\n", path)
+	} else {
+		fmt.Printf("Config for a %s project created at %s\n", name, path)
+	}
+	return nil
+}
+
+// initWizard asks for the project type (suggesting detected) and the paths
+// whose files are embedded, and returns the tailored preset.
+func initWizard(in *bufio.Reader, out io.Writer, detected string) (cfg.Config, error) {
+	presets := cfg.PresetNames()
+	fmt.Fprintln(out, "Project type:")
+	def := len(presets)
+	for i, p := range presets {
+		fmt.Fprintf(out, "  %d) %-9s %s\n", i+1, p[0], p[1])
+		if p[0] == detected {
+			def = i + 1
+		}
+	}
+	ask := func(prompt, fallback string) (string, error) {
+		fmt.Fprintf(out, "%s [%s]: ", prompt, fallback)
+		line, err := in.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+		return cmp.Or(strings.TrimSpace(line), fallback), nil
+	}
+	var c cfg.Config
+	for {
+		answer, err := ask("Choose", strconv.Itoa(def))
+		if err != nil {
+			return c, err
+		}
+		name := answer
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(presets) {
+			name = presets[n-1][0]
+		}
+		if c, err = cfg.Preset(name); err == nil {
+			break
+		}
+		fmt.Fprintln(out, err)
+	}
+	files := &c.Documents[len(c.Documents)-1].Sources[0]
+	answer, err := ask("Source paths to embed, comma-separated", strings.Join(files.SourcePaths, ","))
+	if err != nil {
+		return c, err
+	}
+	files.SourcePaths = nil
+	for _, p := range strings.Split(answer, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			files.SourcePaths = append(files.SourcePaths, p)
+		}
+	}
+	return c, nil
+}
+
+func runGenerate(path, rootFlag, runID string, args []string) error {
+	fs := newFlagSet("generate")
+	document := fs.String("document", "", "generate only the document with this name")
+	only := fs.String("only", "", "comma-separated document names to generate")
+	output := fs.String("o", "", "override outputPath of the selected document (\"-\" for stdout)")
+	toStdout := fs.Bool("stdout", false, "write the selected document to stdout (same as -o -)")
+	dryRun := fs.Bool("dry-run", false, "print the file list and size report without writing anything")
+	jobs := fs.Int("jobs", runtime.GOMAXPROCS(0), "number of documents rendered, and of files read and processed per source, in parallel")
+	github := fs.Bool("github-actions", ghactions.Detected(), "emit ::warning annotations, step outputs and a job summary (default: on when GITHUB_ACTIONS=true)")
+	report := fs.String("report", "", "print a per-document report of included and skipped files: json")
+	exitCodes := fs.Bool("exit-codes", false, "exit with 3 when a document matched no files and 4 when files were skipped")
+	profile := fs.String("profile", "", "apply the named profile from the config's profiles")
+	progress := fs.String("progress-json", "", "stream NDJSON progress events to stderr, unix:PATH or tcp:HOST:PORT")
+	confirm := fs.Bool("confirm", false, "show what would change in existing outputs and ask before overwriting them")
+	gitStore := fs.String("git-store", "", "store documents in git instead of writing them: refs (refs/context/<name>) or notes (on HEAD)")
+	auto := fs.Bool("auto", false, "ignore -config and generate project-context.md from the detected project type")
+	stream := fs.Bool("stream", false, "write documents to their files while rendering instead of building them in memory, for very large outputs")
+	filesFrom := fs.String("files-from", "", "take the files of every document from this newline-separated list (\"-\" for stdin) instead of walking sourcePaths")
+	changed := fs.String("changed", "", "comma-separated changed files (relative to the project root): generate only the documents that depend on them")
+	cost := fs.String("cost", "", "comma-separated models, e.g. gpt-4o,claude-sonnet-4: print the estimated input cost of each document for them")
+	refresh := fs.Bool("refresh", false, "ignore cached url responses and command output and refresh the cache")
+	strictFeatures := fs.Bool("strict-features", false, "fail when a configured feature is unavailable on this machine instead of leaving it out")
+	signKey := fs.String("sign", "", "write a detached signature <outputPath>"+signing.Suffix+" of every document made with this SSH private key")
+	timeout := fs.Duration("timeout", 0, "abort generation when it takes longer than this, e.g. 5m (default: no limit)")
+	archive := fs.String("archive", "", "bundle all documents and an index.md into this .zip, .tar.gz or .tar file instead of writing them")
+	summaryDiff := fs.Bool("summary-diff", false, "print which embedded files each output adds, removes and changes compared with the file on disk")
+	minimalChurn := fs.Bool("minimal-churn", false, "leave outputs on disk untouched when only their run id and timing would change")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if *report != "" && *report != "json" {
+		return fmt.Errorf("unknown report format %q (expected json)", *report)
+	}
+	if *gitStore != "" && !slices.Contains(gitstore.Modes, *gitStore) {
+		return fmt.Errorf("unknown -git-store %q (expected %s)", *gitStore, strings.Join(gitstore.Modes, " or "))
+	}
+	if *toStdout {
+		*output = generator.StdoutPath
+	}
+	if *stream {
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{{"-dry-run", *dryRun}, {"-confirm", *confirm}, {"-summary-diff", *summaryDiff}, {"-minimal-churn", *minimalChurn}, {"-git-store", *gitStore != ""}, {"-archive", *archive != ""}, {"-sign", *signKey != ""}, {"-cost", *cost != ""}} {
+			if f.set {
+				return fmt.Errorf("-stream cannot be combined with %s, which needs the documents in memory", f.name)
+			}
+		}
+	}
+	if *filesFrom == "-" && *confirm {
+		return errors.New("-files-from - cannot be combined with -confirm, which reads the answer from stdin")
+	}
+	if *archive != "" {
+		if *gitStore != "" {
+			return errors.New("-archive and -git-store cannot be combined")
+		}
+		if _, err := generator.ArchiveFormat(*archive); err != nil {
+			return err
+		}
+	}
+
+	var conf cfg.Config
+	var root string
+	var err error
+	if *auto {
+		root = cmp.Or(rootFlag, ".")
+		conf = cfg.Auto(root)
+	} else if conf, root, err = loadConfig(path, rootFlag); err != nil {
+		return err
+	}
+	if *profile != "" {
+		if conf, err = conf.WithProfile(*profile); err != nil {
+			return err
+		}
+	}
+	conf.Documents, err = selectDocuments(conf.Documents, *document+","+*only)
+	if err != nil {
+		return err
+	}
+	var priced []models.Model
+	for _, name := range strings.Split(*cost, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			m, err := models.Priced(name, conf.Pricing)
+			if err != nil {
+				return err
+			}
+			priced = append(priced, m)
+		}
+	}
+	if *changed != "" {
+		if conf.Documents, err = selectChanged(conf, root, path, *changed); err != nil {
+			return err
+		}
+		if len(conf.Documents) == 0 {
+			fmt.Fprintln(os.Stderr, "No document depends on the changed files")
+			return nil
+		}
+	}
+	if *output != "" {
+		if len(conf.Documents) != 1 {
+			return errors.New("-o and -stdout require a single document (use -document or -only)")
+		}
+		conf.Documents[0].OutputPath = *output
+		conf.Documents[0].Outputs = nil
+	}
+
+	opts, err := generatorOptions(runID, *jobs)
+	if err != nil {
+		return err
+	}
+	opts.StrictFeatures = *strictFeatures
+	opts.Refresh = *refresh
+	opts.Stream = *stream
+	if *filesFrom != "" {
+		if opts.FileList, err = readFileList(*filesFrom); err != nil {
+			return err
+		}
+	}
+	opts.NoHooks = *dryRun
+
+	// Ctrl-C aborts rendering promptly; a second one kills the process
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	opts.Context = ctx
+
+	// keep stdout clean when documents are piped through it
+	status := os.Stdout
+	for _, d := range conf.Documents {
+		for _, t := range d.Targets() {
+			if t.Path == generator.StdoutPath {
+				status = os.Stderr
+			}
+		}
+	}
+	if *github {
+		opts.Warn = func(w generator.Warning) {
+			ghactions.Warning(status, w.Path, "context document "+w.Document, w.Msg)
+		}
+	}
+	// a live status line, unless something else reports on stderr
+	if opts.Progress == nil && !verbosity.quiet && !*github && *progress != "stderr" && *report == "" && isTerminal(os.Stderr) {
+		line := generator.NewStatusLine(os.Stderr)
+		defer line.Done()
+		opts.Progress, opts.Warn = line.Progress, line.Warn
+	}
+	if *progress != "" {
+		w, err := openProgress(*progress)
+		if err != nil {
+			return err
+		}
+		defer w.Close()
+		opts.Progress = teeProgress(opts.Progress, generator.NDJSONProgress(w))
+	}
+
+	// documents with failurePolicy continue or retry fail alone: the others
+	// are written, then the run fails
+	outs, renderErr := generator.Render(conf, root, opts)
+	var failed *generator.FailedDocumentsError
+	if renderErr != nil && !errors.As(renderErr, &failed) {
+		return aborted(ctx, renderErr, *timeout)
+	}
+	res := generator.NewResult(opts.RunID, outs)
+	if *dryRun && *report == "" {
+		generator.WriteDryRunReport(os.Stdout, outs)
+	}
+	if len(priced) > 0 {
+		generator.WriteCosts(status, outs, priced)
+	}
+	if !*dryRun && *signKey != "" {
+		if err := generator.Sign(outs, *signKey); err != nil {
+			return err
+		}
+	}
+	if *summaryDiff && !*confirm && *gitStore == "" && *archive == "" {
+		changes, err := generator.Changes(outs)
+		if err != nil {
+			return err
+		}
+		generator.WriteChanges(status, changes)
+	}
+	if !*dryRun && *confirm && *gitStore == "" && *archive == "" {
+		ok, err := confirmOverwrite(outs, status)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Fprintln(status, "Nothing written")
+			return nil
+		}
+	}
+	if !*dryRun {
+		written := outs
+		if *gitStore != "" {
+			if written, err = storeInGit(root, *gitStore, opts.RunID, outs, status); err != nil {
+				return err
+			}
+		}
+		if *minimalChurn && *gitStore == "" && *archive == "" {
+			if written, err = generator.WithoutUnchanged(nil, written); err != nil {
+				return err
+			}
+		}
+		if *archive != "" {
+			err = generator.WriteArchive(*archive, outs, opts.RunID)
+		} else {
+			err = generator.WriteOutputs(written, nil)
+		}
+		if err != nil {
+			return err
+		}
+		if err := generator.RunPostHooks(conf, root, outs, opts); err != nil {
+			return err
+		}
+		if *github {
+			if err := reportGitHubActions(outs, opts.RunID); err != nil {
+				return err
+			}
+		}
+	}
+	if *report == "json" {
+		if err := res.WriteJSON(status); err != nil {
+			return err
+		}
+	} else if !*dryRun && renderErr == nil && !verbosity.quiet {
+		fmt.Fprintf(status, "Generation completed (run-id: %s)\n", opts.RunID)
+	}
+	if renderErr != nil {
+		return renderErr
+	}
+	if *exitCodes {
+		return resultExitCode(res)
+	}
+	return nil
+}
+
+// aborted reports err in plain words when ctx ended the run: -timeout
+// expiring, or an interrupt, which exits with 130 like a shell does.
+func aborted(ctx context.Context, err error, timeout time.Duration) error {
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return fmt.Errorf("timed out after %s", timeout)
+	case context.Canceled:
+		return exitCodeError{exitInterrupted, "interrupted"}
+	}
+	return err
+}
+
+// confirmOverwrite prints how the outputs differ from the files on disk
+// and, when an existing file would change, asks whether to write them.
+func confirmOverwrite(outs []generator.Output, status io.Writer) (bool, error) {
+	changes, err := generator.Changes(outs)
+	if err != nil {
+		return false, err
+	}
+	generator.WriteChanges(status, changes)
+	if !slices.ContainsFunc(changes, func(c generator.OutputChange) bool { return c.Exists && c.Changed }) {
+		return true, nil
+	}
+	fmt.Fprint(status, "Overwrite? [y/N] ")
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+// storeInGit records the outputs in the repository at root as -git-store
+// says and returns those it leaves to be written: the ones going to stdout.
+func storeInGit(root, mode, runID string, outs []generator.Output, status io.Writer) ([]generator.Output, error) {
+	var bundles []gitstore.Bundle
+	var rest []generator.Output
+	for _, o := range outs {
+		if o.Path == generator.StdoutPath {
+			rest = append(rest, o)
+			continue
+		}
+		if len(bundles) == 0 || bundles[len(bundles)-1].Name != o.Document {
+			bundles = append(bundles, gitstore.Bundle{Name: o.Document})
+		}
+		b := &bundles[len(bundles)-1]
+		b.Files = append(b.Files, gitstore.File{Name: filepath.Base(o.Path), Content: o.Content})
+		if o.Signature != "" {
+			b.Files = append(b.Files, gitstore.File{Name: filepath.Base(o.Path) + signing.Suffix, Content: o.Signature})
+		}
+	}
+	refs, err := gitstore.Store(root, mode, runID, bundles)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range refs {
+		fmt.Fprintf(status, "Stored %s\n", ref)
+	}
+	return rest, nil
+}
+
+// Exit codes of generate -exit-codes, for CI gates; hard errors exit with 1
+// and usage errors with 2.
+const (
+	exitNothingMatched = 3
+	exitSkipped        = 4
+	exitInterrupted    = 130
+)
+
+// exitCodeError is an error that main exits with a specific code for.
+type exitCodeError struct {
+	code int
+	msg  string
+}
+
+func (e exitCodeError) Error() string { return e.msg }
+
+// resultExitCode reports documents that matched nothing, then skipped
+// files, as exit code errors.
+func resultExitCode(res generator.Result) error {
+	if names := res.NothingMatched(); len(names) > 0 {
+		return exitCodeError{exitNothingMatched, "no files matched in " + strings.Join(names, ", ")}
+	}
+	if n := res.Skipped(); n > 0 {
+		return exitCodeError{exitSkipped, fmt.Sprintf("%d file(s) skipped", n)}
+	}
+	return nil
+}
+
+// reportGitHubActions sets the run-id, documents and tokens step outputs and
+// appends the generation report to the job summary, when the runner provides
+// the files for them.
+func reportGitHubActions(outs []generator.Output, runID string) error {
+	if os.Getenv("GITHUB_STEP_SUMMARY") != "" {
+		var b strings.Builder
+		generator.WriteMarkdownReport(&b, outs, runID)
+		if err := ghactions.AppendSummary(b.String()); err != nil {
+			return err
+		}
+	}
+	if os.Getenv("GITHUB_OUTPUT") == "" {
+		return nil
+	}
+	var paths []string
+	tokens := 0
+	for _, o := range outs {
+		if o.Path != generator.StdoutPath {
+			paths = append(paths, o.Path)
+		}
+		tokens += generator.EstimateTokens(o.Len())
+	}
+	outputs := [][2]string{
+		{"run-id", runID},
+		{"documents", strings.Join(paths, "\n")},
+		{"tokens", strconv.Itoa(tokens)},
+	}
+	for _, kv := range outputs {
+		if err := ghactions.SetOutput(kv[0], kv[1]); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func runGenerate(path string) error {
+// selectDocuments keeps the documents named in the comma-separated list, in
+// config order. An empty list selects every document.
+func selectDocuments(docs []cfg.Document, namesCSV string) ([]cfg.Document, error) {
+	want := make(map[string]bool)
+	for _, n := range strings.Split(namesCSV, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			want[n] = true
+		}
+	}
+	if len(want) == 0 {
+		return docs, nil
+	}
+	var out []cfg.Document
+	for _, d := range docs {
+		if want[d.Name] {
+			out = append(out, d)
+			delete(want, d.Name)
+		}
+	}
+	if len(want) > 0 {
+		missing := make([]string, 0, len(want))
+		for n := range want {
+			missing = append(missing, n)
+		}
+		sort.Strings(missing)
+		return nil, fmt.Errorf("document not found: %s", strings.Join(missing, ", "))
+	}
+	return out, nil
+}
+
+// selectChanged narrows conf's documents to those depending on the
+// comma-separated changed files, printing why each one is kept. A change to
+// the config file itself keeps every document.
+func selectChanged(conf cfg.Config, root, configPath, changedCSV string) ([]cfg.Document, error) {
+	var changed []string
+	for _, p := range strings.Split(changedCSV, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			changed = append(changed, p)
+		}
+	}
+	configAbs, err := filepath.Abs(cmp.Or(configPath, defaultConfigPath))
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range changed {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(root, p)
+		}
+		if abs, err := filepath.Abs(p); err == nil && abs == configAbs {
+			fmt.Fprintf(os.Stderr, "all documents: %s is the config\n", filepath.Base(configAbs))
+			return conf.Documents, nil
+		}
+	}
+
+	deps, err := generator.Affected(conf, root, changed, generator.Options{})
+	if err != nil {
+		return nil, err
+	}
+	affected := make(map[int]bool)
+	for _, d := range deps {
+		fmt.Fprintln(os.Stderr, d)
+		affected[d.Index] = true
+	}
+	var docs []cfg.Document
+	for i, d := range conf.Documents {
+		if affected[i] {
+			docs = append(docs, d)
+		}
+	}
+	return docs, nil
+}
+
+// openProgress opens the destination of -progress-json: "stderr", or a
+// socket to connect to as unix:PATH or tcp:HOST:PORT.
+func openProgress(dest string) (io.WriteCloser, error) {
+	if dest == "stderr" || dest == "-" {
+		return nopCloser{os.Stderr}, nil
+	}
+	network, addr, ok := strings.Cut(dest, ":")
+	if !ok || (network != "unix" && network != "tcp") {
+		return nil, fmt.Errorf("invalid -progress-json %q (expected stderr, unix:PATH or tcp:HOST:PORT)", dest)
+	}
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("progress socket: %w", err)
+	}
+	return conn, nil
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// generatorOptions builds per-run options, generating a run ID when none is given.
+func generatorOptions(runID string, jobs int) (generator.Options, error) {
+	if runID == "" {
+		id, err := generator.NewRunID()
+		if err != nil {
+			return generator.Options{}, err
+		}
+		runID = id
+	}
+	opts := generator.Options{RunID: runID, Jobs: jobs}
+	switch {
+	case verbosity.quiet:
+		opts.Warn = func(generator.Warning) {}
+	case verbosity.verbose || verbosity.debug:
+		level := slog.LevelInfo
+		if verbosity.debug {
+			level = slog.LevelDebug
+		}
+		opts.Progress = generator.LogProgress(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+		// warnings are logged as progress events
+		opts.Warn = func(generator.Warning) {}
+	}
+	return opts, nil
+}
+
+// teeProgress returns a progress func calling a, when set, and b.
+func teeProgress(a, b func(generator.Event)) func(generator.Event) {
+	if a == nil {
+		return b
+	}
+	return func(e generator.Event) {
+		a(e)
+		b(e)
+	}
+}
+
+// isTerminal reports whether f is a character device such as a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func runValidate(path, root string, args []string) error {
+	if err := newFlagSet("validate").Parse(args); err != nil {
+		return err
+	}
 	if path == "" {
 		path = defaultConfigPath
 	}
-	conf, err := cfg.Load(path)
+	problems, err := cfg.ValidateVars(path, root, configVars)
 	if err != nil {
 		return err
 	}
+	for _, p := range problems {
+		fmt.Fprintf(os.Stderr, "%s:%s\n", path, p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problem(s) found", len(problems))
+	}
+	fmt.Printf("%s is valid\n", path)
+	return nil
+}
 
-	root := conf.ProjectPath
-	if root == "" {
-		root = "."
+// runConfig implements "config print". With -effective the output is the
+// configuration the generator actually uses: defaults and inherited
+// settings filled in and the project root resolved (including -root).
+func runConfig(path, rootFlag string, args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		return errors.New("usage: config print [-effective]")
+	}
+	fs := newFlagSet("config print")
+	effective := fs.Bool("effective", false, "print the fully merged configuration instead of the file as loaded")
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
 	}
-	if err := generator.Generate(conf, root); err != nil {
+
+	conf, root, err := loadConfig(path, rootFlag)
+	if err != nil {
 		return err
 	}
+	if *effective {
+		if abs, err := filepath.Abs(root); err == nil {
+			root = abs
+		}
+		if conf, err = generator.Effective(conf, root); err != nil {
+			return err
+		}
+	}
+	data, err := yaml.Marshal(conf)
+	if err != nil {
+		return fmt.Errorf("encode config: %w", err)
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
 
-	fmt.Println("Generation completed")
+// runMigrateConfig upgrades the config file to the current format, in
+// place or into -o, and prints each change.
+func runMigrateConfig(path string, args []string) error {
+	fs := newFlagSet("migrate-config")
+	output := fs.String("o", "", "write the migrated config here instead of over the file; the extension picks the format")
+	dryRun := fs.Bool("dry-run", false, "print the changes without writing anything")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if path == "" {
+		path = defaultConfigPath
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+	out := cmp.Or(*output, path)
+	migrated, changes, err := cfg.Migrate(path, data, out)
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		fmt.Printf("%s:%s\n", path, c)
+	}
+	if len(changes) == 0 && *output == "" {
+		fmt.Printf("%s is up to date\n", path)
+		return nil
+	}
+	if *dryRun {
+		return nil
+	}
+	if err := os.WriteFile(out, migrated, 0o644); err != nil {
+		return fmt.Errorf("write config: %w", err)
+	}
+	fmt.Printf("wrote %s\n", out)
 	return nil
 }
+
+// sourceFlags defines the flags describing a source on fs and returns a
+// function building the source from them and its sourcePaths.
+func sourceFlags(fs *flag.FlagSet) func(paths []string) cfg.Source {
+	typ := fs.String("type", "file", "source type")
+	pattern := fs.String("pattern", "", `filePattern, e.g. "*.go,!*_test.go"`)
+	exclude := fs.String("exclude", "", "comma-separated excludePaths")
+	root := fs.String("root", "", "directory the paths are relative to instead of projectPath")
+	return func(paths []string) cfg.Source {
+		src := cfg.Source{Type: *typ, SourcePaths: paths, FilePattern: cfg.ParsePatterns(*pattern), Root: *root}
+		if *exclude != "" {
+			src.ExcludePaths = strings.Split(*exclude, ",")
+		}
+		return src
+	}
+}
+
+// runAddDocument appends a document, with a source when paths are given,
+// to the config file, keeping its comments and layout.
+func runAddDocument(path string, args []string) error {
+	fs := newFlagSet("add-document")
+	output := fs.String("output", "", "outputPath (default: NAME.md)")
+	description := fs.String("description", "", "description of the document")
+	source := sourceFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if fs.NArg() < 1 {
+		return errors.New("usage: add-document [flags] NAME [PATH...]")
+	}
+	if path == "" {
+		path = defaultConfigPath
+	}
+	file, err := cfg.LoadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		file, err = cfg.Config{}, nil
+	}
+	if err != nil {
+		return err
+	}
+	doc := cfg.Document{Name: fs.Arg(0), Description: *description, OutputPath: cmp.Or(*output, fs.Arg(0)+".md")}
+	for _, d := range file.Documents {
+		if d.Name == doc.Name || d.OutputPath == doc.OutputPath {
+			return fmt.Errorf("%s already has a document %s", path, cmp.Or(d.Name, d.OutputPath))
+		}
+	}
+	if fs.NArg() > 1 {
+		doc.Sources = []cfg.Source{source(fs.Args()[1:])}
+	}
+	file.Documents = append(file.Documents, doc)
+	if _, err := os.Stat(path); err == nil {
+		warnRewritten(path)
+	}
+	if err := cfg.Save(path, file); err != nil {
+		return err
+	}
+	fmt.Printf("Added document %s (%s) to %s\n", doc.Name, doc.OutputPath, path)
+	return nil
+}
+
+// warnRewritten tells that saving the existing config file at path drops
+// its comments and layout, which only YAML files keep.
+func warnRewritten(path string) {
+	if f := cfg.FormatOf(path); f != cfg.FormatYAML {
+		fmt.Fprintf(os.Stderr, "warning: %s is rewritten: %s files do not keep comments or layout\n", path, strings.ToUpper(f))
+	}
+}
+
+// runAddSource appends a source to a document of the config file, keeping
+// its comments and layout when it is YAML.
+func runAddSource(path string, args []string) error {
+	fs := newFlagSet("add-source")
+	source := sourceFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if fs.NArg() < 2 {
+		return errors.New("usage: add-source [flags] DOC PATH...")
+	}
+	if path == "" {
+		path = defaultConfigPath
+	}
+	file, err := cfg.LoadFile(path)
+	if err != nil {
+		return err
+	}
+	name := fs.Arg(0)
+	i := slices.IndexFunc(file.Documents, func(d cfg.Document) bool { return d.Name == name || d.OutputPath == name })
+	if i < 0 {
+		return fmt.Errorf("%s has no document %s (add it with add-document)", path, name)
+	}
+	src := source(fs.Args()[1:])
+	file.Documents[i].Sources = append(file.Documents[i].Sources, src)
+	warnRewritten(path)
+	if err := cfg.Save(path, file); err != nil {
+		return err
+	}
+	fmt.Printf("Added a %s source to %s in %s\n", src.Type, name, path)
+	return nil
+}
+
+// loadConfig reads the config and resolves the project root and, with
+// outputBase "config", the output paths; a non-empty root (the -root flag)
+// wins over the config's projectPath.
+func loadConfig(path, root string) (cfg.Config, string, error) {
+	if path == "" {
+		path = defaultConfigPath
+	}
+	conf, err := cfg.LoadVars(path, configVars)
+	if err != nil {
+		return conf, "", err
+	}
+	conf = conf.ResolveOutputs(path)
+	if conf, err = conf.Compose(); err != nil {
+		return conf, "", err
+	}
+	if root == "" {
+		root = conf.ResolveRoot(path)
+	}
+	return conf, root, nil
+}
+
+func runExport(path, rootFlag, runID string, args []string) error {
+	fs := newFlagSet("export")
+	filesAPI := fs.Bool("files-api", false, "split documents into files sized for the provider's Files API")
+	provider := fs.String("provider", "openai", "target provider: openai or anthropic")
+	outDir := fs.String("out", "export", "directory for the exported files")
+	maxBytes := fs.Int("max-bytes", 0, "maximum bytes per file (0 = provider limit)")
+	upload := fs.Bool("upload", false, "upload the exported files and print their file IDs")
+	only := fs.String("only", "", "comma-separated document names to export")
+	jobs := fs.Int("jobs", runtime.GOMAXPROCS(0), "number of documents rendered, and of files read and processed per source, in parallel")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if !*filesAPI {
+		return errors.New("no export target given (use -files-api)")
+	}
+	if *maxBytes != 0 && *maxBytes < export.MinPartBytes {
+		return fmt.Errorf("-max-bytes must be at least %d to fit reopened code fences", export.MinPartBytes)
+	}
+	p, err := export.LookupProvider(*provider)
+	if err != nil {
+		return err
+	}
+
+	conf, root, err := loadConfig(path, rootFlag)
+	if err != nil {
+		return err
+	}
+	conf.Documents, err = selectDocuments(conf.Documents, *only)
+	if err != nil {
+		return err
+	}
+	opts, err := generatorOptions(runID, *jobs)
+	if err != nil {
+		return err
+	}
+	outs, err := generator.Render(conf, root, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "run-id: %s\n", opts.RunID)
+
+	for _, o := range outs {
+		parts, err := export.WriteParts(o.Path, o.Content, *outDir, p, *maxBytes)
+		if err != nil {
+			return err
+		}
+		for _, part := range parts {
+			if !*upload {
+				fmt.Println(part.Path)
+				continue
+			}
+			id, err := export.Upload(p, part)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s\t%s\n", part.Path, id)
+		}
+	}
+	return nil
+}
+
+// runPublish renders the selected documents and posts each one as a comment
+// on a GitHub pull request, updating the comments of earlier runs.
+func runPublish(path, rootFlag, runID string, args []string) error {
+	fs := newFlagSet("publish")
+	pr := fs.Int("github-pr", 0, "pull request number (default: taken from GITHUB_REF on pull_request events)")
+	repo := fs.String("repo", "", "repository as owner/name (default: GITHUB_REPOSITORY)")
+	only := fs.String("only", "", "comma-separated document names to publish")
+	jobs := fs.Int("jobs", runtime.GOMAXPROCS(0), "number of documents rendered, and of files read and processed per source, in parallel")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if *pr == 0 {
+		// refs/pull/<number>/merge on pull_request workflows
+		if rest, ok := strings.CutPrefix(os.Getenv("GITHUB_REF"), "refs/pull/"); ok {
+			*pr, _ = strconv.Atoi(strings.TrimSuffix(rest, "/merge"))
+		}
+	}
+	if *pr == 0 {
+		return errors.New("no pull request given (use -github-pr)")
+	}
+	target, err := publish.NewGitHubPR(*repo, *pr)
+	if err != nil {
+		return err
+	}
+
+	conf, root, err := loadConfig(path, rootFlag)
+	if err != nil {
+		return err
+	}
+	conf.Documents, err = selectDocuments(conf.Documents, *only)
+	if err != nil {
+		return err
+	}
+	opts, err := generatorOptions(runID, *jobs)
+	if err != nil {
+		return err
+	}
+	outs, err := generator.Render(conf, root, opts)
+	if err != nil {
+		return err
+	}
+	for _, o := range outs {
+		urls, err := target.Publish(o.Path, o.Content)
+		if err != nil {
+			return fmt.Errorf("publish %s: %w", o.Path, err)
+		}
+		for _, u := range urls {
+			fmt.Printf("%s\t%s\n", o.Path, u)
+		}
+	}
+	return nil
+}
+
+// runCheck re-renders the documents and reports those whose file on disk
+// is missing or differs, for CI and git hooks.
+func runCheck(path, rootFlag string, args []string) error {
+	fs := newFlagSet("check")
+	only := fs.String("only", "", "comma-separated document names to check")
+	jobs := fs.Int("jobs", runtime.GOMAXPROCS(0), "number of documents rendered, and of files read and processed per source, in parallel")
+	ignoreWS := fs.Bool("ignore-whitespace", false, "treat documents differing only in whitespace or line endings as up to date")
+	changed := fs.String("changed", "", "comma-separated changed files (relative to the project root): check only the documents that depend on them")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	conf, root, err := loadConfig(path, rootFlag)
+	if err != nil {
+		return err
+	}
+	conf.Documents, err = selectDocuments(conf.Documents, *only)
+	if err != nil {
+		return err
+	}
+	if *changed != "" {
+		if conf.Documents, err = selectChanged(conf, root, path, *changed); err != nil {
+			return err
+		}
+	}
+	stale, err := generator.Stale(conf, root, generator.Options{Jobs: *jobs, IgnoreWhitespace: *ignoreWS})
+	if err != nil {
+		return err
+	}
+	generator.WriteChanges(os.Stderr, stale)
+	if len(stale) > 0 {
+		return fmt.Errorf("%d document(s) out of date", len(stale))
+	}
+	fmt.Println("All documents are up to date")
+	return nil
+}
+
+// runSnapshot renders the documents in memory and stores the manifest of
+// what they embed under the project's snapshot directory.
+func runSnapshot(path, rootFlag string, args []string) error {
+	fs := newFlagSet("snapshot")
+	name := fs.String("name", "", "snapshot name, e.g. release-1.4 (default: the UTC time, 20060102T150405Z)")
+	only := fs.String("only", "", "comma-separated document names to snapshot")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	conf, root, err := loadConfig(path, rootFlag)
+	if err != nil {
+		return err
+	}
+	if conf.Documents, err = selectDocuments(conf.Documents, *only); err != nil {
+		return err
+	}
+	m, err := renderManifest(conf, root, *name)
+	if err != nil {
+		return err
+	}
+	// a default name taken within the same second gets a numeric suffix
+	dir, base := filepath.Join(root, generator.SnapshotDir), m.Name
+	file, err := generator.SaveManifest(dir, m)
+	for n := 2; errors.Is(err, os.ErrExist) && *name == ""; n++ {
+		m.Name = fmt.Sprintf("%s-%d", base, n)
+		file, err = generator.SaveManifest(dir, m)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Snapshot %s: %d documents (%s)\n", m.Name, len(m.Documents), file)
+	return nil
+}
+
+// runDiffSnapshot reports how the documents drifted since a snapshot: the
+// current render, or a second snapshot, against the first.
+func runDiffSnapshot(path, rootFlag string, args []string) error {
+	fs := newFlagSet("diff-snapshot")
+	only := fs.String("only", "", "comma-separated document names to compare")
+	asJSON := fs.Bool("json", false, "print the drift as JSON")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		return errors.New("usage: diff-snapshot REF [REF]")
+	}
+	conf, root, err := loadConfig(path, rootFlag)
+	if err != nil {
+		return err
+	}
+	if conf.Documents, err = selectDocuments(conf.Documents, *only); err != nil {
+		return err
+	}
+	dir := filepath.Join(root, generator.SnapshotDir)
+	old, err := generator.LoadManifest(dir, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var cur generator.Manifest
+	if fs.NArg() == 2 {
+		cur, err = generator.LoadManifest(dir, fs.Arg(1))
+	} else {
+		cur, err = renderManifest(conf, root, "")
+	}
+	if err != nil {
+		return err
+	}
+	if *only != "" {
+		// keep the same documents on both sides
+		names := make(map[string]bool)
+		for _, d := range cur.Documents {
+			names[d.Name] = true
+		}
+		old.Documents = slices.DeleteFunc(old.Documents, func(d generator.DocumentManifest) bool { return !names[d.Name] })
+	}
+	drifts := generator.CompareManifests(old, cur)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(drifts)
+	}
+	generator.WriteDrift(os.Stdout, old.Name, drifts)
+	return nil
+}
+
+// renderManifest renders conf's documents without writing them and returns
+// the manifest of what they embed, named name or after the current time.
+func renderManifest(conf cfg.Config, root, name string) (generator.Manifest, error) {
+	taken := time.Now()
+	opts, err := generatorOptions("", 0)
+	if err != nil {
+		return generator.Manifest{}, err
+	}
+	opts.NoHooks = true
+	outs, err := generator.Render(conf, root, opts)
+	if err != nil {
+		return generator.Manifest{}, err
+	}
+	return generator.NewManifest(cmp.Or(name, taken.UTC().Format("20060102T150405Z")), opts.RunID, taken, outs), nil
+}
+
+func runFit(path, rootFlag string, args []string) error {
+	fs := newFlagSet("fit")
+	model := fs.String("model", "", "target model, e.g. gpt-4o or claude-sonnet-4")
+	window := fs.Int("context-window", 0, "context window in tokens, for models not known by name")
+	reserve := fs.String("reserve", "", "tokens kept free for the prompt and the answer: a count or a percentage (default: the model's maximum output)")
+	only := fs.String("only", "", "comma-separated document names to check")
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	var m models.Model
+	switch {
+	case *window > 0:
+		m = models.Model{Name: cmp.Or(*model, "custom"), ContextWindow: *window}
+	case *model != "":
+		var err error
+		if m, err = models.Lookup(*model); err != nil {
+			return err
+		}
+	default:
+		return errors.New("-model or -context-window is required")
+	}
+	reserved := m.MaxOutput
+	if *reserve != "" {
+		if pct, ok := strings.CutSuffix(*reserve, "%"); ok {
+			p, err := strconv.ParseFloat(pct, 64)
+			if err != nil || p < 0 || p >= 100 {
+				return fmt.Errorf("invalid -reserve %q", *reserve)
+			}
+			reserved = int(float64(m.ContextWindow) * p / 100)
+		} else {
+			n, err := strconv.Atoi(*reserve)
+			if err != nil || n < 0 || n >= m.ContextWindow {
+				return fmt.Errorf("invalid -reserve %q", *reserve)
+			}
+			reserved = n
+		}
+	}
+
+	conf, root, err := loadConfig(path, rootFlag)
+	if err != nil {
+		return err
+	}
+	conf.Documents, err = selectDocuments(conf.Documents, *only)
+	if err != nil {
+		return err
+	}
+	fits, err := generator.Fit(conf, root, m.ContextWindow-reserved, generator.Options{})
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(fits); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("%s: %d tokens context, %d reserved\n", m.Name, m.ContextWindow, reserved)
+		generator.WriteFit(os.Stdout, fits)
+	}
+	over := 0
+	for _, f := range fits {
+		if !f.Fits {
+			over++
+		}
+	}
+	if over > 0 {
+		return fmt.Errorf("%d document(s) do not fit %s", over, m.Name)
+	}
+	return nil
+}
+
+func runClassify(path, rootFlag string, args []string) error {
+	fs := newFlagSet("classify")
+	only := fs.String("only", "", "comma-separated document names to classify")
+	asJSON := fs.Bool("json", false, "print the classification as JSON")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	conf, root, err := loadConfig(path, rootFlag)
+	if err != nil {
+		return err
+	}
+	conf.Documents, err = selectDocuments(conf.Documents, *only)
+	if err != nil {
+		return err
+	}
+	docs, err := generator.Classify(conf, root, generator.Options{})
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(docs)
+	}
+	generator.WriteClasses(os.Stdout, docs)
+	return nil
+}
+
+func runHooks(path string, args []string) error {
+	if len(args) == 0 || args[0] != "install" {
+		return errors.New("usage: hooks install [-hook pre-commit|pre-push] [-mode check|generate] [-bin gpcm] [-force]")
+	}
+	fs := newFlagSet("hooks install")
+	hook := fs.String("hook", "pre-commit", "git hook to install: pre-commit or pre-push")
+	mode := fs.String("mode", "check", "check: fail on stale documents; generate: regenerate (and stage on pre-commit)")
+	bin := fs.String("bin", "gpcm", "command the hook uses to run this tool")
+	force := fs.Bool("force", false, "replace an existing hook not installed by this tool")
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if path == "" {
+		path = defaultConfigPath
+	}
+
+	top, err := hooks.TopLevel(".")
+	if err != nil {
+		return err
+	}
+	// hooks run from the repository root
+	relToTop := func(p string) (string, error) {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Rel(top, abs)
+	}
+	configRel, err := relToTop(path)
+	if err != nil {
+		return err
+	}
+	var outputs []string
+	if *mode == "generate" {
+		conf, err := cfg.LoadVars(path, configVars)
+		if err != nil {
+			return err
+		}
+		conf = conf.ResolveOutputs(path)
+		for _, d := range conf.Documents {
+			for _, t := range d.Targets() {
+				if t.Path == generator.StdoutPath {
+					continue
+				}
+				rel, err := relToTop(t.Path)
+				if err != nil {
+					return err
+				}
+				outputs = append(outputs, rel)
+			}
+		}
+	}
+
+	hookPath, err := hooks.Install(".", hooks.Options{
+		Hook:    *hook,
+		Mode:    *mode,
+		Bin:     *bin,
+		Config:  configRel,
+		Outputs: outputs,
+		Force:   *force,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Installed %s hook at %s\n", *hook, hookPath)
+	return nil
+}
+
+// runServe serves the documents over HTTP. The config is read again for
+// every request and each response gets a fresh run id.
+func runServe(path, rootFlag string, args []string) error {
+	fs := newFlagSet("serve")
+	addr := fs.String("addr", "127.0.0.1:8080", "address to listen on")
+	jobs := fs.Int("jobs", runtime.GOMAXPROCS(0), "number of documents rendered, and of files read and processed per source, in parallel")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	// fail early on a broken config
+	if _, _, err := loadConfig(path, rootFlag); err != nil {
+		return err
+	}
+	s := &server.Server{
+		Load:    func() (cfg.Config, string, error) { return loadConfig(path, rootFlag) },
+		Options: func() (generator.Options, error) { return generatorOptions("", *jobs) },
+	}
+	fmt.Fprintf(os.Stderr, "Serving documents on http://%s/documents\n", *addr)
+	return http.ListenAndServe(*addr, s.Handler())
+}
+
+// runDeanonymize maps the placeholders of an anonymized document back to
+// the original names, e.g. in an answer produced from it.
+func runDeanonymize(args []string) error {
+	fs := newFlagSet("deanonymize")
+	mapPath := fs.String("map", "", "mapping written next to the document (<outputPath>"+generator.AnonymizeSuffix+")")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if *mapPath == "" {
+		return errors.New("-map is required")
+	}
+	data, err := os.ReadFile(*mapPath)
+	if err != nil {
+		return err
+	}
+	m, err := anonymize.Parse(data)
+	if err != nil {
+		return err
+	}
+	var in []byte
+	if fs.NArg() > 0 {
+		in, err = os.ReadFile(fs.Arg(0))
+	} else {
+		in, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(os.Stdout, m.Reverse(string(in)))
+	return err
+}
+
+// runVerify checks the signatures written by generate -sign.
+func runVerify(args []string) error {
+	fs := newFlagSet("verify")
+	allowed := fs.String("allowed-signers", "", "ssh-keygen allowed signers file listing the trusted keys")
+	identity := fs.String("identity", "", "principal that must have signed (default: any in -allowed-signers)")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if *allowed == "" {
+		return errors.New("-allowed-signers is required")
+	}
+	if fs.NArg() == 0 {
+		return errors.New("no documents to verify")
+	}
+	backends := storage.Default()
+	failed := 0
+	for _, path := range fs.Args() {
+		read := func(p string) ([]byte, error) {
+			st, key, err := backends.For(p)
+			if err != nil {
+				return nil, err
+			}
+			return st.Get(key)
+		}
+		data, err := read(path)
+		if err != nil {
+			return err
+		}
+		sig, err := read(path + signing.Suffix)
+		if err != nil {
+			return err
+		}
+		signer, err := signing.Verify(*allowed, *identity, data, sig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s: good signature by %s\n", path, signer)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d document(s) failed verification", failed)
+	}
+	return nil
+}
+
+// runTUI starts an interactive selection over the project root. A missing
+// config is fine: saving creates it with projectPath pointing at the root.
+func runTUI(path, rootFlag, runID string, args []string) error {
+	if err := newFlagSet("tui").Parse(args); err != nil {
+		return err
+	}
+	if path == "" {
+		path = defaultConfigPath
+	}
+	conf, root, err := loadConfig(path, rootFlag)
+	if errors.Is(err, os.ErrNotExist) {
+		root = rootFlag
+		if root == "" {
+			root = "."
+		}
+		projectPath, relErr := filepath.Rel(filepath.Dir(path), root)
+		if relErr != nil {
+			projectPath, _ = filepath.Abs(root)
+		}
+		conf, err = cfg.Config{ProjectPath: filepath.ToSlash(projectPath)}, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	s := &tui.Session{
+		Root: root,
+		Save: func(doc, output string, src cfg.Source) error {
+			// edit the file as written, keeping its includes
+			file, err := cfg.LoadFile(path)
+			if errors.Is(err, os.ErrNotExist) {
+				file, err = cfg.Config{ProjectPath: conf.ProjectPath}, nil
+			}
+			if err != nil {
+				return err
+			}
+			i := slices.IndexFunc(file.Documents, func(d cfg.Document) bool { return d.Name == doc })
+			if i < 0 {
+				file.Documents = append(file.Documents, cfg.Document{Name: doc, OutputPath: output})
+				i = len(file.Documents) - 1
+			}
+			file.Documents[i].Sources = append(file.Documents[i].Sources, src)
+			return cfg.Save(path, file)
+		},
+		Generate: func(doc cfg.Document) error {
+			opts, err := generatorOptions(runID, 0)
+			if err != nil {
+				return err
+			}
+			one := conf
+			one.Documents = []cfg.Document{doc}
+			if _, err := generator.Generate(one, root, opts); err != nil {
+				return err
+			}
+			fmt.Printf("Generated %s (run-id: %s)\n", doc.OutputPath, opts.RunID)
+			return nil
+		},
+	}
+	return s.Run(os.Stdin, os.Stdout)
+}
+
+// readFileList reads the -files-from list from name, or stdin for "-".
+func readFileList(name string) ([]string, error) {
+	if name == "-" {
+		return generator.ReadFileList(os.Stdin)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("-files-from: %w", err)
+	}
+	defer f.Close()
+	return generator.ReadFileList(f)
+}
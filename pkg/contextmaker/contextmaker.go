@@ -0,0 +1,192 @@
+// Package contextmaker is the public API of go_project_context_maker for
+// embedding context generation in other Go programs and build pipelines.
+//
+// The configuration types are the same ones the CLI reads from YAML, JSON
+// or TOML:
+//
+//	conf, err := contextmaker.Load("config.yaml")
+//	if err != nil { ... }
+//	res, err := contextmaker.Generate(ctx, conf, contextmaker.Options{Root: "."})
+//	if err != nil { ... }
+//	for _, d := range res.Documents {
+//		fmt.Println(d.Path, d.Tokens)
+//	}
+package contextmaker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+
+	"go_project_context_maker/internal/config"
+	"go_project_context_maker/internal/generator"
+	"go_project_context_maker/internal/storage"
+)
+
+// Configuration types, shared with the YAML config file.
+type (
+	Config         = config.Config
+	Document       = config.Document
+	DocumentOutput = config.Output // one entry of Document.Outputs
+	Source         = config.Source
+	LicensePolicy  = config.LicensePolicy
+	Assertions     = config.Assertions
+	Hooks          = config.Hooks
+	Problem        = config.Problem
+	Plugin         = config.Plugin // an external program implementing a source type
+	FileStat       = generator.FileStat
+	Storage        = storage.Storage // where outputs with a URL scheme go
+	MemoryStorage  = storage.Memory
+)
+
+// Custom source types: a SourceProvider registered in Options.Providers
+// under a type name serves the sources of that type.
+type (
+	SourceProvider = generator.SourceProvider
+	SourceRequest  = generator.SourceRequest
+	SourceResponse = generator.SourceResponse
+	SourceItem     = generator.SourceItem
+)
+
+// FailedDocumentsError is returned by Generate, with the result of the
+// other documents, when documents with failurePolicy continue or retry fail.
+type FailedDocumentsError = generator.FailedDocumentsError
+
+// StdoutPath is the outputPath value that streams a document to Options.Stdout.
+const StdoutPath = generator.StdoutPath
+
+// NewMemoryStorage returns an empty in-memory storage, for Options.Storage.
+func NewMemoryStorage() *MemoryStorage {
+	return storage.NewMemory()
+}
+
+// Load reads a configuration file.
+func Load(path string) (Config, error) {
+	return config.Load(path)
+}
+
+// Validate checks the configuration file at path and returns every problem
+// found. root overrides the config's projectPath when not empty.
+func Validate(path, root string) ([]Problem, error) {
+	return config.Validate(path, root)
+}
+
+// Options controls a Generate call.
+type Options struct {
+	// Root is the project root that source paths are resolved against;
+	// empty means Config.ProjectPath (or ".") relative to the working directory.
+	Root string
+	// RunID is embedded in every document; empty generates a random UUID.
+	RunID string
+	// Jobs is the number of files read in parallel per source; 0 means GOMAXPROCS.
+	Jobs int
+	// FS, when set, is read instead of the disk, mounted at Root; see
+	// generator.Options.FS for the limits.
+	FS fs.FS
+	// DryRun renders documents without writing them.
+	DryRun bool
+	// Stdout receives documents whose outputPath is "-"; defaults to os.Stdout.
+	Stdout io.Writer
+	// Log receives warnings; defaults to os.Stderr.
+	Log io.Writer
+	// Storage adds or replaces backends by outputPath scheme, e.g.
+	// {"mem": NewMemoryStorage()} for "mem://api.md"; s3:// and gs:// are
+	// available by default and paths without a scheme go to the disk.
+	Storage map[string]Storage
+	// Providers implement source types besides the built-in ones, by type
+	// name, e.g. {"jira": jiraProvider{}} for sources with type: jira; they
+	// win over the config's plugins of the same name.
+	Providers map[string]SourceProvider
+}
+
+// Result describes a Generate call.
+type Result struct {
+	RunID     string
+	Documents []Output
+}
+
+// Output is one rendered document.
+type Output struct {
+	Path    string
+	Content string
+	Files   []FileStat // embedded files, in output order
+	Tokens  int        // estimated token count of Content
+}
+
+// Generate renders every document of c and, unless opts.DryRun is set, writes
+// them to their output paths. Cancelling ctx stops file collection and
+// aborts commands, fetches and llm requests in flight.
+// Documents failing under failurePolicy continue or retry are left out of
+// the result, which is returned with a *FailedDocumentsError.
+func Generate(ctx context.Context, c Config, opts Options) (*Result, error) {
+	runID := opts.RunID
+	if runID == "" {
+		id, err := generator.NewRunID()
+		if err != nil {
+			return nil, err
+		}
+		runID = id
+	}
+	root := opts.Root
+	if root == "" {
+		root = c.ProjectPath
+	}
+	if root == "" {
+		root = "."
+	}
+	backends := storage.Default()
+	for scheme, st := range opts.Storage {
+		backends[scheme] = st
+	}
+	// documents composed of others keep their sources when rendered alone
+	c, err := c.Compose()
+	if err != nil {
+		return nil, err
+	}
+	gopts := generator.Options{RunID: runID, Jobs: opts.Jobs, FS: opts.FS, Stdout: opts.Stdout, Log: opts.Log, Storage: backends, Context: ctx, NoHooks: opts.DryRun, Providers: opts.Providers}
+
+	res := &Result{RunID: runID}
+	var outs []generator.Output
+	var failed FailedDocumentsError
+	for _, doc := range c.Documents {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		one := c
+		one.Documents = []Document{doc}
+		rendered, err := generator.Render(one, root, gopts)
+		var f *FailedDocumentsError
+		if errors.As(err, &f) {
+			failed.Failures = append(failed.Failures, f.Failures...)
+		} else if err != nil {
+			return nil, err
+		}
+		outs = append(outs, rendered...)
+	}
+	var renderErr error
+	if len(failed.Failures) > 0 {
+		renderErr = &failed
+	}
+	for _, o := range outs {
+		res.Documents = append(res.Documents, Output{
+			Path:    o.Path,
+			Content: o.Content,
+			Files:   o.Files,
+			Tokens:  generator.EstimateTokens(len(o.Content)),
+		})
+	}
+	if opts.DryRun {
+		return res, renderErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := generator.WriteOutputsTo(backends, outs, opts.Stdout); err != nil {
+		return nil, err
+	}
+	if err := generator.RunPostHooks(c, root, outs, gopts); err != nil {
+		return nil, err
+	}
+	return res, renderErr
+}